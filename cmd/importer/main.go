@@ -0,0 +1,230 @@
+// Command importer uploads historical GPX or CSV telemetry to the import API
+// and follows the job until it finishes.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/importer"
+	"fleet-tracker-service/internal/model"
+)
+
+type options struct {
+	url       string
+	token     string
+	username  string
+	password  string
+	format    string
+	vehicleID string
+	plate     string
+	mapping   string
+	wait      bool
+	interval  time.Duration
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.url, "url", "http://localhost:8080", "HTTP base URL")
+	flag.StringVar(&o.token, "token", "", "JWT to use instead of logging in")
+	flag.StringVar(&o.username, "username", "admin", "login username")
+	flag.StringVar(&o.password, "password", "admin@2025", "login password")
+	flag.StringVar(&o.format, "format", "", "gpx or csv (default from the file extension)")
+	flag.StringVar(&o.vehicleID, "vehicle-id", "", "vehicle for every point; required for GPX")
+	flag.StringVar(&o.plate, "plate", "", "plate number used when the vehicle does not exist yet")
+	flag.StringVar(&o.mapping, "mapping", "", `CSV column mapping as JSON or @file, e.g. '{"timestamp":"time","lat":"latitude"}'`)
+	flag.BoolVar(&o.wait, "wait", true, "follow the job until it finishes")
+	flag.DurationVar(&o.interval, "interval", 2*time.Second, "how often to poll progress")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FILE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{baseURL: strings.TrimRight(o.url, "/"), token: o.token, http: &http.Client{}}
+	if c.token == "" {
+		if err := c.login(o.username, o.password); err != nil {
+			log.Fatalf("importer: %v", err)
+		}
+	}
+	failed := false
+	for _, path := range flag.Args() {
+		if err := run(c, o, path); err != nil {
+			log.Printf("%s: %v", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func run(c *client, o options, path string) error {
+	mapping, err := readMapping(o.mapping)
+	if err != nil {
+		return err
+	}
+	fields := map[string]string{
+		"format":       o.format,
+		"vehicle_id":   o.vehicleID,
+		"plate_number": o.plate,
+		"mapping":      mapping,
+	}
+	job, created, err := c.upload(path, fields)
+	if err != nil {
+		return err
+	}
+	if !created {
+		log.Printf("%s: already imported as job %s (%s)", path, job.ID, job.Status)
+	} else {
+		log.Printf("%s: queued as job %s", path, job.ID)
+	}
+	if !o.wait {
+		return nil
+	}
+
+	for job.Status == model.ImportQueued || job.Status == model.ImportRunning {
+		time.Sleep(o.interval)
+		if job, err = c.job(job.ID.String()); err != nil {
+			return err
+		}
+		log.Printf("%s: %s %5.1f%% points=%d imported=%d duplicates=%d rejected=%d failed=%d",
+			path, job.Status, job.Progress()*100, job.Processed, job.Imported, job.Duplicates, job.Rejected, job.Failed)
+	}
+	if job.Status == model.ImportFailed {
+		return fmt.Errorf("import failed: %s", job.Error)
+	}
+	return nil
+}
+
+// readMapping validates an inline or @file mapping and returns it as JSON
+func readMapping(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	b := []byte(v)
+	if strings.HasPrefix(v, "@") {
+		var err error
+		if b, err = os.ReadFile(v[1:]); err != nil {
+			return "", err
+		}
+	}
+	var m importer.Mapping
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", fmt.Errorf("invalid mapping: %w", err)
+	}
+	return string(b), nil
+}
+
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func (c *client) login(username, password string) error {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp, err := c.http.Post(c.baseURL+"/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login: unexpected status %s", resp.Status)
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	c.token = out.Token
+	return nil
+}
+
+// upload streams the file as multipart form data without buffering it
+func (c *client) upload(path string, fields map[string]string) (model.ImportJob, bool, error) {
+	var job model.ImportJob
+	f, err := os.Open(path)
+	if err != nil {
+		return job, false, err
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		for k, v := range fields {
+			if v != "" {
+				if err := mw.WriteField(k, v); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+		}
+		part, err := mw.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/api/imports", pr)
+	if err != nil {
+		return job, false, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return job, false, err
+	}
+	defer resp.Body.Close()
+	if err := decode(resp, &job); err != nil {
+		return job, false, err
+	}
+	return job, resp.StatusCode == http.StatusAccepted, nil
+}
+
+func (c *client) job(id string) (model.ImportJob, error) {
+	var job model.ImportJob
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/api/imports/"+id, nil)
+	if err != nil {
+		return job, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return job, err
+	}
+	defer resp.Body.Close()
+	return job, decode(resp, &job)
+}
+
+func decode(resp *http.Response, v interface{}) error {
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s: %s", resp.Status, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,208 @@
+// Command simulator drives the public ingest APIs with virtual vehicles for
+// load and acceptance testing.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+	"fleet-tracker-service/internal/simulator"
+
+	"github.com/google/uuid"
+)
+
+// vehicleNamespace derives stable vehicle IDs from the seed and index
+var vehicleNamespace = uuid.MustParse("6f1c1a52-3c1e-4f55-9d0b-7a3f8d1a2b40")
+
+type options struct {
+	transport string
+	url       string
+	grpcAddr  string
+	token     string
+	deviceKey string
+	username  string
+	password  string
+	vehicles  int
+	rate      float64
+	duration  time.Duration
+	workers   int
+	seed      int64
+	routes    string
+	scenario  string
+	report    time.Duration
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.transport, "transport", "http", "ingest API to drive: http or grpc")
+	flag.StringVar(&o.url, "url", "http://localhost:8080", "HTTP base URL")
+	flag.StringVar(&o.grpcAddr, "grpc-addr", "localhost:9090", "gRPC address")
+	flag.StringVar(&o.token, "token", "", "JWT to use instead of logging in")
+	flag.StringVar(&o.deviceKey, "device-key", "", "device key for the gRPC transport")
+	flag.StringVar(&o.username, "username", "admin", "login username")
+	flag.StringVar(&o.password, "password", "admin@2025", "login password")
+	flag.IntVar(&o.vehicles, "vehicles", 10, "number of virtual vehicles")
+	flag.Float64Var(&o.rate, "rate", 5, "target reports per second across all vehicles")
+	flag.DurationVar(&o.duration, "duration", 0, "how long to run (0 runs until interrupted)")
+	flag.IntVar(&o.workers, "workers", 8, "concurrent senders")
+	flag.Int64Var(&o.seed, "seed", 1, "random seed; the same seed repeats the same run")
+	flag.StringVar(&o.routes, "routes", "", "comma separated GPX/GeoJSON route files or directories (default built-in Dubai routes)")
+	flag.StringVar(&o.scenario, "scenario", "", "JSON scenario file")
+	flag.DurationVar(&o.report, "report-interval", 10*time.Second, "how often to print progress")
+	flag.Parse()
+
+	if err := run(o); err != nil {
+		log.Fatalf("simulator: %v", err)
+	}
+}
+
+func run(o options) error {
+	if o.vehicles <= 0 || o.rate <= 0 || o.workers <= 0 {
+		return fmt.Errorf("vehicles, rate and workers must be positive")
+	}
+
+	var routes []*simulator.Route
+	var err error
+	if o.routes != "" {
+		routes, err = simulator.LoadRoutes(strings.Split(o.routes, ",")...)
+	} else {
+		routes, err = simulator.BuiltinRoutes()
+	}
+	if err != nil {
+		return err
+	}
+
+	var sc *simulator.Scenario
+	if o.scenario != "" {
+		if sc, err = simulator.LoadScenario(o.scenario); err != nil {
+			return err
+		}
+		log.Printf("Running scenario %q with %d events", sc.Name, len(sc.Events))
+	}
+
+	tr, err := newTransport(o)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if o.duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.duration)
+		defer cancel()
+	}
+
+	cfg := simulator.DefaultConfig()
+	cfg.Seed = o.seed
+	sim := simulator.New(cfg, routes)
+	scenario := simulator.NewScenarioState(sc, o.seed)
+	st := newStats()
+
+	// Each worker owns a fixed subset of vehicles so reports for one
+	// vehicle are always sent in order
+	queues := make([]chan service.IngestPayload, o.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan service.IngestPayload, 64)
+		wg.Add(1)
+		go func(worker int, q <-chan service.IngestPayload) {
+			defer wg.Done()
+			for p := range q {
+				start := time.Now()
+				err := tr.Send(ctx, worker, p)
+				if ctx.Err() != nil {
+					return
+				}
+				st.record(time.Since(start), err)
+			}
+		}(i, queues[i])
+	}
+
+	ids := make([]string, o.vehicles)
+	plates := make([]string, o.vehicles)
+	for i := range ids {
+		ids[i] = uuid.NewSHA1(vehicleNamespace, []byte(fmt.Sprintf("%d-%d", o.seed, i))).String()
+		plates[i] = fmt.Sprintf("SIM-%d-%04d", o.seed, i)
+	}
+
+	// One vehicle reports per tick, round robin, which spreads the target
+	// rate evenly and gives every vehicle a report every vehicles/rate seconds
+	tick := time.Duration(float64(time.Second) / o.rate)
+	perVehicle := time.Duration(float64(time.Second) * float64(o.vehicles) / o.rate)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	progress := time.NewTicker(o.report)
+	defer progress.Stop()
+
+	log.Printf("Driving %d vehicles at %.1f reports/s over %s (%s per vehicle)", o.vehicles, o.rate, o.transport, perVehicle)
+	begin := time.Now()
+	next := 0
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-progress.C:
+			log.Println(st.summary())
+		case now := <-ticker.C:
+			idx := next
+			next = (next + 1) % o.vehicles
+
+			v := sim.Vehicle(ids[idx])
+			v.Step(perVehicle)
+			status := v.Status(now)
+			if !scenario.Apply(idx, now.Sub(begin), status) {
+				st.skip()
+				continue
+			}
+			select {
+			case queues[idx%o.workers] <- service.IngestPayload{VehicleID: ids[idx], PlateNumber: plates[idx], Status: status}:
+			default:
+				// The service is slower than the target rate
+				st.drop()
+			}
+		}
+	}
+
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+
+	accepted, rejected, err := tr.Close()
+	if err != nil {
+		log.Printf("closing transport: %v", err)
+	}
+	log.Printf("Final: %s", st.summary())
+	if o.transport == "grpc" {
+		log.Printf("Server summary: accepted=%d rejected=%d", accepted, rejected)
+	}
+	return nil
+}
+
+func newTransport(o options) (transport, error) {
+	switch o.transport {
+	case "http":
+		return newHTTPTransport(o.url, o.token, o.username, o.password, o.workers)
+	case "grpc":
+		token := o.token
+		if token == "" && o.deviceKey == "" {
+			h, err := newHTTPTransport(o.url, "", o.username, o.password, 1)
+			if err != nil {
+				return nil, err
+			}
+			token = h.token
+		}
+		return newGRPCTransport(o.grpcAddr, token, o.deviceKey)
+	default:
+		return nil, fmt.Errorf("unknown transport %q (want http or grpc)", o.transport)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stats collects request outcomes and latencies for the run
+type stats struct {
+	mu        sync.Mutex
+	start     time.Time
+	latencies []time.Duration
+	ok        int
+	failed    int
+	dropped   int
+	skipped   int
+	lastErr   error
+}
+
+func newStats() *stats {
+	return &stats{start: time.Now()}
+}
+
+func (s *stats) record(d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed++
+		s.lastErr = err
+		return
+	}
+	s.ok++
+	s.latencies = append(s.latencies, d)
+}
+
+func (s *stats) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+}
+
+func (s *stats) skip() {
+	s.mu.Lock()
+	s.skipped++
+	s.mu.Unlock()
+}
+
+// percentile returns the p-th percentile (0..100) of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1)*p/100 + 0.5)
+	return sorted[idx]
+}
+
+func (s *stats) summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.start)
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	out := fmt.Sprintf("elapsed=%s sent=%d ok=%d failed=%d dropped=%d offline=%d rate=%.1f/s p50=%s p90=%s p99=%s max=%s",
+		elapsed.Round(time.Second), s.ok+s.failed, s.ok, s.failed, s.dropped, s.skipped,
+		float64(s.ok)/elapsed.Seconds(),
+		percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), percentile(sorted, 100))
+	if s.lastErr != nil {
+		out += fmt.Sprintf(" last_error=%q", s.lastErr.Error())
+	}
+	return out
+}
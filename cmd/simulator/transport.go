@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"fleet-tracker-service/internal/pb"
+	"fleet-tracker-service/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// transport sends one status report to the service
+type transport interface {
+	Send(ctx context.Context, worker int, p service.IngestPayload) error
+	Close() (accepted, rejected uint64, err error)
+}
+
+// httpTransport posts to /api/vehicle/ingest with a JWT from /login
+type httpTransport struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func newHTTPTransport(baseURL, token, username, password string, workers int) (*httpTransport, error) {
+	t := &httpTransport{
+		baseURL: baseURL,
+		token:   token,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConns:        workers,
+				MaxIdleConnsPerHost: workers,
+			},
+		},
+	}
+	if t.token == "" {
+		if err := t.login(username, password); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *httpTransport) login(username, password string) error {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp, err := t.client.Post(t.baseURL+"/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login: unexpected status %s", resp.Status)
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	t.token = out.Token
+	return nil
+}
+
+func (t *httpTransport) Send(ctx context.Context, _ int, p service.IngestPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/api/vehicle/ingest", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("ingest: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (t *httpTransport) Close() (uint64, uint64, error) {
+	return 0, 0, nil
+}
+
+// grpcTransport keeps one StreamPositions stream per worker. Send returns
+// once the report is written to the stream; accepted/rejected totals come
+// from the summaries returned when the streams are closed.
+type grpcTransport struct {
+	conn    *grpc.ClientConn
+	client  pb.TelemetryServiceClient
+	md      metadata.MD
+	mu      sync.Mutex
+	streams map[int]grpc.ClientStreamingClient[pb.PositionReport, pb.IngestSummary]
+}
+
+func newGRPCTransport(addr, token, deviceKey string) (*grpcTransport, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	md := metadata.MD{}
+	if deviceKey != "" {
+		md.Set("x-device-key", deviceKey)
+	} else {
+		md.Set("authorization", "Bearer "+token)
+	}
+	return &grpcTransport{
+		conn:    conn,
+		client:  pb.NewTelemetryServiceClient(conn),
+		md:      md,
+		streams: map[int]grpc.ClientStreamingClient[pb.PositionReport, pb.IngestSummary]{},
+	}, nil
+}
+
+func (t *grpcTransport) stream(ctx context.Context, worker int) (grpc.ClientStreamingClient[pb.PositionReport, pb.IngestSummary], error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.streams[worker]; ok {
+		return s, nil
+	}
+	s, err := t.client.StreamPositions(metadata.NewOutgoingContext(context.WithoutCancel(ctx), t.md))
+	if err != nil {
+		return nil, err
+	}
+	t.streams[worker] = s
+	return s, nil
+}
+
+func (t *grpcTransport) Send(ctx context.Context, worker int, p service.IngestPayload) error {
+	s, err := t.stream(ctx, worker)
+	if err != nil {
+		return err
+	}
+	st, err := structpb.NewStruct(p.Status)
+	if err != nil {
+		return err
+	}
+	return s.Send(&pb.PositionReport{VehicleId: p.VehicleID, PlateNumber: p.PlateNumber, Status: st})
+}
+
+func (t *grpcTransport) Close() (uint64, uint64, error) {
+	defer t.conn.Close()
+	var accepted, rejected uint64
+	for _, s := range t.streams {
+		sum, err := s.CloseAndRecv()
+		if err != nil {
+			return accepted, rejected, err
+		}
+		accepted += sum.GetAccepted()
+		rejected += sum.GetRejected()
+	}
+	return accepted, rejected, nil
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DeviceKeyHeader is the metadata key devices use to present their key
+const DeviceKeyHeader = "x-device-key"
+
+type claimsKey struct{}
+
+// DeviceKeys is the set of pre-shared keys accepted from tracking devices
+type DeviceKeys []string
+
+// ParseDeviceKeys splits a comma separated list of device keys
+func ParseDeviceKeys(s string) DeviceKeys {
+	var keys DeviceKeys
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Valid reports whether key matches one of the configured device keys
+func (d DeviceKeys) Valid(key string) bool {
+	if key == "" {
+		return false
+	}
+	ok := false
+	for _, k := range d {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// ClaimsFromContext returns the JWT claims stored by the gRPC interceptors.
+// Calls authenticated with a device key carry no claims.
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(jwt.MapClaims)
+	return claims, ok
+}
+
+// UnaryAuthInterceptor authenticates unary RPCs with a bearer token, or with
+// a device key for the methods in deviceMethods only
+func UnaryAuthInterceptor(a *JWTService, keys DeviceKeys, deviceMethods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, a, keys, deviceAllowed(info.FullMethod, deviceMethods))
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor authenticates streaming RPCs with a bearer token, or
+// with a device key for the methods in deviceMethods only
+func StreamAuthInterceptor(a *JWTService, keys DeviceKeys, deviceMethods ...string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), a, keys, deviceAllowed(info.FullMethod, deviceMethods))
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+// deviceAllowed reports whether a device key may call method
+func deviceAllowed(method string, deviceMethods []string) bool {
+	for _, m := range deviceMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks the caller's credentials. A device key only reports
+// positions, so it is refused on any other method and a leaked tracker key
+// cannot read the fleet.
+func authorize(ctx context.Context, a *JWTService, keys DeviceKeys, deviceOK bool) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization")
+	}
+	if vals := md.Get(DeviceKeyHeader); len(vals) > 0 {
+		if !keys.Valid(vals[0]) {
+			return nil, status.Error(codes.Unauthenticated, "invalid device key")
+		}
+		if !deviceOK {
+			return nil, status.Error(codes.PermissionDenied, "device keys may only stream positions")
+		}
+		return ctx, nil
+	}
+	vals := md.Get("authorization")
+	if len(vals) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization")
+	}
+	parts := strings.Fields(vals[0])
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization header")
+	}
+	claims, err := a.ParseToken(parts[1])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ingestMethod = "/fleet.telemetry.v1.TelemetryService/StreamPositions"
+	readMethod   = "/fleet.telemetry.v1.TelemetryService/GetStatus"
+)
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func TestAuthInterceptors(t *testing.T) {
+	jwtSvc := NewJWT([]byte("test-secret"), "fleet", "fleet-api")
+	token, err := jwtSvc.GenerateToken("dispatcher", time.Hour)
+	require.NoError(t, err)
+	other, err := NewJWT([]byte("other-secret"), "fleet", "fleet-api").GenerateToken("dispatcher", time.Hour)
+	require.NoError(t, err)
+	keys := ParseDeviceKeys("key-1, key-2")
+
+	unary := UnaryAuthInterceptor(jwtSvc, keys, ingestMethod)
+	stream := StreamAuthInterceptor(jwtSvc, keys, ingestMethod)
+
+	for _, tc := range []struct {
+		name   string
+		md     metadata.MD
+		method string
+		want   codes.Code
+	}{
+		{"no metadata", nil, readMethod, codes.Unauthenticated},
+		{"no credentials", metadata.Pairs("x-other", "1"), readMethod, codes.Unauthenticated},
+		{"bad device key", metadata.Pairs(DeviceKeyHeader, "key-3"), ingestMethod, codes.Unauthenticated},
+		{"device key on ingest", metadata.Pairs(DeviceKeyHeader, "key-2"), ingestMethod, codes.OK},
+		{"device key on a read", metadata.Pairs(DeviceKeyHeader, "key-1"), readMethod, codes.PermissionDenied},
+		{"malformed header", metadata.Pairs("authorization", token), readMethod, codes.Unauthenticated},
+		{"token signed elsewhere", metadata.Pairs("authorization", "Bearer "+other), readMethod, codes.Unauthenticated},
+		{"valid token on a read", metadata.Pairs("authorization", "Bearer "+token), readMethod, codes.OK},
+		{"valid token on ingest", metadata.Pairs("authorization", "Bearer "+token), ingestMethod, codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tc.md)
+			}
+
+			var claims bool
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method},
+				func(ctx context.Context, _ interface{}) (interface{}, error) {
+					_, claims = ClaimsFromContext(ctx)
+					return nil, nil
+				})
+			assert.Equal(t, tc.want, status.Code(err), "unary")
+
+			err = stream(nil, fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tc.method},
+				func(_ interface{}, ss grpc.ServerStream) error {
+					_, ok := ClaimsFromContext(ss.Context())
+					assert.Equal(t, claims, ok)
+					return nil
+				})
+			assert.Equal(t, tc.want, status.Code(err), "stream")
+
+			if tc.want == codes.OK {
+				_, bearer := tc.md["authorization"]
+				assert.Equal(t, bearer, claims, "only token calls carry claims")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Package dtc decodes OBD-II diagnostic trouble codes (SAE J2012) such as
+// P0301 into the system they belong to, a description and a severity
+package dtc
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"strings"
+)
+
+// Severities of a trouble code
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical" // stop the vehicle or service it at once
+)
+
+//go:embed codes.csv
+var codesCSV []byte
+
+// Code is a decoded trouble code
+type Code struct {
+	Code        string `json:"code"`
+	System      string `json:"system"` // powertrain, chassis, body or network
+	Generic     bool   `json:"generic"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+	Known       bool   `json:"known"` // listed in the embedded table
+}
+
+type entry struct {
+	severity    string
+	description string
+}
+
+var table = loadTable()
+
+func loadTable() map[string]entry {
+	recs, err := csv.NewReader(bytes.NewReader(codesCSV)).ReadAll()
+	if err != nil {
+		panic("dtc: bad embedded table: " + err.Error())
+	}
+	t := make(map[string]entry, len(recs))
+	for _, r := range recs[1:] {
+		t[r[0]] = entry{severity: r[1], description: r[2]}
+	}
+	return t
+}
+
+var systems = map[byte]string{'P': "powertrain", 'C': "chassis", 'B': "body", 'U': "network"}
+
+// Powertrain subsystems by the third character of P0 and P1 codes
+var powertrainAreas = map[byte]string{
+	'0': "fuel and air metering and auxiliary emission controls",
+	'1': "fuel and air metering",
+	'2': "fuel and air metering (injector circuit)",
+	'3': "ignition system or misfire",
+	'4': "auxiliary emission controls",
+	'5': "vehicle speed, idle control and auxiliary inputs",
+	'6': "computer and output circuit",
+	'7': "transmission",
+	'8': "transmission",
+	'9': "transmission",
+	'A': "hybrid propulsion",
+}
+
+// Normalize returns a code in canonical form, e.g. "p0301 " as "P0301", and
+// whether it is a well-formed five character code
+func Normalize(s string) (string, bool) {
+	c := strings.ToUpper(strings.TrimSpace(s))
+	if len(c) != 5 || systems[c[0]] == "" || c[1] < '0' || c[1] > '3' {
+		return c, false
+	}
+	for i := 2; i < 5; i++ {
+		if !strings.ContainsRune("0123456789ABCDEF", rune(c[i])) {
+			return c, false
+		}
+	}
+	return c, true
+}
+
+// Decode describes a well-formed code. Codes missing from the table get a
+// description of their system and area and warning severity.
+func Decode(code string) Code {
+	c, _ := Normalize(code)
+	d := Code{Code: c, Severity: SeverityWarning}
+	if len(c) != 5 {
+		return d
+	}
+	d.System = systems[c[0]]
+	// P0, P2 and the 0 series of the other systems are defined by SAE;
+	// P3 is split, the rest belong to the manufacturer
+	d.Generic = c[1] == '0' || (c[0] == 'P' && c[1] == '2') || (c[0] == 'P' && c[1] == '3' && c[2] >= '4')
+	if e, ok := table[c]; ok {
+		d.Description, d.Severity, d.Known = e.description, e.severity, true
+		return d
+	}
+
+	kind := "manufacturer specific"
+	if d.Generic {
+		kind = "generic"
+	}
+	d.Description = kind + " " + d.System + " code"
+	if area := powertrainAreas[c[2]]; c[0] == 'P' && (c[1] == '0' || c[1] == '1') && area != "" {
+		d.Description += " - " + area
+	}
+	return d
+}
+
+// IsCritical reports whether a code needs immediate attention
+func IsCritical(code string) bool {
+	return Decode(code).Severity == SeverityCritical
+}
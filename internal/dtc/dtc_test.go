@@ -0,0 +1,41 @@
+package dtc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	c, ok := Normalize(" p0301 ")
+	assert.True(t, ok)
+	assert.Equal(t, "P0301", c)
+	for _, bad := range []string{"", "P030", "X0301", "P4301", "P03G1", "P03011"} {
+		_, ok := Normalize(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	d := Decode("P0301")
+	assert.Equal(t, Code{Code: "P0301", System: "powertrain", Generic: true, Description: "Cylinder 1 misfire detected",
+		Severity: SeverityCritical, Known: true}, d)
+	assert.True(t, IsCritical("u0100"))
+	assert.False(t, IsCritical("P0420"))
+
+	d = Decode("P1345")
+	assert.False(t, d.Known)
+	assert.False(t, d.Generic)
+	assert.Equal(t, "manufacturer specific powertrain code - ignition system or misfire", d.Description)
+	assert.Equal(t, SeverityWarning, d.Severity)
+
+	d = Decode("C0999")
+	assert.True(t, d.Generic)
+	assert.Equal(t, "generic chassis code", d.Description)
+
+	for code, e := range table {
+		_, ok := Normalize(code)
+		assert.True(t, ok, code)
+		assert.Contains(t, []string{SeverityInfo, SeverityWarning, SeverityCritical}, e.severity, code)
+	}
+}
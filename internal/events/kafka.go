@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher writes events to a topic keyed by vehicle, which keeps each
+// vehicle's events ordered within a partition
+type KafkaPublisher struct {
+	w *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, e model.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(e.AggregateID.String()),
+		Value: b,
+		Headers: []kafka.Header{
+			{Key: "event_id", Value: []byte(e.ID.String())},
+			{Key: "event_type", Value: []byte(e.Type)},
+		},
+	})
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSPublisher publishes events to <prefix>.<EventType> subjects
+type NATSPublisher struct {
+	nc     *nats.Conn
+	prefix string
+}
+
+func NewNATSPublisher(url, prefix string) (*NATSPublisher, error) {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{nc: nc, prefix: prefix}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, e model.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(p.prefix + "." + e.Type)
+	msg.Header.Set(nats.MsgIdHdr, e.ID.String())
+	msg.Data = b
+	if err := p.nc.PublishMsg(msg); err != nil {
+		return err
+	}
+	// Flush so a successful return means the server received the event
+	return p.nc.FlushWithContext(ctx)
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.nc.Drain()
+}
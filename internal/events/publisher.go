@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Publisher delivers outbox events to an event bus. Publish must return only
+// after the bus has accepted the event.
+type Publisher interface {
+	Publish(ctx context.Context, e model.Event) error
+	Close() error
+}
+
+// Config selects and configures the event bus
+type Config struct {
+	Bus          string // redis, nats or kafka
+	Topic        string // stream, subject prefix or topic name
+	NATSURL      string
+	KafkaBrokers string // comma separated
+}
+
+// NewPublisher builds the publisher selected by cfg.Bus
+func NewPublisher(cfg Config, rdb *redis.Client) (Publisher, error) {
+	switch cfg.Bus {
+	case "redis":
+		return NewRedisPublisher(rdb, cfg.Topic), nil
+	case "nats":
+		return NewNATSPublisher(cfg.NATSURL, cfg.Topic)
+	case "kafka":
+		return NewKafkaPublisher(strings.Split(cfg.KafkaBrokers, ","), cfg.Topic), nil
+	default:
+		return nil, fmt.Errorf("unknown event bus %q", cfg.Bus)
+	}
+}
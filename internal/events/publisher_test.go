@@ -0,0 +1,34 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPublisher(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	defer rdb.Close()
+
+	pub, err := NewPublisher(Config{Bus: "redis", Topic: "fleet:events"}, rdb)
+	require.NoError(t, err)
+	rp, ok := pub.(*RedisPublisher)
+	require.True(t, ok)
+	assert.Equal(t, "fleet:events", rp.stream)
+
+	pub, err = NewPublisher(Config{Bus: "kafka", Topic: "fleet-events", KafkaBrokers: "k1:9092,k2:9092"}, rdb)
+	require.NoError(t, err)
+	kp, ok := pub.(*KafkaPublisher)
+	require.True(t, ok)
+	assert.Equal(t, "fleet-events", kp.w.Topic)
+	assert.Equal(t, "k1:9092,k2:9092", kp.w.Addr.String())
+	require.NoError(t, pub.Close())
+
+	_, err = NewPublisher(Config{Bus: "nats", Topic: "fleet", NATSURL: "nats://127.0.0.1:1"}, rdb)
+	assert.Error(t, err, "the NATS connection is made up front")
+
+	_, err = NewPublisher(Config{Bus: "rabbitmq"}, rdb)
+	assert.EqualError(t, err, `unknown event bus "rabbitmq"`)
+}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisPublisher appends events to a Redis Stream
+type RedisPublisher struct {
+	rdb    *redis.Client
+	stream string
+}
+
+func NewRedisPublisher(rdb *redis.Client, stream string) *RedisPublisher {
+	return &RedisPublisher{rdb: rdb, stream: stream}
+}
+
+func (p *RedisPublisher) Publish(ctx context.Context, e model.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		Values: map[string]interface{}{
+			"id":    e.ID.String(),
+			"type":  e.Type,
+			"event": b,
+		},
+	}).Err()
+}
+
+// Close is a no-op; the Redis client is owned by the caller
+func (p *RedisPublisher) Close() error {
+	return nil
+}
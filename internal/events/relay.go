@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+)
+
+// Relay moves committed outbox events to the event bus. Events are locked,
+// published and marked inside one transaction, so an event is only marked
+// published after the bus accepted it; a crash in between causes a
+// re-publish, never a loss. Consumers should de-duplicate on the event ID.
+type Relay struct {
+	repo      *repository.Repo
+	pub       Publisher
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+}
+
+func NewRelay(repo *repository.Repo, pub Publisher) *Relay {
+	return &Relay{
+		repo:      repo,
+		pub:       pub,
+		interval:  time.Second,
+		batchSize: 100,
+		retention: 7 * 24 * time.Hour,
+	}
+}
+
+// Run publishes pending events until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		n, err := r.publishBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox relay: %v", err)
+		}
+		// Keep draining while full batches are coming back
+		if err == nil && n == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			if _, err := r.repo.DeletePublishedEvents(ctx, time.Now().Add(-r.retention)); err != nil {
+				log.Printf("outbox relay: cleanup: %v", err)
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// outbox is the part of the repository a batch is published through,
+// within its transaction
+type outbox interface {
+	LockUnpublishedEvents(ctx context.Context, limit int) ([]model.Event, error)
+	MarkEventPublished(ctx context.Context, id string) error
+	MarkEventFailed(ctx context.Context, id string, reason string) error
+}
+
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	var published int
+	err := r.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		var err error
+		published, err = r.publishLocked(ctx, tx)
+		return err
+	})
+	return published, err
+}
+
+// publishLocked locks the next batch of unpublished events, publishes them
+// in order and marks each one published. It returns how many were.
+func (r *Relay) publishLocked(ctx context.Context, tx outbox) (int, error) {
+	events, err := tx.LockUnpublishedEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for _, e := range events {
+		if err := r.pub.Publish(ctx, e); err != nil {
+			// Stop at the first failure to preserve ordering and keep
+			// the progress made so far
+			log.Printf("outbox relay: publish %s %s: %v", e.Type, e.ID, err)
+			return published, tx.MarkEventFailed(ctx, e.ID.String(), err.Error())
+		}
+		if err := tx.MarkEventPublished(ctx, e.ID.String()); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
@@ -0,0 +1,148 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOutbox keeps events in insertion order like the outbox table
+type fakeOutbox struct {
+	events    []model.Event
+	published map[uuid.UUID]bool
+	failures  map[uuid.UUID]string
+	lockErr   error
+	markErr   error
+}
+
+func newFakeOutbox(n int) *fakeOutbox {
+	o := &fakeOutbox{published: map[uuid.UUID]bool{}, failures: map[uuid.UUID]string{}}
+	for i := 0; i < n; i++ {
+		o.events = append(o.events, model.Event{ID: uuid.New(), Type: model.EventPositionRecorded, AggregateID: uuid.New()})
+	}
+	return o
+}
+
+func (o *fakeOutbox) LockUnpublishedEvents(_ context.Context, limit int) ([]model.Event, error) {
+	if o.lockErr != nil {
+		return nil, o.lockErr
+	}
+	var res []model.Event
+	for _, e := range o.events {
+		if !o.published[e.ID] && len(res) < limit {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (o *fakeOutbox) MarkEventPublished(_ context.Context, id string) error {
+	if o.markErr != nil {
+		return o.markErr
+	}
+	o.published[uuid.MustParse(id)] = true
+	delete(o.failures, uuid.MustParse(id))
+	return nil
+}
+
+func (o *fakeOutbox) MarkEventFailed(_ context.Context, id string, reason string) error {
+	o.failures[uuid.MustParse(id)] = reason
+	return nil
+}
+
+// fakePublisher records what it published and fails the events in fail
+type fakePublisher struct {
+	sent []uuid.UUID
+	fail map[uuid.UUID]error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, e model.Event) error {
+	if err := p.fail[e.ID]; err != nil {
+		return err
+	}
+	p.sent = append(p.sent, e.ID)
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+func ids(events []model.Event) []uuid.UUID {
+	var res []uuid.UUID
+	for _, e := range events {
+		res = append(res, e.ID)
+	}
+	return res
+}
+
+func TestRelayPublishLocked(t *testing.T) {
+	ctx := context.Background()
+	o := newFakeOutbox(5)
+	pub := &fakePublisher{}
+	r := &Relay{pub: pub, batchSize: 3}
+
+	// Batches are claimed in order and every published event is marked
+	n, err := r.publishLocked(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, ids(o.events[:3]), pub.sent)
+	n, err = r.publishLocked(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, ids(o.events), pub.sent)
+	assert.Len(t, o.published, 5)
+
+	n, err = r.publishLocked(ctx, o)
+	require.NoError(t, err)
+	assert.Zero(t, n, "nothing left")
+}
+
+func TestRelayPublishFailure(t *testing.T) {
+	ctx := context.Background()
+	o := newFakeOutbox(3)
+	bad := o.events[1].ID
+	pub := &fakePublisher{fail: map[uuid.UUID]error{bad: errors.New("bus unavailable")}}
+	r := &Relay{pub: pub, batchSize: 10}
+
+	// The batch stops at the failed event, which is recorded but not marked
+	// published, and nothing behind it is sent out of order
+	n, err := r.publishLocked(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, ids(o.events[:1]), pub.sent)
+	assert.False(t, o.published[bad])
+	assert.Equal(t, "bus unavailable", o.failures[bad])
+
+	// The next batch retries it first
+	delete(pub.fail, bad)
+	n, err = r.publishLocked(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, ids(o.events), pub.sent)
+	assert.Empty(t, o.failures)
+}
+
+func TestRelayOutboxErrors(t *testing.T) {
+	ctx := context.Background()
+	pub := &fakePublisher{}
+	r := &Relay{pub: pub, batchSize: 10}
+
+	o := newFakeOutbox(2)
+	o.lockErr = errors.New("locked")
+	_, err := r.publishLocked(ctx, o)
+	assert.EqualError(t, err, "locked")
+	assert.Empty(t, pub.sent)
+
+	// A failed mark rolls the batch back, so the error reaches the caller
+	o = newFakeOutbox(2)
+	o.markErr = errors.New("connection reset")
+	n, err := r.publishLocked(ctx, o)
+	assert.EqualError(t, err, "connection reset")
+	assert.Zero(t, n)
+	assert.Len(t, pub.sent, 1)
+}
@@ -0,0 +1,241 @@
+// Package export writes vehicle movement as GPX 1.1, KML 2.2 or GeoJSON.
+// Writers stream positions straight from the database cursor so large
+// ranges never have to fit in memory.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+)
+
+// Supported formats
+const (
+	FormatGPX     = "gpx"
+	FormatKML     = "kml"
+	FormatGeoJSON = "geojson"
+)
+
+// Property is an ordered metadata key/value pair
+type Property struct {
+	Key   string
+	Value interface{}
+}
+
+// Track is the movement to export. Each iterates positions in time order and
+// may be called more than once by formats that need two passes.
+type Track struct {
+	Name       string
+	Properties []Property
+	Trips      []model.Trip
+	Each       func(fn func(model.Position) error) error
+}
+
+// ContentType returns the MIME type and file extension for a format
+func ContentType(format string) (string, string, error) {
+	switch format {
+	case FormatGPX:
+		return "application/gpx+xml", "gpx", nil
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml", "kml", nil
+	case FormatGeoJSON:
+		return "application/geo+json", "geojson", nil
+	}
+	return "", "", fmt.Errorf("unsupported export format %q", format)
+}
+
+// Write encodes t in format to w
+func Write(w io.Writer, format string, t Track) error {
+	bw := bufio.NewWriterSize(w, 64*1024)
+	var err error
+	switch format {
+	case FormatGPX:
+		err = writeGPX(bw, t)
+	case FormatKML:
+		err = writeKML(bw, t)
+	case FormatGeoJSON:
+		err = writeGeoJSON(bw, t)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// TripProperties returns the metadata exported for a trip
+func TripProperties(t model.Trip) []Property {
+	return []Property{
+		{"trip_id", t.ID.String()},
+		{"vehicle_id", t.VehicleID.String()},
+		{"start_time", t.StartTime},
+		{"end_time", t.EndTime},
+		{"mileage", t.Mileage},
+		{"avg_speed", t.AvgSpeed},
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case time.Time:
+		return x.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return x
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func jsonValue(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func coord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
+
+func writeGPX(w *bufio.Writer, t Track) error {
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprint(w, `<gpx version="1.1" creator="fleet-tracker-service" xmlns="http://www.topografix.com/GPX/1/1" xmlns:fleet="https://github.com/sarandhanush/fleet-tracker-service/gpx/1">`+"\n")
+	fmt.Fprintf(w, "<metadata><name>%s</name><time>%s</time></metadata>\n", escape(t.Name), time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "<trk><name>%s</name>\n<extensions>\n", escape(t.Name))
+	for _, p := range t.Properties {
+		fmt.Fprintf(w, "<fleet:%s>%s</fleet:%s>\n", p.Key, escape(formatValue(p.Value)), p.Key)
+	}
+	for _, trip := range t.Trips {
+		fmt.Fprint(w, "<fleet:trip>")
+		for _, p := range TripProperties(trip) {
+			fmt.Fprintf(w, "<fleet:%s>%s</fleet:%s>", p.Key, escape(formatValue(p.Value)), p.Key)
+		}
+		fmt.Fprint(w, "</fleet:trip>\n")
+	}
+	fmt.Fprint(w, "</extensions>\n<trkseg>\n")
+	err := t.Each(func(p model.Position) error {
+		fmt.Fprintf(w, `<trkpt lat="%s" lon="%s"><time>%s</time><extensions><fleet:speed>%s</fleet:speed>`,
+			coord(p.Location[1]), coord(p.Location[0]), p.Timestamp.UTC().Format(time.RFC3339), formatValue(p.Speed))
+		if p.Heading != nil {
+			fmt.Fprintf(w, "<fleet:heading>%s</fleet:heading>", formatValue(*p.Heading))
+		}
+		_, err := fmt.Fprint(w, "</extensions></trkpt>\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, "</trkseg>\n</trk>\n</gpx>\n")
+	return err
+}
+
+// writeKML writes a gx:Track, which lists every <when> before the
+// coordinates, so positions are read twice
+func writeKML(w *bufio.Writer, t Track) error {
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprint(w, `<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">`+"\n")
+	fmt.Fprintf(w, "<Document><name>%s</name>\n", escape(t.Name))
+	fmt.Fprintf(w, "<Placemark><name>%s</name>\n<ExtendedData>\n", escape(t.Name))
+	for _, p := range t.Properties {
+		fmt.Fprintf(w, `<Data name="%s"><value>%s</value></Data>`+"\n", p.Key, escape(formatValue(p.Value)))
+	}
+	fmt.Fprint(w, "</ExtendedData>\n<gx:Track>\n")
+	err := t.Each(func(p model.Position) error {
+		_, err := fmt.Fprintf(w, "<when>%s</when>\n", p.Timestamp.UTC().Format(time.RFC3339))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = t.Each(func(p model.Position) error {
+		_, err := fmt.Fprintf(w, "<gx:coord>%s %s 0</gx:coord>\n", coord(p.Location[0]), coord(p.Location[1]))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, "</gx:Track>\n</Placemark>\n")
+	for _, trip := range t.Trips {
+		fmt.Fprintf(w, "<Placemark><name>Trip %s</name><TimeSpan><begin>%s</begin><end>%s</end></TimeSpan><ExtendedData>",
+			trip.ID, trip.StartTime.UTC().Format(time.RFC3339), trip.EndTime.UTC().Format(time.RFC3339))
+		for _, p := range TripProperties(trip) {
+			fmt.Fprintf(w, `<Data name="%s"><value>%s</value></Data>`, p.Key, escape(formatValue(p.Value)))
+		}
+		fmt.Fprint(w, "</ExtendedData></Placemark>\n")
+	}
+	_, err = fmt.Fprint(w, "</Document>\n</kml>\n")
+	return err
+}
+
+// writeGeoJSON writes a FeatureCollection whose first feature is the
+// LineString of the movement. Coordinates and coordTimes are separate
+// arrays, so positions are read twice. Trips follow as features without
+// geometry.
+func writeGeoJSON(w *bufio.Writer, t Track) error {
+	fmt.Fprint(w, `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"LineString","coordinates":[`)
+	first := true
+	err := t.Each(func(p model.Position) error {
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+		_, err := fmt.Fprintf(w, "[%s,%s]", coord(p.Location[0]), coord(p.Location[1]))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, `]},"properties":{`)
+	name, _ := json.Marshal(t.Name)
+	fmt.Fprintf(w, `"name":%s`, name)
+	for _, p := range t.Properties {
+		b, err := json.Marshal(jsonValue(p.Value))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, `,%q:%s`, p.Key, b)
+	}
+	fmt.Fprint(w, `,"coordTimes":[`)
+	first = true
+	err = t.Each(func(p model.Position) error {
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+		_, err := fmt.Fprintf(w, `"%s"`, p.Timestamp.UTC().Format(time.RFC3339))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, `]}}`)
+	for _, trip := range t.Trips {
+		props := map[string]interface{}{"feature": "trip"}
+		for _, p := range TripProperties(trip) {
+			props[p.Key] = jsonValue(p.Value)
+		}
+		b, err := json.Marshal(props)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, `,{"type":"Feature","geometry":null,"properties":%s}`, b)
+	}
+	_, err = fmt.Fprint(w, "]}\n")
+	return err
+}
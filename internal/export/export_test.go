@@ -0,0 +1,127 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+func sampleTrack() (Track, *int) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	trip := model.Trip{ID: uuid.New(), VehicleID: vid, StartTime: start, EndTime: start.Add(time.Minute), Mileage: 1.2, AvgSpeed: 42}
+	heading := 90.0
+	positions := []model.Position{
+		{VehicleID: vid, Location: [2]float64{55.27, 25.2}, Speed: 40, Heading: &heading, Timestamp: start},
+		{VehicleID: vid, Location: [2]float64{55.28, 25.21}, Speed: 44, Timestamp: start.Add(30 * time.Second)},
+		{VehicleID: vid, Location: [2]float64{55.29, 25.22}, Speed: 42, Timestamp: start.Add(time.Minute)},
+	}
+	passes := 0
+	return Track{
+		Name:       "Trip <test> & co",
+		Properties: TripProperties(trip),
+		Trips:      []model.Trip{trip},
+		Each: func(fn func(model.Position) error) error {
+			passes++
+			for _, p := range positions {
+				if err := fn(p); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, &passes
+}
+
+func TestWriteGPX(t *testing.T) {
+	track, _ := sampleTrack()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatGPX, track); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Trk struct {
+			Name   string `xml:"name"`
+			Points []struct {
+				Lat  float64 `xml:"lat,attr"`
+				Lon  float64 `xml:"lon,attr"`
+				Time string  `xml:"time"`
+			} `xml:"trkseg>trkpt"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid GPX: %v\n%s", err, buf.String())
+	}
+	if doc.Trk.Name != "Trip <test> & co" || len(doc.Trk.Points) != 3 {
+		t.Fatalf("unexpected track: %+v", doc.Trk)
+	}
+	if doc.Trk.Points[1].Lat != 25.21 || doc.Trk.Points[1].Time != "2025-06-17T08:00:30Z" {
+		t.Errorf("unexpected point: %+v", doc.Trk.Points[1])
+	}
+	if !strings.Contains(buf.String(), "<fleet:mileage>1.2</fleet:mileage>") {
+		t.Errorf("trip metadata missing from extensions")
+	}
+}
+
+func TestWriteKML(t *testing.T) {
+	track, passes := sampleTrack()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatKML, track); err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), new(struct{})); err != nil {
+		t.Fatalf("invalid KML: %v", err)
+	}
+	out := buf.String()
+	if strings.Count(out, "<when>") != 3 || strings.Count(out, "<gx:coord>") != 3 || *passes != 2 {
+		t.Errorf("expected 3 whens and 3 coords over 2 passes, got:\n%s", out)
+	}
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	track, _ := sampleTrack()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatGeoJSON, track); err != nil {
+		t.Fatal(err)
+	}
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry *struct {
+				Type        string       `json:"type"`
+				Coordinates [][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &fc); err != nil {
+		t.Fatalf("invalid GeoJSON: %v\n%s", err, buf.String())
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Fatalf("unexpected collection: %+v", fc)
+	}
+	line := fc.Features[0]
+	if line.Geometry.Type != "LineString" || len(line.Geometry.Coordinates) != 3 {
+		t.Errorf("unexpected geometry: %+v", line.Geometry)
+	}
+	if times := line.Properties["coordTimes"].([]interface{}); len(times) != 3 {
+		t.Errorf("coordTimes has %d entries, want 3", len(times))
+	}
+	if line.Properties["avg_speed"] != 42.0 || fc.Features[1].Geometry != nil {
+		t.Errorf("unexpected properties: %+v", fc.Features)
+	}
+}
+
+func TestWriteUnsupported(t *testing.T) {
+	track, _ := sampleTrack()
+	if err := Write(&bytes.Buffer{}, "shp", track); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,76 @@
+package geo
+
+import "math"
+
+// EarthRadius is the mean Earth radius in metres
+const EarthRadius = 6371008.8
+
+// Point is a WGS84 coordinate in decimal degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// FromLonLat builds a Point from a GeoJSON style [lon, lat] pair
+func FromLonLat(ll [2]float64) Point {
+	return Point{Lat: ll[1], Lon: ll[0]}
+}
+
+// LonLat returns the point as a GeoJSON style [lon, lat] pair
+func (p Point) LonLat() [2]float64 {
+	return [2]float64{p.Lon, p.Lat}
+}
+
+// IsZero reports whether the point is the 0,0 "null island" coordinate
+func (p Point) IsZero() bool {
+	return p.Lat == 0 && p.Lon == 0
+}
+
+func rad(d float64) float64 { return d * math.Pi / 180 }
+func deg(r float64) float64 { return r * 180 / math.Pi }
+
+// Distance returns the great-circle distance between a and b in metres
+func Distance(a, b Point) float64 {
+	dLat := rad(b.Lat - a.Lat)
+	dLon := rad(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Bearing returns the initial bearing from a to b in degrees clockwise from north
+func Bearing(a, b Point) float64 {
+	lat1, lat2 := rad(a.Lat), rad(b.Lat)
+	dLon := rad(b.Lon - a.Lon)
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(deg(math.Atan2(y, x))+360, 360)
+}
+
+// Interpolate returns the point at fraction f (0..1) of the way from a to b.
+// Linear interpolation is accurate enough for the short segments between fixes.
+func Interpolate(a, b Point, f float64) Point {
+	return Point{
+		Lat: a.Lat + (b.Lat-a.Lat)*f,
+		Lon: a.Lon + (b.Lon-a.Lon)*f,
+	}
+}
+
+// Destination returns the point reached travelling dist metres from p on bearing
+func Destination(p Point, bearing, dist float64) Point {
+	lat1, lon1 := rad(p.Lat), rad(p.Lon)
+	b := rad(bearing)
+	d := dist / EarthRadius
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(b))
+	lon2 := lon1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	return Point{Lat: deg(lat2), Lon: math.Mod(deg(lon2)+540, 360) - 180}
+}
+
+// PathLength returns the total length of a polyline in metres
+func PathLength(pts []Point) float64 {
+	total := 0.0
+	for i := 1; i < len(pts); i++ {
+		total += Distance(pts[i-1], pts[i])
+	}
+	return total
+}
@@ -0,0 +1,89 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	// Dubai Mall to Burj Al Arab is roughly 11 km
+	d := Distance(Point{Lat: 25.1972, Lon: 55.2796}, Point{Lat: 25.1412, Lon: 55.1853})
+	if math.Abs(d-11200) > 300 {
+		t.Errorf("Distance = %.0f m, want about 11200", d)
+	}
+	if Distance(Point{Lat: 1, Lon: 1}, Point{Lat: 1, Lon: 1}) != 0 {
+		t.Errorf("distance to self should be 0")
+	}
+}
+
+func TestEncodePolyline(t *testing.T) {
+	// Example from Google's polyline documentation
+	pts := []Point{{Lat: 38.5, Lon: -120.2}, {Lat: 40.7, Lon: -120.95}, {Lat: 43.252, Lon: -126.453}}
+	const want = "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
+	if got := EncodePolyline(pts); got != want {
+		t.Fatalf("EncodePolyline = %q, want %q", got, want)
+	}
+	back, err := DecodePolyline(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range pts {
+		if math.Abs(back[i].Lat-pts[i].Lat) > 1e-5 || math.Abs(back[i].Lon-pts[i].Lon) > 1e-5 {
+			t.Errorf("point %d decoded as %+v, want %+v", i, back[i], pts[i])
+		}
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	// A straight line with a 2 m wobble and one 100 m detour
+	var pts []Point
+	for i := 0; i <= 100; i++ {
+		p := Destination(Point{Lat: 25.2, Lon: 55.27}, 90, float64(i)*10)
+		off := 2.0
+		if i%2 == 0 {
+			off = -2
+		}
+		if i == 50 {
+			off = 100
+		}
+		pts = append(pts, Destination(p, 0, off))
+	}
+
+	idx := Simplify(pts, 10)
+	if idx[0] != 0 || idx[len(idx)-1] != 100 {
+		t.Fatalf("endpoints must be kept: %v", idx)
+	}
+	found := false
+	for _, i := range idx {
+		if i == 50 {
+			found = true
+		}
+	}
+	if !found || len(idx) > 10 {
+		t.Errorf("Simplify kept %v, want the detour and few other points", idx)
+	}
+	if got := Simplify(pts, 0); len(got) != len(pts) {
+		t.Errorf("zero tolerance should keep all points")
+	}
+}
+
+func TestPathLocate(t *testing.T) {
+	// 1 km east, then back west 30 m further north
+	a := Point{Lat: 25.2, Lon: 55.27}
+	b := Destination(a, 90, 1000)
+	p := NewPath([]Point{a, b, Destination(b, 0, 30), Destination(a, 0, 30)})
+	if math.Abs(p.Length()-2030) > 1 {
+		t.Fatalf("Length = %.1f, want 2030", p.Length())
+	}
+
+	q := Destination(Destination(a, 90, 400), 180, 20)
+	dist, along := p.Locate(q, 0)
+	if math.Abs(dist-20) > 0.5 || math.Abs(along-400) > 0.5 {
+		t.Errorf("Locate = %.1f m off at %.1f m, want 20 m off at 400 m", dist, along)
+	}
+	// on the way back the same place is on the return leg
+	dist, along = p.Locate(q, 1100)
+	if math.Abs(dist-50) > 0.5 || math.Abs(along-1630) > 0.5 {
+		t.Errorf("Locate from 1100 = %.1f m off at %.1f m, want 50 m off at 1630 m", dist, along)
+	}
+}
@@ -0,0 +1,34 @@
+package geo
+
+// Geometry is a GeoJSON geometry object
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// Feature is a GeoJSON feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// FeatureCollection is a GeoJSON feature collection
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// NewLineString builds a LineString feature from points in [lon, lat] order
+func NewLineString(pts []Point, props map[string]interface{}) Feature {
+	coords := make([][2]float64, len(pts))
+	for i, p := range pts {
+		coords[i] = p.LonLat()
+	}
+	return Feature{Type: "Feature", Geometry: Geometry{Type: "LineString", Coordinates: coords}, Properties: props}
+}
+
+// NewPointFeature builds a Point feature
+func NewPointFeature(p Point, props map[string]interface{}) Feature {
+	return Feature{Type: "Feature", Geometry: Geometry{Type: "Point", Coordinates: p.LonLat()}, Properties: props}
+}
@@ -0,0 +1,57 @@
+package geo
+
+import "math"
+
+// Path is a polyline with the distance along it of every vertex, for
+// locating points relative to a planned route
+type Path struct {
+	Points []Point
+	along  []float64
+}
+
+// NewPath measures a polyline
+func NewPath(pts []Point) Path {
+	along := make([]float64, len(pts))
+	for i := 1; i < len(pts); i++ {
+		along[i] = along[i-1] + Distance(pts[i-1], pts[i])
+	}
+	return Path{Points: pts, along: along}
+}
+
+// Length returns the length of the path in metres
+func (p Path) Length() float64 {
+	if len(p.along) == 0 {
+		return 0
+	}
+	return p.along[len(p.along)-1]
+}
+
+// Locate returns the distance from q to the closest point of the path and
+// how far along the path that point is. Segments ending before from are
+// ignored, so a position on a route that passes the same place twice is
+// located on the passage ahead of the vehicle.
+func (p Path) Locate(q Point, from float64) (dist, along float64) {
+	dist, along = math.Inf(1), 0
+	if len(p.Points) == 1 {
+		return Distance(q, p.Points[0]), 0
+	}
+	for i := 1; i < len(p.Points); i++ {
+		if p.along[i] < from && i < len(p.Points)-1 {
+			continue
+		}
+		a, b := p.Points[i-1], p.Points[i]
+		// project on the segment in a plane around q
+		k := math.Cos(rad(q.Lat))
+		ax, ay := (a.Lon-q.Lon)*k, a.Lat-q.Lat
+		bx, by := (b.Lon-q.Lon)*k, b.Lat-q.Lat
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if l2 := dx*dx + dy*dy; l2 > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l2))
+		}
+		if d := Distance(q, Interpolate(a, b, t)); d < dist {
+			dist, along = d, p.along[i-1]+t*(p.along[i]-p.along[i-1])
+		}
+	}
+	return dist, along
+}
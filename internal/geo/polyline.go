@@ -0,0 +1,75 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// EncodePolyline encodes points with Google's polyline algorithm at 1e-5 precision
+func EncodePolyline(pts []Point) string {
+	var b strings.Builder
+	var prevLat, prevLon int64
+	for _, p := range pts {
+		lat := int64(math.Round(p.Lat * 1e5))
+		lon := int64(math.Round(p.Lon * 1e5))
+		encodeValue(&b, lat-prevLat)
+		encodeValue(&b, lon-prevLon)
+		prevLat, prevLon = lat, lon
+	}
+	return b.String()
+}
+
+func encodeValue(b *strings.Builder, v int64) {
+	u := v << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	b.WriteByte(byte(u + 63))
+}
+
+// DecodePolyline decodes a Google encoded polyline at 1e-5 precision
+func DecodePolyline(s string) ([]Point, error) {
+	var pts []Point
+	var lat, lon int64
+	for i := 0; i < len(s); {
+		dLat, n, err := decodeValue(s[i:])
+		if err != nil {
+			return nil, err
+		}
+		i += n
+		dLon, n, err := decodeValue(s[i:])
+		if err != nil {
+			return nil, err
+		}
+		i += n
+		lat += dLat
+		lon += dLon
+		pts = append(pts, Point{Lat: float64(lat) / 1e5, Lon: float64(lon) / 1e5})
+	}
+	return pts, nil
+}
+
+func decodeValue(s string) (int64, int, error) {
+	var result int64
+	var shift uint
+	for i := 0; i < len(s); i++ {
+		c := int64(s[i]) - 63
+		if c < 0 || c > 0x3f {
+			return 0, 0, errors.New("invalid polyline character")
+		}
+		result |= (c & 0x1f) << shift
+		shift += 5
+		if c < 0x20 {
+			if result&1 != 0 {
+				return ^(result >> 1), i + 1, nil
+			}
+			return result >> 1, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("truncated polyline")
+}
@@ -0,0 +1,66 @@
+package geo
+
+import "math"
+
+// Simplify reduces a polyline with the Douglas-Peucker algorithm and returns
+// the indexes of the points to keep. tolerance is in metres; the first and
+// last points are always kept.
+func Simplify(pts []Point, tolerance float64) []int {
+	n := len(pts)
+	if n <= 2 || tolerance <= 0 {
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx
+	}
+
+	// Project to a local plane in metres around the first point
+	xy := make([][2]float64, n)
+	lat0 := rad(pts[0].Lat)
+	for i, p := range pts {
+		xy[i] = [2]float64{
+			rad(p.Lon-pts[0].Lon) * math.Cos(lat0) * EarthRadius,
+			rad(p.Lat-pts[0].Lat) * EarthRadius,
+		}
+	}
+
+	keep := make([]bool, n)
+	keep[0], keep[n-1] = true, true
+	// Iterative to avoid deep recursion on long tracks
+	stack := [][2]int{{0, n - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := seg[0], seg[1]
+		maxDist, index := 0.0, -1
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xy[i], xy[first], xy[last]); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+		if index >= 0 && maxDist > tolerance {
+			keep[index] = true
+			stack = append(stack, [2]int{first, index}, [2]int{index, last})
+		}
+	}
+
+	var idx []int
+	for i, k := range keep {
+		if k {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// segmentDistance returns the distance from p to the segment a-b
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
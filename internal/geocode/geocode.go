@@ -0,0 +1,204 @@
+// Package geocode resolves coordinates to addresses from local datasets
+package geocode
+
+import (
+	"math"
+	"strings"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/mapmatch"
+	"fleet-tracker-service/internal/model"
+)
+
+// Place kinds, from the largest settlement to parts of one
+const (
+	KindCity          = "city"
+	KindTown          = "town"
+	KindVillage       = "village"
+	KindSuburb        = "suburb"
+	KindNeighbourhood = "neighbourhood"
+)
+
+// settlementRadius is how far from its centre a settlement of each kind is
+// assumed to reach
+var settlementRadius = map[string]float64{
+	KindCity:    30000,
+	KindTown:    10000,
+	KindVillage: 4000,
+}
+
+// suburbRadius is how far from its centre a suburb or neighbourhood reaches
+const suburbRadius = 3000
+
+// Search radii around a position in metres
+const (
+	addressRadius = 40
+	roadRadius    = 60
+)
+
+// Place is a named settlement or part of one
+type Place struct {
+	Name        string
+	Kind        string
+	Point       geo.Point
+	CountryCode string
+}
+
+// AddressPoint is a house number on a street
+type AddressPoint struct {
+	Street      string
+	HouseNumber string
+	Point       geo.Point
+}
+
+// Geocoder answers reverse geocoding queries from in-memory indexes
+type Geocoder struct {
+	roads       *mapmatch.Graph
+	settlements []Place
+	suburbs     []Place
+	addrs       []AddressPoint
+
+	settlementIdx *pointIndex
+	suburbIdx     *pointIndex
+	addrIdx       *pointIndex
+}
+
+// New builds a geocoder. roads may be nil, in which case addresses carry no
+// road unless a house number is nearby.
+func New(roads *mapmatch.Graph, places []Place, addrs []AddressPoint) *Geocoder {
+	g := &Geocoder{
+		roads:         roads,
+		addrs:         addrs,
+		settlementIdx: newPointIndex(0.1),
+		suburbIdx:     newPointIndex(0.02),
+		addrIdx:       newPointIndex(0.002),
+	}
+	for _, p := range places {
+		switch {
+		case settlementRadius[p.Kind] > 0:
+			g.settlementIdx.add(p.Point, len(g.settlements))
+			g.settlements = append(g.settlements, p)
+		case p.Kind == KindSuburb || p.Kind == KindNeighbourhood:
+			g.suburbIdx.add(p.Point, len(g.suburbs))
+			g.suburbs = append(g.suburbs, p)
+		}
+	}
+	for i, a := range addrs {
+		g.addrIdx.add(a.Point, i)
+	}
+	return g
+}
+
+// Stats reports how many entries the geocoder indexes
+func (g *Geocoder) Stats() (places, addresses int) {
+	return len(g.settlements) + len(g.suburbs), len(g.addrs)
+}
+
+// Reverse returns the address at p, or false when nothing is known nearby
+func (g *Geocoder) Reverse(p geo.Point) (model.Address, bool) {
+	var a model.Address
+	if i, ok := g.addrIdx.nearest(p, addressRadius); ok {
+		a.HouseNumber = g.addrs[i].HouseNumber
+		a.Road = g.addrs[i].Street
+	}
+	if a.Road == "" && g.roads != nil {
+		if r, _, ok := g.roads.NearestRoad(p, roadRadius); ok {
+			a.Road = r.Name
+			if a.Road == "" {
+				a.Road = r.Ref
+			}
+		}
+	}
+	if i, ok := g.suburbIdx.nearest(p, suburbRadius); ok {
+		a.Suburb = g.suburbs[i].Name
+		a.CountryCode = g.suburbs[i].CountryCode
+	}
+
+	// A city 20 km away still contains p, a village 5 km away does not:
+	// prefer the settlement whose reach p is most deeply inside
+	best, bestRatio := -1, math.Inf(1)
+	g.settlementIdx.within(p, settlementRadius[KindCity], func(i int, d float64) {
+		s := g.settlements[i]
+		if r := d / settlementRadius[s.Kind]; r <= 1 && r < bestRatio {
+			best, bestRatio = i, r
+		}
+	})
+	if best >= 0 {
+		a.City = g.settlements[best].Name
+		if a.CountryCode == "" || g.settlements[best].CountryCode != "" {
+			a.CountryCode = g.settlements[best].CountryCode
+		}
+	}
+
+	a.Label = label(a)
+	return a, a.Label != ""
+}
+
+func label(a model.Address) string {
+	var parts []string
+	add := func(s string) {
+		if s != "" && (len(parts) == 0 || parts[len(parts)-1] != s) {
+			parts = append(parts, s)
+		}
+	}
+	if a.HouseNumber != "" && a.Road != "" {
+		add(a.HouseNumber + " " + a.Road)
+	} else {
+		add(a.Road)
+	}
+	add(a.Suburb)
+	add(a.City)
+	return strings.Join(parts, ", ")
+}
+
+// pointIndex is a grid over points identified by their position in a slice
+type pointIndex struct {
+	cell float64
+	grid map[int64][]int
+	pts  map[int]geo.Point
+}
+
+func newPointIndex(cellDeg float64) *pointIndex {
+	return &pointIndex{cell: cellDeg, grid: map[int64][]int{}, pts: map[int]geo.Point{}}
+}
+
+func (x *pointIndex) key(cx, cy int32) int64 { return int64(cy)<<32 | int64(uint32(cx)) }
+
+func (x *pointIndex) cellOf(p geo.Point) (int32, int32) {
+	return int32(math.Floor(p.Lon / x.cell)), int32(math.Floor(p.Lat / x.cell))
+}
+
+func (x *pointIndex) add(p geo.Point, i int) {
+	cx, cy := x.cellOf(p)
+	k := x.key(cx, cy)
+	x.grid[k] = append(x.grid[k], i)
+	x.pts[i] = p
+}
+
+// within calls fn for every point within radius metres of p
+func (x *pointIndex) within(p geo.Point, radius float64, fn func(i int, d float64)) {
+	dLat := radius / 111320
+	dLon := radius / (111320 * math.Max(math.Cos(p.Lat*math.Pi/180), 0.01))
+	x1, y1 := x.cellOf(geo.Point{Lat: p.Lat - dLat, Lon: p.Lon - dLon})
+	x2, y2 := x.cellOf(geo.Point{Lat: p.Lat + dLat, Lon: p.Lon + dLon})
+	for cx := x1; cx <= x2; cx++ {
+		for cy := y1; cy <= y2; cy++ {
+			for _, i := range x.grid[x.key(cx, cy)] {
+				if d := geo.Distance(p, x.pts[i]); d <= radius {
+					fn(i, d)
+				}
+			}
+		}
+	}
+}
+
+// nearest returns the closest point within radius
+func (x *pointIndex) nearest(p geo.Point, radius float64) (int, bool) {
+	best, bestD := -1, math.Inf(1)
+	x.within(p, radius, func(i int, d float64) {
+		if d < bestD {
+			best, bestD = i, d
+		}
+	})
+	return best, best >= 0
+}
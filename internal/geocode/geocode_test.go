@@ -0,0 +1,76 @@
+package geocode
+
+import (
+	"strings"
+	"testing"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/mapmatch"
+	"fleet-tracker-service/internal/osm"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverse(t *testing.T) {
+	dubai := geo.Point{Lat: 25.2048, Lon: 55.2708}
+	barsha := geo.Destination(dubai, 225, 15000)
+	road := geo.Destination(barsha, 0, 500)
+	roads := mapmatch.Build([]osm.Way{
+		{ID: 1, Nodes: []int64{1, 2}, Tags: map[string]string{"highway": "trunk", "name": "Sheikh Zayed Road", "ref": "E11"}},
+		{ID: 2, Nodes: []int64{3, 4}, Tags: map[string]string{"highway": "service"}},
+	}, map[int64][2]float64{
+		1: geo.Destination(road, 270, 1000).LonLat(),
+		2: geo.Destination(road, 90, 1000).LonLat(),
+		3: geo.Destination(barsha, 180, 1000).LonLat(),
+		4: geo.Destination(barsha, 180, 1200).LonLat(),
+	})
+	places := []Place{
+		{Name: "Dubai", Kind: KindCity, Point: dubai, CountryCode: "AE"},
+		{Name: "Hatta", Kind: KindTown, Point: geo.Destination(dubai, 100, 25000), CountryCode: "AE"},
+		{Name: "Al Barsha", Kind: KindSuburb, Point: barsha},
+	}
+	house := geo.Destination(barsha, 90, 2000)
+	g := New(roads, places, []AddressPoint{{Street: "Street 12", HouseNumber: "7", Point: house}})
+
+	a, ok := g.Reverse(geo.Destination(road, 0, 20))
+	require.True(t, ok)
+	assert.Equal(t, "Sheikh Zayed Road, Al Barsha, Dubai", a.Label)
+	assert.Equal(t, "AE", a.CountryCode)
+
+	a, _ = g.Reverse(geo.Destination(house, 0, 10))
+	assert.Equal(t, "7 Street 12, Al Barsha, Dubai", a.Label)
+
+	// Unnamed roads are skipped; the suburb is out of reach
+	a, _ = g.Reverse(geo.Destination(barsha, 180, 3100))
+	assert.Equal(t, "Dubai", a.Label)
+
+	// Inside the town's reach, which p is deeper in than Dubai's
+	a, _ = g.Reverse(geo.Destination(dubai, 100, 22000))
+	assert.Equal(t, "Hatta", a.City)
+
+	_, ok = g.Reverse(geo.Point{Lat: 10, Lon: 10})
+	assert.False(t, ok)
+}
+
+func TestReadGeoNames(t *testing.T) {
+	row := func(name, class, code, cc, pop string) string {
+		return strings.Join([]string{"1", name, name, "", "25.2", "55.27", class, code, cc, "", "03", "", "", "", pop, "", "5", "Asia/Dubai", "2024-01-01"}, "\t")
+	}
+	in := strings.Join([]string{
+		row("Dubai", "P", "PPLA", "AE", "3478300"),
+		row("Hatta", "P", "PPL", "AE", "12000"),
+		row("Al Barsha", "P", "PPLX", "AE", "0"),
+		row("Burj Khalifa", "S", "TOWR", "AE", "0"),
+	}, "\n")
+	places, err := ReadGeoNames(strings.NewReader(in))
+	require.NoError(t, err)
+	require.Len(t, places, 3)
+	assert.Equal(t, KindCity, places[0].Kind)
+	assert.Equal(t, KindTown, places[1].Kind)
+	assert.Equal(t, KindSuburb, places[2].Kind)
+	assert.Equal(t, "AE", places[0].CountryCode)
+
+	_, err = ReadGeoNames(strings.NewReader("1\tDubai"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package geocode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/osm"
+)
+
+// osmPlaceKinds maps OSM place values to place kinds
+var osmPlaceKinds = map[string]string{
+	"city":          KindCity,
+	"town":          KindTown,
+	"village":       KindVillage,
+	"hamlet":        KindVillage,
+	"suburb":        KindSuburb,
+	"quarter":       KindSuburb,
+	"neighbourhood": KindNeighbourhood,
+}
+
+// LoadOSM reads named places and address nodes from a PBF extract. English
+// names are used where the extract has them.
+func LoadOSM(path string) ([]Place, []AddressPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var places []Place
+	var addrs []AddressPoint
+	err = osm.Scan(f, osm.Handler{Node: func(n osm.Node) error {
+		if n.Tags == nil {
+			return nil
+		}
+		pt := geo.Point{Lat: n.Lat, Lon: n.Lon}
+		if kind, ok := osmPlaceKinds[n.Tags["place"]]; ok {
+			name := n.Tags["name:en"]
+			if name == "" {
+				name = n.Tags["name"]
+			}
+			if name != "" {
+				places = append(places, Place{Name: name, Kind: kind, Point: pt, CountryCode: strings.ToUpper(n.Tags["is_in:country_code"])})
+			}
+		}
+		if street, num := n.Tags["addr:street"], n.Tags["addr:housenumber"]; street != "" && num != "" {
+			addrs = append(addrs, AddressPoint{Street: street, HouseNumber: num, Point: pt})
+		}
+		return nil
+	}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return places, addrs, nil
+}
+
+// LoadGeoNames reads populated places from a GeoNames dump such as
+// cities1000.txt or a country file
+func LoadGeoNames(path string) ([]Place, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	places, err := ReadGeoNames(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return places, nil
+}
+
+// ReadGeoNames parses the tab separated GeoNames format. Only populated
+// places (feature class P) are kept; their kind follows the population.
+func ReadGeoNames(r io.Reader) ([]Place, error) {
+	var places []Place
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		cols := strings.Split(sc.Text(), "\t")
+		if len(cols) < 15 {
+			return nil, fmt.Errorf("line %d: %d columns, want at least 15", line, len(cols))
+		}
+		if cols[6] != "P" {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(cols[4], 64)
+		lon, err2 := strconv.ParseFloat(cols[5], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("line %d: invalid coordinates", line)
+		}
+		pop, _ := strconv.ParseInt(cols[14], 10, 64)
+		places = append(places, Place{
+			Name:        cols[1],
+			Kind:        geoNamesKind(cols[7], pop),
+			Point:       geo.Point{Lat: lat, Lon: lon},
+			CountryCode: cols[8],
+		})
+	}
+	return places, sc.Err()
+}
+
+func geoNamesKind(code string, population int64) string {
+	switch {
+	case code == "PPLX":
+		return KindSuburb
+	case code == "PPLC" || population >= 100000:
+		return KindCity
+	case population >= 10000:
+		return KindTown
+	}
+	return KindVillage
+}
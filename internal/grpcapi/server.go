@@ -0,0 +1,139 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"fleet-tracker-service/internal/pb"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxReportedErrors caps how many per-report errors StreamPositions returns
+const maxReportedErrors = 100
+
+// Server implements pb.TelemetryServiceServer on top of service.Service
+type Server struct {
+	pb.UnimplementedTelemetryServiceServer
+	svc *service.Service
+}
+
+func NewServer(svc *service.Service) *Server {
+	return &Server{svc: svc}
+}
+
+// StreamPositions ingests every report sent by the client and returns a summary
+func (s *Server) StreamPositions(stream pb.TelemetryService_StreamPositionsServer) error {
+	ctx := stream.Context()
+	summary := &pb.IngestSummary{}
+	for index := uint64(0); ; index++ {
+		r, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(summary)
+		}
+		if err != nil {
+			return err
+		}
+
+		payload := service.IngestPayload{
+			VehicleID:   r.GetVehicleId(),
+			PlateNumber: r.GetPlateNumber(),
+		}
+		if r.GetStatus() != nil {
+			payload.Status = r.GetStatus().AsMap()
+		}
+		if err := s.svc.Ingest(ctx, payload); err != nil {
+			summary.Rejected++
+			if len(summary.Errors) < maxReportedErrors {
+				summary.Errors = append(summary.Errors, &pb.IngestError{
+					Index:     index,
+					VehicleId: r.GetVehicleId(),
+					Message:   err.Error(),
+				})
+			}
+			continue
+		}
+		summary.Accepted++
+	}
+}
+
+// GetStatus returns the latest status of a vehicle
+func (s *Server) GetStatus(ctx context.Context, req *pb.GetStatusRequest) (*pb.VehicleStatus, error) {
+	if req.GetVehicleId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "vehicle_id required")
+	}
+	st, err := s.svc.GetStatus(ctx, req.GetVehicleId())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toVehicleStatus(req.GetVehicleId(), st)
+}
+
+// ListTrips returns the trips of a vehicle in the last 24 hours
+func (s *Server) ListTrips(ctx context.Context, req *pb.ListTripsRequest) (*pb.ListTripsResponse, error) {
+	if req.GetVehicleId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "vehicle_id required")
+	}
+	trips, err := s.svc.GetTripsLast24h(ctx, req.GetVehicleId())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	resp := &pb.ListTripsResponse{Trips: make([]*pb.Trip, 0, len(trips))}
+	for _, t := range trips {
+		resp.Trips = append(resp.Trips, &pb.Trip{
+			Id:        t.ID.String(),
+			VehicleId: t.VehicleID.String(),
+			StartTime: timestamppb.New(t.StartTime),
+			EndTime:   timestamppb.New(t.EndTime),
+			Mileage:   t.Mileage,
+			AvgSpeed:  t.AvgSpeed,
+		})
+	}
+	return resp, nil
+}
+
+// WatchVehicles streams status updates until the client cancels
+func (s *Server) WatchVehicles(req *pb.WatchVehiclesRequest, stream pb.TelemetryService_WatchVehiclesServer) error {
+	updates, err := s.svc.WatchStatus(stream.Context(), req.GetVehicleIds())
+	if err != nil {
+		return toStatusError(err)
+	}
+	for u := range updates {
+		msg, err := toVehicleStatus(u.VehicleID, u.Status)
+		if err != nil {
+			continue
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+	return stream.Context().Err()
+}
+
+func toVehicleStatus(vehicleID string, st map[string]interface{}) (*pb.VehicleStatus, error) {
+	pst, err := structpb.NewStruct(st)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "encode status: %v", err)
+	}
+	return &pb.VehicleStatus{VehicleId: vehicleID, Status: pst}, nil
+}
+
+func toStatusError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNoVehicleFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePlannedRouteHandler stores a planned route with its corridor and stops
+func CreatePlannedRouteHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.PlannedRouteInput
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		r, err := svc.CreatePlannedRoute(c.Request.Context(), in)
+		if err != nil {
+			adherenceError(c, err)
+			return
+		}
+		c.Header("Location", "/api/planned-routes/"+r.ID.String())
+		c.JSON(http.StatusCreated, r)
+	}
+}
+
+// ListPlannedRoutesHandler lists the planned routes
+func ListPlannedRoutesHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routes, err := svc.ListPlannedRoutes(c.Request.Context())
+		if err != nil {
+			adherenceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, routes)
+	}
+}
+
+// PlannedRouteHandler returns a planned route
+func PlannedRouteHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := svc.GetPlannedRoute(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			adherenceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// DeletePlannedRouteHandler removes a planned route with its assignments
+func DeletePlannedRouteHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := svc.DeletePlannedRoute(c.Request.Context(), c.Param("id")); err != nil {
+			adherenceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AssignPlannedRouteHandler assigns a planned route to a vehicle for a time window
+func AssignPlannedRouteHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.AssignmentInput
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		a, err := svc.AssignPlannedRoute(c.Request.Context(), c.Param("id"), in)
+		if err != nil {
+			adherenceError(c, err)
+			return
+		}
+		c.Header("Location", "/api/route-assignments/"+a.ID.String())
+		c.JSON(http.StatusCreated, a)
+	}
+}
+
+// RouteAdherenceHandler reports how closely an assignment follows its route
+func RouteAdherenceHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, err := svc.GetRouteAdherence(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			adherenceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, a)
+	}
+}
+
+// AdherenceReportHandler reports on the route assignments in a time range,
+// as JSON or CSV
+func AdherenceReportHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 7*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		q := repository.RouteAssignmentQuery{
+			RouteID:   c.Query("route_id"),
+			VehicleID: c.Query("vehicle_id"),
+			From:      from,
+			To:        to,
+		}
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+			return
+		}
+		rows, err := svc.GetAdherenceReport(c.Request.Context(), q)
+		if err != nil {
+			adherenceError(c, err)
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, rows)
+			return
+		}
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="route-adherence-%s-%s.csv"`,
+			from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02")))
+		c.Status(http.StatusOK)
+		writeAdherenceCSV(c, rows)
+	}
+}
+
+func writeAdherenceCSV(c *gin.Context, rows []service.RouteAdherence) {
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"assignment_id", "route_id", "route_name", "vehicle_id", "start", "end", "state",
+		"adherence_pct", "completed_pct", "off_route_s", "off_route_count", "stops", "stops_visited", "stops_skipped",
+		"stops_missed"})
+	for _, r := range rows {
+		adherence := ""
+		if r.AdherencePct != nil {
+			adherence = strconv.FormatFloat(*r.AdherencePct, 'f', 1, 64)
+		}
+		offRoute := 0
+		for _, d := range r.Deviations {
+			if d.Kind == model.DeviationOffRoute {
+				offRoute++
+			}
+		}
+		_ = w.Write([]string{
+			r.ID.String(), r.RouteID.String(), r.RouteName, r.VehicleID.String(),
+			r.StartAt.UTC().Format(time.RFC3339), r.EndAt.UTC().Format(time.RFC3339), r.State,
+			adherence, strconv.FormatFloat(r.CompletedPct, 'f', 1, 64),
+			strconv.FormatFloat(r.OffRouteSeconds, 'f', 0, 64), strconv.Itoa(offRoute),
+			strconv.Itoa(len(r.Stops)), strconv.Itoa(r.StopsVisited), strconv.Itoa(r.StopsSkipped),
+			strconv.Itoa(r.StopsMissed),
+		})
+	}
+	w.Flush()
+}
+
+func adherenceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPlannedRoute):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and at most 93 days apart"})
+	case errors.Is(err, repository.ErrPlannedRouteNotFound), errors.Is(err, repository.ErrAssignmentNotFound),
+		errors.Is(err, repository.ErrNoVehicleFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrAssignmentOverlap):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
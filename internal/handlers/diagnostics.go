@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VehicleDTCsHandler returns the trouble codes a vehicle had in a time range
+func VehicleDTCsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 30*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.GetVehicleDTCs(c.Request.Context(), c.Param("id"), from, to, c.Query("state"), c.Query("severity"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+				return
+			}
+			diagnosticsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// ActiveDTCsHandler returns the trouble codes currently active across the fleet
+func ActiveDTCsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := svc.GetActiveDTCs(c.Request.Context(), c.Query("group_id"), c.Query("severity"))
+		if err != nil {
+			diagnosticsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// DecodeDTCHandler describes a trouble code
+func DecodeDTCHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, err := svc.DecodeDTC(c.Param("code"))
+		if err != nil {
+			diagnosticsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// EngineReadingsHandler returns the engine parameters of a vehicle in a time range
+func EngineReadingsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.GetEngineReadings(c.Request.Context(), c.Param("id"), from, to)
+		if err != nil {
+			diagnosticsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func diagnosticsError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidDiagnostics):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 31 days"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HarshEventsHandler returns the harsh driving events of a vehicle in a time range
+func HarshEventsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid := c.Query("vehicle_id")
+		if vid == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_id required"})
+			return
+		}
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.GetHarshEvents(c.Request.Context(), vid, from, to, c.Query("kind"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 31 days"})
+				return
+			}
+			scoringError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// TripScoreHandler returns the safety score and harsh events of a trip
+func TripScoreHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := svc.GetTripScore(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			scoringError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// DriverScoreHandler returns a driver's safety score over a time range and per week
+func DriverScoreHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 28*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.GetDriverScore(c.Request.Context(), c.Param("id"), from, to)
+		if err != nil {
+			scoringError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// DriverRankingHandler ranks drivers by safety score
+func DriverRankingHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 28*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var minKm float64
+		if v := c.Query("min_distance"); v != "" {
+			if minKm, err = strconv.ParseFloat(v, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "min_distance must be a number of km"})
+				return
+			}
+		}
+		res, err := svc.GetDriverRanking(c.Request.Context(), from, to, c.Query("group_id"), minKm)
+		if err != nil {
+			scoringError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// ScoringSettingsHandler returns the safety score weights
+func ScoringSettingsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, err := svc.GetScoringSettings(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// UpdateScoringSettingsHandler changes the safety score weights
+func UpdateScoringSettingsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.ScoringUpdate
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		s, err := svc.UpdateScoringSettings(c.Request.Context(), in)
+		if err != nil {
+			scoringError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+func scoringError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidScoring):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 366 days"})
+	case errors.Is(err, repository.ErrTripNotFound), errors.Is(err, repository.ErrDriverNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
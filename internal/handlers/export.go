@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"fleet-tracker-service/internal/export"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportTripHandler streams a single trip as GPX, KML or GeoJSON
+func ExportTripHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", export.FormatGeoJSON)
+		opened := false
+		err := svc.ExportTrip(c.Request.Context(), c.Param("id"), format, openDownload(c, format, &opened))
+		handleExportError(c, err, opened)
+	}
+}
+
+// ExportRangeHandler streams a vehicle's movement in a time range as GPX, KML or GeoJSON
+func ExportRangeHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid, ok := queryVehicleID(c)
+		if !ok {
+			return
+		}
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		format := c.DefaultQuery("format", export.FormatGeoJSON)
+		opened := false
+		err = svc.ExportRange(c.Request.Context(), vid, from, to, format, openDownload(c, format, &opened))
+		handleExportError(c, err, opened)
+	}
+}
+
+func openDownload(c *gin.Context, format string, opened *bool) func(string) io.Writer {
+	return func(name string) io.Writer {
+		contentType, ext, _ := export.ContentType(format)
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, ext))
+		c.Status(http.StatusOK)
+		*opened = true
+		return c.Writer
+	}
+}
+
+func handleExportError(c *gin.Context, err error, opened bool) {
+	if err == nil {
+		return
+	}
+	if opened {
+		// Headers are already sent; the client sees a truncated file
+		log.Printf("export aborted: %v", err)
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrUnsupportedFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be gpx, kml or geojson"})
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 366 days"})
+	case errors.Is(err, repository.ErrTripNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
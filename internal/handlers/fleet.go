@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type nameReq struct {
+	Name          string `json:"name"`
+	LicenseNumber string `json:"license_number"`
+}
+
+// CreateGroupHandler creates a vehicle group
+func CreateGroupHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r nameReq
+		if err := c.BindJSON(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		g, err := svc.CreateGroup(c.Request.Context(), r.Name)
+		if err != nil {
+			fleetError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, g)
+	}
+}
+
+// ListGroupsHandler lists vehicle groups
+func ListGroupsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groups, err := svc.ListGroups(c.Request.Context())
+		if err != nil {
+			fleetError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, groups)
+	}
+}
+
+// CreateDriverHandler registers a driver
+func CreateDriverHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r nameReq
+		if err := c.BindJSON(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		d, err := svc.CreateDriver(c.Request.Context(), r.Name, r.LicenseNumber)
+		if err != nil {
+			fleetError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, d)
+	}
+}
+
+// ListDriversHandler lists drivers
+func ListDriversHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		drivers, err := svc.ListDrivers(c.Request.Context())
+		if err != nil {
+			fleetError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, drivers)
+	}
+}
+
+// ListVehiclesHandler lists the fleet with meters and maintenance state
+func ListVehiclesHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vehicles, err := svc.ListVehicles(c.Request.Context(), c.Query("group_id"))
+		if err != nil {
+			fleetError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, vehicles)
+	}
+}
+
+type assignmentReq struct {
+	GroupID  string `json:"group_id"`
+	DriverID string `json:"driver_id"`
+}
+
+// AssignVehicleHandler sets a vehicle's group and current driver
+func AssignVehicleHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r assignmentReq
+		if err := c.BindJSON(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		if err := svc.AssignVehicle(c.Request.Context(), c.Param("id"), r.GroupID, r.DriverID); err != nil {
+			fleetError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"vehicle_id": c.Param("id"), "group_id": r.GroupID, "driver_id": r.DriverID})
+	}
+}
+
+func fleetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidFleetInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrNoVehicleFound), errors.Is(err, repository.ErrGroupNotFound),
+		errors.Is(err, repository.ErrDriverNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrGroupExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FuelReportHandler returns the refuels, drops and consumption of a vehicle in a time range
+func FuelReportHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid := c.Query("vehicle_id")
+		if vid == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_id required"})
+			return
+		}
+		from, to, err := parseTimeRange(c, 7*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rep, err := svc.GetFuelReport(c.Request.Context(), vid, from, to)
+		if err != nil {
+			fuelError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rep)
+	}
+}
+
+// FuelReadingsHandler returns the raw and smoothed fuel levels of a vehicle in a time range
+func FuelReadingsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid := c.Query("vehicle_id")
+		if vid == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_id required"})
+			return
+		}
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.GetFuelReadings(c.Request.Context(), vid, from, to)
+		if err != nil {
+			fuelError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func fuelError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 31 days"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	"fleet-tracker-service/internal/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type loginReq struct {
@@ -46,6 +48,10 @@ func IngestHandler(svc *service.Service) gin.HandlerFunc {
 			return
 		}
 		if err := svc.Ingest(c.Request.Context(), payload); err != nil {
+			if errors.Is(err, service.ErrInvalidPayload) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -53,6 +59,39 @@ func IngestHandler(svc *service.Service) gin.HandlerFunc {
 	}
 }
 
+// AsyncIngestHandler validates the payload and queues it for the ingest workers
+func AsyncIngestHandler(pool *service.IngestPool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var payload service.IngestPayload
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+		id, err := pool.Enqueue(c.Request.Context(), payload)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidPayload) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"ok": true, "id": id})
+	}
+}
+
+// IngestStatsHandler reports ingest stream length, lag and worker counters
+func IngestStatsHandler(pool *service.IngestPool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st, err := pool.Stats(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, st)
+	}
+}
+
 // StatusHandler retrieves the latest status of a vehicle
 func StatusHandler(svc *service.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -86,3 +125,40 @@ func TripsHandler(svc *service.Service) gin.HandlerFunc {
 		c.JSON(http.StatusOK, trips)
 	}
 }
+
+// queryVehicleID reads the vehicle_id query parameter and answers 400 when it
+// is missing or not a UUID
+func queryVehicleID(c *gin.Context) (string, bool) {
+	vid := c.Query("vehicle_id")
+	if vid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_id required"})
+		return "", false
+	}
+	if _, err := uuid.Parse(vid); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_id must be a UUID"})
+		return "", false
+	}
+	return vid, true
+}
+
+// parseTimeRange reads the from/to query parameters (RFC3339). A missing to
+// defaults to now and a missing from to window before to.
+func parseTimeRange(c *gin.Context, window time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be RFC3339")
+		}
+		to = t
+	}
+	from := to.Add(-window)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be RFC3339")
+		}
+		from = t
+	}
+	return from.UTC(), to.UTC(), nil
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListHOSRuleSetsHandler lists the driving-time rule sets
+func ListHOSRuleSetsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := svc.ListHOSRuleSets(c.Request.Context())
+		if err != nil {
+			hosError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// CreateHOSRuleSetHandler adds a driving-time rule set
+func CreateHOSRuleSetHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.HOSRuleSetInput
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		rs, err := svc.CreateHOSRuleSet(c.Request.Context(), in)
+		if err != nil {
+			hosError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, rs)
+	}
+}
+
+// UpdateHOSRuleSetHandler replaces the limits of a rule set
+func UpdateHOSRuleSetHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.HOSRuleSetInput
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		rs, err := svc.UpdateHOSRuleSet(c.Request.Context(), c.Param("id"), in)
+		if err != nil {
+			hosError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rs)
+	}
+}
+
+// SetDriverHOSRuleSetHandler holds a driver to a rule set; an empty
+// rule_set_id reverts to the default one
+func SetDriverHOSRuleSetHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in struct {
+			RuleSetID string `json:"rule_set_id"`
+		}
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		if err := svc.SetDriverHOSRuleSet(c.Request.Context(), c.Param("id"), in.RuleSetID); err != nil {
+			hosError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// DriverHoursHandler returns a driver's remaining driving time with their
+// activity and violations in a time range
+func DriverHoursHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.GetDriverHours(c.Request.Context(), c.Param("id"), from, to)
+		if err != nil {
+			hosError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// HOSViolationsReportHandler reports driving-time violations in a time range,
+// as JSON or CSV
+func HOSViolationsReportHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 7*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+			return
+		}
+		rows, err := svc.GetHOSViolations(c.Request.Context(), from, to, c.Query("driver_id"), c.Query("kind"))
+		if err != nil {
+			hosError(c, err)
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, rows)
+			return
+		}
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="hos-violations-%s-%s.csv"`,
+			from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02")))
+		c.Status(http.StatusOK)
+		writeHOSViolationsCSV(c, rows)
+	}
+}
+
+func writeHOSViolationsCSV(c *gin.Context, rows []model.HOSViolation) {
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"driver_id", "driver_name", "rule_set", "kind", "period_start", "at", "limit_min",
+		"actual_min", "excess_min"})
+	for _, v := range rows {
+		_ = w.Write([]string{
+			v.DriverID.String(), v.DriverName, v.RuleSet, v.Kind,
+			v.PeriodStart.UTC().Format(time.RFC3339), v.At.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(v.LimitMin, 'f', -1, 64), strconv.FormatFloat(v.ActualMin, 'f', 1, 64),
+			strconv.FormatFloat(v.ExcessMin, 'f', 1, 64),
+		})
+	}
+	w.Flush()
+}
+
+func hosError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidHOSRuleSet):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and at most 93 days apart"})
+	case errors.Is(err, repository.ErrHOSRuleSetNotFound), errors.Is(err, repository.ErrDriverNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrHOSRuleSetExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"fleet-tracker-service/internal/importer"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateImportHandler accepts a GPX or CSV upload and queues its import.
+// A file already imported with the same options returns the existing job.
+func CreateImportHandler(im *service.Importer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file required"})
+			return
+		}
+		opts := importer.Options{
+			Format:      c.PostForm("format"),
+			VehicleID:   c.PostForm("vehicle_id"),
+			PlateNumber: c.PostForm("plate_number"),
+		}
+		if m := c.PostForm("mapping"); m != "" {
+			mapping := importer.DefaultMapping()
+			if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mapping: " + err.Error()})
+				return
+			}
+			opts.Mapping = &mapping
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+
+		job, created, err := im.Submit(c.Request.Context(), fh.Filename, f, opts)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidImport) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !created {
+			c.JSON(http.StatusOK, job)
+			return
+		}
+		c.Header("Location", "/api/imports/"+job.ID.String())
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// ImportHandler reports the status and progress of an import job
+func ImportHandler(im *service.Importer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := im.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			if errors.Is(err, repository.ErrImportNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
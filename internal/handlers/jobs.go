@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+	"fleet-tracker-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateJobHandler adds a dispatch job, assigned when it names a vehicle
+func CreateJobHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.JobInput
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		j, err := svc.CreateJob(c.Request.Context(), in)
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		c.Header("Location", "/api/jobs/"+j.ID.String())
+		c.JSON(http.StatusCreated, j)
+	}
+}
+
+// ListJobsHandler lists jobs by status, vehicle, priority and creation time
+func ListJobsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := repository.JobQuery{
+			Status:    c.Query("status"),
+			VehicleID: c.Query("vehicle_id"),
+			Priority:  c.Query("priority"),
+			Limit:     100,
+		}
+		var err error
+		if c.Query("from") != "" || c.Query("to") != "" {
+			if q.From, q.To, err = parseTimeRange(c, 24*time.Hour); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			if q.Limit, err = strconv.Atoi(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+				return
+			}
+		}
+		jobs, err := svc.ListJobs(c.Request.Context(), q)
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, jobs)
+	}
+}
+
+// JobHandler returns a job with its ETA and proof-of-delivery attachments
+func JobHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		j, err := svc.GetJob(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, j)
+	}
+}
+
+// AssignJobHandler assigns a job to a vehicle, or unassigns it with an
+// empty vehicle_id
+func AssignJobHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in struct {
+			VehicleID string `json:"vehicle_id"`
+		}
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		j, err := svc.AssignJob(c.Request.Context(), c.Param("id"), in.VehicleID)
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, j)
+	}
+}
+
+// JobStatusHandler moves a job forward by hand or cancels it
+func JobStatusHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in struct {
+			Status string `json:"status"`
+		}
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		j, err := svc.SetJobStatus(c.Request.Context(), c.Param("id"), in.Status)
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, j)
+	}
+}
+
+// UploadJobAttachmentHandler accepts a proof-of-delivery signature or photo
+// as multipart form data
+func UploadJobAttachmentHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxAttachmentBytes+1<<20)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file required, at most 10 MB"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+
+		deliver := false
+		if v := c.PostForm("deliver"); v != "" {
+			if deliver, err = strconv.ParseBool(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "deliver must be true or false"})
+				return
+			}
+		}
+
+		a, err := svc.AddJobAttachment(c.Request.Context(), c.Param("id"), c.PostForm("kind"), fh.Filename, fh.Size, f, deliver)
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		c.Header("Location", fmt.Sprintf("/api/jobs/%s/attachments/%s", a.JobID, a.ID))
+		c.JSON(http.StatusCreated, a)
+	}
+}
+
+// JobAttachmentHandler downloads a proof-of-delivery file
+func JobAttachmentHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, rc, err := svc.OpenJobAttachment(c.Request.Context(), c.Param("id"), c.Param("attachment_id"))
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		defer rc.Close()
+		c.DataFromReader(http.StatusOK, a.SizeBytes, a.ContentType, rc, map[string]string{
+			"Content-Disposition": fmt.Sprintf("inline; filename=%q", a.FileName),
+		})
+	}
+}
+
+func jobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidJob):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+	case errors.Is(err, repository.ErrJobNotFound), errors.Is(err, repository.ErrAttachmentNotFound),
+		errors.Is(err, repository.ErrNoVehicleFound), errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
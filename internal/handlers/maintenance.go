@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePlanHandler adds a maintenance plan for a vehicle or group
+func CreatePlanHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r service.PlanInput
+		if err := c.BindJSON(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		p, err := svc.CreatePlan(c.Request.Context(), r)
+		if err != nil {
+			maintenanceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+// ListPlansHandler lists maintenance plans, optionally of one vehicle or group
+func ListPlansHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plans, err := svc.ListPlans(c.Request.Context(), c.Query("vehicle_id"), c.Query("group_id"))
+		if err != nil {
+			maintenanceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, plans)
+	}
+}
+
+// DeletePlanHandler removes a maintenance plan
+func DeletePlanHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := svc.DeletePlan(c.Request.Context(), c.Param("id")); err != nil {
+			maintenanceError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// DueMaintenanceHandler lists plans due soon or overdue across the fleet
+func DueMaintenanceHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		due, err := svc.GetDueMaintenance(c.Request.Context(), c.Query("state"), c.Query("group_id"))
+		if err != nil {
+			maintenanceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, due)
+	}
+}
+
+// VehicleMaintenanceHandler returns when each plan of a vehicle falls due
+func VehicleMaintenanceHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		due, err := svc.GetVehicleMaintenance(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			maintenanceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, due)
+	}
+}
+
+// CreateServiceRecordHandler records maintenance work done on a vehicle
+func CreateServiceRecordHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r service.ServiceInput
+		if err := c.BindJSON(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		rec, err := svc.AddServiceRecord(c.Request.Context(), c.Param("id"), r, actor(c))
+		if err != nil {
+			maintenanceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, rec)
+	}
+}
+
+// ServiceRecordsHandler returns the service history of a vehicle
+func ServiceRecordsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recs, err := svc.GetServiceRecords(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			maintenanceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, recs)
+	}
+}
+
+func maintenanceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMaintenance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrNoVehicleFound), errors.Is(err, repository.ErrGroupNotFound),
+		errors.Is(err, repository.ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
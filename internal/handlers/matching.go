@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MatchTripHandler returns a trip snapped to the road network with corrected
+// mileage and the roads driven
+func MatchTripHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := svc.MatchTrip(c.Request.Context(), c.Param("id"))
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, res)
+		case errors.Is(err, repository.ErrTripNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNoRoadNetwork):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "map matching is unavailable: set MAP_PBF to an OSM extract and wait for it to load"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
+}
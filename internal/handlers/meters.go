@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// actor returns the subject of the caller's token for audit records
+func actor(c *gin.Context) string {
+	claims, _ := c.Get("claims")
+	if mc, ok := claims.(jwt.MapClaims); ok {
+		if sub, ok := mc["sub"].(string); ok {
+			return sub
+		}
+	}
+	return ""
+}
+
+// MetersHandler returns the current odometer and engine hours of a vehicle
+func MetersHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := svc.GetMeters(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			metersError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// CalibrateMetersHandler manually sets a vehicle's odometer, engine hours or odometer source
+func CalibrateMetersHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r service.MeterCalibration
+		if err := c.BindJSON(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		m, err := svc.CalibrateMeters(c.Request.Context(), c.Param("id"), r, actor(c))
+		if err != nil {
+			metersError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// MeterHistoryHandler returns the audit history of a vehicle's meters
+func MeterHistoryHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 30*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res, err := svc.GetMeterHistory(c.Request.Context(), c.Param("id"), from, to, c.Query("kind"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+				return
+			}
+			metersError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func metersError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMeters):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrNoVehicleFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
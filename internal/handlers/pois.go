@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePOIHandler adds a point of interest
+func CreatePOIHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.POIInput
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		p, err := svc.CreatePOI(c.Request.Context(), in)
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.Header("Location", "/api/pois/"+p.ID.String())
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+// ListPOIsHandler lists POIs by category and name, or nearest first around
+// near=lon,lat within radius metres
+func ListPOIsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := repository.POIQuery{Category: strings.ToLower(c.Query("category")), Search: c.Query("q")}
+		var err error
+		for name, dst := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+			if v := c.Query(name); v != "" {
+				if *dst, err = strconv.Atoi(v); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a number"})
+					return
+				}
+			}
+		}
+		var near *service.POINear
+		if v := c.Query("near"); v != "" {
+			near = &service.POINear{RadiusM: 1000}
+			parts := strings.Split(v, ",")
+			if len(parts) != 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "near must be lon,lat"})
+				return
+			}
+			for i, part := range parts {
+				if near.Location[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "near must be lon,lat"})
+					return
+				}
+			}
+			if r := c.Query("radius"); r != "" {
+				if near.RadiusM, err = strconv.ParseFloat(r, 64); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "radius must be a number"})
+					return
+				}
+			}
+		}
+		pois, err := svc.ListPOIs(c.Request.Context(), q, near)
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, pois)
+	}
+}
+
+// POICategoriesHandler lists the POI categories in use with their counts
+func POICategoriesHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cats, err := svc.POICategories(c.Request.Context())
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, cats)
+	}
+}
+
+// POIHandler returns a POI
+func POIHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := svc.GetPOI(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// UpdatePOIHandler replaces the details of a POI
+func UpdatePOIHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in service.POIInput
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		p, err := svc.UpdatePOI(c.Request.Context(), c.Param("id"), in)
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// DeletePOIHandler removes a POI with its visits
+func DeletePOIHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := svc.DeletePOI(c.Request.Context(), c.Param("id")); err != nil {
+			poiError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ImportPOIsHandler adds or updates POIs from an uploaded CSV file
+func ImportPOIsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxPOIImportBytes+1<<20)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file required, at most 20 MB"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+
+		res, err := svc.ImportPOIs(c.Request.Context(), f)
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// poiVisitQuery reads the time range and filters of a visits request
+func poiVisitQuery(c *gin.Context) (repository.POIVisitQuery, bool) {
+	from, to, err := parseTimeRange(c, 7*24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return repository.POIVisitQuery{}, false
+	}
+	q := repository.POIVisitQuery{
+		POIID:     c.Query("poi_id"),
+		VehicleID: c.Query("vehicle_id"),
+		Category:  strings.ToLower(c.Query("category")),
+		From:      from,
+		To:        to,
+	}
+	if v := c.Query("min_duration"); v != "" {
+		if q.MinDuration, err = time.ParseDuration(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_duration must be a duration such as 5m"})
+			return q, false
+		}
+	}
+	return q, true
+}
+
+// POIVisitsHandler lists the visits to a POI
+func POIVisitsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, ok := poiVisitQuery(c)
+		if !ok {
+			return
+		}
+		if _, err := svc.GetPOI(c.Request.Context(), c.Param("id")); err != nil {
+			poiError(c, err)
+			return
+		}
+		q.POIID = c.Param("id")
+		visits, err := svc.GetPOIVisits(c.Request.Context(), q)
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, visits)
+	}
+}
+
+// VehiclePOIVisitsHandler lists the POIs a vehicle visited
+func VehiclePOIVisitsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, ok := poiVisitQuery(c)
+		if !ok {
+			return
+		}
+		q.VehicleID = c.Param("id")
+		visits, err := svc.GetPOIVisits(c.Request.Context(), q)
+		if err != nil {
+			poiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, visits)
+	}
+}
+
+// POIVisitReportHandler reports POI visits in a time range per POI, per
+// vehicle or one row per visit, as JSON or CSV
+func POIVisitReportHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, ok := poiVisitQuery(c)
+		if !ok {
+			return
+		}
+		by := c.DefaultQuery("by", service.VisitsByPOI)
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+			return
+		}
+
+		var rows interface{}
+		var write func(w *csv.Writer)
+		if by == service.VisitsByVisit {
+			visits, err := svc.GetPOIVisits(c.Request.Context(), q)
+			if err != nil {
+				poiError(c, err)
+				return
+			}
+			rows, write = visits, func(w *csv.Writer) { writePOIVisitsCSV(w, visits) }
+		} else {
+			sums, err := svc.GetPOIVisitSummary(c.Request.Context(), q, by)
+			if err != nil {
+				poiError(c, err)
+				return
+			}
+			rows, write = sums, func(w *csv.Writer) { writePOIVisitSummaryCSV(w, by, sums) }
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, rows)
+			return
+		}
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="poi-visits-%s-%s-%s.csv"`, by,
+			q.From.UTC().Format("2006-01-02"), q.To.UTC().Format("2006-01-02")))
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		write(w)
+		w.Flush()
+	}
+}
+
+func writePOIVisitsCSV(w *csv.Writer, visits []model.POIVisit) {
+	_ = w.Write([]string{"poi_id", "poi_name", "category", "vehicle_id", "plate_number", "arrival", "departure",
+		"duration_s", "distance_m"})
+	for _, v := range visits {
+		departure := ""
+		if v.Departure != nil {
+			departure = v.Departure.UTC().Format(time.RFC3339)
+		}
+		_ = w.Write([]string{
+			v.POIID.String(), v.POIName, v.Category, v.VehicleID.String(), v.PlateNumber,
+			v.Arrival.UTC().Format(time.RFC3339), departure,
+			strconv.FormatFloat(v.DurationSeconds, 'f', 0, 64), strconv.FormatFloat(v.DistanceM, 'f', 0, 64),
+		})
+	}
+}
+
+func writePOIVisitSummaryCSV(w *csv.Writer, by string, sums []service.POIVisitSummary) {
+	header := []string{"poi_id", "poi_name", "category", "visits", "vehicles"}
+	if by == service.VisitsByVehicle {
+		header = []string{"vehicle_id", "plate_number", "visits", "pois"}
+	}
+	_ = w.Write(append(header, "dwell_s", "avg_dwell_s", "first_arrival", "last_arrival"))
+	for _, s := range sums {
+		row := []string{s.ID.String(), s.Name}
+		if by == service.VisitsByPOI {
+			row = append(row, s.Category)
+		}
+		_ = w.Write(append(row,
+			strconv.Itoa(s.Visits), strconv.Itoa(s.Distinct),
+			strconv.FormatFloat(s.DwellSeconds, 'f', 0, 64), strconv.FormatFloat(s.AvgDwellSeconds, 'f', 0, 64),
+			s.FirstArrival.UTC().Format(time.RFC3339), s.LastArrival.UTC().Format(time.RFC3339),
+		))
+	}
+}
+
+func poiError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPOI):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and at most 93 days apart"})
+	case errors.Is(err, repository.ErrPOINotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
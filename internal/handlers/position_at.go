@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseAt reads the required at query parameter (RFC3339)
+func parseAt(c *gin.Context) (time.Time, bool) {
+	at, err := time.Parse(time.RFC3339, c.Query("at"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at must be RFC3339"})
+		return time.Time{}, false
+	}
+	return at.UTC(), true
+}
+
+// PositionAtHandler returns where a vehicle was at an instant, interpolated
+// between the stored fixes around it
+func PositionAtHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid := c.Query("vehicle_id")
+		if vid == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_id required"})
+			return
+		}
+		at, ok := parseAt(c)
+		if !ok {
+			return
+		}
+
+		pos, err := svc.GetPositionAt(c.Request.Context(), vid, at)
+		if err != nil {
+			if errors.Is(err, service.ErrNoPosition) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no position within 24h of that time"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, pos)
+	}
+}
+
+// FleetPositionAtHandler returns where every vehicle, optionally of one
+// group, was at an instant
+func FleetPositionAtHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		at, ok := parseAt(c)
+		if !ok {
+			return
+		}
+
+		res, err := svc.GetFleetPositionAt(c.Request.Context(), at, c.Query("group_id"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidFleetInput) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "group_id must be a UUID"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RejectedPositionsHandler lists the fixes of a vehicle the ingest filter dropped and why
+func RejectedPositionsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid, ok := queryVehicleID(c)
+		if !ok {
+			return
+		}
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		res, err := svc.GetRejectedPositions(c.Request.Context(), vid, from, to, c.Query("reason"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 31 days"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UtilizationReportHandler returns per-vehicle or per-group utilization per
+// day or month as JSON or CSV
+func UtilizationReportHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		today := time.Now().UTC()
+		q := service.UtilizationReport{
+			From:       c.DefaultQuery("from", today.AddDate(0, 0, -29).Format("2006-01-02")),
+			To:         c.DefaultQuery("to", today.Format("2006-01-02")),
+			Period:     c.Query("period"),
+			GroupBy:    c.Query("group_by"),
+			VehicleIDs: queryList(c, "vehicle_id"),
+			GroupID:    c.Query("group_id"),
+		}
+		rows, err := svc.GetUtilization(c.Request.Context(), q)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRange) || errors.Is(err, service.ErrInvalidSearch) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch c.DefaultQuery("format", "json") {
+		case "json":
+			c.JSON(http.StatusOK, rows)
+		case "csv":
+			c.Header("Content-Type", "text/csv")
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="utilization-%s-%s.csv"`, q.From, q.To))
+			c.Status(http.StatusOK)
+			writeUtilizationCSV(c, rows)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		}
+	}
+}
+
+func writeUtilizationCSV(c *gin.Context, rows []model.UtilizationRow) {
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"period", "vehicle_id", "plate_number", "group_id", "group_name", "vehicles", "distance_km",
+		"driving_hours", "idle_hours", "trip_count", "max_speed", "first_start", "last_stop", "utilization_pct"})
+	id := func(v fmt.Stringer, ok bool) string {
+		if !ok {
+			return ""
+		}
+		return v.String()
+	}
+	ts := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	num := func(v float64, prec int) string {
+		return strconv.FormatFloat(v, 'f', prec, 64)
+	}
+	for _, r := range rows {
+		_ = w.Write([]string{
+			r.Period,
+			id(r.VehicleID, r.VehicleID != nil), r.PlateNumber,
+			id(r.GroupID, r.GroupID != nil), r.GroupName,
+			strconv.Itoa(r.Vehicles),
+			num(r.DistanceKm, 2),
+			num(r.DrivingSeconds/3600, 2),
+			num(r.IdleSeconds/3600, 2),
+			strconv.Itoa(r.TripCount),
+			num(r.MaxSpeed, 1),
+			ts(r.FirstStart), ts(r.LastStop),
+			num(r.Utilization, 1),
+		})
+	}
+	w.Flush()
+}
+
+// SpeedingReportHandler returns the overspeed episodes in a time range with
+// their duration, peak speed and posted limit as JSON or CSV
+func SpeedingReportHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 7*24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		q := repository.SpeedingQuery{
+			From:      from,
+			To:        to,
+			VehicleID: c.Query("vehicle_id"),
+			DriverID:  c.Query("driver_id"),
+			GroupID:   c.Query("group_id"),
+		}
+		if v := c.Query("min_duration"); v != "" {
+			if q.MinDuration, err = time.ParseDuration(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "min_duration must be a duration such as 30s"})
+				return
+			}
+		}
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+			return
+		}
+		rows, err := svc.GetSpeedingReport(c.Request.Context(), q)
+		if err != nil {
+			scoringError(c, err)
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, rows)
+			return
+		}
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="speeding-%s-%s.csv"`,
+			from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02")))
+		c.Status(http.StatusOK)
+		writeSpeedingCSV(c, rows)
+	}
+}
+
+func writeSpeedingCSV(c *gin.Context, rows []model.SpeedingViolation) {
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"vehicle_id", "plate_number", "driver_id", "driver_name", "start", "end", "duration_s",
+		"peak_speed_kmh", "limit_kmh", "excess_kmh", "limit_source", "road", "lon", "lat"})
+	num := func(v *float64, prec int) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', prec, 64)
+	}
+	for _, r := range rows {
+		driver := ""
+		if r.DriverID != nil {
+			driver = r.DriverID.String()
+		}
+		_ = w.Write([]string{
+			r.VehicleID.String(), r.PlateNumber,
+			driver, r.DriverName,
+			r.OccurredAt.UTC().Format(time.RFC3339), r.EndedAt.UTC().Format(time.RFC3339),
+			num(&r.DurationSeconds, 0),
+			num(&r.Value, 1), num(r.LimitKmh, 0), num(r.ExcessKmh, 1),
+			r.LimitSource, r.Road,
+			num(&r.Location[0], 6), num(&r.Location[1], 6),
+		})
+	}
+	w.Flush()
+}
+
+// OrgSettingsHandler returns the organization's reporting settings
+func OrgSettingsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, err := svc.GetOrgSettings(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// UpdateOrgSettingsHandler changes the timezone and working hours reports use
+func UpdateOrgSettingsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in model.OrgSettings
+		if err := c.BindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		s, err := svc.UpdateOrgSettings(c.Request.Context(), in)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidSettings) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteHandler returns the travelled path of a vehicle as GeoJSON and an encoded polyline
+func RouteHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid, ok := queryVehicleID(c)
+		if !ok {
+			return
+		}
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tolerance := 0.0
+		if v := c.Query("tolerance"); v != "" {
+			tolerance, err = strconv.ParseFloat(v, 64)
+			if err != nil || tolerance < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "tolerance must be a non-negative number of metres"})
+				return
+			}
+		}
+		sp := service.DefaultStopParams()
+		if v := c.Query("min_stop"); v != "" {
+			sp.MinDuration, err = time.ParseDuration(v)
+			if err != nil || sp.MinDuration <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "min_stop must be a positive duration such as 5m"})
+				return
+			}
+		}
+
+		route, err := svc.GetRoute(c.Request.Context(), vid, from, to, tolerance, sp)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 31 days"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, route)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StopsHandler returns the stops of a vehicle in a time range with dwell and idle totals
+func StopsHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vid, ok := queryVehicleID(c)
+		if !ok {
+			return
+		}
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		minDuration := service.DefaultStopParams().MinDuration
+		if v := c.Query("min_duration"); v != "" {
+			minDuration, err = time.ParseDuration(v)
+			if err != nil || minDuration <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "min_duration must be a positive duration such as 10m"})
+				return
+			}
+		}
+		var idling *bool
+		if v := c.Query("idling"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "idling must be true or false"})
+				return
+			}
+			idling = &b
+		}
+
+		rep, err := svc.GetStops(c.Request.Context(), vid, from, to, minDuration, idling)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to and the range at most 31 days"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rep)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TripSearchHandler searches trips by time range, vehicle, driver, group and
+// minimum distance or duration with sorting and cursor pagination
+func TripSearchHandler(svc *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, err := parseTimeRange(c, 24*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		q := service.TripSearch{
+			From:       from,
+			To:         to,
+			VehicleIDs: queryList(c, "vehicle_id"),
+			DriverID:   c.Query("driver_id"),
+			GroupID:    c.Query("group_id"),
+			Sort:       c.Query("sort"),
+			Cursor:     c.Query("cursor"),
+		}
+		if v := c.Query("min_distance"); v != "" {
+			if q.MinMileage, err = strconv.ParseFloat(v, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "min_distance must be a number of km"})
+				return
+			}
+		}
+		if v := c.Query("min_duration"); v != "" {
+			if q.MinDuration, err = time.ParseDuration(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "min_duration must be a duration such as 10m"})
+				return
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			if q.Limit, err = strconv.Atoi(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+				return
+			}
+		}
+
+		page, err := svc.SearchTrips(c.Request.Context(), q)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidSearch) || errors.Is(err, service.ErrInvalidRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// queryList reads a parameter given repeatedly or as a comma separated list
+func queryList(c *gin.Context, key string) []string {
+	var out []string
+	for _, v := range c.QueryArray(key) {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
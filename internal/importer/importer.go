@@ -0,0 +1,444 @@
+// Package importer reads historical telemetry from GPX tracks and CSV files
+// and turns every point into an ingest status, so imported history goes
+// through the same validation and storage as live reports.
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+)
+
+// Supported formats
+const (
+	FormatGPX = "gpx"
+	FormatCSV = "csv"
+)
+
+// Speed units accepted in CSV files
+const (
+	SpeedKmh = "kmh"
+	SpeedMS  = "ms"
+	SpeedMph = "mph"
+)
+
+// Mapping names the CSV columns holding each field. Only Timestamp, Lat and
+// Lon are required; VehicleID and PlateNumber fall back to the options.
+type Mapping struct {
+	VehicleID       string `json:"vehicle_id"`
+	PlateNumber     string `json:"plate_number"`
+	Timestamp       string `json:"timestamp"`
+	Lat             string `json:"lat"`
+	Lon             string `json:"lon"`
+	Speed           string `json:"speed"`
+	Heading         string `json:"heading"`
+	Ignition        string `json:"ignition"`
+	TimestampFormat string `json:"timestamp_format"` // rfc3339 (default), unix, unix_ms or a Go time layout
+	SpeedUnit       string `json:"speed_unit"`       // kmh (default), ms or mph
+	Delimiter       string `json:"delimiter"`        // defaults to ","
+}
+
+// DefaultMapping returns the column names used when none are configured
+func DefaultMapping() Mapping {
+	return Mapping{
+		VehicleID:   "vehicle_id",
+		PlateNumber: "plate_number",
+		Timestamp:   "timestamp",
+		Lat:         "lat",
+		Lon:         "lon",
+		Speed:       "speed",
+		Heading:     "heading",
+		Ignition:    "ignition",
+	}
+}
+
+// Options describe one import file
+type Options struct {
+	Format      string   `json:"format"`
+	VehicleID   string   `json:"vehicle_id,omitempty"`   // used when the file has no vehicle column
+	PlateNumber string   `json:"plate_number,omitempty"` // used when the file has no plate column
+	Mapping     *Mapping `json:"mapping,omitempty"`      // CSV only
+}
+
+// Record is one point of the file as an ingest payload
+type Record struct {
+	VehicleID   string
+	PlateNumber string
+	Status      map[string]interface{}
+}
+
+// RowError is a point that could not be read. Reading continues after it.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("row %d: %v", e.Row, e.Err) }
+
+func (e *RowError) Unwrap() error { return e.Err }
+
+// Read parses r and calls fn for every point in file order. Points that
+// cannot be read are passed to fn as a *RowError; any other error, including
+// one returned by fn, stops reading.
+func Read(r io.Reader, opts Options, fn func(Record, error) error) error {
+	switch opts.Format {
+	case FormatGPX:
+		return readGPX(r, opts, fn)
+	case FormatCSV:
+		return readCSV(r, opts, fn)
+	}
+	return fmt.Errorf("unsupported import format %q", opts.Format)
+}
+
+// FormatFromName guesses the format from a file name
+func FormatFromName(name string) string {
+	switch {
+	case strings.HasSuffix(strings.ToLower(name), ".gpx"):
+		return FormatGPX
+	case strings.HasSuffix(strings.ToLower(name), ".csv"):
+		return FormatCSV
+	}
+	return ""
+}
+
+func status(lon, lat float64, ts time.Time) (map[string]interface{}, error) {
+	if lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("coordinates out of range: %v, %v", lat, lon)
+	}
+	return map[string]interface{}{
+		"location":  []interface{}{lon, lat},
+		"timestamp": ts.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func readCSV(r io.Reader, opts Options, fn func(Record, error) error) error {
+	m := DefaultMapping()
+	if opts.Mapping != nil {
+		m = *opts.Mapping
+	}
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	cr.FieldsPerRecord = -1
+	if m.Delimiter != "" {
+		d := []rune(m.Delimiter)
+		if len(d) != 1 {
+			return fmt.Errorf("delimiter must be a single character")
+		}
+		cr.Comma = d[0]
+	}
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("read csv header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	index := func(name string, required bool) (int, error) {
+		if name == "" {
+			if required {
+				return -1, errors.New("mapping is missing a required column")
+			}
+			return -1, nil
+		}
+		i, ok := cols[name]
+		if !ok && required {
+			return -1, fmt.Errorf("column %q not found in csv header", name)
+		}
+		if !ok {
+			return -1, nil
+		}
+		return i, nil
+	}
+	var idx csvColumns
+	for _, f := range []struct {
+		dst      *int
+		name     string
+		required bool
+	}{
+		{&idx.vehicle, m.VehicleID, opts.VehicleID == ""},
+		{&idx.plate, m.PlateNumber, false},
+		{&idx.ts, m.Timestamp, true},
+		{&idx.lat, m.Lat, true},
+		{&idx.lon, m.Lon, true},
+		{&idx.speed, m.Speed, false},
+		{&idx.heading, m.Heading, false},
+		{&idx.ignition, m.Ignition, false},
+	} {
+		if *f.dst, err = index(f.name, f.required); err != nil {
+			return err
+		}
+	}
+	speedFactor, err := speedToKmh(m.SpeedUnit)
+	if err != nil {
+		return err
+	}
+
+	for row := 2; ; row++ {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			if err := fn(Record{}, &RowError{Row: row, Err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rec, err := idx.record(fields, m.TimestampFormat, speedFactor, opts)
+		if err != nil {
+			err = &RowError{Row: row, Err: err}
+		}
+		if err := fn(rec, err); err != nil {
+			return err
+		}
+	}
+}
+
+// csvColumns holds the index of each mapped column, -1 when absent
+type csvColumns struct {
+	vehicle, plate, ts, lat, lon, speed, heading, ignition int
+}
+
+func (c csvColumns) record(fields []string, tsFormat string, speedFactor float64, opts Options) (Record, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+	rec := Record{VehicleID: opts.VehicleID, PlateNumber: opts.PlateNumber}
+	if v := field(c.vehicle); v != "" {
+		rec.VehicleID = v
+	}
+	if v := field(c.plate); v != "" {
+		rec.PlateNumber = v
+	}
+
+	t, err := parseTime(field(c.ts), tsFormat)
+	if err != nil {
+		return rec, err
+	}
+	la, err := strconv.ParseFloat(field(c.lat), 64)
+	if err != nil {
+		return rec, fmt.Errorf("lat: %w", err)
+	}
+	lo, err := strconv.ParseFloat(field(c.lon), 64)
+	if err != nil {
+		return rec, fmt.Errorf("lon: %w", err)
+	}
+	if rec.Status, err = status(lo, la, t); err != nil {
+		return rec, err
+	}
+	if v := field(c.speed); v != "" {
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return rec, fmt.Errorf("speed: %w", err)
+		}
+		rec.Status["speed"] = round1(s * speedFactor)
+	}
+	if v := field(c.heading); v != "" {
+		h, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return rec, fmt.Errorf("heading: %w", err)
+		}
+		rec.Status["heading"] = h
+	}
+	if v := field(c.ignition); v != "" {
+		on, err := parseBool(v)
+		if err != nil {
+			return rec, fmt.Errorf("ignition: %w", err)
+		}
+		rec.Status["ignition"] = on
+	}
+	return rec, nil
+}
+
+func parseTime(v, format string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, errors.New("missing timestamp")
+	}
+	switch format {
+	case "", "rfc3339":
+		return time.Parse(time.RFC3339, v)
+	case "unix", "unix_ms":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("timestamp: %w", err)
+		}
+		if format == "unix_ms" {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	default:
+		return time.Parse(format, v)
+	}
+}
+
+func parseBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "on", "yes", "y":
+		return true, nil
+	case "off", "no", "n":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+func speedToKmh(unit string) (float64, error) {
+	switch unit {
+	case "", SpeedKmh:
+		return 1, nil
+	case SpeedMS:
+		return 3.6, nil
+	case SpeedMph:
+		return 1.609344, nil
+	}
+	return 0, fmt.Errorf("unknown speed unit %q", unit)
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// gpxPoint is a trkpt. GPX 1.0 <speed> and Garmin TrackPointExtension speeds
+// are in m/s; <fleet:speed> written by our own export is in km/h.
+type gpxPoint struct {
+	Lat    float64 `xml:"lat,attr"`
+	Lon    float64 `xml:"lon,attr"`
+	Time   string  `xml:"time"`
+	Speed  string  `xml:"speed"`
+	Course string  `xml:"course"`
+	Ext    gpxExt  `xml:"extensions"`
+}
+
+type gpxExt struct {
+	Inner []byte `xml:",innerxml"`
+}
+
+// values picks known speed and heading elements out of a trkpt's
+// extensions regardless of namespace prefix
+func (e gpxExt) values() (kmh, ms, heading string) {
+	d := xml.NewDecoder(strings.NewReader("<x>" + string(e.Inner) + "</x>"))
+	var cur xml.Name
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			cur = t.Name
+		case xml.EndElement:
+			cur = xml.Name{}
+		case xml.CharData:
+			v := strings.TrimSpace(string(t))
+			if v == "" {
+				continue
+			}
+			switch {
+			// innerxml drops namespace declarations, so Space is the prefix
+			case cur.Local == "speed" && strings.Contains(cur.Space, "fleet"):
+				kmh = v
+			case cur.Local == "speed":
+				ms = v
+			case cur.Local == "heading" || cur.Local == "course":
+				heading = v
+			}
+		}
+	}
+}
+
+func readGPX(r io.Reader, opts Options, fn func(Record, error) error) error {
+	if opts.VehicleID == "" {
+		return errors.New("vehicle_id is required for gpx imports")
+	}
+	d := xml.NewDecoder(r)
+	var prev *geo.Point
+	var prevTime time.Time
+	row := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read gpx: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "trkpt" {
+			continue
+		}
+		row++
+		var pt gpxPoint
+		if err := d.DecodeElement(&pt, &se); err != nil {
+			return fmt.Errorf("read gpx: %w", err)
+		}
+		rec, err := gpxRecord(pt, prev, prevTime, opts)
+		if err != nil {
+			err = &RowError{Row: row, Err: err}
+		} else {
+			p := geo.Point{Lat: pt.Lat, Lon: pt.Lon}
+			prev = &p
+			prevTime, _ = time.Parse(time.RFC3339, rec.Status["timestamp"].(string))
+		}
+		if err := fn(rec, err); err != nil {
+			return err
+		}
+	}
+}
+
+func gpxRecord(pt gpxPoint, prev *geo.Point, prevTime time.Time, opts Options) (Record, error) {
+	rec := Record{VehicleID: opts.VehicleID, PlateNumber: opts.PlateNumber}
+	if pt.Time == "" {
+		return rec, errors.New("trkpt has no time")
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(pt.Time))
+	if err != nil {
+		return rec, err
+	}
+	if rec.Status, err = status(pt.Lon, pt.Lat, t); err != nil {
+		return rec, err
+	}
+
+	kmh, ms, heading := pt.Ext.values()
+	if ms == "" {
+		ms = pt.Speed
+	}
+	if heading == "" {
+		heading = pt.Course
+	}
+	switch {
+	case kmh != "":
+		if v, err := strconv.ParseFloat(kmh, 64); err == nil {
+			rec.Status["speed"] = v
+		}
+	case ms != "":
+		if v, err := strconv.ParseFloat(ms, 64); err == nil {
+			rec.Status["speed"] = round1(v * 3.6)
+		}
+	case prev != nil && t.After(prevTime):
+		// Most trackers omit speed, so derive it from the previous point
+		d := geo.Distance(*prev, geo.Point{Lat: pt.Lat, Lon: pt.Lon})
+		rec.Status["speed"] = round1(d / t.Sub(prevTime).Seconds() * 3.6)
+	}
+	if heading != "" {
+		if v, err := strconv.ParseFloat(heading, 64); err == nil {
+			rec.Status["heading"] = v
+		}
+	}
+	return rec, nil
+}
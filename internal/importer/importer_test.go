@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, in string, opts Options) ([]Record, []*RowError) {
+	t.Helper()
+	var recs []Record
+	var rowErrs []*RowError
+	err := Read(strings.NewReader(in), opts, func(r Record, err error) error {
+		var re *RowError
+		if errors.As(err, &re) {
+			rowErrs = append(rowErrs, re)
+			return nil
+		}
+		require.NoError(t, err)
+		recs = append(recs, r)
+		return nil
+	})
+	require.NoError(t, err)
+	return recs, rowErrs
+}
+
+func TestReadCSVWithMapping(t *testing.T) {
+	in := "unit;time;latitude;longitude;mph;engine\n" +
+		"9b2f7c1e-6c55-4d7e-8f3e-0a1b2c3d4e5f;1718611200;25.2;55.27;10;on\n" +
+		"9b2f7c1e-6c55-4d7e-8f3e-0a1b2c3d4e5f;not-a-time;25.2;55.27;10;on\n" +
+		"9b2f7c1e-6c55-4d7e-8f3e-0a1b2c3d4e5f;1718611230;95;55.27;0;off\n"
+	opts := Options{Format: FormatCSV, PlateNumber: "DXB-1", Mapping: &Mapping{
+		VehicleID:       "unit",
+		Timestamp:       "time",
+		Lat:             "latitude",
+		Lon:             "longitude",
+		Speed:           "mph",
+		Ignition:        "engine",
+		TimestampFormat: "unix",
+		SpeedUnit:       SpeedMph,
+		Delimiter:       ";",
+	}}
+	recs, rowErrs := readAll(t, in, opts)
+
+	require.Len(t, recs, 1)
+	assert.Equal(t, "9b2f7c1e-6c55-4d7e-8f3e-0a1b2c3d4e5f", recs[0].VehicleID)
+	assert.Equal(t, "DXB-1", recs[0].PlateNumber)
+	assert.Equal(t, "2024-06-17T08:00:00Z", recs[0].Status["timestamp"])
+	assert.Equal(t, []interface{}{55.27, 25.2}, recs[0].Status["location"])
+	assert.Equal(t, 16.1, recs[0].Status["speed"])
+	assert.Equal(t, true, recs[0].Status["ignition"])
+
+	require.Len(t, rowErrs, 2)
+	assert.Equal(t, 3, rowErrs[0].Row)
+	assert.Equal(t, 4, rowErrs[1].Row)
+}
+
+func TestReadCSVMissingColumn(t *testing.T) {
+	err := Read(strings.NewReader("timestamp,lat\n"), Options{Format: FormatCSV, VehicleID: "x"}, func(Record, error) error { return nil })
+	assert.ErrorContains(t, err, `column "lon" not found`)
+}
+
+func TestReadGPX(t *testing.T) {
+	in := `<?xml version="1.0"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1" xmlns:fleet="https://github.com/sarandhanush/fleet-tracker-service/gpx/1">
+<trk><trkseg>
+<trkpt lat="25.2" lon="55.27"><time>2024-06-17T08:00:00Z</time><extensions><fleet:speed>42</fleet:speed><fleet:heading>90</fleet:heading></extensions></trkpt>
+<trkpt lat="25.2" lon="55.28"><time>2024-06-17T08:01:00Z</time></trkpt>
+<trkpt lat="25.2" lon="55.29"></trkpt>
+</trkseg></trk></gpx>`
+	recs, rowErrs := readAll(t, in, Options{Format: FormatGPX, VehicleID: "v"})
+
+	require.Len(t, recs, 2)
+	assert.Equal(t, 42.0, recs[0].Status["speed"])
+	assert.Equal(t, 90.0, recs[0].Status["heading"])
+	// About 1 km in a minute when the file has no speed
+	assert.InDelta(t, 60.5, recs[1].Status["speed"], 1)
+	require.Len(t, rowErrs, 1)
+	assert.Equal(t, 3, rowErrs[0].Row)
+}
@@ -0,0 +1,329 @@
+// Package mapmatch snaps GPS tracks to an in-memory road network built from
+// an OpenStreetMap extract
+package mapmatch
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/osm"
+)
+
+// routable lists the highway values vehicles drive on
+var routable = map[string]bool{
+	"motorway": true, "motorway_link": true, "trunk": true, "trunk_link": true,
+	"primary": true, "primary_link": true, "secondary": true, "secondary_link": true,
+	"tertiary": true, "tertiary_link": true, "unclassified": true, "residential": true,
+	"living_street": true, "service": true, "road": true,
+}
+
+// Road holds the attributes of the OSM way a segment belongs to
+type Road struct {
+	WayID   int64
+	Name    string
+	Ref     string
+	Highway string
+	Oneway  bool
+	// MaxSpeedKmh is the posted limit from the maxspeed tag, 0 when unknown
+	MaxSpeedKmh float64
+}
+
+// edge is one segment of a way between consecutive nodes. Oneway edges may
+// only be travelled from a to b.
+type edge struct {
+	a, b   int32
+	road   int32
+	length float64
+}
+
+// Graph is a road network with a grid index over its segments
+type Graph struct {
+	nodes []geo.Point
+	edges []edge
+	adj   [][]int32 // edges touching each node
+	roads []Road
+	grid  map[int64][]int32
+}
+
+// cellDeg is the size of a spatial index cell, about 550 m of latitude
+const cellDeg = 0.005
+
+func cellKey(x, y int32) int64 { return int64(y)<<32 | int64(uint32(x)) }
+
+func cellOf(p geo.Point) (x, y int32) {
+	return int32(math.Floor(p.Lon / cellDeg)), int32(math.Floor(p.Lat / cellDeg))
+}
+
+// Load builds a graph from the drivable roads of a PBF extract. The file is
+// read twice so only the coordinates of road nodes are kept in memory.
+func Load(path string) (*Graph, error) {
+	var ways []osm.Way
+	needed := map[int64][2]float64{}
+	if err := scanFile(path, osm.Handler{Way: func(w osm.Way) error {
+		if !routable[w.Tags["highway"]] || len(w.Nodes) < 2 {
+			return nil
+		}
+		ways = append(ways, osm.Way{ID: w.ID, Nodes: w.Nodes, Tags: roadTags(w.Tags)})
+		for _, id := range w.Nodes {
+			needed[id] = [2]float64{math.NaN(), math.NaN()}
+		}
+		return nil
+	}}); err != nil {
+		return nil, err
+	}
+	if err := scanFile(path, osm.Handler{Node: func(n osm.Node) error {
+		if _, ok := needed[n.ID]; ok {
+			needed[n.ID] = [2]float64{n.Lon, n.Lat}
+		}
+		return nil
+	}}); err != nil {
+		return nil, err
+	}
+	return Build(ways, needed), nil
+}
+
+func scanFile(path string, h osm.Handler) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := osm.Scan(f, h); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// roadTags keeps only the tags the graph uses to save memory on large extracts
+func roadTags(tags map[string]string) map[string]string {
+	out := map[string]string{}
+	for _, k := range []string{"highway", "name", "ref", "oneway", "junction", "maxspeed"} {
+		if v, ok := tags[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Build creates a graph from ways and the [lon, lat] of their nodes. Ways
+// that are not drivable roads and nodes without coordinates are skipped.
+func Build(ways []osm.Way, coords map[int64][2]float64) *Graph {
+	g := &Graph{grid: map[int64][]int32{}}
+	index := map[int64]int32{}
+	node := func(id int64) (int32, bool) {
+		if i, ok := index[id]; ok {
+			return i, true
+		}
+		c, ok := coords[id]
+		if !ok || math.IsNaN(c[0]) {
+			return 0, false
+		}
+		i := int32(len(g.nodes))
+		index[id] = i
+		g.nodes = append(g.nodes, geo.FromLonLat(c))
+		g.adj = append(g.adj, nil)
+		return i, true
+	}
+
+	for _, w := range ways {
+		if !routable[w.Tags["highway"]] {
+			continue
+		}
+		refs := w.Nodes
+		oneway := false
+		switch w.Tags["oneway"] {
+		case "yes", "true", "1":
+			oneway = true
+		case "-1", "reverse":
+			oneway = true
+			refs = make([]int64, len(w.Nodes))
+			for i, id := range w.Nodes {
+				refs[len(refs)-1-i] = id
+			}
+		case "no", "false", "0":
+		default:
+			oneway = w.Tags["highway"] == "motorway" || w.Tags["junction"] == "roundabout"
+		}
+		road := int32(len(g.roads))
+		maxspeed, _ := ParseMaxSpeed(w.Tags["maxspeed"])
+		g.roads = append(g.roads, Road{
+			WayID:       w.ID,
+			Name:        w.Tags["name"],
+			Ref:         w.Tags["ref"],
+			Highway:     w.Tags["highway"],
+			Oneway:      oneway,
+			MaxSpeedKmh: maxspeed,
+		})
+		prev, havePrev := int32(0), false
+		for _, id := range refs {
+			cur, ok := node(id)
+			if !ok {
+				havePrev = false
+				continue
+			}
+			if havePrev && cur != prev {
+				g.addEdge(edge{a: prev, b: cur, road: road, length: geo.Distance(g.nodes[prev], g.nodes[cur])})
+			}
+			prev, havePrev = cur, true
+		}
+	}
+	return g
+}
+
+func (g *Graph) addEdge(e edge) {
+	id := int32(len(g.edges))
+	g.edges = append(g.edges, e)
+	g.adj[e.a] = append(g.adj[e.a], id)
+	g.adj[e.b] = append(g.adj[e.b], id)
+
+	x1, y1 := cellOf(g.nodes[e.a])
+	x2, y2 := cellOf(g.nodes[e.b])
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	for x := x1; x <= x2; x++ {
+		for y := y1; y <= y2; y++ {
+			k := cellKey(x, y)
+			g.grid[k] = append(g.grid[k], id)
+		}
+	}
+}
+
+// Stats reports the size of the graph
+func (g *Graph) Stats() (nodes, edges, roads int) {
+	return len(g.nodes), len(g.edges), len(g.roads)
+}
+
+// candidate is the projection of a fix onto a nearby segment
+type candidate struct {
+	edge  int32
+	t     float64 // position along the edge from a (0) to b (1)
+	point geo.Point
+	dist  float64 // metres from the fix
+}
+
+// candidates returns the closest point on each segment within radius of p,
+// nearest first, at most max of them
+func (g *Graph) candidates(p geo.Point, radius float64, max int) []candidate {
+	dLat := radius / 111320
+	dLon := radius / (111320 * math.Max(math.Cos(p.Lat*math.Pi/180), 0.01))
+	x1, y1 := cellOf(geo.Point{Lat: p.Lat - dLat, Lon: p.Lon - dLon})
+	x2, y2 := cellOf(geo.Point{Lat: p.Lat + dLat, Lon: p.Lon + dLon})
+
+	seen := map[int32]bool{}
+	var out []candidate
+	for x := x1; x <= x2; x++ {
+		for y := y1; y <= y2; y++ {
+			for _, id := range g.grid[cellKey(x, y)] {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				e := g.edges[id]
+				t, q := project(p, g.nodes[e.a], g.nodes[e.b])
+				if d := geo.Distance(p, q); d <= radius {
+					out = append(out, candidate{edge: id, t: t, point: q, dist: d})
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].dist < out[j].dist })
+	if len(out) > max {
+		out = out[:max]
+	}
+	return out
+}
+
+// project returns the closest point to p on segment ab and its fraction along
+// the segment, using a local plane around p
+func project(p, a, b geo.Point) (float64, geo.Point) {
+	k := math.Cos(p.Lat * math.Pi / 180)
+	ax, ay := (a.Lon-p.Lon)*k, a.Lat-p.Lat
+	bx, by := (b.Lon-p.Lon)*k, b.Lat-p.Lat
+	dx, dy := bx-ax, by-ay
+	l2 := dx*dx + dy*dy
+	t := 0.0
+	if l2 > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l2))
+	}
+	return t, geo.Interpolate(a, b, t)
+}
+
+// NearestRoad returns the closest road with a name or ref within radius
+// metres of p and its distance
+func (g *Graph) NearestRoad(p geo.Point, radius float64) (Road, float64, bool) {
+	for _, c := range g.candidates(p, radius, 20) {
+		if r := g.roads[g.edges[c.edge].road]; r.Name != "" || r.Ref != "" {
+			return r, c.dist, true
+		}
+	}
+	return Road{}, 0, false
+}
+
+// ParseMaxSpeed reads an OSM maxspeed value in km/h. Plain numbers are km/h,
+// "mph" and "knots" suffixes are converted and of several values separated
+// by ";" the lowest applies. Values without a number ("none", "signals",
+// "AE:urban") are not known limits.
+func ParseMaxSpeed(v string) (float64, bool) {
+	best, ok := 0.0, false
+	for _, part := range strings.Split(v, ";") {
+		f := strings.Fields(strings.TrimSpace(part))
+		if len(f) == 0 || len(f) > 2 {
+			continue
+		}
+		n, err := strconv.ParseFloat(f[0], 64)
+		if err != nil || n <= 0 {
+			continue
+		}
+		if len(f) == 2 {
+			switch f[1] {
+			case "mph":
+				n *= 1.609344
+			case "knots":
+				n *= 1.852
+			case "km/h", "kmh", "kph":
+			default:
+				continue
+			}
+		}
+		if !ok || n < best {
+			best, ok = n, true
+		}
+	}
+	return best, ok
+}
+
+// maxHeadingDiff is how far a vehicle's heading may be from a road's
+// direction for it to be driving on that road
+const maxHeadingDiff = 45
+
+// RoadAt returns the road a vehicle at p is most likely driving on and its
+// distance: the closest within radius metres whose direction matches the
+// heading, when one is known. Oneway roads only match in their direction,
+// so a service road or opposite carriageway next to a highway is not
+// mistaken for it.
+func (g *Graph) RoadAt(p geo.Point, heading *float64, radius float64) (Road, float64, bool) {
+	for _, c := range g.candidates(p, radius, 20) {
+		e := g.edges[c.edge]
+		r := g.roads[e.road]
+		if heading != nil {
+			d := math.Abs(math.Mod(*heading-geo.Bearing(g.nodes[e.a], g.nodes[e.b])+540, 360) - 180)
+			if !r.Oneway {
+				d = math.Min(d, 180-d)
+			}
+			if d > maxHeadingDiff {
+				continue
+			}
+		}
+		return r, c.dist, true
+	}
+	return Road{}, 0, false
+}
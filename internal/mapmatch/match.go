@@ -0,0 +1,338 @@
+package mapmatch
+
+import (
+	"container/heap"
+	"math"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+)
+
+// Params tunes the hidden Markov model used for matching
+type Params struct {
+	SigmaM        float64 // standard deviation of GPS noise
+	BetaM         float64 // how much longer than the straight line a route between fixes usually is
+	RadiusM       float64 // roads further than this from a fix are not considered
+	MaxCandidates int     // closest road segments considered per fix
+}
+
+// DefaultParams returns parameters suited to fixes every few seconds to a minute
+func DefaultParams() Params {
+	return Params{SigmaM: 10, BetaM: 50, RadiusM: 50, MaxCandidates: 5}
+}
+
+// Fix is a GPS position to match
+type Fix struct {
+	Point geo.Point
+	Time  time.Time
+}
+
+// RoadSegment is a stretch of the matched path along one road
+type RoadSegment struct {
+	Name      string
+	Ref       string
+	Highway   string
+	DistanceM float64
+	Start     time.Time // time of the fix before the road was entered
+	End       time.Time // time of the first fix after it was left
+}
+
+// Result is a track snapped to the road network
+type Result struct {
+	Geometry  []geo.Point
+	DistanceM float64
+	Roads     []RoadSegment
+	Matched   int // fixes snapped to a road; fixes within 2 sigma of the previous one are skipped
+	Unmatched int // fixes with no road within the radius
+	Breaks    int // places where no route connected consecutive fixes
+}
+
+// Match finds the most likely sequence of roads for fixes in time order with
+// the Viterbi algorithm. Fixes with no road nearby are skipped; where no
+// route connects two fixes the match restarts and the gap is bridged with a
+// straight line.
+func (g *Graph) Match(fixes []Fix, p Params) Result {
+	var res Result
+	type layer struct {
+		fix   Fix
+		cands []candidate
+		score []float64
+		from  []int
+	}
+	var chain []layer
+	var last *geo.Point
+
+	flush := func() {
+		if len(chain) == 0 {
+			return
+		}
+		// Backtrack the best path through the chain
+		best := 0
+		end := chain[len(chain)-1]
+		for j := range end.cands {
+			if end.score[j] > end.score[best] {
+				best = j
+			}
+		}
+		picks := make([]int, len(chain))
+		for i := len(chain) - 1; i >= 0; i-- {
+			picks[i] = best
+			best = chain[i].from[best]
+		}
+
+		first := chain[0].cands[picks[0]].point
+		if last != nil {
+			res.DistanceM += geo.Distance(*last, first)
+		}
+		res.Geometry = append(res.Geometry, first)
+		for i := 1; i < len(chain); i++ {
+			from, to := chain[i-1], chain[i]
+			g.appendRoute(&res, from.cands[picks[i-1]], to.cands[picks[i]], from.fix, to.fix, p)
+		}
+		end0 := res.Geometry[len(res.Geometry)-1]
+		last = &end0
+		res.Matched += len(chain)
+		chain = nil
+	}
+
+	var prevKept *Fix
+	for i, f := range fixes {
+		// Dense fixes closer than the noise add nothing but noise
+		if prevKept != nil && i < len(fixes)-1 && geo.Distance(prevKept.Point, f.Point) < 2*p.SigmaM {
+			continue
+		}
+		cands := g.candidates(f.Point, p.RadiusM, p.MaxCandidates)
+		if len(cands) == 0 {
+			res.Unmatched++
+			continue
+		}
+		fix := f
+		prevKept = &fix
+
+		l := layer{fix: f, cands: cands, score: make([]float64, len(cands)), from: make([]int, len(cands))}
+		for j, c := range cands {
+			l.score[j] = emission(c.dist, p)
+		}
+		if len(chain) == 0 {
+			chain = append(chain, l)
+			continue
+		}
+
+		prev := chain[len(chain)-1]
+		straight := geo.Distance(prev.fix.Point, f.Point)
+		limit := routeLimit(straight)
+		for j := range l.score {
+			l.score[j], l.from[j] = math.Inf(-1), 0
+		}
+		for k, pc := range prev.cands {
+			if math.IsInf(prev.score[k], -1) {
+				continue
+			}
+			tree := g.search(pc, limit)
+			for j, c := range cands {
+				d, _, ok := tree.to(c, p)
+				if !ok {
+					continue
+				}
+				s := prev.score[k] + transition(d, straight, p) + emission(c.dist, p)
+				if s > l.score[j] {
+					l.score[j], l.from[j] = s, k
+				}
+			}
+		}
+
+		reachable := false
+		for _, s := range l.score {
+			reachable = reachable || !math.IsInf(s, -1)
+		}
+		if !reachable {
+			flush()
+			res.Breaks++
+			for j, c := range cands {
+				l.score[j] = emission(c.dist, p)
+			}
+		}
+		chain = append(chain, l)
+	}
+	flush()
+	return res
+}
+
+// routeLimit is the longest route considered between fixes straight metres
+// apart; longer detours are treated as unconnected
+func routeLimit(straight float64) float64 {
+	return 2*straight + 500
+}
+
+// emission is the log likelihood of a fix at dist metres from the road
+func emission(dist float64, p Params) float64 {
+	z := dist / p.SigmaM
+	return -0.5 * z * z
+}
+
+// transition is the log likelihood of driving route metres between fixes
+// straight metres apart
+func transition(route, straight float64, p Params) float64 {
+	return -math.Abs(route-straight) / p.BetaM
+}
+
+// appendRoute adds the path from a to b to the result geometry, distance and
+// road segments
+func (g *Graph) appendRoute(res *Result, a, b candidate, from, to Fix, p Params) {
+	start, end := from.Time, to.Time
+	d, path, ok := g.search(a, routeLimit(geo.Distance(from.Point, to.Point))).to(b, p)
+	if !ok {
+		return
+	}
+	type piece struct {
+		road int32
+		to   geo.Point
+		len  float64
+	}
+	var pieces []piece
+	if len(path) == 0 {
+		pieces = append(pieces, piece{g.edges[a.edge].road, b.point, d})
+	} else {
+		at := a.point
+		prevNode := int32(-1)
+		for i, n := range path {
+			road := g.edges[a.edge].road
+			if i > 0 {
+				road = g.edges[g.edgeBetween(prevNode, n)].road
+			}
+			pt := g.nodes[n]
+			pieces = append(pieces, piece{road, pt, geo.Distance(at, pt)})
+			at, prevNode = pt, n
+		}
+		pieces = append(pieces, piece{g.edges[b.edge].road, b.point, geo.Distance(at, b.point)})
+	}
+
+	for _, pc := range pieces {
+		if pc.len == 0 {
+			continue
+		}
+		res.Geometry = append(res.Geometry, pc.to)
+		res.DistanceM += pc.len
+		r := g.roads[pc.road]
+		if n := len(res.Roads); n > 0 && res.Roads[n-1].Name == r.Name && res.Roads[n-1].Ref == r.Ref &&
+			res.Roads[n-1].Highway == r.Highway {
+			res.Roads[n-1].DistanceM += pc.len
+			res.Roads[n-1].End = end
+			continue
+		}
+		res.Roads = append(res.Roads, RoadSegment{
+			Name: r.Name, Ref: r.Ref, Highway: r.Highway, DistanceM: pc.len, Start: start, End: end,
+		})
+	}
+}
+
+// edgeBetween returns the edge connecting two adjacent nodes
+func (g *Graph) edgeBetween(u, v int32) int32 {
+	best, bestLen := int32(-1), math.Inf(1)
+	for _, id := range g.adj[u] {
+		e := g.edges[id]
+		if (e.a == u && e.b == v || e.b == u && e.a == v) && e.length < bestLen {
+			best, bestLen = id, e.length
+		}
+	}
+	return best
+}
+
+// tree holds shortest network distances from a candidate to nearby nodes
+type tree struct {
+	g    *Graph
+	src  candidate
+	dist map[int32]float64
+	prev map[int32]int32
+}
+
+// search runs Dijkstra from a candidate until distances exceed limit
+func (g *Graph) search(src candidate, limit float64) *tree {
+	t := &tree{g: g, src: src, dist: map[int32]float64{}, prev: map[int32]int32{}}
+	e := g.edges[src.edge]
+	q := &queue{}
+	push := func(n int32, d float64, from int32) {
+		if old, ok := t.dist[n]; ok && old <= d {
+			return
+		}
+		t.dist[n] = d
+		t.prev[n] = from
+		heap.Push(q, item{n, d})
+	}
+	push(e.b, (1-src.t)*e.length, -1)
+	if !g.roads[e.road].Oneway {
+		push(e.a, src.t*e.length, -1)
+	}
+	for q.Len() > 0 {
+		it := heap.Pop(q).(item)
+		if it.d > t.dist[it.node] || it.d > limit {
+			continue
+		}
+		for _, id := range g.adj[it.node] {
+			ed := g.edges[id]
+			switch {
+			case ed.a == it.node:
+				push(ed.b, it.d+ed.length, it.node)
+			case !g.roads[ed.road].Oneway:
+				push(ed.a, it.d+ed.length, it.node)
+			}
+		}
+	}
+	return t
+}
+
+// to returns the network distance from the tree's source to dst and the
+// nodes passed on the way
+func (t *tree) to(dst candidate, p Params) (float64, []int32, bool) {
+	g := t.g
+	e := g.edges[dst.edge]
+	oneway := g.roads[e.road].Oneway
+	best, via := math.Inf(1), int32(-1)
+	if dst.edge == t.src.edge {
+		back := (t.src.t - dst.t) * e.length
+		switch {
+		case back <= 0:
+			best = -back
+		case !oneway:
+			best = back
+		case back <= 2*p.SigmaM:
+			// Noise can place a slow vehicle slightly behind itself
+			best = 0
+		}
+	}
+	if d, ok := t.dist[e.a]; ok && d+dst.t*e.length < best {
+		best, via = d+dst.t*e.length, e.a
+	}
+	if d, ok := t.dist[e.b]; ok && !oneway && d+(1-dst.t)*e.length < best {
+		best, via = d+(1-dst.t)*e.length, e.b
+	}
+	if math.IsInf(best, 1) {
+		return 0, nil, false
+	}
+	var path []int32
+	for n := via; n != -1; n = t.prev[n] {
+		path = append(path, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return best, path, true
+}
+
+type item struct {
+	node int32
+	d    float64
+}
+
+type queue []item
+
+func (q queue) Len() int            { return len(q) }
+func (q queue) Less(i, j int) bool  { return q[i].d < q[j].d }
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x interface{}) { *q = append(*q, x.(item)) }
+func (q *queue) Pop() interface{} {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,172 @@
+package mapmatch
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/osm"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNetwork is an L-shaped route: 1 km east along Sheikh Zayed Road, then
+// 1 km north along Al Khail Road. A service road runs parallel 30 m north of
+// the first 400 m and joins it at both ends; a footway leads off the corner.
+func testNetwork() (*Graph, geo.Point, geo.Point) {
+	origin := geo.Point{Lat: 25.2, Lon: 55.27}
+	corner := geo.Destination(origin, 90, 1000)
+	coords := map[int64][2]float64{}
+	var szr, khail []int64
+	for i := 0; i <= 10; i++ {
+		coords[int64(100+i)] = geo.Destination(origin, 90, float64(i*100)).LonLat()
+		szr = append(szr, int64(100+i))
+	}
+	khail = append(khail, 110)
+	for i := 1; i <= 10; i++ {
+		coords[int64(200+i)] = geo.Destination(corner, 0, float64(i*100)).LonLat()
+		khail = append(khail, int64(200+i))
+	}
+	coords[301] = geo.Destination(origin, 0, 30).LonLat()
+	coords[302] = geo.Destination(geo.Destination(origin, 90, 400), 0, 30).LonLat()
+	coords[401] = geo.Destination(corner, 180, 300).LonLat()
+
+	ways := []osm.Way{
+		{ID: 1, Nodes: szr, Tags: map[string]string{"highway": "primary", "name": "Sheikh Zayed Road", "ref": "E11"}},
+		{ID: 2, Nodes: khail, Tags: map[string]string{"highway": "secondary", "name": "Al Khail Road"}},
+		{ID: 3, Nodes: []int64{100, 301, 302, 104}, Tags: map[string]string{"highway": "service", "name": "Service Road"}},
+		{ID: 4, Nodes: []int64{110, 401}, Tags: map[string]string{"highway": "footway"}},
+	}
+	return Build(ways, coords), origin, corner
+}
+
+func TestBuild(t *testing.T) {
+	g, _, _ := testNetwork()
+	nodes, edges, roads := g.Stats()
+	assert.Equal(t, 23, nodes, "footway nodes are left out")
+	assert.Equal(t, 23, edges)
+	assert.Equal(t, 3, roads)
+}
+
+func TestMatch(t *testing.T) {
+	g, origin, corner := testNetwork()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+
+	var fixes []Fix
+	add := func(p geo.Point) {
+		fixes = append(fixes, Fix{Point: p, Time: start.Add(time.Duration(len(fixes)) * 10 * time.Second)})
+	}
+	for i := 0; i < 10; i++ {
+		p := geo.Destination(origin, 90, float64(i*100+50))
+		offset := -8.0
+		if i == 2 {
+			offset = 16 // closer to the service road, but switching would be a detour
+		}
+		add(geo.Destination(p, 0, offset))
+	}
+	// Cut the corner
+	add(geo.Destination(geo.Destination(corner, 270, 30), 0, 30))
+	for i := 1; i <= 9; i++ {
+		add(geo.Destination(geo.Destination(corner, 0, float64(i*100+50)), 90, 6))
+	}
+	// A fix far from any road
+	add(geo.Destination(corner, 45, 5000))
+
+	res := g.Match(fixes, DefaultParams())
+	assert.Equal(t, 20, res.Matched)
+	assert.Equal(t, 1, res.Unmatched)
+	assert.Equal(t, 0, res.Breaks)
+	assert.InDelta(t, 1900, res.DistanceM, 5, "from the first to the last matched fix along the roads")
+
+	require.Len(t, res.Roads, 2)
+	assert.Equal(t, "Sheikh Zayed Road", res.Roads[0].Name)
+	assert.Equal(t, "E11", res.Roads[0].Ref)
+	assert.InDelta(t, 950, res.Roads[0].DistanceM, 5)
+	assert.Equal(t, start, res.Roads[0].Start)
+	assert.Equal(t, "Al Khail Road", res.Roads[1].Name)
+	assert.InDelta(t, 950, res.Roads[1].DistanceM, 5)
+	assert.Equal(t, fixes[19].Time, res.Roads[1].End)
+
+	for _, p := range res.Geometry {
+		onRoad := p.Lat <= origin.Lat+1e-6 || p.Lon >= corner.Lon-1e-6
+		assert.True(t, onRoad, "%v is off the matched roads", p)
+	}
+}
+
+func TestMatchRespectsOneway(t *testing.T) {
+	origin := geo.Point{Lat: 25.2, Lon: 55.27}
+	coords := map[int64][2]float64{
+		1: origin.LonLat(),
+		2: geo.Destination(origin, 90, 500).LonLat(),
+	}
+	g := Build([]osm.Way{{ID: 1, Nodes: []int64{1, 2}, Tags: map[string]string{"highway": "primary", "oneway": "-1"}}}, coords)
+
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	westbound := []Fix{
+		{Point: geo.Destination(origin, 90, 400), Time: start},
+		{Point: geo.Destination(origin, 90, 100), Time: start.Add(30 * time.Second)},
+	}
+	res := g.Match(westbound, DefaultParams())
+	assert.Equal(t, 0, res.Breaks)
+	assert.InDelta(t, 300, res.DistanceM, 1)
+
+	eastbound := []Fix{westbound[1], {Point: westbound[0].Point, Time: start.Add(time.Minute)}}
+	res = g.Match(eastbound, DefaultParams())
+	assert.Equal(t, 1, res.Breaks, "driving against a oneway road is not a route")
+}
+
+func TestParseMaxSpeed(t *testing.T) {
+	for v, want := range map[string]float64{
+		"50":       50,
+		"30 mph":   48.28,
+		"10 knots": 18.52,
+		"80;60":    60,
+		"100 km/h": 100,
+	} {
+		got, ok := ParseMaxSpeed(v)
+		assert.True(t, ok, v)
+		assert.InDelta(t, want, got, 0.01, v)
+	}
+	for _, v := range []string{"", "none", "signals", "RU:urban", "0", "50 furlongs"} {
+		_, ok := ParseMaxSpeed(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestRoadAt(t *testing.T) {
+	// an 80 km/h road running east crossed by a 30 km/h street running north
+	origin := geo.Point{Lat: 25.2, Lon: 55.27}
+	cross := geo.Destination(origin, 90, 500)
+	coords := map[int64][2]float64{
+		1: origin.LonLat(),
+		2: cross.LonLat(),
+		3: geo.Destination(origin, 90, 1000).LonLat(),
+		4: geo.Destination(cross, 180, 500).LonLat(),
+		5: geo.Destination(cross, 0, 500).LonLat(),
+	}
+	g := Build([]osm.Way{
+		{ID: 1, Nodes: []int64{1, 2, 3}, Tags: map[string]string{"highway": "primary", "name": "Main Road", "maxspeed": "80"}},
+		{ID: 2, Nodes: []int64{4, 2, 5}, Tags: map[string]string{"highway": "residential", "name": "School Lane", "maxspeed": "30"}},
+	}, coords)
+
+	// 15 m north of the road, 5 m east of the street
+	p := geo.Destination(geo.Destination(cross, 0, 15), 90, 5)
+	r, dist, ok := g.RoadAt(p, nil, 50)
+	require.True(t, ok)
+	assert.Equal(t, "School Lane", r.Name, "without a heading the closest road wins")
+	assert.InDelta(t, 5, dist, 1)
+
+	east := 92.0
+	r, _, ok = g.RoadAt(p, &east, 50)
+	require.True(t, ok)
+	assert.Equal(t, "Main Road", r.Name)
+	assert.Equal(t, 80.0, r.MaxSpeedKmh)
+
+	west := 270.0
+	r, _, _ = g.RoadAt(p, &west, 50)
+	assert.Equal(t, "Main Road", r.Name, "two-way roads match either direction")
+
+	_, _, ok = g.RoadAt(geo.Destination(origin, 0, 200), nil, 50)
+	assert.False(t, ok)
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Domain event types written to the outbox
+const (
+	EventPositionRecorded  = "PositionRecorded"
+	EventTripStarted       = "TripStarted"
+	EventTripCompleted     = "TripCompleted"
+	EventVehicleRegistered = "VehicleRegistered"
+	EventMetersCalibrated  = "MetersCalibrated"
+	EventMaintenanceDue    = "MaintenanceDue"
+	EventFuelRefuelled     = "FuelRefuelled"
+	EventFuelDropDetected  = "FuelDropDetected"
+	EventCriticalDTC       = "CriticalDTCDetected"
+	EventJobStatusChanged  = "JobStatusChanged"
+	EventRouteDeviation    = "RouteDeviation"
+	EventPOIArrived        = "POIArrived"
+	EventPOIDeparted       = "POIDeparted"
+	EventHOSWarning        = "HOSWarning"
+)
+
+// Event is a domain event stored in the outbox and published to the event bus
+type Event struct {
+	ID          uuid.UUID       `db:"id" json:"id"`
+	Type        string          `db:"event_type" json:"type"`
+	AggregateID uuid.UUID       `db:"aggregate_id" json:"aggregate_id"`
+	OccurredAt  time.Time       `db:"occurred_at" json:"occurred_at"`
+	Payload     json.RawMessage `db:"payload" json:"payload"`
+}
+
+// NewEvent builds an event for the given vehicle with payload encoded as JSON
+func NewEvent(eventType string, vehicleID uuid.UUID, payload interface{}) (Event, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:          uuid.New(),
+		Type:        eventType,
+		AggregateID: vehicleID,
+		OccurredAt:  time.Now().UTC(),
+		Payload:     b,
+	}, nil
+}
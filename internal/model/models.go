@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,6 +13,21 @@ type Vehicle struct {
 	LastStatus  VehicleStatus `db:"last_status" json:"last_status"`
 }
 
+// Group is a named set of vehicles, such as a depot or a customer account
+type Group struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Driver is a person who drives fleet vehicles
+type Driver struct {
+	ID            uuid.UUID `db:"id" json:"id"`
+	Name          string    `db:"name" json:"name"`
+	LicenseNumber string    `db:"license_number" json:"license_number,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
 type VehicleStatus struct {
 	Location  [2]float64 `json:"location"`
 	Speed     float64    `json:"speed"`
@@ -19,15 +35,681 @@ type VehicleStatus struct {
 }
 
 type Trip struct {
-	ID        uuid.UUID `db:"id" json:"id"`
-	VehicleID uuid.UUID `db:"vehicle_id" json:"vehicle_id"`
-	StartTime time.Time `db:"start_time" json:"start_time"`
-	EndTime   time.Time `db:"end_time" json:"end_time"`
-	Mileage   float64   `db:"mileage" json:"mileage"`
-	AvgSpeed  float64   `db:"avg_speed" json:"avg_speed"`
+	ID            uuid.UUID   `db:"id" json:"id"`
+	VehicleID     uuid.UUID   `db:"vehicle_id" json:"vehicle_id"`
+	StartTime     time.Time   `db:"start_time" json:"start_time"`
+	EndTime       time.Time   `db:"end_time" json:"end_time"`
+	Mileage       float64     `db:"mileage" json:"mileage"`
+	AvgSpeed      float64     `db:"avg_speed" json:"avg_speed"`
+	InProgress    bool        `db:"in_progress" json:"in_progress"`
+	DriverID      *uuid.UUID  `db:"driver_id" json:"driver_id,omitempty"`
+	StartLocation *[2]float64 `json:"start_location,omitempty"` // lon, lat
+	EndLocation   *[2]float64 `json:"end_location,omitempty"`
+	StartAddress  *Address    `json:"start_address,omitempty"`
+	EndAddress    *Address    `json:"end_address,omitempty"`
+}
+
+// Address is the result of reverse geocoding a position
+type Address struct {
+	Label       string `json:"label"` // e.g. "Sheikh Zayed Road, Al Barsha, Dubai"
+	HouseNumber string `json:"house_number,omitempty"`
+	Road        string `json:"road,omitempty"`
+	Suburb      string `json:"suburb,omitempty"`
+	City        string `json:"city,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+}
+
+// OpenTrip is a trip still being extended by incoming fixes together with
+// the state segmentation needs to continue it
+type OpenTrip struct {
+	Trip
+	LastFixAt    time.Time
+	LastMovingAt time.Time
+	LastLocation [2]float64 // lon, lat of the last moving fix
+}
+
+// Position is a single stored GPS fix
+type Position struct {
+	VehicleID uuid.UUID  `db:"vehicle_id" json:"vehicle_id"`
+	Location  [2]float64 `json:"location"` // lon, lat
+	Speed     float64    `db:"speed" json:"speed"`
+	Heading   *float64   `db:"heading" json:"heading,omitempty"`
+	Ignition  *bool      `db:"ignition" json:"ignition,omitempty"`
+	Timestamp time.Time  `db:"recorded_at" json:"timestamp"`
+}
+
+// Reasons a fix is rejected by the ingest filter
+const (
+	RejectNullIsland    = "null_island"
+	RejectLowSatellites = "low_satellites"
+	RejectLowAccuracy   = "low_accuracy"
+	RejectReportedSpeed = "reported_speed"
+	RejectImpliedSpeed  = "implied_speed"
+)
+
+// RejectedPosition is a fix the ingest filter dropped
+type RejectedPosition struct {
+	ID         int64      `db:"id" json:"id"`
+	VehicleID  uuid.UUID  `db:"vehicle_id" json:"vehicle_id"`
+	Location   [2]float64 `json:"location"` // lon, lat
+	Speed      float64    `db:"speed" json:"speed"`
+	Accuracy   *float64   `db:"accuracy" json:"accuracy,omitempty"`
+	Satellites *int       `db:"satellites" json:"satellites,omitempty"`
+	Timestamp  time.Time  `db:"recorded_at" json:"timestamp"`
+	ReceivedAt time.Time  `db:"received_at" json:"received_at"`
+	Reason     string     `db:"reason" json:"reason"`
+	Detail     string     `db:"detail" json:"detail,omitempty"`
+}
+
+// FilterState is the Kalman smoothing state of a vehicle's position
+type FilterState struct {
+	Location [2]float64 // lon, lat
+	Variance float64    // m²
+	FixAt    time.Time
+}
+
+// Stop is a period where a vehicle stayed within a small radius
+type Stop struct {
+	ID              *uuid.UUID `db:"id" json:"id,omitempty"`
+	VehicleID       uuid.UUID  `db:"vehicle_id" json:"vehicle_id"`
+	Location        [2]float64 `json:"location"` // lon, lat
+	Arrival         time.Time  `db:"arrival" json:"arrival"`
+	Departure       time.Time  `db:"departure" json:"departure"`
+	DurationSeconds float64    `db:"duration_seconds" json:"duration_seconds"`
+	IdleSeconds     float64    `db:"idle_seconds" json:"idle_seconds"`
+	Idling          bool       `db:"idling" json:"idling"` // ignition on for at least half the stop
+	InProgress      bool       `db:"in_progress" json:"in_progress,omitempty"`
+	Address         *Address   `json:"address,omitempty"`
+}
+
+// OpenStop is a stop still being extended by incoming fixes
+type OpenStop struct {
+	Stop
+	Anchor       [2]float64 // first fix; later fixes must stay within the radius
+	SumLon       float64
+	SumLat       float64
+	Fixes        int
+	LastFixAt    time.Time
+	LastIgnition *bool
 }
 
 type IngestData struct {
 	VehicleID uuid.UUID     `json:"vehicle_id"`
 	Status    VehicleStatus `json:"status"`
 }
+
+// Import job states
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportJob tracks a background import of historical telemetry
+type ImportJob struct {
+	ID         uuid.UUID       `db:"id" json:"id"`
+	Format     string          `db:"format" json:"format"`
+	FileName   string          `db:"file_name" json:"file_name"`
+	Checksum   string          `db:"checksum" json:"checksum"`
+	VehicleID  *uuid.UUID      `db:"vehicle_id" json:"vehicle_id,omitempty"`
+	Options    json.RawMessage `db:"options" json:"options"`
+	Status     string          `db:"status" json:"status"`
+	SizeBytes  int64           `db:"size_bytes" json:"size_bytes"`
+	ReadBytes  int64           `db:"read_bytes" json:"read_bytes"`
+	Processed  int64           `db:"processed" json:"processed"`
+	Imported   int64           `db:"imported" json:"imported"`
+	Duplicates int64           `db:"duplicates" json:"duplicates"`
+	Rejected   int64           `db:"rejected" json:"rejected"`
+	Failed     int64           `db:"failed" json:"failed"`
+	Error      string          `db:"error" json:"error,omitempty"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+	FinishedAt *time.Time      `db:"finished_at" json:"finished_at,omitempty"`
+}
+
+// Progress is the fraction of the file read so far, between 0 and 1
+func (j ImportJob) Progress() float64 {
+	if j.Status == ImportCompleted {
+		return 1
+	}
+	if j.SizeBytes <= 0 {
+		return 0
+	}
+	return float64(j.ReadBytes) / float64(j.SizeBytes)
+}
+
+// MarshalJSON adds the computed progress to the stored fields
+func (j ImportJob) MarshalJSON() ([]byte, error) {
+	type job ImportJob
+	return json.Marshal(struct {
+		job
+		Progress float64 `json:"progress"`
+	}{job(j), j.Progress()})
+}
+
+// OrgSettings are the organization-wide settings reports are computed with
+type OrgSettings struct {
+	Timezone  string    `json:"timezone"`   // IANA name, e.g. Asia/Dubai
+	WorkStart string    `json:"work_start"` // local HH:MM
+	WorkEnd   string    `json:"work_end"`
+	WorkDays  []int     `json:"work_days"` // 0 Sunday ... 6 Saturday
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DailyUsage is a vehicle's activity on one local day
+type DailyUsage struct {
+	VehicleID             uuid.UUID  `json:"vehicle_id"`
+	Day                   time.Time  `json:"day"`
+	DistanceKm            float64    `json:"distance_km"`
+	DrivingSeconds        float64    `json:"driving_seconds"`
+	IdleSeconds           float64    `json:"idle_seconds"`
+	TripCount             int        `json:"trip_count"`
+	MaxSpeed              float64    `json:"max_speed"`
+	FirstStart            *time.Time `json:"first_start,omitempty"`
+	LastStop              *time.Time `json:"last_stop,omitempty"`
+	WorkingSeconds        float64    `json:"working_seconds"`
+	WorkingDrivingSeconds float64    `json:"working_driving_seconds"`
+}
+
+// UtilizationRow summarises usage of a vehicle or group over a day or month.
+// Utilization is the share of working hours spent driving, in percent.
+type UtilizationRow struct {
+	Period         string     `json:"period"`
+	VehicleID      *uuid.UUID `json:"vehicle_id,omitempty"`
+	PlateNumber    string     `json:"plate_number,omitempty"`
+	GroupID        *uuid.UUID `json:"group_id,omitempty"`
+	GroupName      string     `json:"group_name,omitempty"`
+	Vehicles       int        `json:"vehicles"`
+	DistanceKm     float64    `json:"distance_km"`
+	DrivingSeconds float64    `json:"driving_seconds"`
+	IdleSeconds    float64    `json:"idle_seconds"`
+	TripCount      int        `json:"trip_count"`
+	MaxSpeed       float64    `json:"max_speed"`
+	FirstStart     *time.Time `json:"first_start,omitempty"`
+	LastStop       *time.Time `json:"last_stop,omitempty"`
+	Utilization    float64    `json:"utilization"`
+}
+
+// Odometer sources
+const (
+	OdometerVirtual = "virtual" // accumulated from trip distance
+	OdometerDevice  = "device"  // reported by the device plus a calibration offset
+)
+
+// Kinds of meter readings
+const (
+	ReadingTrip        = "trip"
+	ReadingCalibration = "calibration"
+)
+
+// VehicleMeters is the odometer and engine hours of a vehicle
+type VehicleMeters struct {
+	VehicleID        uuid.UUID  `json:"vehicle_id"`
+	OdometerKm       float64    `json:"odometer_km"`
+	EngineHours      float64    `json:"engine_hours"`
+	OdometerSource   string     `json:"odometer_source"`
+	DeviceOdometerKm *float64   `json:"device_odometer_km,omitempty"` // last raw device reading
+	DeviceOffsetKm   float64    `json:"device_offset_km"`
+	LastFixAt        *time.Time `json:"last_fix_at,omitempty"`
+	LastIgnition     *bool      `json:"-"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// MeterReading is an entry of a vehicle's odometer and engine hours history
+type MeterReading struct {
+	ID              int64      `json:"id"`
+	VehicleID       uuid.UUID  `json:"vehicle_id"`
+	RecordedAt      time.Time  `json:"recorded_at"`
+	Kind            string     `json:"kind"`
+	OdometerKm      float64    `json:"odometer_km"`
+	EngineHours     float64    `json:"engine_hours"`
+	PrevOdometerKm  *float64   `json:"prev_odometer_km,omitempty"`
+	PrevEngineHours *float64   `json:"prev_engine_hours,omitempty"`
+	OdometerSource  string     `json:"odometer_source"`
+	TripID          *uuid.UUID `json:"trip_id,omitempty"`
+	Actor           string     `json:"actor,omitempty"`
+	Note            string     `json:"note,omitempty"`
+}
+
+// Maintenance states, from best to worst
+const (
+	MaintenanceOK      = "ok"
+	MaintenanceDueSoon = "due_soon"
+	MaintenanceOverdue = "overdue"
+)
+
+// MaintenancePlan is a recurring service due every IntervalKm, IntervalHours
+// or IntervalDays, whichever comes first, for one vehicle or every vehicle of
+// a group. It turns due soon within the DueSoon margins.
+type MaintenancePlan struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	VehicleID     *uuid.UUID `json:"vehicle_id,omitempty"`
+	GroupID       *uuid.UUID `json:"group_id,omitempty"`
+	IntervalKm    *float64   `json:"interval_km,omitempty"`
+	IntervalHours *float64   `json:"interval_hours,omitempty"`
+	IntervalDays  *int       `json:"interval_days,omitempty"`
+	DueSoonKm     float64    `json:"due_soon_km"`
+	DueSoonHours  float64    `json:"due_soon_hours"`
+	DueSoonDays   int        `json:"due_soon_days"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ServiceRecord is maintenance work done on a vehicle
+type ServiceRecord struct {
+	ID          uuid.UUID  `json:"id"`
+	VehicleID   uuid.UUID  `json:"vehicle_id"`
+	PlanID      *uuid.UUID `json:"plan_id,omitempty"`
+	PerformedAt time.Time  `json:"performed_at"`
+	OdometerKm  float64    `json:"odometer_km"`
+	EngineHours float64    `json:"engine_hours"`
+	Notes       string     `json:"notes,omitempty"`
+	Cost        *float64   `json:"cost,omitempty"`
+	RecordedBy  string     `json:"recorded_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// MaintenanceDue is when a plan next falls due for a vehicle, counted from
+// the last service under the plan or from when the plan started applying
+type MaintenanceDue struct {
+	PlanID          uuid.UUID  `json:"plan_id"`
+	PlanName        string     `json:"plan_name"`
+	VehicleID       uuid.UUID  `json:"vehicle_id"`
+	State           string     `json:"state"`
+	BaseAt          time.Time  `json:"base_at"`
+	BaseOdometerKm  float64    `json:"base_odometer_km"`
+	BaseEngineHours float64    `json:"base_engine_hours"`
+	LastServiceID   *uuid.UUID `json:"last_service_id,omitempty"`
+	DueOdometerKm   *float64   `json:"due_odometer_km,omitempty"`
+	DueEngineHours  *float64   `json:"due_engine_hours,omitempty"`
+	DueAt           *time.Time `json:"due_at,omitempty"`
+	RemainingKm     *float64   `json:"remaining_km,omitempty"`
+	RemainingHours  *float64   `json:"remaining_hours,omitempty"`
+	RemainingDays   *float64   `json:"remaining_days,omitempty"`
+}
+
+// VehicleSummary is a vehicle in the fleet list
+type VehicleSummary struct {
+	ID               uuid.UUID  `json:"id"`
+	PlateNumber      string     `json:"plate_number"`
+	GroupID          *uuid.UUID `json:"group_id,omitempty"`
+	DriverID         *uuid.UUID `json:"driver_id,omitempty"`
+	OdometerKm       float64    `json:"odometer_km"`
+	EngineHours      float64    `json:"engine_hours"`
+	MaintenanceState string     `json:"maintenance_state,omitempty"` // worst state of its plans; empty without plans
+	MaintenanceDue   int        `json:"maintenance_due"`             // plans due soon or overdue
+}
+
+// Fuel event kinds
+const (
+	FuelRefuel = "refuel"
+	FuelDrop   = "drop" // sudden loss while stationary, possibly theft
+)
+
+// FuelReading is a fuel level sample; Level is the smoothed value
+type FuelReading struct {
+	VehicleID uuid.UUID `json:"vehicle_id"`
+	Timestamp time.Time `json:"timestamp"`
+	RawLevel  float64   `json:"raw_level_l"`
+	Level     float64   `json:"level_l"`
+	Speed     float64   `json:"speed"`
+}
+
+// FuelEvent is a refuel or a fuel drop
+type FuelEvent struct {
+	ID         uuid.UUID  `json:"id"`
+	VehicleID  uuid.UUID  `json:"vehicle_id"`
+	Kind       string     `json:"kind"`
+	StartAt    time.Time  `json:"start_at"`
+	EndAt      time.Time  `json:"end_at"`
+	StartLevel float64    `json:"start_level_l"`
+	EndLevel   float64    `json:"end_level_l"`
+	Amount     float64    `json:"amount_l"`
+	Location   [2]float64 `json:"location"` // lon, lat
+}
+
+// FuelState is the detection state of a vehicle's fuel level. Pending is a
+// rise or drop still in progress; its end is the current level.
+type FuelState struct {
+	Level   float64
+	At      time.Time
+	Pending *FuelEvent
+}
+
+// DTCOccurrence is a diagnostic trouble code active on a vehicle from
+// FirstSeenAt until ClearedAt, the first report without it
+type DTCOccurrence struct {
+	ID          uuid.UUID  `json:"id"`
+	VehicleID   uuid.UUID  `json:"vehicle_id"`
+	Code        string     `json:"code"`
+	System      string     `json:"system"`
+	Description string     `json:"description"`
+	Severity    string     `json:"severity"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ClearedAt   *time.Time `json:"cleared_at,omitempty"`
+}
+
+// EngineReading is a set of engine parameters reported with a fix
+type EngineReading struct {
+	VehicleID    uuid.UUID `json:"vehicle_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	RPM          *float64  `json:"rpm,omitempty"`
+	CoolantTempC *float64  `json:"coolant_temp_c,omitempty"`
+	EngineLoad   *float64  `json:"engine_load,omitempty"` // percent
+}
+
+// Harsh driving event kinds
+const (
+	HarshAcceleration = "harsh_acceleration"
+	HarshBraking      = "harsh_braking"
+	HarshCornering    = "harsh_cornering"
+	Overspeed         = "overspeed"
+)
+
+// HarshKinds lists every harsh driving event kind
+var HarshKinds = []string{HarshAcceleration, HarshBraking, HarshCornering, Overspeed}
+
+// Where a harsh driving event was detected
+const (
+	HarshDerived = "derived" // from consecutive fixes
+	HarshDevice  = "device"  // reported by the device's accelerometer
+)
+
+// HarshEvent is a harsh driving event. Overspeed events span from the first
+// to the last fix over the limit; the others are instantaneous.
+type HarshEvent struct {
+	ID         uuid.UUID  `json:"id"`
+	VehicleID  uuid.UUID  `json:"vehicle_id"`
+	TripID     *uuid.UUID `json:"trip_id,omitempty"`
+	DriverID   *uuid.UUID `json:"driver_id,omitempty"`
+	Kind       string     `json:"kind"`
+	Source     string     `json:"source"`
+	OccurredAt time.Time  `json:"occurred_at"`
+	EndedAt    time.Time  `json:"ended_at"`
+	Location   [2]float64 `json:"location"` // lon, lat
+	Speed      float64    `json:"speed"`
+	Value      float64    `json:"value"` // peak m/s², or peak km/h for overspeed
+	// Overspeed only: the limit and road at the fix furthest over it
+	LimitKmh    *float64 `json:"limit_kmh,omitempty"`
+	ExcessKmh   *float64 `json:"excess_kmh,omitempty"`
+	LimitSource string   `json:"limit_source,omitempty"`
+	Road        string   `json:"road,omitempty"`
+}
+
+// Where an overspeed event's limit came from
+const (
+	LimitRoad    = "road"    // the maxspeed of the road driven on
+	LimitDefault = "default" // the configured limit for roads without one
+)
+
+// SpeedingViolation is an overspeed episode in the speeding compliance report
+type SpeedingViolation struct {
+	HarshEvent
+	PlateNumber     string  `json:"plate_number"`
+	DriverName      string  `json:"driver_name,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// ScoringSettings weigh harsh events into the safety score. Weights are
+// penalty points per event per 100 km; trips shorter than MinDistanceKm
+// are scored as if they were that long.
+type ScoringSettings struct {
+	Weights       map[string]float64 `json:"weights"`
+	MinDistanceKm float64            `json:"min_distance_km"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+// Dispatch job statuses, in the order a job moves through them
+const (
+	JobPending   = "pending"   // not assigned to a vehicle
+	JobAssigned  = "assigned"  // heading to the pickup
+	JobAtPickup  = "at_pickup" // inside the pickup radius
+	JobPickedUp  = "picked_up" // left the pickup, heading to the drop
+	JobAtDrop    = "at_drop"   // inside the drop radius
+	JobDelivered = "delivered"
+	JobCancelled = "cancelled"
+)
+
+// JobStatuses lists every job status in order
+var JobStatuses = []string{JobPending, JobAssigned, JobAtPickup, JobPickedUp, JobAtDrop, JobDelivered, JobCancelled}
+
+// Job priorities, lowest first
+const (
+	JobPriorityLow    = "low"
+	JobPriorityNormal = "normal"
+	JobPriorityHigh   = "high"
+	JobPriorityUrgent = "urgent"
+)
+
+// JobStop is the pickup or the drop of a job. The vehicle is there while
+// it is within RadiusM; the window is when it is expected.
+type JobStop struct {
+	Location    [2]float64 `json:"location"` // lon, lat
+	Address     string     `json:"address,omitempty"`
+	RadiusM     float64    `json:"radius_m"`
+	WindowStart *time.Time `json:"window_start,omitempty"`
+	WindowEnd   *time.Time `json:"window_end,omitempty"`
+	ArrivedAt   *time.Time `json:"arrived_at,omitempty"`
+	DepartedAt  *time.Time `json:"departed_at,omitempty"`
+}
+
+// Job is a dispatch order: collect at Pickup and deliver to Drop
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	Reference   string          `json:"reference,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Priority    string          `json:"priority"`
+	Status      string          `json:"status"`
+	StatusAt    time.Time       `json:"status_at"` // when the job entered Status
+	VehicleID   *uuid.UUID      `json:"vehicle_id,omitempty"`
+	AssignedAt  *time.Time      `json:"assigned_at,omitempty"`
+	Pickup      JobStop         `json:"pickup"`
+	Drop        JobStop         `json:"drop"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty"`
+	CancelledAt *time.Time      `json:"cancelled_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ETA         *JobETA         `json:"eta,omitempty"`
+	Attachments []JobAttachment `json:"attachments,omitempty"`
+}
+
+// JobETA is when the vehicle is expected at the next stop of its job,
+// estimated from its latest fix
+type JobETA struct {
+	Stop       string    `json:"stop"` // pickup or drop
+	DistanceM  float64   `json:"distance_m"`
+	SpeedKmh   float64   `json:"speed_kmh"` // speed the estimate assumes
+	ArrivalAt  time.Time `json:"arrival_at"`
+	Late       bool      `json:"late"` // arrives after the stop's window ends
+	PositionAt time.Time `json:"position_at"`
+}
+
+// Proof-of-delivery attachment kinds
+const (
+	AttachmentSignature = "signature"
+	AttachmentPhoto     = "photo"
+)
+
+// JobAttachment is a proof-of-delivery file of a job
+type JobAttachment struct {
+	ID          uuid.UUID `json:"id"`
+	JobID       uuid.UUID `json:"job_id"`
+	Kind        string    `json:"kind"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	StorageKey  string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PlannedStop is a scheduled stop of a planned route
+type PlannedStop struct {
+	Name               string     `json:"name"`
+	Location           [2]float64 `json:"location"` // lon, lat
+	RadiusM            float64    `json:"radius_m"`
+	ScheduledOffsetMin *float64   `json:"scheduled_offset_min,omitempty"` // minutes after an assignment starts
+	AlongM             float64    `json:"along_m"`                        // distance along the route
+}
+
+// PlannedRoute is the expected path of a fixed route. A vehicle driving it
+// is on route while within CorridorM of the path.
+type PlannedRoute struct {
+	ID        uuid.UUID     `json:"id"`
+	Name      string        `json:"name"`
+	Path      [][2]float64  `json:"path"` // lon, lat
+	CorridorM float64       `json:"corridor_m"`
+	LengthM   float64       `json:"length_m"`
+	Stops     []PlannedStop `json:"stops"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Stop visit statuses
+const (
+	StopVisited = "visited"
+	StopSkipped = "skipped" // the vehicle went past without stopping there
+)
+
+// RouteAssignment is a planned route driven by a vehicle in [StartAt,
+// EndAt) with the progress tracked from its fixes
+type RouteAssignment struct {
+	ID              uuid.UUID         `json:"id"`
+	RouteID         uuid.UUID         `json:"route_id"`
+	VehicleID       uuid.UUID         `json:"vehicle_id"`
+	StartAt         time.Time         `json:"start_at"`
+	EndAt           time.Time         `json:"end_at"`
+	ProgressM       float64           `json:"progress_m"` // furthest point reached along the route
+	Fixes           int               `json:"fixes"`
+	FixesInCorridor int               `json:"fixes_in_corridor"`
+	OffRouteID      *uuid.UUID        `json:"off_route_id,omitempty"` // open off-route deviation
+	LastAt          *time.Time        `json:"last_at,omitempty"`
+	Visits          map[int]StopVisit `json:"-"` // by stop index
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+// StopVisit is when a scheduled stop was visited or skipped
+type StopVisit struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+// Route deviation kinds
+const (
+	DeviationOffRoute    = "off_route"
+	DeviationSkippedStop = "skipped_stop"
+)
+
+// RouteDeviation is a stretch outside a planned route's corridor or a
+// skipped stop
+type RouteDeviation struct {
+	ID           uuid.UUID  `json:"id"`
+	AssignmentID uuid.UUID  `json:"assignment_id"`
+	RouteID      uuid.UUID  `json:"route_id"`
+	VehicleID    uuid.UUID  `json:"vehicle_id"`
+	Kind         string     `json:"kind"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"` // nil while still off route
+	MaxDistanceM float64    `json:"max_distance_m"`
+	StopIndex    *int       `json:"stop_index,omitempty"`
+	StopName     string     `json:"stop_name,omitempty"`
+	Location     [2]float64 `json:"location"` // where it started, lon, lat
+}
+
+// POI is a point of interest such as a customer site. A vehicle stopping
+// within RadiusM of it visits it.
+type POI struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Category    string     `json:"category"`
+	ExternalRef string     `json:"external_ref,omitempty"` // id in the customer's own system
+	Address     string     `json:"address,omitempty"`
+	Location    [2]float64 `json:"location"` // lon, lat
+	RadiusM     float64    `json:"radius_m"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// POICategory is a POI category with the number of POIs in it
+type POICategory struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// POIVisit is a stop of a vehicle within a POI
+type POIVisit struct {
+	POIID           uuid.UUID  `json:"poi_id"`
+	POIName         string     `json:"poi_name"`
+	Category        string     `json:"category"`
+	StopID          uuid.UUID  `json:"stop_id"`
+	VehicleID       uuid.UUID  `json:"vehicle_id"`
+	PlateNumber     string     `json:"plate_number"`
+	Arrival         time.Time  `json:"arrival"`
+	Departure       *time.Time `json:"departure,omitempty"` // nil while the vehicle is still there
+	DurationSeconds float64    `json:"duration_seconds"`
+	DistanceM       float64    `json:"distance_m"` // from the POI to where the vehicle stopped
+}
+
+// HOSRuleSet holds the driving-time limits a driver is held to, in minutes.
+// Rests shorter than MinBreakPartMin do not count towards a break; a zero
+// weekly or fortnightly limit does not apply.
+type HOSRuleSet struct {
+	ID                      uuid.UUID `json:"id"`
+	Name                    string    `json:"name"`
+	MaxContinuousDrivingMin float64   `json:"max_continuous_driving_min"`
+	MinBreakMin             float64   `json:"min_break_min"`
+	MinBreakPartMin         float64   `json:"min_break_part_min"`
+	MaxDailyDrivingMin      float64   `json:"max_daily_driving_min"`
+	MinDailyRestMin         float64   `json:"min_daily_rest_min"`
+	MaxDutySpanMin          float64   `json:"max_duty_span_min"` // from starting work to the next daily rest
+	MaxWeeklyDrivingMin     float64   `json:"max_weekly_driving_min"`
+	MaxFortnightDrivingMin  float64   `json:"max_fortnight_driving_min"` // over two consecutive weeks
+	WarnBeforeMin           float64   `json:"warn_before_min"`
+	IsDefault               bool      `json:"is_default"`
+	CreatedAt               time.Time `json:"created_at"`
+}
+
+// Driver activities
+const (
+	ActivityDriving = "driving"
+	ActivityWork    = "work" // stopped with the engine running
+	ActivityRest    = "rest"
+	ActivityOffDuty = "off_duty" // resting after a daily rest
+)
+
+// Driving-time limits
+const (
+	HOSContinuousDriving = "continuous_driving"
+	HOSDailyDriving      = "daily_driving"
+	HOSDutySpan          = "duty_span"
+	HOSWeeklyDriving     = "weekly_driving"
+	HOSFortnightDriving  = "fortnight_driving"
+)
+
+// HOSPeriod is a stretch of one activity of a driver
+type HOSPeriod struct {
+	Activity  string     `json:"activity"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	VehicleID *uuid.UUID `json:"vehicle_id,omitempty"`
+}
+
+// HOSLimit is how much of a limit a driver has used in the current period
+type HOSLimit struct {
+	Kind         string    `json:"kind"`
+	PeriodStart  time.Time `json:"period_start"`
+	LimitMin     float64   `json:"limit_min"`
+	UsedMin      float64   `json:"used_min"`
+	RemainingMin float64   `json:"remaining_min"` // negative once exceeded
+}
+
+// HOSViolation is a limit a driver exceeded
+type HOSViolation struct {
+	DriverID    uuid.UUID `json:"driver_id"`
+	DriverName  string    `json:"driver_name"`
+	RuleSet     string    `json:"rule_set"`
+	Kind        string    `json:"kind"`
+	PeriodStart time.Time `json:"period_start"`
+	At          time.Time `json:"at"` // when the limit was exceeded
+	LimitMin    float64   `json:"limit_min"`
+	ActualMin   float64   `json:"actual_min"`
+	ExcessMin   float64   `json:"excess_min"`
+}
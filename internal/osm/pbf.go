@@ -0,0 +1,404 @@
+// Package osm reads OpenStreetMap PBF extracts without external tools
+package osm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Node is an OSM node; Tags is nil for untagged nodes
+type Node struct {
+	ID   int64
+	Lon  float64
+	Lat  float64
+	Tags map[string]string
+}
+
+// Way is an OSM way referencing its nodes in order
+type Way struct {
+	ID    int64
+	Nodes []int64
+	Tags  map[string]string
+}
+
+// Handler receives the elements of an extract. Nil callbacks skip decoding
+// of that element type; returning an error stops the scan.
+type Handler struct {
+	Node func(Node) error
+	Way  func(Way) error
+}
+
+// maxBlobSize is the largest blob the format allows
+const maxBlobSize = 32 << 20
+
+var supportedFeatures = map[string]bool{"OsmSchema-V0.6": true, "DenseNodes": true}
+
+// ErrFormat is returned for input that is not a readable OSM PBF file
+var ErrFormat = errors.New("invalid osm pbf")
+
+// Scan reads a PBF stream and calls h for every node and way in file order.
+// Relations are skipped.
+func Scan(r io.Reader, h Handler) error {
+	var lenBuf [4]byte
+	for {
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		n := binary.BigEndian.Uint32(lenBuf[:])
+		if n > 64<<10 {
+			return fmt.Errorf("%w: blob header of %d bytes", ErrFormat, n)
+		}
+		hdr := make([]byte, n)
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		typ, size, err := parseBlobHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if size > maxBlobSize {
+			return fmt.Errorf("%w: blob of %d bytes", ErrFormat, size)
+		}
+		blob := make([]byte, size)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		data, err := blobData(blob)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case "OSMHeader":
+			if err := checkHeader(data); err != nil {
+				return err
+			}
+		case "OSMData":
+			if err := readBlock(data, h); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fields walks the top-level fields of a protobuf message
+func fields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrFormat
+		}
+		b = b[n:]
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return ErrFormat
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseBlobHeader(b []byte) (typ string, size int, err error) {
+	err = fields(b, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			typ = string(v)
+		case 3:
+			size = int(x)
+		}
+		return nil
+	})
+	return typ, size, err
+}
+
+func blobData(b []byte) ([]byte, error) {
+	var raw, compressed []byte
+	rawSize := 0
+	unsupported := false
+	err := fields(b, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			raw = v
+		case 2:
+			rawSize = int(x)
+		case 3:
+			compressed = v
+		case 4, 5, 6, 7:
+			unsupported = true
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case raw != nil:
+		return raw, nil
+	case compressed != nil:
+		if rawSize > maxBlobSize {
+			return nil, fmt.Errorf("%w: blob of %d bytes", ErrFormat, rawSize)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		defer zr.Close()
+		out := make([]byte, 0, rawSize)
+		buf := bytes.NewBuffer(out)
+		if _, err := io.Copy(buf, io.LimitReader(zr, maxBlobSize)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		return buf.Bytes(), nil
+	case unsupported:
+		return nil, fmt.Errorf("%w: only raw and zlib blobs are supported", ErrFormat)
+	}
+	return nil, nil
+}
+
+func checkHeader(b []byte) error {
+	return fields(b, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+		if num == 4 && !supportedFeatures[string(v)] {
+			return fmt.Errorf("%w: unsupported required feature %q", ErrFormat, v)
+		}
+		return nil
+	})
+}
+
+// block holds what elements of one PrimitiveBlock need to be decoded
+type block struct {
+	strings     [][]byte
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+func (b *block) lat(v int64) float64 { return 1e-9 * float64(b.latOffset+b.granularity*v) }
+func (b *block) lon(v int64) float64 { return 1e-9 * float64(b.lonOffset+b.granularity*v) }
+
+func (b *block) str(i uint64) (string, error) {
+	if i >= uint64(len(b.strings)) {
+		return "", fmt.Errorf("%w: string index %d out of range", ErrFormat, i)
+	}
+	return string(b.strings[i]), nil
+}
+
+func readBlock(data []byte, h Handler) error {
+	blk := block{granularity: 100}
+	var groups [][]byte
+	err := fields(data, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			return fields(v, func(num protowire.Number, _ protowire.Type, s []byte, _ uint64) error {
+				if num == 1 {
+					blk.strings = append(blk.strings, s)
+				}
+				return nil
+			})
+		case 2:
+			groups = append(groups, v)
+		case 17:
+			blk.granularity = int64(x)
+		case 19:
+			blk.latOffset = int64(x)
+		case 20:
+			blk.lonOffset = int64(x)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		err := fields(g, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+			switch {
+			case num == 1 && h.Node != nil:
+				return blk.node(v, h.Node)
+			case num == 2 && h.Node != nil:
+				return blk.denseNodes(v, h.Node)
+			case num == 3 && h.Way != nil:
+				return blk.way(v, h.Way)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packed appends the values of a repeated varint field, which writers may
+// encode packed or one value per tag
+func packed(dst []uint64, typ protowire.Type, v []byte, x uint64) ([]uint64, error) {
+	if typ == protowire.VarintType {
+		return append(dst, x), nil
+	}
+	for len(v) > 0 {
+		x, n := protowire.ConsumeVarint(v)
+		if n < 0 {
+			return dst, ErrFormat
+		}
+		dst = append(dst, x)
+		v = v[n:]
+	}
+	return dst, nil
+}
+
+func (b *block) tags(keys, vals []uint64) (map[string]string, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("%w: %d keys for %d values", ErrFormat, len(keys), len(vals))
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(keys))
+	for i := range keys {
+		k, err := b.str(keys[i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := b.str(vals[i])
+		if err != nil {
+			return nil, err
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (b *block) node(data []byte, fn func(Node) error) error {
+	var id, lat, lon int64
+	var keys, vals []uint64
+	err := fields(data, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) (err error) {
+		switch num {
+		case 1:
+			id = protowire.DecodeZigZag(x)
+		case 2:
+			keys, err = packed(keys, typ, v, x)
+		case 3:
+			vals, err = packed(vals, typ, v, x)
+		case 8:
+			lat = protowire.DecodeZigZag(x)
+		case 9:
+			lon = protowire.DecodeZigZag(x)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	tags, err := b.tags(keys, vals)
+	if err != nil {
+		return err
+	}
+	return fn(Node{ID: id, Lat: b.lat(lat), Lon: b.lon(lon), Tags: tags})
+}
+
+func (b *block) denseNodes(data []byte, fn func(Node) error) error {
+	var ids, lats, lons, kv []uint64
+	err := fields(data, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) (err error) {
+		switch num {
+		case 1:
+			ids, err = packed(ids, typ, v, x)
+		case 8:
+			lats, err = packed(lats, typ, v, x)
+		case 9:
+			lons, err = packed(lons, typ, v, x)
+		case 10:
+			kv, err = packed(kv, typ, v, x)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return fmt.Errorf("%w: dense nodes of unequal length", ErrFormat)
+	}
+
+	var id, lat, lon int64
+	for i := range ids {
+		id += protowire.DecodeZigZag(ids[i])
+		lat += protowire.DecodeZigZag(lats[i])
+		lon += protowire.DecodeZigZag(lons[i])
+		n := Node{ID: id, Lat: b.lat(lat), Lon: b.lon(lon)}
+		// keys_vals holds key, value pairs per node, each node ending with 0
+		for len(kv) > 0 {
+			k := kv[0]
+			kv = kv[1:]
+			if k == 0 {
+				break
+			}
+			if len(kv) == 0 {
+				return fmt.Errorf("%w: dense node tag without value", ErrFormat)
+			}
+			ks, err := b.str(k)
+			if err != nil {
+				return err
+			}
+			vs, err := b.str(kv[0])
+			if err != nil {
+				return err
+			}
+			kv = kv[1:]
+			if n.Tags == nil {
+				n.Tags = map[string]string{}
+			}
+			n.Tags[ks] = vs
+		}
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *block) way(data []byte, fn func(Way) error) error {
+	var w Way
+	var keys, vals, refs []uint64
+	err := fields(data, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) (err error) {
+		switch num {
+		case 1:
+			w.ID = int64(x)
+		case 2:
+			keys, err = packed(keys, typ, v, x)
+		case 3:
+			vals, err = packed(vals, typ, v, x)
+		case 8:
+			refs, err = packed(refs, typ, v, x)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if w.Tags, err = b.tags(keys, vals); err != nil {
+		return err
+	}
+	w.Nodes = make([]int64, len(refs))
+	var ref int64
+	for i, d := range refs {
+		ref += protowire.DecodeZigZag(d)
+		w.Nodes[i] = ref
+	}
+	return fn(w)
+}
@@ -0,0 +1,142 @@
+package osm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func message(fn func(b []byte) []byte) []byte { return fn(nil) }
+
+func packedSint(vals ...int64) []byte {
+	var b []byte
+	for _, v := range vals {
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+	}
+	return b
+}
+
+func packedUint(vals ...uint64) []byte {
+	var b []byte
+	for _, v := range vals {
+		b = protowire.AppendVarint(b, v)
+	}
+	return b
+}
+
+func writeBlob(buf *bytes.Buffer, typ string, data []byte) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	blob := message(func(b []byte) []byte {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(len(data)))
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		return protowire.AppendBytes(b, z.Bytes())
+	})
+	hdr := message(func(b []byte) []byte {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, typ)
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(len(blob)))
+	})
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(hdr)))
+	buf.Write(hdr)
+	buf.Write(blob)
+}
+
+// testPBF encodes three dense nodes, the middle one tagged, and a way over them
+func testPBF(required string) []byte {
+	var buf bytes.Buffer
+	writeBlob(&buf, "OSMHeader", message(func(b []byte) []byte {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		return protowire.AppendString(b, required)
+	}))
+
+	strs := []string{"", "highway", "residential", "name", "Al Wasl Road", "traffic_signals"}
+	st := message(func(b []byte) []byte {
+		for _, s := range strs {
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+		return b
+	})
+	dense := message(func(b []byte) []byte {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, packedSint(10, 1, 1))
+		// granularity 100: 25.2 degrees is 252000000 units
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, packedSint(252000000, 1000, 1000))
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, packedSint(552700000, 2000, 2000))
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		return protowire.AppendBytes(b, packedUint(0, 1, 5, 0, 0))
+	})
+	way := message(func(b []byte) []byte {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, 7)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, packedUint(1, 3))
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, packedUint(2, 4))
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		return protowire.AppendBytes(b, packedSint(10, 1, 1))
+	})
+	writeBlob(&buf, "OSMData", message(func(b []byte) []byte {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, st)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, message(func(g []byte) []byte {
+			g = protowire.AppendTag(g, 2, protowire.BytesType)
+			return protowire.AppendBytes(g, dense)
+		}))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		return protowire.AppendBytes(b, message(func(g []byte) []byte {
+			g = protowire.AppendTag(g, 3, protowire.BytesType)
+			return protowire.AppendBytes(g, way)
+		}))
+	}))
+	return buf.Bytes()
+}
+
+func TestScan(t *testing.T) {
+	var nodes []Node
+	var ways []Way
+	err := Scan(bytes.NewReader(testPBF("DenseNodes")), Handler{
+		Node: func(n Node) error { nodes = append(nodes, n); return nil },
+		Way:  func(w Way) error { ways = append(ways, w); return nil },
+	})
+	require.NoError(t, err)
+
+	require.Len(t, nodes, 3)
+	assert.Equal(t, []int64{10, 11, 12}, []int64{nodes[0].ID, nodes[1].ID, nodes[2].ID})
+	assert.InDelta(t, 25.2, nodes[0].Lat, 1e-9)
+	assert.InDelta(t, 55.27, nodes[0].Lon, 1e-9)
+	assert.InDelta(t, 25.2002, nodes[2].Lat, 1e-9)
+	assert.InDelta(t, 55.2704, nodes[2].Lon, 1e-9)
+	assert.Nil(t, nodes[0].Tags)
+	assert.Equal(t, map[string]string{"highway": "traffic_signals"}, nodes[1].Tags)
+
+	require.Len(t, ways, 1)
+	assert.Equal(t, int64(7), ways[0].ID)
+	assert.Equal(t, []int64{10, 11, 12}, ways[0].Nodes)
+	assert.Equal(t, map[string]string{"highway": "residential", "name": "Al Wasl Road"}, ways[0].Tags)
+
+	// Ways only
+	ways = nil
+	require.NoError(t, Scan(bytes.NewReader(testPBF("DenseNodes")), Handler{
+		Way: func(w Way) error { ways = append(ways, w); return nil },
+	}))
+	assert.Len(t, ways, 1)
+
+	err = Scan(bytes.NewReader(testPBF("HistoricalInformation")), Handler{})
+	assert.ErrorIs(t, err, ErrFormat)
+	err = Scan(bytes.NewReader([]byte("not a pbf file")), Handler{})
+	assert.ErrorIs(t, err, ErrFormat)
+}
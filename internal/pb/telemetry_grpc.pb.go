@@ -0,0 +1,248 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.2
+// source: telemetry.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TelemetryService_StreamPositions_FullMethodName = "/fleet.telemetry.v1.TelemetryService/StreamPositions"
+	TelemetryService_GetStatus_FullMethodName       = "/fleet.telemetry.v1.TelemetryService/GetStatus"
+	TelemetryService_ListTrips_FullMethodName       = "/fleet.telemetry.v1.TelemetryService/ListTrips"
+	TelemetryService_WatchVehicles_FullMethodName   = "/fleet.telemetry.v1.TelemetryService/WatchVehicles"
+)
+
+// TelemetryServiceClient is the client API for TelemetryService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TelemetryService exposes the same ingest and query operations as the
+// HTTP API for gateways that keep a long-lived connection open.
+type TelemetryServiceClient interface {
+	// StreamPositions accepts a stream of position reports and replies once
+	// the client closes the stream.
+	StreamPositions(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PositionReport, IngestSummary], error)
+	// GetStatus returns the latest known status of a vehicle.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*VehicleStatus, error)
+	// ListTrips returns the trips of a vehicle in the last 24 hours.
+	ListTrips(ctx context.Context, in *ListTripsRequest, opts ...grpc.CallOption) (*ListTripsResponse, error)
+	// WatchVehicles streams status updates as they are ingested.
+	WatchVehicles(ctx context.Context, in *WatchVehiclesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VehicleStatus], error)
+}
+
+type telemetryServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTelemetryServiceClient(cc grpc.ClientConnInterface) TelemetryServiceClient {
+	return &telemetryServiceClient{cc}
+}
+
+func (c *telemetryServiceClient) StreamPositions(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PositionReport, IngestSummary], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TelemetryService_ServiceDesc.Streams[0], TelemetryService_StreamPositions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PositionReport, IngestSummary]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetryService_StreamPositionsClient = grpc.ClientStreamingClient[PositionReport, IngestSummary]
+
+func (c *telemetryServiceClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*VehicleStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VehicleStatus)
+	err := c.cc.Invoke(ctx, TelemetryService_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telemetryServiceClient) ListTrips(ctx context.Context, in *ListTripsRequest, opts ...grpc.CallOption) (*ListTripsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTripsResponse)
+	err := c.cc.Invoke(ctx, TelemetryService_ListTrips_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telemetryServiceClient) WatchVehicles(ctx context.Context, in *WatchVehiclesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VehicleStatus], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TelemetryService_ServiceDesc.Streams[1], TelemetryService_WatchVehicles_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchVehiclesRequest, VehicleStatus]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetryService_WatchVehiclesClient = grpc.ServerStreamingClient[VehicleStatus]
+
+// TelemetryServiceServer is the server API for TelemetryService service.
+// All implementations must embed UnimplementedTelemetryServiceServer
+// for forward compatibility.
+//
+// TelemetryService exposes the same ingest and query operations as the
+// HTTP API for gateways that keep a long-lived connection open.
+type TelemetryServiceServer interface {
+	// StreamPositions accepts a stream of position reports and replies once
+	// the client closes the stream.
+	StreamPositions(grpc.ClientStreamingServer[PositionReport, IngestSummary]) error
+	// GetStatus returns the latest known status of a vehicle.
+	GetStatus(context.Context, *GetStatusRequest) (*VehicleStatus, error)
+	// ListTrips returns the trips of a vehicle in the last 24 hours.
+	ListTrips(context.Context, *ListTripsRequest) (*ListTripsResponse, error)
+	// WatchVehicles streams status updates as they are ingested.
+	WatchVehicles(*WatchVehiclesRequest, grpc.ServerStreamingServer[VehicleStatus]) error
+	mustEmbedUnimplementedTelemetryServiceServer()
+}
+
+// UnimplementedTelemetryServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTelemetryServiceServer struct{}
+
+func (UnimplementedTelemetryServiceServer) StreamPositions(grpc.ClientStreamingServer[PositionReport, IngestSummary]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamPositions not implemented")
+}
+func (UnimplementedTelemetryServiceServer) GetStatus(context.Context, *GetStatusRequest) (*VehicleStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedTelemetryServiceServer) ListTrips(context.Context, *ListTripsRequest) (*ListTripsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTrips not implemented")
+}
+func (UnimplementedTelemetryServiceServer) WatchVehicles(*WatchVehiclesRequest, grpc.ServerStreamingServer[VehicleStatus]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchVehicles not implemented")
+}
+func (UnimplementedTelemetryServiceServer) mustEmbedUnimplementedTelemetryServiceServer() {}
+func (UnimplementedTelemetryServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeTelemetryServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TelemetryServiceServer will
+// result in compilation errors.
+type UnsafeTelemetryServiceServer interface {
+	mustEmbedUnimplementedTelemetryServiceServer()
+}
+
+func RegisterTelemetryServiceServer(s grpc.ServiceRegistrar, srv TelemetryServiceServer) {
+	// If the following call pancis, it indicates UnimplementedTelemetryServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TelemetryService_ServiceDesc, srv)
+}
+
+func _TelemetryService_StreamPositions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TelemetryServiceServer).StreamPositions(&grpc.GenericServerStream[PositionReport, IngestSummary]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetryService_StreamPositionsServer = grpc.ClientStreamingServer[PositionReport, IngestSummary]
+
+func _TelemetryService_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServiceServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TelemetryService_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServiceServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TelemetryService_ListTrips_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTripsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServiceServer).ListTrips(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TelemetryService_ListTrips_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServiceServer).ListTrips(ctx, req.(*ListTripsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TelemetryService_WatchVehicles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchVehiclesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TelemetryServiceServer).WatchVehicles(m, &grpc.GenericServerStream[WatchVehiclesRequest, VehicleStatus]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetryService_WatchVehiclesServer = grpc.ServerStreamingServer[VehicleStatus]
+
+// TelemetryService_ServiceDesc is the grpc.ServiceDesc for TelemetryService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TelemetryService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fleet.telemetry.v1.TelemetryService",
+	HandlerType: (*TelemetryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _TelemetryService_GetStatus_Handler,
+		},
+		{
+			MethodName: "ListTrips",
+			Handler:    _TelemetryService_ListTrips_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamPositions",
+			Handler:       _TelemetryService_StreamPositions_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchVehicles",
+			Handler:       _TelemetryService_WatchVehicles_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "telemetry.proto",
+}
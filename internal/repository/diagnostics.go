@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/lib/pq"
+)
+
+const dtcColumns = `o.id, o.vehicle_id, o.code, o.system, o.description, o.severity, o.first_seen_at, o.last_seen_at,
+    o.cleared_at`
+
+func scanDTC(row scanner) (model.DTCOccurrence, error) {
+	var o model.DTCOccurrence
+	var cleared sql.NullTime
+	err := row.Scan(&o.ID, &o.VehicleID, &o.Code, &o.System, &o.Description, &o.Severity, &o.FirstSeenAt,
+		&o.LastSeenAt, &cleared)
+	if cleared.Valid {
+		o.ClearedAt = &cleared.Time
+	}
+	return o, err
+}
+
+// DTCQuery selects trouble code occurrences. State is "active", "cleared"
+// or empty for both; From and To, when set, keep occurrences that were
+// active at some point in [From, To).
+type DTCQuery struct {
+	VehicleID string
+	GroupID   string
+	State     string
+	Severity  string
+	From, To  time.Time
+}
+
+// GetDTCs returns the trouble code occurrences matching q, newest first
+func (r *Repo) GetDTCs(ctx context.Context, q DTCQuery) ([]model.DTCOccurrence, error) {
+	var from, to *time.Time
+	if !q.From.IsZero() {
+		from, to = &q.From, &q.To
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+dtcColumns+`
+        FROM dtc_occurrences o
+        JOIN vehicle v ON v.id = o.vehicle_id
+        WHERE ($1 = '' OR o.vehicle_id::text = $1)
+          AND ($2 = '' OR v.group_id::text = $2)
+          AND ($3 = '' OR ($3 = 'active') = (o.cleared_at IS NULL))
+          AND ($4 = '' OR o.severity = $4)
+          AND ($5::timestamptz IS NULL OR (o.first_seen_at < $6 AND (o.cleared_at IS NULL OR o.cleared_at >= $5)))
+        ORDER BY o.first_seen_at DESC
+    `, q.VehicleID, q.GroupID, q.State, q.Severity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.DTCOccurrence{}
+	for rows.Next() {
+		o, err := scanDTC(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, o)
+	}
+	return res, rows.Err()
+}
+
+// GetDTCReportedAt returns when the last DTC list of a vehicle was applied,
+// locked for update, or nil before the first one
+func (r *Repo) GetDTCReportedAt(ctx context.Context, vehicleID string) (*time.Time, error) {
+	var at time.Time
+	err := r.db.QueryRowContext(ctx, `
+        SELECT reported_at FROM dtc_reports WHERE vehicle_id = $1 FOR UPDATE
+    `, vehicleID).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+
+// SaveDTCReportedAt records when the last DTC list of a vehicle was applied
+func (r *Repo) SaveDTCReportedAt(ctx context.Context, vehicleID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO dtc_reports (vehicle_id, reported_at) VALUES ($1, $2)
+        ON CONFLICT (vehicle_id) DO UPDATE SET reported_at = EXCLUDED.reported_at
+    `, vehicleID, at)
+	return err
+}
+
+// InsertDTC stores a new trouble code occurrence
+func (r *Repo) InsertDTC(ctx context.Context, o model.DTCOccurrence) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO dtc_occurrences (id, vehicle_id, code, system, description, severity, first_seen_at, last_seen_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `, o.ID, o.VehicleID, o.Code, o.System, o.Description, o.Severity, o.FirstSeenAt, o.LastSeenAt)
+	return err
+}
+
+// TouchDTCs marks the active occurrences of codes as still reported at
+func (r *Repo) TouchDTCs(ctx context.Context, vehicleID string, codes []string, at time.Time) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE dtc_occurrences SET last_seen_at = $3
+        WHERE vehicle_id = $1 AND code = ANY($2) AND cleared_at IS NULL
+    `, vehicleID, pq.Array(codes), at)
+	return err
+}
+
+// ClearDTCs ends the active occurrences of codes at
+func (r *Repo) ClearDTCs(ctx context.Context, vehicleID string, codes []string, at time.Time) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE dtc_occurrences SET cleared_at = $3
+        WHERE vehicle_id = $1 AND code = ANY($2) AND cleared_at IS NULL
+    `, vehicleID, pq.Array(codes), at)
+	return err
+}
+
+// InsertEngineReading stores the engine parameters reported with a fix
+func (r *Repo) InsertEngineReading(ctx context.Context, e model.EngineReading) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO engine_readings (vehicle_id, recorded_at, rpm, coolant_temp_c, engine_load)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (vehicle_id, recorded_at) DO NOTHING
+    `, e.VehicleID, e.Timestamp, e.RPM, e.CoolantTempC, e.EngineLoad)
+	return err
+}
+
+// GetEngineReadings returns the engine parameters of a vehicle in [from, to), oldest first
+func (r *Repo) GetEngineReadings(ctx context.Context, vehicleID string, from, to time.Time) ([]model.EngineReading, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT vehicle_id, recorded_at, rpm, coolant_temp_c, engine_load
+        FROM engine_readings
+        WHERE vehicle_id = $1 AND recorded_at >= $2 AND recorded_at < $3
+        ORDER BY recorded_at
+    `, vehicleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.EngineReading{}
+	for rows.Next() {
+		var e model.EngineReading
+		if err := rows.Scan(&e.VehicleID, &e.Timestamp, &e.RPM, &e.CoolantTempC, &e.EngineLoad); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const harshColumns = `h.id, h.vehicle_id, h.trip_id, h.driver_id, h.kind, h.source, h.occurred_at, h.ended_at,
+    h.lon, h.lat, h.speed, h.value, h.limit_kmh, h.excess_kmh, COALESCE(h.limit_source, ''), COALESCE(h.road, '')`
+
+func scanHarsh(row scanner) (model.HarshEvent, error) {
+	var h model.HarshEvent
+	err := row.Scan(&h.ID, &h.VehicleID, &h.TripID, &h.DriverID, &h.Kind, &h.Source, &h.OccurredAt, &h.EndedAt,
+		&h.Location[0], &h.Location[1], &h.Speed, &h.Value, &h.LimitKmh, &h.ExcessKmh, &h.LimitSource, &h.Road)
+	return h, err
+}
+
+// InsertHarshEvent stores a harsh driving event
+func (r *Repo) InsertHarshEvent(ctx context.Context, h model.HarshEvent) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO harsh_events (id, vehicle_id, trip_id, driver_id, kind, source, occurred_at, ended_at,
+                                  lon, lat, speed, value, limit_kmh, excess_kmh, limit_source, road)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), NULLIF($16, ''))
+    `, h.ID, h.VehicleID, h.TripID, h.DriverID, h.Kind, h.Source, h.OccurredAt, h.EndedAt,
+		h.Location[0], h.Location[1], h.Speed, h.Value, h.LimitKmh, h.ExcessKmh, h.LimitSource, h.Road)
+	return err
+}
+
+// AttributeHarshEvents attaches the vehicle's unattributed harsh events
+// during a trip to the trip and its driver
+func (r *Repo) AttributeHarshEvents(ctx context.Context, t model.Trip) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE harsh_events SET trip_id = $2, driver_id = $3
+        WHERE vehicle_id = $1 AND trip_id IS NULL
+          AND occurred_at BETWEEN $4 AND $5
+    `, t.VehicleID, t.ID, t.DriverID, t.StartTime, t.EndTime)
+	return err
+}
+
+// ExtendOverspeed moves the end of the vehicle's overspeed episode that
+// ended at prevAt to the fix h, raising its peak speed, and reports whether
+// there was one. The limit, road and location follow the fix furthest over
+// its limit.
+func (r *Repo) ExtendOverspeed(ctx context.Context, prevAt time.Time, h model.HarshEvent) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE harsh_events SET ended_at = $3, value = GREATEST(value, $4),
+               limit_kmh    = CASE WHEN $5 > excess_kmh THEN $6 ELSE limit_kmh END,
+               limit_source = CASE WHEN $5 > excess_kmh THEN NULLIF($7, '') ELSE limit_source END,
+               road         = CASE WHEN $5 > excess_kmh THEN NULLIF($8, '') ELSE road END,
+               lon          = CASE WHEN $5 > excess_kmh THEN $9 ELSE lon END,
+               lat          = CASE WHEN $5 > excess_kmh THEN $10 ELSE lat END,
+               speed        = CASE WHEN $5 > excess_kmh THEN $4 ELSE speed END,
+               excess_kmh   = GREATEST(excess_kmh, $5)
+        WHERE vehicle_id = $1 AND kind = 'overspeed' AND ended_at = $2
+    `, h.VehicleID, prevAt, h.EndedAt, h.Value, h.ExcessKmh, h.LimitKmh, h.LimitSource, h.Road,
+		h.Location[0], h.Location[1])
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// HarshQuery selects harsh driving events; empty fields do not filter
+type HarshQuery struct {
+	VehicleID string
+	TripID    string
+	Kind      string
+	From, To  time.Time
+}
+
+// GetHarshEvents returns the harsh driving events matching q, oldest first.
+// From and To only apply when From is set.
+func (r *Repo) GetHarshEvents(ctx context.Context, q HarshQuery) ([]model.HarshEvent, error) {
+	var from, to *time.Time
+	if !q.From.IsZero() {
+		from, to = &q.From, &q.To
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+harshColumns+`
+        FROM harsh_events h
+        WHERE ($1 = '' OR h.vehicle_id::text = $1)
+          AND ($2 = '' OR h.trip_id::text = $2)
+          AND ($3 = '' OR h.kind = $3)
+          AND ($4::timestamptz IS NULL OR (h.occurred_at >= $4 AND h.occurred_at < $5))
+        ORDER BY h.occurred_at
+    `, q.VehicleID, q.TripID, q.Kind, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.HarshEvent{}
+	for rows.Next() {
+		h, err := scanHarsh(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, h)
+	}
+	return res, rows.Err()
+}
+
+// SpeedingQuery selects overspeed episodes starting in [From, To); empty
+// fields do not filter
+type SpeedingQuery struct {
+	From, To    time.Time
+	VehicleID   string
+	DriverID    string
+	GroupID     string
+	MinDuration time.Duration
+}
+
+// GetSpeedingViolations returns the overspeed episodes matching q with the
+// vehicle's plate and the driver's name, oldest first
+func (r *Repo) GetSpeedingViolations(ctx context.Context, q SpeedingQuery) ([]model.SpeedingViolation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+harshColumns+`, v.plate_number, COALESCE(d.name, ''),
+               EXTRACT(EPOCH FROM h.ended_at - h.occurred_at)
+        FROM harsh_events h
+        JOIN vehicle v ON v.id = h.vehicle_id
+        LEFT JOIN drivers d ON d.id = h.driver_id
+        WHERE h.kind = 'overspeed' AND h.occurred_at >= $1 AND h.occurred_at < $2
+          AND ($3 = '' OR h.vehicle_id::text = $3)
+          AND ($4 = '' OR h.driver_id::text = $4)
+          AND ($5 = '' OR v.group_id::text = $5)
+          AND h.ended_at - h.occurred_at >= $6 * INTERVAL '1 second'
+        ORDER BY h.occurred_at
+    `, q.From, q.To, q.VehicleID, q.DriverID, q.GroupID, q.MinDuration.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.SpeedingViolation{}
+	for rows.Next() {
+		var sv model.SpeedingViolation
+		h := &sv.HarshEvent
+		if err := rows.Scan(&h.ID, &h.VehicleID, &h.TripID, &h.DriverID, &h.Kind, &h.Source, &h.OccurredAt, &h.EndedAt,
+			&h.Location[0], &h.Location[1], &h.Speed, &h.Value, &h.LimitKmh, &h.ExcessKmh, &h.LimitSource, &h.Road,
+			&sv.PlateNumber, &sv.DriverName, &sv.DurationSeconds); err != nil {
+			return nil, err
+		}
+		res = append(res, sv)
+	}
+	return res, rows.Err()
+}
+
+// TripHarshCounts is a driven trip with the number of harsh events of each kind
+type TripHarshCounts struct {
+	TripID     uuid.UUID
+	VehicleID  uuid.UUID
+	DriverID   uuid.UUID
+	StartTime  time.Time
+	DistanceKm float64
+	Counts     map[string]int
+}
+
+// DriverTripCounts returns the trips with a driver starting in [from, to),
+// optionally of one driver or of vehicles in one group, with their harsh
+// event counts, oldest first
+func (r *Repo) DriverTripCounts(ctx context.Context, from, to time.Time, driverID, groupID string) ([]TripHarshCounts, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT t.id, t.vehicle_id, t.driver_id, t.start_time, t.mileage,
+               COUNT(h.id) FILTER (WHERE h.kind = 'harsh_acceleration'),
+               COUNT(h.id) FILTER (WHERE h.kind = 'harsh_braking'),
+               COUNT(h.id) FILTER (WHERE h.kind = 'harsh_cornering'),
+               COUNT(h.id) FILTER (WHERE h.kind = 'overspeed')
+        FROM trips t
+        JOIN vehicle v ON v.id = t.vehicle_id
+        LEFT JOIN harsh_events h ON h.trip_id = t.id
+        WHERE t.start_time >= $1 AND t.start_time < $2 AND t.driver_id IS NOT NULL
+          AND ($3 = '' OR t.driver_id::text = $3)
+          AND ($4 = '' OR v.group_id::text = $4)
+        GROUP BY t.id
+        ORDER BY t.start_time
+    `, from, to, driverID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []TripHarshCounts{}
+	for rows.Next() {
+		var t TripHarshCounts
+		var accel, brake, corner, over int
+		if err := rows.Scan(&t.TripID, &t.VehicleID, &t.DriverID, &t.StartTime, &t.DistanceKm,
+			&accel, &brake, &corner, &over); err != nil {
+			return nil, err
+		}
+		t.Counts = map[string]int{
+			model.HarshAcceleration: accel,
+			model.HarshBraking:      brake,
+			model.HarshCornering:    corner,
+			model.Overspeed:         over,
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repo) GetScoringSettings(ctx context.Context) (model.ScoringSettings, error) {
+	var s model.ScoringSettings
+	var weights []byte
+	err := r.db.QueryRowContext(ctx, `
+        SELECT weights, min_distance_km, updated_at
+        FROM scoring_settings
+        WHERE id
+    `).Scan(&weights, &s.MinDistanceKm, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(weights, &s.Weights)
+	return s, err
+}
+
+func (r *Repo) SaveScoringSettings(ctx context.Context, s model.ScoringSettings) error {
+	weights, err := json.Marshal(s.Weights)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+        INSERT INTO scoring_settings (id, weights, min_distance_km, updated_at)
+        VALUES (TRUE, $1::jsonb, $2, $3)
+        ON CONFLICT (id) DO UPDATE
+          SET weights = EXCLUDED.weights,
+              min_distance_km = EXCLUDED.min_distance_km,
+              updated_at = EXCLUDED.updated_at
+    `, string(weights), s.MinDistanceKm, s.UpdatedAt)
+	return err
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+)
+
+// LastPositionBefore returns the newest stored fix of a vehicle older than
+// at, or nil when there is none
+func (r *Repo) LastPositionBefore(ctx context.Context, vehicleID string, at time.Time) (*model.Position, error) {
+	var p model.Position
+	err := r.db.QueryRowContext(ctx, `
+        SELECT vehicle_id, recorded_at, lon, lat, speed, heading, ignition
+        FROM positions
+        WHERE vehicle_id = $1 AND recorded_at < $2
+        ORDER BY recorded_at DESC
+        LIMIT 1
+    `, vehicleID, at).Scan(&p.VehicleID, &p.Timestamp, &p.Location[0], &p.Location[1], &p.Speed, &p.Heading, &p.Ignition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+const rejectedColumns = `id, vehicle_id, recorded_at, received_at, lon, lat, speed, accuracy, satellites, reason, detail`
+
+func scanRejected(row scanner) (model.RejectedPosition, error) {
+	var p model.RejectedPosition
+	err := row.Scan(&p.ID, &p.VehicleID, &p.Timestamp, &p.ReceivedAt, &p.Location[0], &p.Location[1], &p.Speed,
+		&p.Accuracy, &p.Satellites, &p.Reason, &p.Detail)
+	return p, err
+}
+
+// LastRejected returns the newest fix rejected for reason in (after, before),
+// or nil when there is none
+func (r *Repo) LastRejected(ctx context.Context, vehicleID, reason string, after, before time.Time) (*model.RejectedPosition, error) {
+	p, err := scanRejected(r.db.QueryRowContext(ctx, `
+        SELECT `+rejectedColumns+`
+        FROM rejected_positions
+        WHERE vehicle_id = $1 AND reason = $2 AND recorded_at > $3 AND recorded_at < $4
+        ORDER BY recorded_at DESC
+        LIMIT 1
+    `, vehicleID, reason, after, before))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// InsertRejectedPosition records a fix dropped by the filter and reports
+// whether it was new. A fix already recorded for the vehicle and timestamp
+// is kept.
+func (r *Repo) InsertRejectedPosition(ctx context.Context, p model.RejectedPosition) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO rejected_positions (vehicle_id, recorded_at, lon, lat, speed, accuracy, satellites, reason, detail)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (vehicle_id, recorded_at) DO NOTHING
+    `, p.VehicleID, p.Timestamp, p.Location[0], p.Location[1], p.Speed, p.Accuracy, p.Satellites, p.Reason, p.Detail)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetRejectedPositions returns fixes of a vehicle rejected in [from, to),
+// oldest first, optionally only those rejected for reason
+func (r *Repo) GetRejectedPositions(ctx context.Context, vehicleID string, from, to time.Time, reason string) ([]model.RejectedPosition, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+rejectedColumns+`
+        FROM rejected_positions
+        WHERE vehicle_id = $1 AND recorded_at >= $2 AND recorded_at < $3
+          AND ($4 = '' OR reason = $4)
+        ORDER BY recorded_at
+    `, vehicleID, from, to, reason)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.RejectedPosition{}
+	for rows.Next() {
+		p, err := scanRejected(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// GetFilterState returns the smoothing state of a vehicle locked for
+// update, or nil when none is stored yet
+func (r *Repo) GetFilterState(ctx context.Context, vehicleID string) (*model.FilterState, error) {
+	var st model.FilterState
+	err := r.db.QueryRowContext(ctx, `
+        SELECT lon, lat, variance, fix_at
+        FROM position_filter_state
+        WHERE vehicle_id = $1
+        FOR UPDATE
+    `, vehicleID).Scan(&st.Location[0], &st.Location[1], &st.Variance, &st.FixAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// SaveFilterState stores the smoothing state of a vehicle
+func (r *Repo) SaveFilterState(ctx context.Context, vehicleID string, st model.FilterState) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO position_filter_state (vehicle_id, lon, lat, variance, fix_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (vehicle_id) DO UPDATE
+          SET lon = EXCLUDED.lon, lat = EXCLUDED.lat, variance = EXCLUDED.variance, fix_at = EXCLUDED.fix_at
+    `, vehicleID, st.Location[0], st.Location[1], st.Variance, st.FixAt)
+	return err
+}
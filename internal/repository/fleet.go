@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrDriverNotFound = errors.New("driver not found")
+	ErrGroupExists    = errors.New("group already exists")
+)
+
+func (r *Repo) CreateGroup(ctx context.Context, g model.Group) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO vehicle_groups (id, name, created_at) VALUES ($1, $2, $3)
+    `, g.ID, g.Name, g.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrGroupExists
+	}
+	return err
+}
+
+func (r *Repo) ListGroups(ctx context.Context) ([]model.Group, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, created_at FROM vehicle_groups ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.Group{}
+	for rows.Next() {
+		var g model.Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, g)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repo) CreateDriver(ctx context.Context, d model.Driver) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO drivers (id, name, license_number, created_at) VALUES ($1, $2, NULLIF($3, ''), $4)
+    `, d.ID, d.Name, d.LicenseNumber, d.CreatedAt)
+	return err
+}
+
+func (r *Repo) ListDrivers(ctx context.Context) ([]model.Driver, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, COALESCE(license_number, ''), created_at FROM drivers ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.Driver{}
+	for rows.Next() {
+		var d model.Driver
+		if err := rows.Scan(&d.ID, &d.Name, &d.LicenseNumber, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// AssignVehicle sets the group and current driver of a vehicle; nil clears them
+func (r *Repo) AssignVehicle(ctx context.Context, vehicleID string, groupID, driverID *uuid.UUID) error {
+	if groupID != nil {
+		var ok bool
+		if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM vehicle_groups WHERE id = $1)`, groupID).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return ErrGroupNotFound
+		}
+	}
+	if driverID != nil {
+		var ok bool
+		if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM drivers WHERE id = $1)`, driverID).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return ErrDriverNotFound
+		}
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE vehicle SET group_id = $2, driver_id = $3 WHERE id = $1`, vehicleID, groupID, driverID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrNoVehicleFound
+		}
+		return err
+	}
+	return nil
+}
+
+// TripDriver returns the driver of a trip starting now: the driver the device
+// reported when it is known, otherwise the driver assigned to the vehicle
+func (r *Repo) TripDriver(ctx context.Context, vehicleID string, reported *uuid.UUID) (*uuid.UUID, error) {
+	var id *uuid.UUID
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COALESCE((SELECT id FROM drivers WHERE id = $2), v.driver_id)
+        FROM vehicle v
+        WHERE v.id = $1
+    `, vehicleID, reported).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+)
+
+// RecentRawFuel returns up to n raw fuel levels of a vehicle recorded
+// before at, newest first
+func (r *Repo) RecentRawFuel(ctx context.Context, vehicleID string, at time.Time, n int) ([]float64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT raw_level_l FROM fuel_readings
+        WHERE vehicle_id = $1 AND recorded_at < $2
+        ORDER BY recorded_at DESC
+        LIMIT $3
+    `, vehicleID, at, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []float64
+	for rows.Next() {
+		var v float64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
+
+// InsertFuelReading stores a fuel sample and reports whether it was new
+func (r *Repo) InsertFuelReading(ctx context.Context, f model.FuelReading) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO fuel_readings (vehicle_id, recorded_at, raw_level_l, level_l, speed)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (vehicle_id, recorded_at) DO NOTHING
+    `, f.VehicleID, f.Timestamp, f.RawLevel, f.Level, f.Speed)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetFuelReadings returns the fuel samples of a vehicle in [from, to), oldest first
+func (r *Repo) GetFuelReadings(ctx context.Context, vehicleID string, from, to time.Time) ([]model.FuelReading, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT vehicle_id, recorded_at, raw_level_l, level_l, speed
+        FROM fuel_readings
+        WHERE vehicle_id = $1 AND recorded_at >= $2 AND recorded_at < $3
+        ORDER BY recorded_at
+    `, vehicleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.FuelReading{}
+	for rows.Next() {
+		var f model.FuelReading
+		if err := rows.Scan(&f.VehicleID, &f.Timestamp, &f.RawLevel, &f.Level, &f.Speed); err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, rows.Err()
+}
+
+// GetFuelState returns the fuel detection state of a vehicle locked for
+// update, or nil before its first reading
+func (r *Repo) GetFuelState(ctx context.Context, vehicleID string) (*model.FuelState, error) {
+	var st model.FuelState
+	var kind sql.NullString
+	var startAt sql.NullTime
+	var startLevel, lon, lat sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT level_l, at, pending_kind, pending_start_at, pending_start_level_l, pending_lon, pending_lat
+        FROM fuel_state
+        WHERE vehicle_id = $1
+        FOR UPDATE
+    `, vehicleID).Scan(&st.Level, &st.At, &kind, &startAt, &startLevel, &lon, &lat)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kind.Valid {
+		st.Pending = &model.FuelEvent{
+			Kind:       kind.String,
+			StartAt:    startAt.Time,
+			StartLevel: startLevel.Float64,
+			EndAt:      st.At,
+			EndLevel:   st.Level,
+			Location:   [2]float64{lon.Float64, lat.Float64},
+		}
+	}
+	return &st, nil
+}
+
+// SaveFuelState stores the fuel detection state of a vehicle
+func (r *Repo) SaveFuelState(ctx context.Context, vehicleID string, st model.FuelState) error {
+	var kind *string
+	var startAt *time.Time
+	var startLevel, lon, lat *float64
+	if p := st.Pending; p != nil {
+		kind, startAt, startLevel, lon, lat = &p.Kind, &p.StartAt, &p.StartLevel, &p.Location[0], &p.Location[1]
+	}
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO fuel_state (vehicle_id, level_l, at, pending_kind, pending_start_at, pending_start_level_l,
+                                pending_lon, pending_lat)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (vehicle_id) DO UPDATE SET
+            level_l = EXCLUDED.level_l,
+            at = EXCLUDED.at,
+            pending_kind = EXCLUDED.pending_kind,
+            pending_start_at = EXCLUDED.pending_start_at,
+            pending_start_level_l = EXCLUDED.pending_start_level_l,
+            pending_lon = EXCLUDED.pending_lon,
+            pending_lat = EXCLUDED.pending_lat
+    `, vehicleID, st.Level, st.At, kind, startAt, startLevel, lon, lat)
+	return err
+}
+
+// InsertFuelEvent stores a detected refuel or drop
+func (r *Repo) InsertFuelEvent(ctx context.Context, e model.FuelEvent) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO fuel_events (id, vehicle_id, kind, start_at, end_at, start_level_l, end_level_l, amount_l, lon, lat)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `, e.ID, e.VehicleID, e.Kind, e.StartAt, e.EndAt, e.StartLevel, e.EndLevel, e.Amount, e.Location[0], e.Location[1])
+	return err
+}
+
+// GetFuelEvents returns the refuels and drops of a vehicle starting in
+// [from, to), oldest first, optionally only one kind
+func (r *Repo) GetFuelEvents(ctx context.Context, vehicleID string, from, to time.Time, kind string) ([]model.FuelEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, vehicle_id, kind, start_at, end_at, start_level_l, end_level_l, amount_l, lon, lat
+        FROM fuel_events
+        WHERE vehicle_id = $1 AND start_at >= $2 AND start_at < $3 AND ($4 = '' OR kind = $4)
+        ORDER BY start_at
+    `, vehicleID, from, to, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.FuelEvent{}
+	for rows.Next() {
+		var e model.FuelEvent
+		if err := rows.Scan(&e.ID, &e.VehicleID, &e.Kind, &e.StartAt, &e.EndAt, &e.StartLevel, &e.EndLevel,
+			&e.Amount, &e.Location[0], &e.Location[1]); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrHOSRuleSetNotFound is returned for an unknown rule set
+	ErrHOSRuleSetNotFound = errors.New("hos rule set not found")
+	// ErrHOSRuleSetExists is returned when a rule set name is taken
+	ErrHOSRuleSetExists = errors.New("hos rule set already exists")
+)
+
+const hosRuleSetColumns = `r.id, r.name, r.max_continuous_driving_min, r.min_break_min, r.min_break_part_min,
+       r.max_daily_driving_min, r.min_daily_rest_min, r.max_duty_span_min, r.max_weekly_driving_min,
+       r.max_fortnight_driving_min, r.warn_before_min, r.is_default, r.created_at`
+
+func scanHOSRuleSet(row scanner, extra ...interface{}) (model.HOSRuleSet, error) {
+	var rs model.HOSRuleSet
+	err := row.Scan(append(extra, &rs.ID, &rs.Name, &rs.MaxContinuousDrivingMin, &rs.MinBreakMin, &rs.MinBreakPartMin,
+		&rs.MaxDailyDrivingMin, &rs.MinDailyRestMin, &rs.MaxDutySpanMin, &rs.MaxWeeklyDrivingMin,
+		&rs.MaxFortnightDrivingMin, &rs.WarnBeforeMin, &rs.IsDefault, &rs.CreatedAt)...)
+	return rs, err
+}
+
+// ListHOSRuleSets returns the rule sets by name
+func (r *Repo) ListHOSRuleSets(ctx context.Context) ([]model.HOSRuleSet, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+hosRuleSetColumns+` FROM hos_rule_sets r ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.HOSRuleSet{}
+	for rows.Next() {
+		rs, err := scanHOSRuleSet(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rs)
+	}
+	return res, rows.Err()
+}
+
+// GetHOSRuleSet returns a rule set by id
+func (r *Repo) GetHOSRuleSet(ctx context.Context, id string) (model.HOSRuleSet, error) {
+	rs, err := scanHOSRuleSet(r.db.QueryRowContext(ctx, `SELECT `+hosRuleSetColumns+` FROM hos_rule_sets r WHERE r.id::text = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rs, ErrHOSRuleSetNotFound
+	}
+	return rs, err
+}
+
+// SaveHOSRuleSet inserts or replaces a rule set. A default rule set takes
+// over from the previous default, so call it in a transaction.
+func (r *Repo) SaveHOSRuleSet(ctx context.Context, rs model.HOSRuleSet) error {
+	if rs.IsDefault {
+		if _, err := r.db.ExecContext(ctx, `UPDATE hos_rule_sets SET is_default = FALSE WHERE is_default AND id <> $1`, rs.ID); err != nil {
+			return err
+		}
+	}
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO hos_rule_sets (id, name, max_continuous_driving_min, min_break_min, min_break_part_min,
+                                   max_daily_driving_min, min_daily_rest_min, max_duty_span_min,
+                                   max_weekly_driving_min, max_fortnight_driving_min, warn_before_min,
+                                   is_default, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+        ON CONFLICT (id) DO UPDATE
+          SET name = EXCLUDED.name,
+              max_continuous_driving_min = EXCLUDED.max_continuous_driving_min,
+              min_break_min = EXCLUDED.min_break_min,
+              min_break_part_min = EXCLUDED.min_break_part_min,
+              max_daily_driving_min = EXCLUDED.max_daily_driving_min,
+              min_daily_rest_min = EXCLUDED.min_daily_rest_min,
+              max_duty_span_min = EXCLUDED.max_duty_span_min,
+              max_weekly_driving_min = EXCLUDED.max_weekly_driving_min,
+              max_fortnight_driving_min = EXCLUDED.max_fortnight_driving_min,
+              warn_before_min = EXCLUDED.warn_before_min,
+              is_default = EXCLUDED.is_default
+    `, rs.ID, rs.Name, rs.MaxContinuousDrivingMin, rs.MinBreakMin, rs.MinBreakPartMin, rs.MaxDailyDrivingMin,
+		rs.MinDailyRestMin, rs.MaxDutySpanMin, rs.MaxWeeklyDrivingMin, rs.MaxFortnightDrivingMin, rs.WarnBeforeMin,
+		rs.IsDefault, rs.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "hos_rule_sets_name_key" {
+		return ErrHOSRuleSetExists
+	}
+	return err
+}
+
+// SetDriverHOSRuleSet holds a driver to a rule set; nil reverts to the default
+func (r *Repo) SetDriverHOSRuleSet(ctx context.Context, driverID string, ruleSetID *uuid.UUID) error {
+	if ruleSetID != nil {
+		if _, err := r.GetHOSRuleSet(ctx, ruleSetID.String()); err != nil {
+			return err
+		}
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE drivers SET hos_rule_set_id = $2 WHERE id::text = $1`, driverID, ruleSetID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrDriverNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// HOSDriver is a driver with the rule set that applies to them
+type HOSDriver struct {
+	ID      uuid.UUID
+	Name    string
+	RuleSet model.HOSRuleSet
+}
+
+// HOSDrivers returns the drivers with their own rule set or the default
+// one; drivers without either are left out. An empty driverID returns
+// every driver.
+func (r *Repo) HOSDrivers(ctx context.Context, driverID string) ([]HOSDriver, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT d.id, d.name, `+hosRuleSetColumns+`
+        FROM drivers d
+        JOIN hos_rule_sets r ON r.id = COALESCE(d.hos_rule_set_id, (SELECT id FROM hos_rule_sets WHERE is_default))
+        WHERE $1 = '' OR d.id::text = $1
+        ORDER BY d.name, d.id
+    `, driverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []HOSDriver{}
+	for rows.Next() {
+		var d HOSDriver
+		if d.RuleSet, err = scanHOSRuleSet(rows, &d.ID, &d.Name); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// HOSTrip is a trip of a driver with the stops that interrupted or ended it
+type HOSTrip struct {
+	ID        uuid.UUID
+	VehicleID uuid.UUID
+	DriverID  uuid.UUID
+	Start     time.Time
+	End       time.Time
+	Stops     []model.Stop // by arrival
+}
+
+// HOSTrips returns the trips with a driver overlapping [from, to), by driver
+// and start time. A stop belongs to a trip when it begins on the trip's
+// vehicle between the trip's start and stopAfter past its last movement.
+func (r *Repo) HOSTrips(ctx context.Context, from, to time.Time, driverID string, stopAfter time.Duration) ([]HOSTrip, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT t.id, t.vehicle_id, t.driver_id, t.start_time, t.end_time,
+               s.arrival, s.departure, s.idling
+        FROM trips t
+        LEFT JOIN stops s ON s.vehicle_id = t.vehicle_id
+                         AND s.arrival >= (t.start_time AT TIME ZONE 'UTC')
+                         AND s.arrival <= (t.end_time AT TIME ZONE 'UTC') + $4 * INTERVAL '1 second'
+        WHERE t.driver_id IS NOT NULL
+          AND t.end_time >= ($1::timestamptz AT TIME ZONE 'UTC') AND t.start_time < ($2::timestamptz AT TIME ZONE 'UTC')
+          AND ($3 = '' OR t.driver_id::text = $3)
+        ORDER BY t.driver_id, t.start_time, t.id, s.arrival
+    `, from, to, driverID, stopAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []HOSTrip{}
+	for rows.Next() {
+		var t HOSTrip
+		var arrival, departure *time.Time
+		var idling *bool
+		if err := rows.Scan(&t.ID, &t.VehicleID, &t.DriverID, &t.Start, &t.End, &arrival, &departure, &idling); err != nil {
+			return nil, err
+		}
+		if n := len(res); n == 0 || res[n-1].ID != t.ID {
+			res = append(res, t)
+		}
+		if arrival != nil {
+			last := &res[len(res)-1]
+			last.Stops = append(last.Stops, model.Stop{
+				VehicleID: t.VehicleID,
+				Arrival:   *arrival,
+				Departure: *departure,
+				Idling:    *idling,
+			})
+		}
+	}
+	return res, rows.Err()
+}
+
+// MarkHOSWarning records a warning about a limit in a period and reports
+// whether it had not been raised before
+func (r *Repo) MarkHOSWarning(ctx context.Context, driverID uuid.UUID, kind string, periodStart, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO hos_warnings (driver_id, kind, period_start, raised_at) VALUES ($1, $2, $3, $4)
+        ON CONFLICT DO NOTHING
+    `, driverID, kind, periodStart, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// PruneHOSWarnings removes warnings raised before a time
+func (r *Repo) PruneHOSWarnings(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM hos_warnings WHERE raised_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"fleet-tracker-service/internal/model"
+)
+
+var ErrImportNotFound = errors.New("import job not found")
+
+const importJobColumns = `id, format, file_name, checksum, vehicle_id, options, status, size_bytes, read_bytes,
+               processed, imported, duplicates, rejected, failed, COALESCE(error, ''), created_at, finished_at`
+
+func scanImportJob(row interface{ Scan(...interface{}) error }) (model.ImportJob, error) {
+	var j model.ImportJob
+	var opts []byte
+	err := row.Scan(&j.ID, &j.Format, &j.FileName, &j.Checksum, &j.VehicleID, &opts, &j.Status, &j.SizeBytes, &j.ReadBytes,
+		&j.Processed, &j.Imported, &j.Duplicates, &j.Rejected, &j.Failed, &j.Error, &j.CreatedAt, &j.FinishedAt)
+	j.Options = opts
+	return j, err
+}
+
+func (r *Repo) CreateImportJob(ctx context.Context, j model.ImportJob) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO import_jobs (id, format, file_name, checksum, vehicle_id, options, status, size_bytes, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8, $9)
+    `, j.ID, j.Format, j.FileName, j.Checksum, j.VehicleID, string(j.Options), j.Status, j.SizeBytes, j.CreatedAt)
+	return err
+}
+
+func (r *Repo) GetImportJob(ctx context.Context, id string) (model.ImportJob, error) {
+	j, err := scanImportJob(r.db.QueryRowContext(ctx, `
+        SELECT `+importJobColumns+`
+        FROM import_jobs
+        WHERE id = $1
+    `, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, ErrImportNotFound
+	}
+	return j, err
+}
+
+// FindImportJob returns the newest job for the same file and options that
+// has not failed, so an identical upload can reuse it
+func (r *Repo) FindImportJob(ctx context.Context, checksum string) (model.ImportJob, error) {
+	j, err := scanImportJob(r.db.QueryRowContext(ctx, `
+        SELECT `+importJobColumns+`
+        FROM import_jobs
+        WHERE checksum = $1 AND status <> $2
+        ORDER BY created_at DESC
+        LIMIT 1
+    `, checksum, model.ImportFailed))
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, ErrImportNotFound
+	}
+	return j, err
+}
+
+// GetUnfinishedImportJobs returns queued and running jobs, oldest first
+func (r *Repo) GetUnfinishedImportJobs(ctx context.Context) ([]model.ImportJob, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+importJobColumns+`
+        FROM import_jobs
+        WHERE status IN ($1, $2)
+        ORDER BY created_at
+    `, model.ImportQueued, model.ImportRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.ImportJob
+	for rows.Next() {
+		j, err := scanImportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, j)
+	}
+	return res, rows.Err()
+}
+
+// UpdateImportJob saves the status, counters and error of a job
+func (r *Repo) UpdateImportJob(ctx context.Context, j model.ImportJob) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE import_jobs
+        SET status = $2, read_bytes = $3, processed = $4, imported = $5, duplicates = $6, rejected = $7,
+            failed = $8, error = NULLIF($9, ''), finished_at = $10
+        WHERE id = $1
+    `, j.ID, j.Status, j.ReadBytes, j.Processed, j.Imported, j.Duplicates, j.Rejected, j.Failed, j.Error, j.FinishedAt)
+	return err
+}
@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrJobNotFound is returned for an unknown dispatch job
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrAttachmentNotFound is returned for an unknown job attachment
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// activeJobStatuses are the statuses in which a job follows its vehicle
+var activeJobStatuses = []string{model.JobAssigned, model.JobAtPickup, model.JobPickedUp, model.JobAtDrop}
+
+const jobColumns = `j.id, j.reference, j.description, j.priority, j.status, j.status_at, j.vehicle_id, j.assigned_at,
+       j.pickup_lon, j.pickup_lat, j.pickup_address, j.pickup_radius_m, j.pickup_window_start, j.pickup_window_end,
+       j.pickup_arrived_at, j.pickup_departed_at,
+       j.drop_lon, j.drop_lat, j.drop_address, j.drop_radius_m, j.drop_window_start, j.drop_window_end,
+       j.drop_arrived_at, j.drop_departed_at,
+       j.delivered_at, j.cancelled_at, j.created_at`
+
+func scanJob(row scanner) (model.Job, error) {
+	var j model.Job
+	p, d := &j.Pickup, &j.Drop
+	err := row.Scan(&j.ID, &j.Reference, &j.Description, &j.Priority, &j.Status, &j.StatusAt, &j.VehicleID, &j.AssignedAt,
+		&p.Location[0], &p.Location[1], &p.Address, &p.RadiusM, &p.WindowStart, &p.WindowEnd, &p.ArrivedAt, &p.DepartedAt,
+		&d.Location[0], &d.Location[1], &d.Address, &d.RadiusM, &d.WindowStart, &d.WindowEnd, &d.ArrivedAt, &d.DepartedAt,
+		&j.DeliveredAt, &j.CancelledAt, &j.CreatedAt)
+	return j, err
+}
+
+// checkVehicle returns ErrNoVehicleFound unless the vehicle exists
+func (r *Repo) checkVehicle(ctx context.Context, id uuid.UUID) error {
+	var ok bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM vehicle WHERE id = $1)`, id).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoVehicleFound
+	}
+	return nil
+}
+
+// CreateJob stores a new job. Its vehicle, if any, must exist.
+func (r *Repo) CreateJob(ctx context.Context, j model.Job) error {
+	if j.VehicleID != nil {
+		if err := r.checkVehicle(ctx, *j.VehicleID); err != nil {
+			return err
+		}
+	}
+	p, d := j.Pickup, j.Drop
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO jobs (id, reference, description, priority, status, status_at, vehicle_id, assigned_at,
+                          pickup_lon, pickup_lat, pickup_address, pickup_radius_m, pickup_window_start, pickup_window_end,
+                          drop_lon, drop_lat, drop_address, drop_radius_m, drop_window_start, drop_window_end, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+    `, j.ID, j.Reference, j.Description, j.Priority, j.Status, j.StatusAt, j.VehicleID, j.AssignedAt,
+		p.Location[0], p.Location[1], p.Address, p.RadiusM, p.WindowStart, p.WindowEnd,
+		d.Location[0], d.Location[1], d.Address, d.RadiusM, d.WindowStart, d.WindowEnd, j.CreatedAt)
+	return err
+}
+
+func (r *Repo) getJob(ctx context.Context, id, lock string) (model.Job, error) {
+	j, err := scanJob(r.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs j WHERE j.id::text = $1 `+lock, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, ErrJobNotFound
+	}
+	return j, err
+}
+
+// GetJob returns a job by id
+func (r *Repo) GetJob(ctx context.Context, id string) (model.Job, error) {
+	return r.getJob(ctx, id, "")
+}
+
+// GetJobForUpdate returns a job by id locked for update
+func (r *Repo) GetJobForUpdate(ctx context.Context, id string) (model.Job, error) {
+	return r.getJob(ctx, id, "FOR UPDATE")
+}
+
+// SaveJob stores the assignment and progress of a job. A newly assigned
+// vehicle must exist.
+func (r *Repo) SaveJob(ctx context.Context, j model.Job) error {
+	if j.VehicleID != nil {
+		if err := r.checkVehicle(ctx, *j.VehicleID); err != nil {
+			return err
+		}
+	}
+	p, d := j.Pickup, j.Drop
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE jobs SET status = $2, status_at = $3, vehicle_id = $4, assigned_at = $5,
+               pickup_arrived_at = $6, pickup_departed_at = $7, drop_arrived_at = $8, drop_departed_at = $9,
+               delivered_at = $10, cancelled_at = $11
+        WHERE id = $1
+    `, j.ID, j.Status, j.StatusAt, j.VehicleID, j.AssignedAt, p.ArrivedAt, p.DepartedAt, d.ArrivedAt, d.DepartedAt,
+		j.DeliveredAt, j.CancelledAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrJobNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// ActiveJobs returns the jobs a vehicle is working on, locked for update,
+// oldest first
+func (r *Repo) ActiveJobs(ctx context.Context, vehicleID string) ([]model.Job, error) {
+	return r.queryJobs(ctx, `
+        SELECT `+jobColumns+`
+        FROM jobs j
+        WHERE j.vehicle_id = $1 AND j.status = ANY($2)
+        ORDER BY j.created_at
+        FOR UPDATE
+    `, vehicleID, pq.Array(activeJobStatuses))
+}
+
+// JobQuery selects jobs; empty fields do not filter. Status "active"
+// matches every status in which a job follows its vehicle.
+type JobQuery struct {
+	Status    string
+	VehicleID string
+	Priority  string
+	From, To  time.Time // created in [From, To) when From is set
+	Limit     int
+}
+
+// ListJobs returns the jobs matching q, most urgent first, then by the end
+// of the pickup window and creation time
+func (r *Repo) ListJobs(ctx context.Context, q JobQuery) ([]model.Job, error) {
+	statuses := []string{}
+	switch q.Status {
+	case "":
+	case "active":
+		statuses = activeJobStatuses
+	default:
+		statuses = []string{q.Status}
+	}
+	var from, to *time.Time
+	if !q.From.IsZero() {
+		from, to = &q.From, &q.To
+	}
+	return r.queryJobs(ctx, `
+        SELECT `+jobColumns+`
+        FROM jobs j
+        WHERE (cardinality($1::text[]) = 0 OR j.status = ANY($1))
+          AND ($2 = '' OR j.vehicle_id::text = $2)
+          AND ($3 = '' OR j.priority = $3)
+          AND ($4::timestamptz IS NULL OR (j.created_at >= $4 AND j.created_at < $5))
+        ORDER BY array_position(ARRAY['urgent', 'high', 'normal', 'low'], j.priority),
+                 j.pickup_window_end NULLS LAST, j.created_at
+        LIMIT $6
+    `, pq.Array(statuses), q.VehicleID, q.Priority, from, to, q.Limit)
+}
+
+func (r *Repo) queryJobs(ctx context.Context, query string, args ...interface{}) ([]model.Job, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, j)
+	}
+	return res, rows.Err()
+}
+
+// LatestPositions returns the newest stored fix of each vehicle that has one
+func (r *Repo) LatestPositions(ctx context.Context, vehicleIDs []uuid.UUID) (map[uuid.UUID]model.Position, error) {
+	ids := make([]string, len(vehicleIDs))
+	for i, id := range vehicleIDs {
+		ids[i] = id.String()
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT p.vehicle_id, p.recorded_at, p.lon, p.lat, p.speed, p.heading, p.ignition
+        FROM unnest($1::uuid[]) AS v(id)
+        CROSS JOIN LATERAL (
+            SELECT * FROM positions WHERE vehicle_id = v.id ORDER BY recorded_at DESC LIMIT 1
+        ) p
+    `, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[uuid.UUID]model.Position{}
+	for rows.Next() {
+		var p model.Position
+		if err := rows.Scan(&p.VehicleID, &p.Timestamp, &p.Location[0], &p.Location[1], &p.Speed, &p.Heading, &p.Ignition); err != nil {
+			return nil, err
+		}
+		res[p.VehicleID] = p
+	}
+	return res, rows.Err()
+}
+
+// InsertJobAttachment records a stored proof-of-delivery file
+func (r *Repo) InsertJobAttachment(ctx context.Context, a model.JobAttachment) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO job_attachments (id, job_id, kind, file_name, content_type, size_bytes, storage_key, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `, a.ID, a.JobID, a.Kind, a.FileName, a.ContentType, a.SizeBytes, a.StorageKey, a.CreatedAt)
+	return err
+}
+
+const attachmentColumns = `id, job_id, kind, file_name, content_type, size_bytes, storage_key, created_at`
+
+func scanAttachment(row scanner) (model.JobAttachment, error) {
+	var a model.JobAttachment
+	err := row.Scan(&a.ID, &a.JobID, &a.Kind, &a.FileName, &a.ContentType, &a.SizeBytes, &a.StorageKey, &a.CreatedAt)
+	return a, err
+}
+
+// GetJobAttachments returns the attachments of a job, oldest first
+func (r *Repo) GetJobAttachments(ctx context.Context, jobID string) ([]model.JobAttachment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+attachmentColumns+` FROM job_attachments WHERE job_id::text = $1 ORDER BY created_at
+    `, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.JobAttachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+// GetJobAttachment returns one attachment of a job
+func (r *Repo) GetJobAttachment(ctx context.Context, jobID, id string) (model.JobAttachment, error) {
+	a, err := scanAttachment(r.db.QueryRowContext(ctx, `
+        SELECT `+attachmentColumns+` FROM job_attachments WHERE job_id::text = $1 AND id::text = $2
+    `, jobID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrAttachmentNotFound
+	}
+	return a, err
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrPlanNotFound is returned for an unknown maintenance plan
+var ErrPlanNotFound = errors.New("maintenance plan not found")
+
+const planColumns = `p.id, p.name, p.vehicle_id, p.group_id, p.interval_km, p.interval_hours, p.interval_days,
+       p.due_soon_km, p.due_soon_hours, p.due_soon_days, p.created_at`
+
+func scanPlan(row scanner, extra ...interface{}) (model.MaintenancePlan, error) {
+	var p model.MaintenancePlan
+	err := row.Scan(append([]interface{}{&p.ID, &p.Name, &p.VehicleID, &p.GroupID, &p.IntervalKm, &p.IntervalHours,
+		&p.IntervalDays, &p.DueSoonKm, &p.DueSoonHours, &p.DueSoonDays, &p.CreatedAt}, extra...)...)
+	return p, err
+}
+
+// CreatePlan stores a maintenance plan. The vehicle or group must exist.
+func (r *Repo) CreatePlan(ctx context.Context, p model.MaintenancePlan) error {
+	var ok bool
+	var err error
+	if p.VehicleID != nil {
+		err = r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM vehicle WHERE id = $1)`, p.VehicleID).Scan(&ok)
+		if err == nil && !ok {
+			return ErrNoVehicleFound
+		}
+	} else {
+		err = r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM vehicle_groups WHERE id = $1)`, p.GroupID).Scan(&ok)
+		if err == nil && !ok {
+			return ErrGroupNotFound
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+        INSERT INTO maintenance_plans (id, name, vehicle_id, group_id, interval_km, interval_hours, interval_days,
+                                       due_soon_km, due_soon_hours, due_soon_days, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+    `, p.ID, p.Name, p.VehicleID, p.GroupID, p.IntervalKm, p.IntervalHours, p.IntervalDays,
+		p.DueSoonKm, p.DueSoonHours, p.DueSoonDays, p.CreatedAt)
+	return err
+}
+
+// GetPlan returns a maintenance plan by id
+func (r *Repo) GetPlan(ctx context.Context, id string) (model.MaintenancePlan, error) {
+	p, err := scanPlan(r.db.QueryRowContext(ctx, `SELECT `+planColumns+` FROM maintenance_plans p WHERE p.id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrPlanNotFound
+	}
+	return p, err
+}
+
+// ListPlans returns the maintenance plans, optionally only those of a
+// vehicle or a group, by name
+func (r *Repo) ListPlans(ctx context.Context, vehicleID, groupID string) ([]model.MaintenancePlan, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+planColumns+`
+        FROM maintenance_plans p
+        WHERE ($1 = '' OR p.vehicle_id::text = $1) AND ($2 = '' OR p.group_id::text = $2)
+        ORDER BY p.name, p.created_at
+    `, vehicleID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.MaintenancePlan{}
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// DeletePlan removes a maintenance plan; service records done under it are kept
+func (r *Repo) DeletePlan(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM maintenance_plans WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrPlanNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// MaintenanceTarget is a plan applying to a vehicle with the vehicle's
+// current meters and the stored status, nil before the first computation
+type MaintenanceTarget struct {
+	Plan        model.MaintenancePlan
+	VehicleID   uuid.UUID
+	OdometerKm  float64
+	EngineHours float64
+	Status      *MaintenanceStatus
+}
+
+// MaintenanceStatus is the stored progress of a plan for a vehicle. Without
+// a BaseServiceID the base is when the plan started applying.
+type MaintenanceStatus struct {
+	BaseAt          time.Time
+	BaseOdometerKm  float64
+	BaseEngineHours float64
+	BaseServiceID   *uuid.UUID
+	State           string
+	NotifiedState   string
+}
+
+// MaintenanceFilter narrows MaintenanceTargets; empty fields match all
+type MaintenanceFilter struct {
+	VehicleID string
+	GroupID   string
+	PlanID    string
+}
+
+// MaintenanceTargets returns every plan and vehicle pair it applies to: plans
+// of the vehicle itself and of its current group
+func (r *Repo) MaintenanceTargets(ctx context.Context, f MaintenanceFilter) ([]MaintenanceTarget, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+planColumns+`, v.id, COALESCE(m.odometer_km, 0), COALESCE(m.engine_seconds, 0) / 3600,
+               s.base_at, s.base_odometer_km, s.base_engine_hours, s.base_service_id, s.state, s.notified_state
+        FROM maintenance_plans p
+        JOIN vehicle v ON v.id = p.vehicle_id OR v.group_id = p.group_id
+        LEFT JOIN vehicle_meters m ON m.vehicle_id = v.id
+        LEFT JOIN maintenance_status s ON s.plan_id = p.id AND s.vehicle_id = v.id
+        WHERE ($1 = '' OR v.id::text = $1) AND ($2 = '' OR v.group_id::text = $2) AND ($3 = '' OR p.id::text = $3)
+        ORDER BY v.id, p.name
+    `, f.VehicleID, f.GroupID, f.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []MaintenanceTarget{}
+	for rows.Next() {
+		var t MaintenanceTarget
+		var baseAt sql.NullTime
+		var baseKm, baseHours sql.NullFloat64
+		var baseService *uuid.UUID
+		var state, notified sql.NullString
+		t.Plan, err = scanPlan(rows, &t.VehicleID, &t.OdometerKm, &t.EngineHours,
+			&baseAt, &baseKm, &baseHours, &baseService, &state, &notified)
+		if err != nil {
+			return nil, err
+		}
+		if baseAt.Valid {
+			t.Status = &MaintenanceStatus{
+				BaseAt:          baseAt.Time,
+				BaseOdometerKm:  baseKm.Float64,
+				BaseEngineHours: baseHours.Float64,
+				BaseServiceID:   baseService,
+				State:           state.String,
+				NotifiedState:   notified.String,
+			}
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// SaveMaintenanceStatus stores the progress of a plan for a vehicle
+func (r *Repo) SaveMaintenanceStatus(ctx context.Context, planID, vehicleID uuid.UUID, s MaintenanceStatus) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO maintenance_status (plan_id, vehicle_id, base_at, base_odometer_km, base_engine_hours,
+                                        base_service_id, state, notified_state, computed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+        ON CONFLICT (plan_id, vehicle_id) DO UPDATE SET
+            base_at = EXCLUDED.base_at,
+            base_odometer_km = EXCLUDED.base_odometer_km,
+            base_engine_hours = EXCLUDED.base_engine_hours,
+            base_service_id = EXCLUDED.base_service_id,
+            state = EXCLUDED.state,
+            notified_state = EXCLUDED.notified_state,
+            computed_at = NOW()
+    `, planID, vehicleID, s.BaseAt, s.BaseOdometerKm, s.BaseEngineHours, s.BaseServiceID, s.State, s.NotifiedState)
+	return err
+}
+
+// GetMaintenanceStatusForUpdate returns the stored progress of a plan for a
+// vehicle, nil when there is none, locking it until the transaction ends
+func (r *Repo) GetMaintenanceStatusForUpdate(ctx context.Context, planID, vehicleID uuid.UUID) (*MaintenanceStatus, error) {
+	var s MaintenanceStatus
+	err := r.db.QueryRowContext(ctx, `
+        SELECT base_at, base_odometer_km, base_engine_hours, base_service_id, state, notified_state
+        FROM maintenance_status
+        WHERE plan_id = $1 AND vehicle_id = $2
+        FOR UPDATE
+    `, planID, vehicleID).Scan(&s.BaseAt, &s.BaseOdometerKm, &s.BaseEngineHours, &s.BaseServiceID, &s.State, &s.NotifiedState)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// PruneMaintenanceStatus drops the status of plans that no longer apply to
+// a vehicle, for example after it moved to another group
+func (r *Repo) PruneMaintenanceStatus(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+        DELETE FROM maintenance_status s
+        USING maintenance_plans p, vehicle v
+        WHERE p.id = s.plan_id AND v.id = s.vehicle_id
+          AND p.vehicle_id IS DISTINCT FROM v.id AND p.group_id IS DISTINCT FROM v.group_id
+    `)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// InsertServiceRecord stores work done on a vehicle
+func (r *Repo) InsertServiceRecord(ctx context.Context, s model.ServiceRecord) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO service_records (id, vehicle_id, plan_id, performed_at, odometer_km, engine_hours, notes, cost,
+                                     recorded_by, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `, s.ID, s.VehicleID, s.PlanID, s.PerformedAt, s.OdometerKm, s.EngineHours, s.Notes, s.Cost, s.RecordedBy, s.CreatedAt)
+	return err
+}
+
+// GetServiceRecords returns the service history of a vehicle, newest first
+func (r *Repo) GetServiceRecords(ctx context.Context, vehicleID string) ([]model.ServiceRecord, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, vehicle_id, plan_id, performed_at, odometer_km, engine_hours, notes, cost, recorded_by, created_at
+        FROM service_records
+        WHERE vehicle_id = $1
+        ORDER BY performed_at DESC, created_at DESC
+    `, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.ServiceRecord{}
+	for rows.Next() {
+		var s model.ServiceRecord
+		if err := rows.Scan(&s.ID, &s.VehicleID, &s.PlanID, &s.PerformedAt, &s.OdometerKm, &s.EngineHours,
+			&s.Notes, &s.Cost, &s.RecordedBy, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// ListVehicles returns the fleet, optionally one group, with meters and the
+// maintenance state last computed by the scheduler
+func (r *Repo) ListVehicles(ctx context.Context, groupID string) ([]model.VehicleSummary, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT v.id, v.plate_number, v.group_id, v.driver_id,
+               COALESCE(m.odometer_km, 0), COALESCE(m.engine_seconds, 0) / 3600,
+               COALESCE(ms.worst, ''), COALESCE(ms.due, 0)
+        FROM vehicle v
+        LEFT JOIN vehicle_meters m ON m.vehicle_id = v.id
+        LEFT JOIN (
+            SELECT vehicle_id,
+                   CASE MAX(CASE state WHEN 'overdue' THEN 2 WHEN 'due_soon' THEN 1 ELSE 0 END)
+                       WHEN 2 THEN 'overdue' WHEN 1 THEN 'due_soon' ELSE 'ok' END AS worst,
+                   COUNT(*) FILTER (WHERE state <> 'ok') AS due
+            FROM maintenance_status
+            GROUP BY vehicle_id
+        ) ms ON ms.vehicle_id = v.id
+        WHERE $1 = '' OR v.group_id::text = $1
+        ORDER BY v.plate_number
+    `, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.VehicleSummary{}
+	for rows.Next() {
+		var v model.VehicleSummary
+		if err := rows.Scan(&v.ID, &v.PlateNumber, &v.GroupID, &v.DriverID, &v.OdometerKm, &v.EngineHours,
+			&v.MaintenanceState, &v.MaintenanceDue); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+)
+
+// GetMeters returns the meters of a vehicle, zero when none were recorded yet
+func (r *Repo) GetMeters(ctx context.Context, vehicleID string) (model.VehicleMeters, error) {
+	return r.getMeters(ctx, vehicleID, "")
+}
+
+// GetMetersForUpdate is GetMeters locking the vehicle until the transaction ends
+func (r *Repo) GetMetersForUpdate(ctx context.Context, vehicleID string) (model.VehicleMeters, error) {
+	return r.getMeters(ctx, vehicleID, "FOR UPDATE OF v")
+}
+
+func (r *Repo) getMeters(ctx context.Context, vehicleID, lock string) (model.VehicleMeters, error) {
+	var m model.VehicleMeters
+	var engineSeconds float64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT v.id, COALESCE(m.odometer_km, 0), COALESCE(m.engine_seconds, 0),
+               COALESCE(m.odometer_source, 'virtual'), m.device_odometer_km, COALESCE(m.device_offset_km, 0),
+               m.last_fix_at, m.last_ignition, COALESCE(m.updated_at, now())
+        FROM vehicle v
+        LEFT JOIN vehicle_meters m ON m.vehicle_id = v.id
+        WHERE v.id = $1
+        `+lock, vehicleID).Scan(&m.VehicleID, &m.OdometerKm, &engineSeconds, &m.OdometerSource, &m.DeviceOdometerKm,
+		&m.DeviceOffsetKm, &m.LastFixAt, &m.LastIgnition, &m.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, ErrNoVehicleFound
+	}
+	m.EngineHours = engineSeconds / 3600
+	return m, err
+}
+
+// SaveMeters stores the meters of a vehicle
+func (r *Repo) SaveMeters(ctx context.Context, m model.VehicleMeters) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO vehicle_meters (vehicle_id, odometer_km, engine_seconds, odometer_source, device_odometer_km,
+                                    device_offset_km, last_fix_at, last_ignition, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now())
+        ON CONFLICT (vehicle_id) DO UPDATE SET
+            odometer_km = EXCLUDED.odometer_km,
+            engine_seconds = EXCLUDED.engine_seconds,
+            odometer_source = EXCLUDED.odometer_source,
+            device_odometer_km = EXCLUDED.device_odometer_km,
+            device_offset_km = EXCLUDED.device_offset_km,
+            last_fix_at = EXCLUDED.last_fix_at,
+            last_ignition = EXCLUDED.last_ignition,
+            updated_at = now()
+    `, m.VehicleID, m.OdometerKm, m.EngineHours*3600, m.OdometerSource, m.DeviceOdometerKm,
+		m.DeviceOffsetKm, m.LastFixAt, m.LastIgnition)
+	return err
+}
+
+// InsertMeterReading appends an entry to a vehicle's meter history
+func (r *Repo) InsertMeterReading(ctx context.Context, rd model.MeterReading) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO meter_readings (vehicle_id, recorded_at, kind, odometer_km, engine_hours, prev_odometer_km,
+                                    prev_engine_hours, odometer_source, trip_id, actor, note)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+    `, rd.VehicleID, rd.RecordedAt, rd.Kind, rd.OdometerKm, rd.EngineHours, rd.PrevOdometerKm,
+		rd.PrevEngineHours, rd.OdometerSource, rd.TripID, rd.Actor, rd.Note)
+	return err
+}
+
+// GetMeterReadings returns the meter history of a vehicle in [from, to),
+// oldest first, optionally only entries of one kind
+func (r *Repo) GetMeterReadings(ctx context.Context, vehicleID string, from, to time.Time, kind string) ([]model.MeterReading, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, vehicle_id, recorded_at, kind, odometer_km, engine_hours, prev_odometer_km, prev_engine_hours,
+               odometer_source, trip_id, actor, note
+        FROM meter_readings
+        WHERE vehicle_id = $1 AND recorded_at >= $2 AND recorded_at < $3
+          AND ($4 = '' OR kind = $4)
+        ORDER BY recorded_at, id
+    `, vehicleID, from, to, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.MeterReading{}
+	for rows.Next() {
+		var rd model.MeterReading
+		if err := rows.Scan(&rd.ID, &rd.VehicleID, &rd.RecordedAt, &rd.Kind, &rd.OdometerKm, &rd.EngineHours,
+			&rd.PrevOdometerKm, &rd.PrevEngineHours, &rd.OdometerSource, &rd.TripID, &rd.Actor, &rd.Note); err != nil {
+			return nil, err
+		}
+		res = append(res, rd)
+	}
+	return res, rows.Err()
+}
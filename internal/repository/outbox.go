@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+)
+
+// InsertEvents appends events to the outbox. Call it inside WithTx so the
+// events are committed or rolled back together with the state change.
+func (r *Repo) InsertEvents(ctx context.Context, events ...model.Event) error {
+	for _, e := range events {
+		_, err := r.db.ExecContext(ctx, `
+        INSERT INTO outbox (id, event_type, aggregate_id, payload, occurred_at)
+        VALUES ($1, $2, $3, $4::jsonb, $5)
+    `, e.ID, e.Type, e.AggregateID, string(e.Payload), e.OccurredAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockUnpublishedEvents returns the oldest unpublished events and locks them
+// until the surrounding transaction ends, so concurrent relays skip them.
+func (r *Repo) LockUnpublishedEvents(ctx context.Context, limit int) ([]model.Event, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, event_type, aggregate_id, payload, occurred_at
+        FROM outbox
+        WHERE published_at IS NULL
+        ORDER BY seq
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.Event
+	for rows.Next() {
+		var e model.Event
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateID, &payload, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// MarkEventPublished records that the event reached the bus
+func (r *Repo) MarkEventPublished(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE outbox SET published_at = NOW(), attempts = attempts + 1, last_error = NULL
+        WHERE id = $1
+    `, id)
+	return err
+}
+
+// MarkEventFailed records a failed publish attempt
+func (r *Repo) MarkEventFailed(ctx context.Context, id string, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE outbox SET attempts = attempts + 1, last_error = $2
+        WHERE id = $1
+    `, id, reason)
+	return err
+}
+
+// DeletePublishedEvents removes events published before the cutoff
+func (r *Repo) DeletePublishedEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrPlannedRouteNotFound is returned for an unknown planned route
+	ErrPlannedRouteNotFound = errors.New("planned route not found")
+	// ErrAssignmentNotFound is returned for an unknown route assignment
+	ErrAssignmentNotFound = errors.New("route assignment not found")
+	// ErrAssignmentOverlap is returned when a vehicle already drives a
+	// planned route in part of the window
+	ErrAssignmentOverlap = errors.New("the vehicle already has a route assignment in that window")
+)
+
+const plannedRouteColumns = `r.id, r.name, r.path, r.corridor_m, r.length_m, r.stops, r.created_at`
+
+func scanPlannedRoute(row scanner, extra ...interface{}) (model.PlannedRoute, error) {
+	var r model.PlannedRoute
+	var path, stops []byte
+	err := row.Scan(append([]interface{}{&r.ID, &r.Name, &path, &r.CorridorM, &r.LengthM, &stops, &r.CreatedAt}, extra...)...)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(path, &r.Path); err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(stops, &r.Stops)
+	return r, err
+}
+
+// CreatePlannedRoute stores a planned route
+func (r *Repo) CreatePlannedRoute(ctx context.Context, pr model.PlannedRoute) error {
+	path, err := json.Marshal(pr.Path)
+	if err != nil {
+		return err
+	}
+	stops, err := json.Marshal(pr.Stops)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+        INSERT INTO planned_routes (id, name, path, corridor_m, length_m, stops, created_at)
+        VALUES ($1, $2, $3::jsonb, $4, $5, $6::jsonb, $7)
+    `, pr.ID, pr.Name, string(path), pr.CorridorM, pr.LengthM, string(stops), pr.CreatedAt)
+	return err
+}
+
+// GetPlannedRoute returns a planned route by id
+func (r *Repo) GetPlannedRoute(ctx context.Context, id string) (model.PlannedRoute, error) {
+	pr, err := scanPlannedRoute(r.db.QueryRowContext(ctx, `
+        SELECT `+plannedRouteColumns+` FROM planned_routes r WHERE r.id::text = $1
+    `, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return pr, ErrPlannedRouteNotFound
+	}
+	return pr, err
+}
+
+// ListPlannedRoutes returns the planned routes by name
+func (r *Repo) ListPlannedRoutes(ctx context.Context) ([]model.PlannedRoute, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+plannedRouteColumns+` FROM planned_routes r ORDER BY r.name, r.created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.PlannedRoute{}
+	for rows.Next() {
+		pr, err := scanPlannedRoute(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, pr)
+	}
+	return res, rows.Err()
+}
+
+// DeletePlannedRoute removes a planned route with its assignments and their deviations
+func (r *Repo) DeletePlannedRoute(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM planned_routes WHERE id::text = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrPlannedRouteNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+const assignmentColumns = `a.id, a.route_id, a.vehicle_id, a.start_at, a.end_at, a.progress_m, a.fixes, a.fixes_in_corridor,
+       a.off_route_id, a.last_at, a.created_at`
+
+func assignmentDest(a *model.RouteAssignment) []interface{} {
+	return []interface{}{&a.ID, &a.RouteID, &a.VehicleID, &a.StartAt, &a.EndAt, &a.ProgressM, &a.Fixes,
+		&a.FixesInCorridor, &a.OffRouteID, &a.LastAt, &a.CreatedAt}
+}
+
+// CreateRouteAssignment stores a route assignment. The route and vehicle
+// must exist and the vehicle must not drive another route in the window.
+func (r *Repo) CreateRouteAssignment(ctx context.Context, a model.RouteAssignment) error {
+	if _, err := r.GetPlannedRoute(ctx, a.RouteID.String()); err != nil {
+		return err
+	}
+	if err := r.checkVehicle(ctx, a.VehicleID); err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO route_assignments (id, route_id, vehicle_id, start_at, end_at, created_at)
+        SELECT $1, $2, $3, $4, $5, $6
+        WHERE NOT EXISTS (
+            SELECT 1 FROM route_assignments
+            WHERE vehicle_id = $3 AND start_at < $5 AND end_at > $4
+        )
+    `, a.ID, a.RouteID, a.VehicleID, a.StartAt, a.EndAt, a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrAssignmentOverlap
+		}
+		return err
+	}
+	return nil
+}
+
+// ActiveRoute is a route assignment in progress with its route
+type ActiveRoute struct {
+	Assignment model.RouteAssignment
+	Route      model.PlannedRoute
+}
+
+// ActiveRouteAssignments returns the assignments of a vehicle whose window
+// contains at, with their routes and stop visits, locked for update
+func (r *Repo) ActiveRouteAssignments(ctx context.Context, vehicleID string, at time.Time) ([]ActiveRoute, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+plannedRouteColumns+`, `+assignmentColumns+`
+        FROM route_assignments a
+        JOIN planned_routes r ON r.id = a.route_id
+        WHERE a.vehicle_id = $1 AND a.start_at <= $2 AND a.end_at > $2
+        ORDER BY a.start_at
+        FOR UPDATE OF a
+    `, vehicleID, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []ActiveRoute
+	for rows.Next() {
+		var ar ActiveRoute
+		if ar.Route, err = scanPlannedRoute(rows, assignmentDest(&ar.Assignment)...); err != nil {
+			return nil, err
+		}
+		res = append(res, ar)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	as := make([]model.RouteAssignment, len(res))
+	for i := range res {
+		as[i] = res[i].Assignment
+	}
+	if err := r.loadVisits(ctx, as); err != nil {
+		return nil, err
+	}
+	for i := range res {
+		res[i].Assignment = as[i]
+	}
+	return res, nil
+}
+
+// loadVisits fills in the stop visits of assignments
+func (r *Repo) loadVisits(ctx context.Context, as []model.RouteAssignment) error {
+	idx := map[uuid.UUID]int{}
+	ids := make([]string, len(as))
+	for i := range as {
+		as[i].Visits = map[int]model.StopVisit{}
+		idx[as[i].ID] = i
+		ids[i] = as[i].ID.String()
+	}
+	if len(as) == 0 {
+		return nil
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT assignment_id, stop_index, status, at FROM route_stop_visits WHERE assignment_id = ANY($1::uuid[])
+    `, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var i int
+		var v model.StopVisit
+		if err := rows.Scan(&id, &i, &v.Status, &v.At); err != nil {
+			return err
+		}
+		as[idx[id]].Visits[i] = v
+	}
+	return rows.Err()
+}
+
+// queryAssignments runs a query selecting assignmentColumns and loads the stop visits
+func (r *Repo) queryAssignments(ctx context.Context, query string, args ...interface{}) ([]model.RouteAssignment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.RouteAssignment{}
+	for rows.Next() {
+		var a model.RouteAssignment
+		if err := rows.Scan(assignmentDest(&a)...); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return res, r.loadVisits(ctx, res)
+}
+
+// GetRouteAssignment returns a route assignment with its stop visits
+func (r *Repo) GetRouteAssignment(ctx context.Context, id string) (model.RouteAssignment, error) {
+	res, err := r.queryAssignments(ctx, `SELECT `+assignmentColumns+` FROM route_assignments a WHERE a.id::text = $1`, id)
+	if err != nil {
+		return model.RouteAssignment{}, err
+	}
+	if len(res) == 0 {
+		return model.RouteAssignment{}, ErrAssignmentNotFound
+	}
+	return res[0], nil
+}
+
+// RouteAssignmentQuery selects route assignments whose window overlaps
+// [From, To); empty ids do not filter
+type RouteAssignmentQuery struct {
+	RouteID   string
+	VehicleID string
+	From, To  time.Time
+}
+
+// ListRouteAssignments returns the route assignments matching q with their
+// stop visits, by start
+func (r *Repo) ListRouteAssignments(ctx context.Context, q RouteAssignmentQuery) ([]model.RouteAssignment, error) {
+	return r.queryAssignments(ctx, `
+        SELECT `+assignmentColumns+`
+        FROM route_assignments a
+        WHERE ($1 = '' OR a.route_id::text = $1)
+          AND ($2 = '' OR a.vehicle_id::text = $2)
+          AND a.start_at < $4 AND a.end_at > $3
+        ORDER BY a.start_at
+    `, q.RouteID, q.VehicleID, q.From, q.To)
+}
+
+// SaveRouteProgress stores the tracked progress of a route assignment
+func (r *Repo) SaveRouteProgress(ctx context.Context, a model.RouteAssignment) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE route_assignments
+        SET progress_m = $2, fixes = $3, fixes_in_corridor = $4, off_route_id = $5, last_at = $6
+        WHERE id = $1
+    `, a.ID, a.ProgressM, a.Fixes, a.FixesInCorridor, a.OffRouteID, a.LastAt)
+	return err
+}
+
+// SaveStopVisit records that a stop of an assignment was visited or
+// skipped. A visit replaces an earlier skip; nothing replaces a visit.
+func (r *Repo) SaveStopVisit(ctx context.Context, assignmentID uuid.UUID, stop int, v model.StopVisit) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO route_stop_visits (assignment_id, stop_index, status, at) VALUES ($1, $2, $3, $4)
+        ON CONFLICT (assignment_id, stop_index) DO UPDATE SET status = EXCLUDED.status, at = EXCLUDED.at
+        WHERE route_stop_visits.status <> 'visited'
+    `, assignmentID, stop, v.Status, v.At)
+	return err
+}
+
+// InsertRouteDeviation stores a route deviation
+func (r *Repo) InsertRouteDeviation(ctx context.Context, d model.RouteDeviation) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO route_deviations (id, assignment_id, route_id, vehicle_id, kind, started_at, ended_at,
+                                      max_distance_m, stop_index, stop_name, lon, lat)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12)
+    `, d.ID, d.AssignmentID, d.RouteID, d.VehicleID, d.Kind, d.StartedAt, d.EndedAt,
+		d.MaxDistanceM, d.StopIndex, d.StopName, d.Location[0], d.Location[1])
+	return err
+}
+
+// UpdateOffRoute raises the furthest distance of an off-route deviation
+// and ends it at endedAt when set
+func (r *Repo) UpdateOffRoute(ctx context.Context, id uuid.UUID, distM float64, endedAt *time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE route_deviations SET max_distance_m = GREATEST(max_distance_m, $2), ended_at = $3
+        WHERE id = $1
+    `, id, distM, endedAt)
+	return err
+}
+
+// GetRouteDeviations returns the deviations of assignments, oldest first
+func (r *Repo) GetRouteDeviations(ctx context.Context, assignmentIDs []uuid.UUID) ([]model.RouteDeviation, error) {
+	ids := make([]string, len(assignmentIDs))
+	for i, id := range assignmentIDs {
+		ids[i] = id.String()
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, assignment_id, route_id, vehicle_id, kind, started_at, ended_at, max_distance_m, stop_index,
+               COALESCE(stop_name, ''), lon, lat
+        FROM route_deviations
+        WHERE assignment_id = ANY($1::uuid[])
+        ORDER BY started_at
+    `, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.RouteDeviation{}
+	for rows.Next() {
+		var d model.RouteDeviation
+		if err := rows.Scan(&d.ID, &d.AssignmentID, &d.RouteID, &d.VehicleID, &d.Kind, &d.StartedAt, &d.EndedAt,
+			&d.MaxDistanceM, &d.StopIndex, &d.StopName, &d.Location[0], &d.Location[1]); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrPOINotFound is returned for an unknown point of interest
+var ErrPOINotFound = errors.New("poi not found")
+
+const poiColumns = `p.id, p.name, p.category, COALESCE(p.external_ref, ''), COALESCE(p.address, ''), p.lon, p.lat,
+       p.radius_m, p.created_at, p.updated_at`
+
+func scanPOI(row scanner) (model.POI, error) {
+	var p model.POI
+	err := row.Scan(&p.ID, &p.Name, &p.Category, &p.ExternalRef, &p.Address, &p.Location[0], &p.Location[1],
+		&p.RadiusM, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// CreatePOI stores a POI in its grid cell
+func (r *Repo) CreatePOI(ctx context.Context, p model.POI, cell int64) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO pois (id, name, category, external_ref, address, lon, lat, radius_m, cell, created_at, updated_at)
+        VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11)
+    `, p.ID, p.Name, p.Category, p.ExternalRef, p.Address, p.Location[0], p.Location[1], p.RadiusM, cell,
+		p.CreatedAt, p.UpdatedAt)
+	return err
+}
+
+// UpdatePOI replaces the details of a POI
+func (r *Repo) UpdatePOI(ctx context.Context, p model.POI, cell int64) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE pois SET name = $2, category = $3, external_ref = NULLIF($4, ''), address = NULLIF($5, ''),
+               lon = $6, lat = $7, radius_m = $8, cell = $9, updated_at = $10
+        WHERE id = $1
+    `, p.ID, p.Name, p.Category, p.ExternalRef, p.Address, p.Location[0], p.Location[1], p.RadiusM, cell, p.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrPOINotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// UpsertPOIByRef stores a POI with an external reference, replacing the
+// details of the POI that already has that reference. It reports whether
+// the POI was created.
+func (r *Repo) UpsertPOIByRef(ctx context.Context, p model.POI, cell int64) (bool, error) {
+	var created bool
+	err := r.db.QueryRowContext(ctx, `
+        INSERT INTO pois (id, name, category, external_ref, address, lon, lat, radius_m, cell, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11)
+        ON CONFLICT (external_ref) WHERE external_ref IS NOT NULL DO UPDATE
+          SET name = EXCLUDED.name,
+              category = EXCLUDED.category,
+              address = EXCLUDED.address,
+              lon = EXCLUDED.lon,
+              lat = EXCLUDED.lat,
+              radius_m = EXCLUDED.radius_m,
+              cell = EXCLUDED.cell,
+              updated_at = EXCLUDED.updated_at
+        RETURNING xmax = 0
+    `, p.ID, p.Name, p.Category, p.ExternalRef, p.Address, p.Location[0], p.Location[1], p.RadiusM, cell,
+		p.CreatedAt, p.UpdatedAt).Scan(&created)
+	return created, err
+}
+
+// GetPOI returns a POI by id
+func (r *Repo) GetPOI(ctx context.Context, id string) (model.POI, error) {
+	p, err := scanPOI(r.db.QueryRowContext(ctx, `SELECT `+poiColumns+` FROM pois p WHERE p.id::text = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrPOINotFound
+	}
+	return p, err
+}
+
+// DeletePOI removes a POI with its visits
+func (r *Repo) DeletePOI(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM pois WHERE id::text = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrPOINotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// POIQuery selects POIs; empty fields do not filter. Search matches part of
+// the name or the whole external reference. A zero Limit returns every match.
+type POIQuery struct {
+	Category string
+	Search   string
+	Cells    []int64 // grid cells to look in
+	Limit    int
+	Offset   int
+}
+
+// ListPOIs returns the POIs matching q by category and name
+func (r *Repo) ListPOIs(ctx context.Context, q POIQuery) ([]model.POI, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+poiColumns+`
+        FROM pois p
+        WHERE ($1 = '' OR p.category = $1)
+          AND ($2 = '' OR p.name ILIKE '%' || $2 || '%' OR p.external_ref = $2)
+          AND (cardinality($3::bigint[]) = 0 OR p.cell = ANY($3))
+        ORDER BY p.category, p.name, p.id
+        LIMIT NULLIF($4, 0) OFFSET $5
+    `, q.Category, q.Search, pq.Array(q.Cells), q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.POI{}
+	for rows.Next() {
+		p, err := scanPOI(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// POICategories returns the categories in use with their POI counts
+func (r *Repo) POICategories(ctx context.Context) ([]model.POICategory, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT category, COUNT(*) FROM pois GROUP BY category ORDER BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.POICategory{}
+	for rows.Next() {
+		var c model.POICategory
+		if err := rows.Scan(&c.Category, &c.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+// InsertPOIVisit records that a stop is within a POI
+func (r *Repo) InsertPOIVisit(ctx context.Context, poiID uuid.UUID, st model.Stop, distM float64) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO poi_visits (poi_id, stop_id, vehicle_id, arrival, distance_m) VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT DO NOTHING
+    `, poiID, st.ID, st.VehicleID, st.Arrival, distM)
+	return err
+}
+
+const poiVisitColumns = `p.id, p.name, p.category, s.id, s.vehicle_id, v.plate_number, s.arrival,
+       CASE WHEN s.in_progress THEN NULL ELSE s.departure END, s.duration_seconds, pv.distance_m`
+
+func scanPOIVisit(row scanner) (model.POIVisit, error) {
+	var v model.POIVisit
+	err := row.Scan(&v.POIID, &v.POIName, &v.Category, &v.StopID, &v.VehicleID, &v.PlateNumber, &v.Arrival,
+		&v.Departure, &v.DurationSeconds, &v.DistanceM)
+	return v, err
+}
+
+// GetStopPOIVisits returns the visits a stop made
+func (r *Repo) GetStopPOIVisits(ctx context.Context, stopID uuid.UUID) ([]model.POIVisit, error) {
+	return r.queryPOIVisits(ctx, `
+        SELECT `+poiVisitColumns+`
+        FROM poi_visits pv
+        JOIN pois p ON p.id = pv.poi_id
+        JOIN stops s ON s.id = pv.stop_id
+        JOIN vehicle v ON v.id = pv.vehicle_id
+        WHERE pv.stop_id = $1
+        ORDER BY pv.distance_m
+    `, stopID)
+}
+
+// POIVisitQuery selects POI visits arriving in [From, To); empty fields
+// do not filter
+type POIVisitQuery struct {
+	POIID       string
+	VehicleID   string
+	Category    string
+	From, To    time.Time
+	MinDuration time.Duration
+}
+
+// GetPOIVisits returns the visits matching q, oldest first
+func (r *Repo) GetPOIVisits(ctx context.Context, q POIVisitQuery) ([]model.POIVisit, error) {
+	return r.queryPOIVisits(ctx, `
+        SELECT `+poiVisitColumns+`
+        FROM poi_visits pv
+        JOIN pois p ON p.id = pv.poi_id
+        JOIN stops s ON s.id = pv.stop_id
+        JOIN vehicle v ON v.id = pv.vehicle_id
+        WHERE pv.arrival >= $1 AND pv.arrival < $2
+          AND ($3 = '' OR pv.poi_id::text = $3)
+          AND ($4 = '' OR pv.vehicle_id::text = $4)
+          AND ($5 = '' OR p.category = $5)
+          AND s.duration_seconds >= $6
+        ORDER BY pv.arrival, p.name
+    `, q.From, q.To, q.POIID, q.VehicleID, q.Category, q.MinDuration.Seconds())
+}
+
+func (r *Repo) queryPOIVisits(ctx context.Context, query string, args ...interface{}) ([]model.POIVisit, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.POIVisit{}
+	for rows.Next() {
+		v, err := scanPOIVisit(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// InsertPosition stores a fix and reports whether it was new. Re-sending a
+// fix with the same timestamp is a no-op.
+func (r *Repo) InsertPosition(ctx context.Context, p model.Position) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO positions (vehicle_id, recorded_at, lon, lat, speed, heading, ignition)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (vehicle_id, recorded_at) DO NOTHING
+    `, p.VehicleID, p.Timestamp, p.Location[0], p.Location[1], p.Speed, p.Heading, p.Ignition)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// EachPosition calls fn for every fix of a vehicle in [from, to) in time order
+// without loading the whole range into memory
+func (r *Repo) EachPosition(ctx context.Context, vehicleID string, from, to time.Time, fn func(model.Position) error) error {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT vehicle_id, recorded_at, lon, lat, speed, heading, ignition
+        FROM positions
+        WHERE vehicle_id = $1 AND recorded_at >= $2 AND recorded_at < $3
+        ORDER BY recorded_at
+    `, vehicleID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p model.Position
+		if err := rows.Scan(&p.VehicleID, &p.Timestamp, &p.Location[0], &p.Location[1], &p.Speed, &p.Heading, &p.Ignition); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetPositions returns the fixes of a vehicle in [from, to) in time order
+func (r *Repo) GetPositions(ctx context.Context, vehicleID string, from, to time.Time) ([]model.Position, error) {
+	res := []model.Position{}
+	err := r.EachPosition(ctx, vehicleID, from, to, func(p model.Position) error {
+		res = append(res, p)
+		return nil
+	})
+	return res, err
+}
+
+// PositionsAround returns the last fix at or before at and the first fix
+// after it, each at most window away. Either may be nil.
+func (r *Repo) PositionsAround(ctx context.Context, vehicleID string, at time.Time, window time.Duration) (before, after *model.Position, err error) {
+	pairs, err := r.positionsAround(ctx, at, window, `v.id = $3`, vehicleID)
+	if err != nil || len(pairs) == 0 {
+		return nil, nil, err
+	}
+	return pairs[0].Before, pairs[0].After, nil
+}
+
+// PositionPair holds the fixes of a vehicle bracketing an instant
+type PositionPair struct {
+	VehicleID string
+	Before    *model.Position
+	After     *model.Position
+}
+
+// FleetPositionsAround returns the bracketing fixes of every vehicle, or of
+// the vehicles in a group, that has a fix within window of at
+func (r *Repo) FleetPositionsAround(ctx context.Context, at time.Time, window time.Duration, groupID string) ([]PositionPair, error) {
+	if groupID != "" {
+		return r.positionsAround(ctx, at, window, `v.group_id = $3`, groupID)
+	}
+	return r.positionsAround(ctx, at, window, `TRUE`)
+}
+
+func (r *Repo) positionsAround(ctx context.Context, at time.Time, window time.Duration, where string, args ...interface{}) ([]PositionPair, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT v.id,
+               b.recorded_at, b.lon, b.lat, b.speed, b.heading, b.ignition,
+               a.recorded_at, a.lon, a.lat, a.speed, a.heading, a.ignition
+        FROM vehicle v
+        LEFT JOIN LATERAL (
+            SELECT recorded_at, lon, lat, speed, heading, ignition FROM positions
+            WHERE vehicle_id = v.id AND recorded_at <= $1 AND recorded_at >= $1 - $2 * INTERVAL '1 second'
+            ORDER BY recorded_at DESC LIMIT 1
+        ) b ON TRUE
+        LEFT JOIN LATERAL (
+            SELECT recorded_at, lon, lat, speed, heading, ignition FROM positions
+            WHERE vehicle_id = v.id AND recorded_at > $1 AND recorded_at <= $1 + $2 * INTERVAL '1 second'
+            ORDER BY recorded_at LIMIT 1
+        ) a ON TRUE
+        WHERE `+where+` AND (b.recorded_at IS NOT NULL OR a.recorded_at IS NOT NULL)
+        ORDER BY v.id
+    `, append([]interface{}{at, window.Seconds()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []PositionPair{}
+	for rows.Next() {
+		var pp PositionPair
+		var b, a nullPosition
+		if err := rows.Scan(&pp.VehicleID,
+			&b.at, &b.lon, &b.lat, &b.speed, &b.heading, &b.ignition,
+			&a.at, &a.lon, &a.lat, &a.speed, &a.heading, &a.ignition); err != nil {
+			return nil, err
+		}
+		pp.Before, pp.After = b.position(pp.VehicleID), a.position(pp.VehicleID)
+		res = append(res, pp)
+	}
+	return res, rows.Err()
+}
+
+// nullPosition scans a fix from an outer join that may have no row
+type nullPosition struct {
+	at       sql.NullTime
+	lon, lat sql.NullFloat64
+	speed    sql.NullFloat64
+	heading  sql.NullFloat64
+	ignition sql.NullBool
+}
+
+func (n nullPosition) position(vehicleID string) *model.Position {
+	if !n.at.Valid {
+		return nil
+	}
+	p := &model.Position{
+		VehicleID: uuid.MustParse(vehicleID),
+		Location:  [2]float64{n.lon.Float64, n.lat.Float64},
+		Speed:     n.speed.Float64,
+		Timestamp: n.at.Time.UTC(),
+	}
+	if n.heading.Valid {
+		p.Heading = &n.heading.Float64
+	}
+	if n.ignition.Valid {
+		p.Ignition = &n.ignition.Bool
+	}
+	return p
+}
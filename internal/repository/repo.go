@@ -13,31 +13,73 @@ import (
 )
 
 var (
-	ErrNoTrips        = errors.New("trips not found")
 	ErrNoVehicleFound = errors.New("Vehicle not found")
+	ErrTripNotFound   = errors.New("trip not found")
 )
 
+// DBTX is the subset of *sql.DB and *sql.Tx used by the repository
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type Repo struct {
-	db *sql.DB
+	db   DBTX
+	conn *sql.DB
 }
 
 func NewRepo(db *sql.DB) *Repo {
-	return &Repo{db: db}
+	return &Repo{db: db, conn: db}
 }
 
-func (r *Repo) UpsertVehicleStatus(ctx context.Context, vehicleID, plateNumber string, status map[string]interface{}) error {
-	b, err := json.Marshal(status)
+// WithTx runs fn with a Repo bound to a single transaction. The transaction is
+// committed when fn returns nil and rolled back otherwise.
+func (r *Repo) WithTx(ctx context.Context, fn func(tx *Repo) error) error {
+	if _, ok := r.db.(*sql.Tx); ok {
+		return fn(r)
+	}
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&Repo{db: tx, conn: r.conn}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithSnapshot runs fn in a read-only repeatable-read transaction, so
+// several queries see the same data even while ingest continues
+func (r *Repo) WithSnapshot(ctx context.Context, fn func(tx *Repo) error) error {
+	if _, ok := r.db.(*sql.Tx); ok {
+		return fn(r)
+	}
+	tx, err := r.conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+	return fn(&Repo{db: tx, conn: r.conn})
+}
+
+// UpsertVehicleStatus stores the latest status and reports whether the vehicle was newly created
+func (r *Repo) UpsertVehicleStatus(ctx context.Context, vehicleID, plateNumber string, status map[string]interface{}) (bool, error) {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return false, err
+	}
 
-	_, err = r.db.ExecContext(ctx, `
+	var inserted bool
+	err = r.db.QueryRowContext(ctx, `
     INSERT INTO vehicle (id, plate_number, last_status)
     VALUES ($1, $2, $3::jsonb)
     ON CONFLICT (id) DO UPDATE
       SET last_status = EXCLUDED.last_status
-`, vehicleID, plateNumber, string(b))
-	return err
+    RETURNING (xmax = 0)
+`, vehicleID, plateNumber, string(b)).Scan(&inserted)
+	return inserted, err
 }
 
 func (r *Repo) GetVehicleStatus(ctx context.Context, vehicleID string) (map[string]interface{}, error) {
@@ -67,8 +109,8 @@ func (r *Repo) InsertTrip(ctx context.Context, t model.Trip) error {
 
 func (r *Repo) GetTripsSince(ctx context.Context, vehicleID string, since time.Time) ([]model.Trip, error) {
 	rows, err := r.db.QueryContext(ctx, `
-        SELECT id, vehicle_id, start_time, end_time, mileage, avg_speed
-        FROM trips
+        SELECT `+tripColumns+`
+        FROM trips t
         WHERE vehicle_id = $1 AND start_time >= $2
         ORDER BY start_time DESC
     `, vehicleID, since)
@@ -77,20 +119,51 @@ func (r *Repo) GetTripsSince(ctx context.Context, vehicleID string, since time.T
 	}
 	defer rows.Close()
 
-	var res []model.Trip
+	res := []model.Trip{}
 	for rows.Next() {
-		var t model.Trip
-		if err := rows.Scan(&t.ID, &t.VehicleID, &t.StartTime, &t.EndTime, &t.Mileage, &t.AvgSpeed); err != nil {
+		t, err := scanTrip(rows)
+		if err != nil {
 			return nil, err
 		}
 		res = append(res, t)
 	}
+	return res, rows.Err()
+}
+
+func (r *Repo) GetTrip(ctx context.Context, tripID string) (model.Trip, error) {
+	t, err := scanTrip(r.db.QueryRowContext(ctx, `
+        SELECT `+tripColumns+`
+        FROM trips t
+        WHERE id = $1
+    `, tripID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrTripNotFound
+	}
+	return t, err
+}
 
-	if len(res) == 0 {
-		return nil, ErrNoTrips
+// GetTripsBetween returns the trips of a vehicle starting in [from, to), oldest first
+func (r *Repo) GetTripsBetween(ctx context.Context, vehicleID string, from, to time.Time) ([]model.Trip, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+tripColumns+`
+        FROM trips t
+        WHERE vehicle_id = $1 AND start_time >= $2 AND start_time < $3
+        ORDER BY start_time
+    `, vehicleID, from, to)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return res, nil
+	res := []model.Trip{}
+	for rows.Next() {
+		t, err := scanTrip(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
 }
 
 func (r *Repo) GetAllVehicleIDs(ctx context.Context) ([]string, error) {
@@ -111,3 +184,24 @@ func (r *Repo) GetAllVehicleIDs(ctx context.Context) ([]string, error) {
 
 	return vehicleIDs, nil
 }
+
+// EnsureVehicle creates the vehicle with status when it does not exist yet
+// and reports whether it was created. The status of an existing vehicle is
+// left alone, which lets historical fixes be stored without replacing the
+// live status. Like UpsertVehicleStatus it locks the vehicle row.
+func (r *Repo) EnsureVehicle(ctx context.Context, vehicleID, plateNumber string, status map[string]interface{}) (bool, error) {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return false, err
+	}
+
+	var inserted bool
+	err = r.db.QueryRowContext(ctx, `
+    INSERT INTO vehicle (id, plate_number, last_status)
+    VALUES ($1, $2, $3::jsonb)
+    ON CONFLICT (id) DO UPDATE
+      SET id = vehicle.id
+    RETURNING (xmax = 0)
+`, vehicleID, plateNumber, string(b)).Scan(&inserted)
+	return inserted, err
+}
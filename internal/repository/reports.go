@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func (r *Repo) GetOrgSettings(ctx context.Context) (model.OrgSettings, error) {
+	var s model.OrgSettings
+	var days pq.Int64Array
+	err := r.db.QueryRowContext(ctx, `
+        SELECT timezone, work_start, work_end, work_days, updated_at
+        FROM organization_settings
+        WHERE id
+    `).Scan(&s.Timezone, &s.WorkStart, &s.WorkEnd, &days, &s.UpdatedAt)
+	for _, d := range days {
+		s.WorkDays = append(s.WorkDays, int(d))
+	}
+	return s, err
+}
+
+func (r *Repo) SaveOrgSettings(ctx context.Context, s model.OrgSettings) error {
+	days := make(pq.Int64Array, len(s.WorkDays))
+	for i, d := range s.WorkDays {
+		days[i] = int64(d)
+	}
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO organization_settings (id, timezone, work_start, work_end, work_days, updated_at)
+        VALUES (TRUE, $1, $2, $3, $4, $5)
+        ON CONFLICT (id) DO UPDATE
+          SET timezone = EXCLUDED.timezone,
+              work_start = EXCLUDED.work_start,
+              work_end = EXCLUDED.work_end,
+              work_days = EXCLUDED.work_days,
+              updated_at = EXCLUDED.updated_at
+    `, s.Timezone, s.WorkStart, s.WorkEnd, days, s.UpdatedAt)
+	return err
+}
+
+// GetWatermark returns how far the named rollup has processed, or the zero
+// time when it has not run yet
+func (r *Repo) GetWatermark(ctx context.Context, name string) (time.Time, error) {
+	var t time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT watermark FROM rollup_state WHERE name = $1`, name).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return t, err
+}
+
+func (r *Repo) SetWatermark(ctx context.Context, name string, t time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO rollup_state (name, watermark) VALUES ($1, $2)
+        ON CONFLICT (name) DO UPDATE SET watermark = EXCLUDED.watermark
+    `, name, t)
+	return err
+}
+
+// VehicleDay is a vehicle and a local calendar day
+type VehicleDay struct {
+	VehicleID string
+	Day       time.Time
+}
+
+// ChangedVehicleDays returns the local days, in tz, of fixes received in
+// (since, until]
+func (r *Repo) ChangedVehicleDays(ctx context.Context, tz string, since, until time.Time) ([]VehicleDay, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT vehicle_id, (recorded_at AT TIME ZONE $1)::date AS day
+        FROM positions
+        WHERE received_at > $2 AND received_at <= $3
+        GROUP BY 1, 2
+        ORDER BY 2, 1
+    `, tz, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []VehicleDay
+	for rows.Next() {
+		var d VehicleDay
+		if err := rows.Scan(&d.VehicleID, &d.Day); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// IdleVehicleDays returns the local days from each vehicle's first usage
+// rollup up to to, and from from on when it is set, that have no rollup
+// because the vehicle sent no fixes
+func (r *Repo) IdleVehicleDays(ctx context.Context, from, to time.Time) ([]VehicleDay, error) {
+	var since interface{}
+	if !from.IsZero() {
+		since = from.Format("2006-01-02")
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT f.vehicle_id, d::date
+        FROM (SELECT vehicle_id, MIN(day) AS first FROM vehicle_daily_usage GROUP BY vehicle_id) f
+        CROSS JOIN LATERAL generate_series(GREATEST(f.first, COALESCE($1::date, f.first)), $2::date, INTERVAL '1 day') d
+        WHERE NOT EXISTS (
+            SELECT 1 FROM vehicle_daily_usage u WHERE u.vehicle_id = f.vehicle_id AND u.day = d::date
+        )
+        ORDER BY 2, 1
+    `, since, to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []VehicleDay
+	for rows.Next() {
+		var d VehicleDay
+		if err := rows.Scan(&d.VehicleID, &d.Day); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repo) UpsertDailyUsage(ctx context.Context, u model.DailyUsage) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO vehicle_daily_usage (vehicle_id, day, distance_km, driving_seconds, idle_seconds, trip_count,
+                                         max_speed, first_start, last_stop, working_seconds, working_driving_seconds, computed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+        ON CONFLICT (vehicle_id, day) DO UPDATE
+          SET distance_km = EXCLUDED.distance_km,
+              driving_seconds = EXCLUDED.driving_seconds,
+              idle_seconds = EXCLUDED.idle_seconds,
+              trip_count = EXCLUDED.trip_count,
+              max_speed = EXCLUDED.max_speed,
+              first_start = EXCLUDED.first_start,
+              last_stop = EXCLUDED.last_stop,
+              working_seconds = EXCLUDED.working_seconds,
+              working_driving_seconds = EXCLUDED.working_driving_seconds,
+              computed_at = EXCLUDED.computed_at
+    `, u.VehicleID, u.Day.Format("2006-01-02"), u.DistanceKm, u.DrivingSeconds, u.IdleSeconds, u.TripCount,
+		u.MaxSpeed, u.FirstStart, u.LastStop, u.WorkingSeconds, u.WorkingDrivingSeconds)
+	return err
+}
+
+// DeleteDailyUsage drops all usage rollups so they are rebuilt with new settings
+func (r *Repo) DeleteDailyUsage(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM vehicle_daily_usage`)
+	return err
+}
+
+// UtilizationQuery selects and groups daily usage rows. From and To are
+// local dates, both inclusive.
+type UtilizationQuery struct {
+	From, To   time.Time
+	Monthly    bool
+	ByGroup    bool
+	VehicleIDs []string
+	GroupID    string
+}
+
+// GetUtilization aggregates daily usage per day or month and per vehicle or group
+func (r *Repo) GetUtilization(ctx context.Context, q UtilizationQuery) ([]model.UtilizationRow, error) {
+	period := `to_char(u.day, 'YYYY-MM-DD')`
+	if q.Monthly {
+		period = `to_char(u.day, 'YYYY-MM')`
+	}
+	key := `u.vehicle_id::text, v.plate_number`
+	if q.ByGroup {
+		key = `g.id::text, COALESCE(g.name, '')`
+	}
+
+	args := []interface{}{q.From.Format("2006-01-02"), q.To.Format("2006-01-02")}
+	where := []string{"u.day >= $1", "u.day <= $2"}
+	if len(q.VehicleIDs) > 0 {
+		args = append(args, pq.Array(q.VehicleIDs))
+		where = append(where, fmt.Sprintf("u.vehicle_id = ANY($%d::uuid[])", len(args)))
+	}
+	if q.GroupID != "" {
+		args = append(args, q.GroupID)
+		where = append(where, fmt.Sprintf("v.group_id = $%d", len(args)))
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+period+` AS period, `+key+`,
+               COUNT(DISTINCT u.vehicle_id),
+               SUM(u.distance_km), SUM(u.driving_seconds), SUM(u.idle_seconds), SUM(u.trip_count),
+               MAX(u.max_speed), MIN(u.first_start), MAX(u.last_stop),
+               SUM(u.working_seconds), SUM(u.working_driving_seconds)
+        FROM vehicle_daily_usage u
+        JOIN vehicle v ON v.id = u.vehicle_id
+        LEFT JOIN vehicle_groups g ON g.id = v.group_id
+        WHERE `+strings.Join(where, " AND ")+`
+        GROUP BY 1, 2, 3
+        ORDER BY 1, 3
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.UtilizationRow{}
+	for rows.Next() {
+		var row model.UtilizationRow
+		var id sql.NullString
+		var name string
+		var working, workingDriving float64
+		if err := rows.Scan(&row.Period, &id, &name, &row.Vehicles, &row.DistanceKm, &row.DrivingSeconds, &row.IdleSeconds,
+			&row.TripCount, &row.MaxSpeed, &row.FirstStart, &row.LastStop, &working, &workingDriving); err != nil {
+			return nil, err
+		}
+		if id.Valid {
+			u := uuid.MustParse(id.String)
+			if q.ByGroup {
+				row.GroupID, row.GroupName = &u, name
+			} else {
+				row.VehicleID, row.PlateNumber = &u, name
+			}
+		}
+		if working > 0 {
+			row.Utilization = workingDriving / working * 100
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+)
+
+const stopColumns = `id, vehicle_id, lon, lat, arrival, departure, duration_seconds, idle_seconds, idling, in_progress`
+
+func scanStop(row scanner, extra ...interface{}) (model.Stop, error) {
+	var s model.Stop
+	dest := append([]interface{}{&s.ID, &s.VehicleID, &s.Location[0], &s.Location[1], &s.Arrival, &s.Departure,
+		&s.DurationSeconds, &s.IdleSeconds, &s.Idling, &s.InProgress}, extra...)
+	err := row.Scan(dest...)
+	return s, err
+}
+
+// GetOpenStop returns the in-progress stop of a vehicle locked for update,
+// or nil when the vehicle is moving
+func (r *Repo) GetOpenStop(ctx context.Context, vehicleID string) (*model.OpenStop, error) {
+	var o model.OpenStop
+	st, err := scanStop(r.db.QueryRowContext(ctx, `
+        SELECT `+stopColumns+`, anchor_lon, anchor_lat, sum_lon, sum_lat, fixes, last_fix_at, last_ignition
+        FROM stops
+        WHERE vehicle_id = $1 AND in_progress
+        FOR UPDATE
+    `, vehicleID), &o.Anchor[0], &o.Anchor[1], &o.SumLon, &o.SumLat, &o.Fixes, &o.LastFixAt, &o.LastIgnition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.Stop = st
+	return &o, nil
+}
+
+// SaveStop inserts or updates a stop together with its detection state
+func (r *Repo) SaveStop(ctx context.Context, s model.OpenStop) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO stops (id, vehicle_id, lon, lat, arrival, departure, duration_seconds, idle_seconds, idling, in_progress,
+                           anchor_lon, anchor_lat, sum_lon, sum_lat, fixes, last_fix_at, last_ignition)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+        ON CONFLICT (id) DO UPDATE
+          SET lon = EXCLUDED.lon,
+              lat = EXCLUDED.lat,
+              departure = EXCLUDED.departure,
+              duration_seconds = EXCLUDED.duration_seconds,
+              idle_seconds = EXCLUDED.idle_seconds,
+              idling = EXCLUDED.idling,
+              in_progress = EXCLUDED.in_progress,
+              sum_lon = EXCLUDED.sum_lon,
+              sum_lat = EXCLUDED.sum_lat,
+              fixes = EXCLUDED.fixes,
+              last_fix_at = EXCLUDED.last_fix_at,
+              last_ignition = EXCLUDED.last_ignition
+    `, s.ID, s.VehicleID, s.Location[0], s.Location[1], s.Arrival, s.Departure, s.DurationSeconds, s.IdleSeconds, s.Idling, s.InProgress,
+		s.Anchor[0], s.Anchor[1], s.SumLon, s.SumLat, s.Fixes, s.LastFixAt, s.LastIgnition)
+	return err
+}
+
+// InsertStopIfFree stores a stop unless the vehicle already has a stop
+// overlapping it, and reports whether it was stored
+func (r *Repo) InsertStopIfFree(ctx context.Context, s model.OpenStop) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO stops (id, vehicle_id, lon, lat, arrival, departure, duration_seconds, idle_seconds, idling, in_progress,
+                           anchor_lon, anchor_lat, sum_lon, sum_lat, fixes, last_fix_at, last_ignition)
+        SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+        WHERE NOT EXISTS (
+            SELECT 1 FROM stops
+            WHERE vehicle_id = $2 AND arrival <= $6 AND (departure >= $5 OR in_progress)
+        )
+    `, s.ID, s.VehicleID, s.Location[0], s.Location[1], s.Arrival, s.Departure, s.DurationSeconds, s.IdleSeconds, s.Idling, s.InProgress,
+		s.Anchor[0], s.Anchor[1], s.SumLon, s.SumLat, s.Fixes, s.LastFixAt, s.LastIgnition)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteStop removes a stop candidate that turned out too short
+func (r *Repo) DeleteStop(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM stops WHERE id = $1`, id)
+	return err
+}
+
+// StopQuery selects stops of a vehicle arriving in [From, To)
+type StopQuery struct {
+	VehicleID   string
+	From, To    time.Time
+	MinDuration time.Duration
+	Idling      *bool
+}
+
+// GetStops returns matching stops oldest first. In-progress stops are
+// included once they have lasted MinDuration.
+func (r *Repo) GetStops(ctx context.Context, q StopQuery) ([]model.Stop, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+stopColumns+`
+        FROM stops
+        WHERE vehicle_id = $1 AND arrival >= $2 AND arrival < $3
+          AND duration_seconds >= $4
+          AND ($5::boolean IS NULL OR idling = $5)
+        ORDER BY arrival
+    `, q.VehicleID, q.From, q.To, q.MinDuration.Seconds(), q.Idling)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.Stop{}
+	for rows.Next() {
+		s, err := scanStop(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
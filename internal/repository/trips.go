@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/lib/pq"
+)
+
+// tripColumns selects a trip from trips aliased as t
+const tripColumns = `t.id, t.vehicle_id, t.start_time, t.end_time, COALESCE(t.mileage, 0), COALESCE(t.avg_speed, 0), t.in_progress, t.driver_id,
+       t.start_lon, t.start_lat, t.last_lon, t.last_lat`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTrip(row scanner, extra ...interface{}) (model.Trip, error) {
+	var t model.Trip
+	var start, end [2]sql.NullFloat64
+	dest := append([]interface{}{&t.ID, &t.VehicleID, &t.StartTime, &t.EndTime, &t.Mileage, &t.AvgSpeed, &t.InProgress, &t.DriverID,
+		&start[0], &start[1], &end[0], &end[1]}, extra...)
+	err := row.Scan(dest...)
+	t.StartLocation = lonLat(start)
+	t.EndLocation = lonLat(end)
+	return t, err
+}
+
+func lonLat(v [2]sql.NullFloat64) *[2]float64 {
+	if !v[0].Valid || !v[1].Valid {
+		return nil
+	}
+	return &[2]float64{v[0].Float64, v[1].Float64}
+}
+
+// GetOpenTrip returns the in-progress trip of a vehicle locked for update,
+// or nil when the vehicle is not on a trip
+func (r *Repo) GetOpenTrip(ctx context.Context, vehicleID string) (*model.OpenTrip, error) {
+	var t model.OpenTrip
+	trip, err := scanTrip(r.db.QueryRowContext(ctx, `
+        SELECT `+tripColumns+`, t.last_fix_at, t.last_moving_at, t.last_lon, t.last_lat
+        FROM trips t
+        WHERE vehicle_id = $1 AND in_progress
+        FOR UPDATE
+    `, vehicleID), &t.LastFixAt, &t.LastMovingAt, &t.LastLocation[0], &t.LastLocation[1])
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Trip = trip
+	return &t, nil
+}
+
+// TripAt returns the vehicle's trip under way at at, or nil when there was
+// none. An open trip covers the time up to its last fix.
+func (r *Repo) TripAt(ctx context.Context, vehicleID string, at time.Time) (*model.Trip, error) {
+	t, err := scanTrip(r.db.QueryRowContext(ctx, `
+        SELECT `+tripColumns+`
+        FROM trips t
+        WHERE t.vehicle_id = $1 AND t.start_time <= ($2::timestamptz AT TIME ZONE 'UTC')
+          AND (t.end_time >= ($2::timestamptz AT TIME ZONE 'UTC') OR (t.in_progress AND t.last_fix_at >= $2::timestamptz))
+        ORDER BY t.start_time DESC
+        LIMIT 1
+    `, vehicleID, at))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveTrip inserts or updates a trip together with its segmentation state
+func (r *Repo) SaveTrip(ctx context.Context, t model.OpenTrip) error {
+	var startLon, startLat interface{}
+	if t.StartLocation != nil {
+		startLon, startLat = t.StartLocation[0], t.StartLocation[1]
+	}
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO trips (id, vehicle_id, start_time, end_time, mileage, avg_speed, in_progress,
+                           last_fix_at, last_moving_at, last_lon, last_lat, driver_id, start_lon, start_lat)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+        ON CONFLICT (id) DO UPDATE
+          SET end_time = EXCLUDED.end_time,
+              mileage = EXCLUDED.mileage,
+              avg_speed = EXCLUDED.avg_speed,
+              in_progress = EXCLUDED.in_progress,
+              last_fix_at = EXCLUDED.last_fix_at,
+              last_moving_at = EXCLUDED.last_moving_at,
+              last_lon = EXCLUDED.last_lon,
+              last_lat = EXCLUDED.last_lat
+    `, t.ID, t.VehicleID, t.StartTime, t.EndTime, t.Mileage, t.AvgSpeed, t.InProgress,
+		t.LastFixAt, t.LastMovingAt, t.LastLocation[0], t.LastLocation[1], t.DriverID, startLon, startLat)
+	return err
+}
+
+// InsertTripIfFree stores a completed trip unless the vehicle already has a
+// trip overlapping it, and reports whether it was stored
+func (r *Repo) InsertTripIfFree(ctx context.Context, t model.OpenTrip) (bool, error) {
+	var startLon, startLat interface{}
+	if t.StartLocation != nil {
+		startLon, startLat = t.StartLocation[0], t.StartLocation[1]
+	}
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO trips (id, vehicle_id, start_time, end_time, mileage, avg_speed, in_progress,
+                           last_fix_at, last_moving_at, last_lon, last_lat, driver_id, start_lon, start_lat)
+        SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+        WHERE NOT EXISTS (
+            SELECT 1 FROM trips
+            WHERE vehicle_id = $2 AND start_time <= $4 AND (end_time >= $3 OR in_progress)
+        )
+    `, t.ID, t.VehicleID, t.StartTime, t.EndTime, t.Mileage, t.AvgSpeed, t.InProgress,
+		t.LastFixAt, t.LastMovingAt, t.LastLocation[0], t.LastLocation[1], t.DriverID, startLon, startLat)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Trip sort keys
+const (
+	TripSortStartTime = "start_time"
+	TripSortMileage   = "mileage"
+	TripSortDuration  = "duration"
+	TripSortAvgSpeed  = "avg_speed"
+)
+
+// tripSortExprs maps a sort key to its SQL expression and the type a cursor
+// value is cast to
+var tripSortExprs = map[string][2]string{
+	TripSortStartTime: {"t.start_time", "timestamp"},
+	TripSortMileage:   {"COALESCE(t.mileage, 0)", "float8"},
+	TripSortDuration:  {"EXTRACT(EPOCH FROM (t.end_time - t.start_time))", "numeric"},
+	TripSortAvgSpeed:  {"COALESCE(t.avg_speed, 0)", "float8"},
+}
+
+// ValidTripSort reports whether key is a supported sort key
+func ValidTripSort(key string) bool {
+	_, ok := tripSortExprs[key]
+	return ok
+}
+
+// TripCursor is the position after which the next page starts: the sort
+// value and ID of the last trip returned
+type TripCursor struct {
+	Value string
+	ID    string
+}
+
+// TripQuery filters and orders a trip search. Zero values disable a filter.
+type TripQuery struct {
+	From, To    time.Time // trips starting in [From, To)
+	VehicleIDs  []string
+	DriverID    string
+	GroupID     string
+	MinMileage  float64 // km
+	MinDuration time.Duration
+	Sort        string
+	Desc        bool
+	After       *TripCursor
+	Limit       int
+}
+
+// SearchTrips returns one page of trips matching q using keyset pagination
+// on the sort value and trip ID
+func (r *Repo) SearchTrips(ctx context.Context, q TripQuery) ([]model.Trip, error) {
+	sort, ok := tripSortExprs[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unsupported trip sort %q", q.Sort)
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	where = append(where, "t.start_time >= "+arg(q.From), "t.start_time < "+arg(q.To))
+	if len(q.VehicleIDs) > 0 {
+		where = append(where, "t.vehicle_id = ANY("+arg(pq.Array(q.VehicleIDs))+"::uuid[])")
+	}
+	if q.DriverID != "" {
+		where = append(where, "t.driver_id = "+arg(q.DriverID))
+	}
+	if q.GroupID != "" {
+		where = append(where, "v.group_id = "+arg(q.GroupID))
+	}
+	if q.MinMileage > 0 {
+		where = append(where, "COALESCE(t.mileage, 0) >= "+arg(q.MinMileage))
+	}
+	if q.MinDuration > 0 {
+		where = append(where, "t.end_time - t.start_time >= "+arg(q.MinDuration.Seconds())+" * INTERVAL '1 second'")
+	}
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		where = append(where, fmt.Sprintf("(%s, t.id) %s (%s::%s, %s::uuid)", sort[0], cmp, arg(q.After.Value), sort[1], arg(q.After.ID)))
+	}
+
+	query := `
+        SELECT ` + tripColumns + `
+        FROM trips t
+        JOIN vehicle v ON v.id = t.vehicle_id
+        WHERE ` + strings.Join(where, " AND ") + `
+        ORDER BY ` + sort[0] + ` ` + dir + `, t.id ` + dir + `
+        LIMIT ` + arg(q.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []model.Trip{}
+	for rows.Next() {
+		t, err := scanTrip(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,539 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidPlannedRoute is returned for an invalid planned route, assignment
+// or adherence query
+var ErrInvalidPlannedRoute = errors.New("invalid planned route input")
+
+const (
+	// MaxAssignmentWindow limits how long a vehicle drives one planned route
+	MaxAssignmentWindow = 7 * 24 * time.Hour
+	// MaxAdherenceRange limits how much history a route adherence report covers
+	MaxAdherenceRange = 93 * 24 * time.Hour
+)
+
+// AdherenceParams controls route adherence tracking
+type AdherenceParams struct {
+	CorridorM   float64 // corridor width when a route does not set one
+	StopRadiusM float64 // stop radius when a stop does not set one
+	SkipSlackM  float64 // distance past a stop's radius after which an unvisited stop is skipped
+	BacktrackM  float64 // how far behind its progress a vehicle is still located on the route
+	MaxStopM    float64 // how far from the path a stop may be
+}
+
+// DefaultAdherenceParams returns the parameters used on ingest
+func DefaultAdherenceParams() AdherenceParams {
+	return AdherenceParams{CorridorM: 50, StopRadiusM: 50, SkipSlackM: 200, BacktrackM: 500, MaxStopM: 500}
+}
+
+// PlannedStopInput describes a scheduled stop of a new planned route
+type PlannedStopInput struct {
+	Name               string     `json:"name"`
+	Location           [2]float64 `json:"location"` // lon, lat
+	RadiusM            *float64   `json:"radius_m"`
+	ScheduledOffsetMin *float64   `json:"scheduled_offset_min"`
+}
+
+// PlannedRouteInput describes a new planned route. The path is given either
+// as [lon, lat] points or as an encoded polyline; stops are in driving order.
+type PlannedRouteInput struct {
+	Name      string             `json:"name"`
+	Path      [][2]float64       `json:"path"`
+	Polyline  string             `json:"polyline"`
+	CorridorM *float64           `json:"corridor_m"`
+	Stops     []PlannedStopInput `json:"stops"`
+}
+
+func validLonLat(p [2]float64) bool {
+	return p[0] >= -180 && p[0] <= 180 && p[1] >= -90 && p[1] <= 90 && !(p[0] == 0 && p[1] == 0)
+}
+
+func routePath(r model.PlannedRoute) geo.Path {
+	pts := make([]geo.Point, len(r.Path))
+	for i, p := range r.Path {
+		pts[i] = geo.FromLonLat(p)
+	}
+	return geo.NewPath(pts)
+}
+
+func (in PlannedRouteInput) route(now time.Time, p AdherenceParams) (model.PlannedRoute, error) {
+	r := model.PlannedRoute{
+		ID:        uuid.New(),
+		Name:      strings.TrimSpace(in.Name),
+		Path:      in.Path,
+		CorridorM: p.CorridorM,
+		Stops:     []model.PlannedStop{},
+		CreatedAt: now,
+	}
+	if r.Name == "" {
+		return r, fmt.Errorf("%w: name required", ErrInvalidPlannedRoute)
+	}
+	switch {
+	case in.Polyline != "" && len(in.Path) > 0:
+		return r, fmt.Errorf("%w: give either path or polyline", ErrInvalidPlannedRoute)
+	case in.Polyline != "":
+		pts, err := geo.DecodePolyline(in.Polyline)
+		if err != nil {
+			return r, fmt.Errorf("%w: %v", ErrInvalidPlannedRoute, err)
+		}
+		r.Path = make([][2]float64, len(pts))
+		for i, pt := range pts {
+			r.Path[i] = [2]float64{pt.Lon, pt.Lat}
+		}
+	}
+	if len(r.Path) < 2 {
+		return r, fmt.Errorf("%w: the path needs at least 2 points", ErrInvalidPlannedRoute)
+	}
+	for _, pt := range r.Path {
+		if !validLonLat(pt) {
+			return r, fmt.Errorf("%w: path points must be [lon, lat]", ErrInvalidPlannedRoute)
+		}
+	}
+	if in.CorridorM != nil {
+		if *in.CorridorM <= 0 || *in.CorridorM > 1000 {
+			return r, fmt.Errorf("%w: corridor_m must be between 0 and 1000", ErrInvalidPlannedRoute)
+		}
+		r.CorridorM = *in.CorridorM
+	}
+	path := routePath(r)
+	r.LengthM = math.Round(path.Length())
+
+	along := 0.0
+	for i, st := range in.Stops {
+		ps := model.PlannedStop{
+			Name:               strings.TrimSpace(st.Name),
+			Location:           st.Location,
+			RadiusM:            p.StopRadiusM,
+			ScheduledOffsetMin: st.ScheduledOffsetMin,
+		}
+		if ps.Name == "" {
+			ps.Name = fmt.Sprintf("Stop %d", i+1)
+		}
+		if !validLonLat(st.Location) {
+			return r, fmt.Errorf("%w: stop %d location must be [lon, lat]", ErrInvalidPlannedRoute, i+1)
+		}
+		if st.RadiusM != nil {
+			if *st.RadiusM <= 0 || *st.RadiusM > 1000 {
+				return r, fmt.Errorf("%w: stop %d radius_m must be between 0 and 1000", ErrInvalidPlannedRoute, i+1)
+			}
+			ps.RadiusM = *st.RadiusM
+		}
+		if st.ScheduledOffsetMin != nil && *st.ScheduledOffsetMin < 0 {
+			return r, fmt.Errorf("%w: stop %d scheduled_offset_min must not be negative", ErrInvalidPlannedRoute, i+1)
+		}
+		// stops follow each other along the path
+		dist, a := path.Locate(geo.FromLonLat(st.Location), along)
+		if dist > p.MaxStopM {
+			return r, fmt.Errorf("%w: stop %d is %.0f m from the path past the previous stop", ErrInvalidPlannedRoute, i+1, dist)
+		}
+		ps.AlongM, along = math.Round(a), a
+		r.Stops = append(r.Stops, ps)
+	}
+	return r, nil
+}
+
+// adherenceStep is what a fix changed about a route assignment
+type adherenceStep struct {
+	stale      bool    // no newer than the last fix tracked
+	tracked    bool    // false before the vehicle first joined the route
+	distM      float64 // distance from the path
+	onRoute    bool
+	wasOnRoute bool
+	visited    []int // stops reached with the fix
+	skipped    []int // stops the fix left behind unvisited
+}
+
+// adhere tracks a route assignment with a fix of its vehicle. The fix is
+// located on the stretch of the path from BacktrackM behind the progress
+// so far, so a route passing a place twice is followed in order. Fixes
+// before the vehicle first enters the corridor are not counted: it is
+// still on its way to the route. Stops are visited within their radius and
+// skipped once the progress is SkipSlackM past their radius; a skipped
+// stop driven back to is visited late.
+func adhere(a *model.RouteAssignment, r model.PlannedRoute, path geo.Path, pos model.Position, p AdherenceParams) adherenceStep {
+	var st adherenceStep
+	if a.LastAt != nil && !pos.Timestamp.After(*a.LastAt) {
+		st.stale = true
+		return st
+	}
+	at := pos.Timestamp
+	a.LastAt = &at
+	if a.Visits == nil {
+		a.Visits = map[int]model.StopVisit{}
+	}
+
+	q := geo.FromLonLat(pos.Location)
+	dist, along := path.Locate(q, math.Max(0, a.ProgressM-p.BacktrackM))
+	if dist > r.CorridorM {
+		// off the stretch ahead; how far from the route at all
+		if d, _ := path.Locate(q, 0); d < dist {
+			dist = d
+		}
+	}
+	st.distM = dist
+	st.onRoute = dist <= r.CorridorM
+	st.wasOnRoute = a.OffRouteID == nil
+	if a.FixesInCorridor == 0 && !st.onRoute {
+		return st
+	}
+	st.tracked = true
+	a.Fixes++
+	if st.onRoute {
+		a.FixesInCorridor++
+		a.ProgressM = math.Max(a.ProgressM, along)
+	}
+
+	for i, stop := range r.Stops {
+		v, seen := a.Visits[i]
+		switch {
+		case v.Status == model.StopVisited:
+		case geo.Distance(q, geo.FromLonLat(stop.Location)) <= stop.RadiusM:
+			a.Visits[i] = model.StopVisit{Status: model.StopVisited, At: at}
+			st.visited = append(st.visited, i)
+		case !seen && a.ProgressM > stop.AlongM+stop.RadiusM+p.SkipSlackM:
+			a.Visits[i] = model.StopVisit{Status: model.StopSkipped, At: at}
+			st.skipped = append(st.skipped, i)
+		}
+	}
+	return st
+}
+
+func deviationEvent(d model.RouteDeviation, routeName string) (model.Event, error) {
+	return model.NewEvent(model.EventRouteDeviation, d.VehicleID, map[string]interface{}{
+		"deviation_id":  d.ID,
+		"assignment_id": d.AssignmentID,
+		"route_id":      d.RouteID,
+		"route_name":    routeName,
+		"vehicle_id":    d.VehicleID,
+		"kind":          d.Kind,
+		"at":            d.StartedAt,
+		"distance_m":    d.MaxDistanceM,
+		"stop_index":    d.StopIndex,
+		"stop_name":     d.StopName,
+		"location":      d.Location,
+	})
+}
+
+// trackRoutes follows the planned routes the vehicle of a newly stored fix
+// is assigned to and returns the deviation events
+func trackRoutes(ctx context.Context, tx *repository.Repo, pos model.Position) ([]model.Event, error) {
+	active, err := tx.ActiveRouteAssignments(ctx, pos.VehicleID.String(), pos.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	var events []model.Event
+	emit := func(d model.RouteDeviation, route string) error {
+		if err := tx.InsertRouteDeviation(ctx, d); err != nil {
+			return err
+		}
+		e, err := deviationEvent(d, route)
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	}
+
+	p := DefaultAdherenceParams()
+	for _, ar := range active {
+		a, r := ar.Assignment, ar.Route
+		st := adhere(&a, r, routePath(r), pos, p)
+		if st.stale {
+			continue
+		}
+		if !st.tracked {
+			if err := tx.SaveRouteProgress(ctx, a); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		dev := func(kind string) model.RouteDeviation {
+			return model.RouteDeviation{
+				ID:           uuid.New(),
+				AssignmentID: a.ID,
+				RouteID:      r.ID,
+				VehicleID:    a.VehicleID,
+				Kind:         kind,
+				StartedAt:    pos.Timestamp,
+				Location:     pos.Location,
+			}
+		}
+		switch {
+		case !st.onRoute && st.wasOnRoute:
+			d := dev(model.DeviationOffRoute)
+			d.MaxDistanceM = math.Round(st.distM)
+			if err := emit(d, r.Name); err != nil {
+				return nil, err
+			}
+			a.OffRouteID = &d.ID
+		case !st.onRoute:
+			if err := tx.UpdateOffRoute(ctx, *a.OffRouteID, math.Round(st.distM), nil); err != nil {
+				return nil, err
+			}
+		case !st.wasOnRoute:
+			if err := tx.UpdateOffRoute(ctx, *a.OffRouteID, 0, &pos.Timestamp); err != nil {
+				return nil, err
+			}
+			a.OffRouteID = nil
+		}
+		for _, i := range st.visited {
+			if err := tx.SaveStopVisit(ctx, a.ID, i, a.Visits[i]); err != nil {
+				return nil, err
+			}
+		}
+		for _, i := range st.skipped {
+			if err := tx.SaveStopVisit(ctx, a.ID, i, a.Visits[i]); err != nil {
+				return nil, err
+			}
+			d := dev(model.DeviationSkippedStop)
+			idx := i
+			d.StopIndex, d.StopName = &idx, r.Stops[i].Name
+			d.EndedAt = &d.StartedAt
+			d.MaxDistanceM = math.Round(geo.Distance(geo.FromLonLat(pos.Location), geo.FromLonLat(r.Stops[i].Location)))
+			if err := emit(d, r.Name); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.SaveRouteProgress(ctx, a); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// Assignment states in an adherence report
+const (
+	AssignmentScheduled  = "scheduled"
+	AssignmentInProgress = "in_progress"
+	AssignmentCompleted  = "completed"
+)
+
+// Stop statuses in an adherence report besides visited and skipped
+const (
+	StopMissed  = "missed"  // the assignment ended before the vehicle got there
+	StopPending = "pending" // not reached yet
+)
+
+// StopAdherence is how a scheduled stop of an assignment went
+type StopAdherence struct {
+	Index        int        `json:"index"`
+	Name         string     `json:"name"`
+	Status       string     `json:"status"`
+	ScheduledAt  *time.Time `json:"scheduled_at,omitempty"`
+	At           *time.Time `json:"at,omitempty"`            // when it was visited or skipped
+	DelaySeconds *float64   `json:"delay_seconds,omitempty"` // visit behind schedule, negative when early
+}
+
+// RouteAdherence is how closely a vehicle drove a planned route
+type RouteAdherence struct {
+	model.RouteAssignment
+	RouteName       string                 `json:"route_name"`
+	State           string                 `json:"state"`
+	AdherencePct    *float64               `json:"adherence_pct"` // share of tracked fixes within the corridor
+	CompletedPct    float64                `json:"completed_pct"` // progress along the route
+	OffRouteSeconds float64                `json:"off_route_seconds"`
+	StopsVisited    int                    `json:"stops_visited"`
+	StopsSkipped    int                    `json:"stops_skipped"`
+	StopsMissed     int                    `json:"stops_missed"`
+	Stops           []StopAdherence        `json:"stops"`
+	Deviations      []model.RouteDeviation `json:"deviations"`
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// adherenceOf summarises an assignment of a route with its deviations as
+// of now
+func adherenceOf(a model.RouteAssignment, r model.PlannedRoute, devs []model.RouteDeviation, now time.Time) RouteAdherence {
+	res := RouteAdherence{
+		RouteAssignment: a,
+		RouteName:       r.Name,
+		State:           AssignmentInProgress,
+		Stops:           []StopAdherence{},
+		Deviations:      []model.RouteDeviation{},
+	}
+	switch {
+	case now.Before(a.StartAt):
+		res.State = AssignmentScheduled
+	case !now.Before(a.EndAt):
+		res.State = AssignmentCompleted
+	}
+	if a.Fixes > 0 {
+		v := round1(100 * float64(a.FixesInCorridor) / float64(a.Fixes))
+		res.AdherencePct = &v
+	}
+	if r.LengthM > 0 {
+		res.CompletedPct = round1(math.Min(100, 100*a.ProgressM/r.LengthM))
+	}
+
+	for i, st := range r.Stops {
+		sa := StopAdherence{Index: i, Name: st.Name, Status: StopPending}
+		if st.ScheduledOffsetMin != nil {
+			t := a.StartAt.Add(time.Duration(*st.ScheduledOffsetMin * float64(time.Minute)))
+			sa.ScheduledAt = &t
+		}
+		if v, ok := a.Visits[i]; ok {
+			at := v.At
+			sa.Status, sa.At = v.Status, &at
+			if v.Status == model.StopVisited && sa.ScheduledAt != nil {
+				d := at.Sub(*sa.ScheduledAt).Seconds()
+				sa.DelaySeconds = &d
+			}
+		} else if res.State == AssignmentCompleted {
+			sa.Status = StopMissed
+		}
+		switch sa.Status {
+		case model.StopVisited:
+			res.StopsVisited++
+		case model.StopSkipped:
+			res.StopsSkipped++
+		case StopMissed:
+			res.StopsMissed++
+		}
+		res.Stops = append(res.Stops, sa)
+	}
+
+	end := now
+	if a.EndAt.Before(end) {
+		end = a.EndAt
+	}
+	for _, d := range devs {
+		if d.AssignmentID != a.ID {
+			continue
+		}
+		res.Deviations = append(res.Deviations, d)
+		if d.Kind != model.DeviationOffRoute {
+			continue
+		}
+		to := end
+		if d.EndedAt != nil {
+			to = *d.EndedAt
+		}
+		if to.After(d.StartedAt) {
+			res.OffRouteSeconds += to.Sub(d.StartedAt).Seconds()
+		}
+	}
+	return res
+}
+
+// CreatePlannedRoute stores a planned route, locating its stops on the path
+func (s *Service) CreatePlannedRoute(ctx context.Context, in PlannedRouteInput) (model.PlannedRoute, error) {
+	r, err := in.route(time.Now().UTC(), DefaultAdherenceParams())
+	if err != nil {
+		return r, err
+	}
+	return r, s.repo.CreatePlannedRoute(ctx, r)
+}
+
+// ListPlannedRoutes returns the planned routes
+func (s *Service) ListPlannedRoutes(ctx context.Context) ([]model.PlannedRoute, error) {
+	return s.repo.ListPlannedRoutes(ctx)
+}
+
+// GetPlannedRoute returns a planned route
+func (s *Service) GetPlannedRoute(ctx context.Context, id string) (model.PlannedRoute, error) {
+	return s.repo.GetPlannedRoute(ctx, id)
+}
+
+// DeletePlannedRoute removes a planned route with its assignments
+func (s *Service) DeletePlannedRoute(ctx context.Context, id string) error {
+	return s.repo.DeletePlannedRoute(ctx, id)
+}
+
+// AssignmentInput assigns a planned route to a vehicle for a time window
+type AssignmentInput struct {
+	VehicleID string    `json:"vehicle_id"`
+	StartAt   time.Time `json:"start_at"`
+	EndAt     time.Time `json:"end_at"`
+}
+
+// AssignPlannedRoute assigns a planned route to a vehicle; its fixes in
+// the window are tracked against the route from then on
+func (s *Service) AssignPlannedRoute(ctx context.Context, routeID string, in AssignmentInput) (model.RouteAssignment, error) {
+	a := model.RouteAssignment{ID: uuid.New(), StartAt: in.StartAt.UTC(), EndAt: in.EndAt.UTC(), CreatedAt: time.Now().UTC()}
+	var err error
+	if a.RouteID, err = uuid.Parse(routeID); err != nil {
+		return a, repository.ErrPlannedRouteNotFound
+	}
+	if a.VehicleID, err = uuid.Parse(in.VehicleID); err != nil {
+		return a, fmt.Errorf("%w: invalid vehicle_id", ErrInvalidPlannedRoute)
+	}
+	if in.StartAt.IsZero() || in.EndAt.IsZero() {
+		return a, fmt.Errorf("%w: start_at and end_at required", ErrInvalidPlannedRoute)
+	}
+	if err := ValidateRange(a.StartAt, a.EndAt, MaxAssignmentWindow); err != nil {
+		return a, fmt.Errorf("%w: start_at must be before end_at and at most 7 days before it", ErrInvalidPlannedRoute)
+	}
+	return a, s.repo.CreateRouteAssignment(ctx, a)
+}
+
+// GetRouteAdherence reports how closely an assignment follows its route
+func (s *Service) GetRouteAdherence(ctx context.Context, id string) (RouteAdherence, error) {
+	a, err := s.repo.GetRouteAssignment(ctx, id)
+	if err != nil {
+		return RouteAdherence{}, err
+	}
+	r, err := s.repo.GetPlannedRoute(ctx, a.RouteID.String())
+	if err != nil {
+		return RouteAdherence{}, err
+	}
+	devs, err := s.repo.GetRouteDeviations(ctx, []uuid.UUID{a.ID})
+	if err != nil {
+		return RouteAdherence{}, err
+	}
+	return adherenceOf(a, r, devs, time.Now().UTC()), nil
+}
+
+// GetAdherenceReport reports on the route assignments overlapping a time
+// range, optionally of one route or vehicle
+func (s *Service) GetAdherenceReport(ctx context.Context, q repository.RouteAssignmentQuery) ([]RouteAdherence, error) {
+	if err := ValidateRange(q.From, q.To, MaxAdherenceRange); err != nil {
+		return nil, err
+	}
+	for name, id := range map[string]string{"route_id": q.RouteID, "vehicle_id": q.VehicleID} {
+		if _, err := uuid.Parse(id); id != "" && err != nil {
+			return nil, fmt.Errorf("%w: invalid %s", ErrInvalidPlannedRoute, name)
+		}
+	}
+	as, err := s.repo.ListRouteAssignments(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(as))
+	for i, a := range as {
+		ids[i] = a.ID
+	}
+	devs, err := s.repo.GetRouteDeviations(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	routes := map[uuid.UUID]model.PlannedRoute{}
+	now := time.Now().UTC()
+	res := []RouteAdherence{}
+	for _, a := range as {
+		r, ok := routes[a.RouteID]
+		if !ok {
+			if r, err = s.repo.GetPlannedRoute(ctx, a.RouteID.String()); err != nil {
+				return nil, err
+			}
+			routes[a.RouteID] = r
+		}
+		res = append(res, adherenceOf(a, r, devs, now))
+	}
+	return res, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlannedRouteInput(t *testing.T) {
+	start := geo.Point{Lat: 25.2, Lon: 55.27}
+	end := geo.Destination(start, 90, 5000)
+	offset := 5.0
+	in := PlannedRouteInput{
+		Name: "School run",
+		Path: [][2]float64{start.LonLat(), end.LonLat()},
+		Stops: []PlannedStopInput{
+			{Name: "Gate", Location: geo.Destination(geo.Destination(start, 90, 1000), 0, 20).LonLat(), ScheduledOffsetMin: &offset},
+			{Location: geo.Destination(start, 90, 4000).LonLat()},
+		},
+	}
+	r, err := in.route(time.Now(), DefaultAdherenceParams())
+	require.NoError(t, err)
+	assert.InDelta(t, 5000, r.LengthM, 5)
+	assert.Equal(t, 50.0, r.CorridorM)
+	require.Len(t, r.Stops, 2)
+	assert.InDelta(t, 1000, r.Stops[0].AlongM, 5)
+	assert.Equal(t, "Stop 2", r.Stops[1].Name)
+	assert.InDelta(t, 4000, r.Stops[1].AlongM, 5)
+
+	enc := PlannedRouteInput{Name: "Encoded", Polyline: geo.EncodePolyline([]geo.Point{start, end})}
+	r, err = enc.route(time.Now(), DefaultAdherenceParams())
+	require.NoError(t, err)
+	assert.InDelta(t, 5000, r.LengthM, 5)
+
+	in.Stops = append(in.Stops, PlannedStopInput{Location: geo.Destination(start, 0, 2000).LonLat()})
+	_, err = in.route(time.Now(), DefaultAdherenceParams())
+	assert.ErrorIs(t, err, ErrInvalidPlannedRoute, "a stop far from the path")
+
+	_, err = PlannedRouteInput{Name: "Dot", Path: [][2]float64{start.LonLat()}}.route(time.Now(), DefaultAdherenceParams())
+	assert.ErrorIs(t, err, ErrInvalidPlannedRoute)
+}
+
+func TestAdhere(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 7, 0, 0, 0, time.UTC)
+	start := geo.Point{Lat: 25.2, Lon: 55.27}
+	east := func(m float64) geo.Point { return geo.Destination(start, 90, m) }
+	offset := 3.0
+	p := DefaultAdherenceParams()
+	r, err := PlannedRouteInput{
+		Name: "Line 4",
+		Path: [][2]float64{start.LonLat(), east(5000).LonLat()},
+		Stops: []PlannedStopInput{
+			{Name: "Library", Location: east(1000).LonLat(), ScheduledOffsetMin: &offset},
+			{Name: "Park", Location: east(2500).LonLat()},
+			{Name: "School", Location: east(4000).LonLat()},
+		},
+	}.route(t0, p)
+	require.NoError(t, err)
+	path := routePath(r)
+	a := model.RouteAssignment{ID: uuid.New(), RouteID: r.ID, StartAt: t0, EndAt: t0.Add(time.Hour)}
+
+	sec := 0
+	fix := func(at geo.Point) model.Position {
+		sec += 60
+		return model.Position{Location: at.LonLat(), Timestamp: t0.Add(time.Duration(sec) * time.Second)}
+	}
+	steps := map[string]adherenceStep{}
+	for _, f := range []struct {
+		name string
+		at   geo.Point
+	}{
+		{"depot", geo.Destination(start, 270, 2000)},
+		{"start", start},
+		{"on the way", east(500)},
+		{"library", geo.Destination(east(1000), 0, 30)},
+		{"before the park", east(1500)},
+		{"detour", geo.Destination(east(2500), 0, 300)},
+		{"back", east(3200)},
+		{"school", east(4000)},
+	} {
+		steps[f.name] = adhere(&a, r, path, fix(f.at), p)
+	}
+
+	assert.False(t, steps["depot"].tracked, "fixes before joining the route are not counted")
+	assert.Equal(t, []int{0}, steps["library"].visited)
+	assert.True(t, steps["detour"].tracked)
+	assert.False(t, steps["detour"].onRoute)
+	assert.InDelta(t, 300, steps["detour"].distM, 5)
+	assert.Equal(t, []int{1}, steps["back"].skipped)
+	assert.Equal(t, []int{2}, steps["school"].visited)
+	assert.Equal(t, 7, a.Fixes)
+	assert.Equal(t, 6, a.FixesInCorridor)
+	assert.InDelta(t, 4000, a.ProgressM, 5)
+
+	stale := adhere(&a, r, path, model.Position{Location: east(4500).LonLat(), Timestamp: t0}, p)
+	assert.True(t, stale.stale)
+	assert.Equal(t, 7, a.Fixes)
+
+	ended := t0.Add(7 * time.Minute)
+	devs := []model.RouteDeviation{
+		{AssignmentID: a.ID, Kind: model.DeviationOffRoute, StartedAt: t0.Add(6 * time.Minute), EndedAt: &ended},
+		{AssignmentID: uuid.New(), Kind: model.DeviationOffRoute, StartedAt: t0},
+	}
+	rep := adherenceOf(a, r, devs, t0.Add(2*time.Hour))
+	assert.Equal(t, AssignmentCompleted, rep.State)
+	require.NotNil(t, rep.AdherencePct)
+	assert.Equal(t, 85.7, *rep.AdherencePct)
+	assert.Equal(t, 80.0, rep.CompletedPct)
+	assert.Equal(t, 60.0, rep.OffRouteSeconds)
+	assert.Len(t, rep.Deviations, 1)
+	assert.Equal(t, 2, rep.StopsVisited)
+	assert.Equal(t, 1, rep.StopsSkipped)
+	require.NotNil(t, rep.Stops[0].DelaySeconds)
+	assert.Equal(t, 60.0, *rep.Stops[0].DelaySeconds, "visited at 4 min, scheduled at 3")
+
+	rep = adherenceOf(model.RouteAssignment{StartAt: t0, EndAt: t0.Add(time.Hour)}, r, nil, t0.Add(2*time.Hour))
+	assert.Nil(t, rep.AdherencePct)
+	assert.Equal(t, 3, rep.StopsMissed)
+}
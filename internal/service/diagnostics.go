@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"fleet-tracker-service/internal/dtc"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidDiagnostics is returned for invalid trouble code filters
+var ErrInvalidDiagnostics = errors.New("invalid diagnostics query")
+
+// reportedDTCs returns the well-formed codes of the "dtcs" list in a status
+// payload, and whether the payload had one. A list, even an empty one, is
+// the full set of codes active on the vehicle.
+func reportedDTCs(status map[string]interface{}) ([]string, bool) {
+	list, ok := status["dtcs"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	seen := map[string]bool{}
+	var codes []string
+	for _, v := range list {
+		s, _ := v.(string)
+		c, ok := dtc.Normalize(s)
+		if !ok || seen[c] {
+			continue
+		}
+		seen[c] = true
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	return codes, true
+}
+
+// engineReading returns the engine parameters in the "engine" object of a
+// status payload, or nil when it reports none
+func engineReading(pos model.Position, status map[string]interface{}) *model.EngineReading {
+	m, ok := status["engine"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	e := model.EngineReading{VehicleID: pos.VehicleID, Timestamp: pos.Timestamp}
+	get := func(key string) *float64 {
+		if v, ok := toFloat(m[key]); ok {
+			return &v
+		}
+		return nil
+	}
+	e.RPM, e.CoolantTempC, e.EngineLoad = get("rpm"), get("coolant_temp_c"), get("engine_load")
+	if e.RPM == nil && e.CoolantTempC == nil && e.EngineLoad == nil {
+		return nil
+	}
+	return &e
+}
+
+// diffDTCs compares a reported code list with the active occurrences and
+// returns the codes still active, newly set and no longer reported
+func diffDTCs(active []model.DTCOccurrence, reported []string) (kept, added, cleared []string) {
+	isActive := map[string]bool{}
+	for _, o := range active {
+		isActive[o.Code] = true
+	}
+	isReported := map[string]bool{}
+	for _, c := range reported {
+		isReported[c] = true
+		if isActive[c] {
+			kept = append(kept, c)
+		} else {
+			added = append(added, c)
+		}
+	}
+	for _, o := range active {
+		if !isReported[o.Code] {
+			cleared = append(cleared, o.Code)
+		}
+	}
+	return kept, added, cleared
+}
+
+// recordDiagnostics stores the engine parameters and trouble codes of a
+// newly stored fix and returns an event for every critical code that was
+// not already active. Code lists older than the last one applied are
+// ignored so a late report cannot reopen or clear codes.
+func recordDiagnostics(ctx context.Context, tx *repository.Repo, pos model.Position, status map[string]interface{}) ([]model.Event, error) {
+	if e := engineReading(pos, status); e != nil {
+		if err := tx.InsertEngineReading(ctx, *e); err != nil {
+			return nil, err
+		}
+	}
+	codes, ok := reportedDTCs(status)
+	if !ok {
+		return nil, nil
+	}
+	vid := pos.VehicleID.String()
+	last, err := tx.GetDTCReportedAt(ctx, vid)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && !pos.Timestamp.After(*last) {
+		return nil, nil
+	}
+	if err := tx.SaveDTCReportedAt(ctx, vid, pos.Timestamp); err != nil {
+		return nil, err
+	}
+	active, err := tx.GetDTCs(ctx, repository.DTCQuery{VehicleID: vid, State: "active"})
+	if err != nil {
+		return nil, err
+	}
+
+	kept, added, cleared := diffDTCs(active, codes)
+	if err := tx.TouchDTCs(ctx, vid, kept, pos.Timestamp); err != nil {
+		return nil, err
+	}
+	if err := tx.ClearDTCs(ctx, vid, cleared, pos.Timestamp); err != nil {
+		return nil, err
+	}
+	var events []model.Event
+	for _, c := range added {
+		d := dtc.Decode(c)
+		o := model.DTCOccurrence{
+			ID:          uuid.New(),
+			VehicleID:   pos.VehicleID,
+			Code:        d.Code,
+			System:      d.System,
+			Description: d.Description,
+			Severity:    d.Severity,
+			FirstSeenAt: pos.Timestamp,
+			LastSeenAt:  pos.Timestamp,
+		}
+		if err := tx.InsertDTC(ctx, o); err != nil {
+			return nil, err
+		}
+		if d.Severity != dtc.SeverityCritical {
+			continue
+		}
+		e, err := model.NewEvent(model.EventCriticalDTC, pos.VehicleID, map[string]interface{}{
+			"vehicle_id":  pos.VehicleID,
+			"code":        o.Code,
+			"description": o.Description,
+			"location":    pos.Location,
+			"seen_at":     o.FirstSeenAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func validDTCFilter(state, severity string) error {
+	if state != "" && state != "active" && state != "cleared" {
+		return fmt.Errorf("%w: state must be active or cleared", ErrInvalidDiagnostics)
+	}
+	switch severity {
+	case "", dtc.SeverityInfo, dtc.SeverityWarning, dtc.SeverityCritical:
+		return nil
+	}
+	return fmt.Errorf("%w: severity must be info, warning or critical", ErrInvalidDiagnostics)
+}
+
+// GetVehicleDTCs returns the trouble codes of a vehicle that were active at
+// some point in a time range, newest first
+func (s *Service) GetVehicleDTCs(ctx context.Context, vehicleID string, from, to time.Time, state, severity string) ([]model.DTCOccurrence, error) {
+	if err := ValidateRange(from, to, 0); err != nil {
+		return nil, err
+	}
+	if err := validDTCFilter(state, severity); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return []model.DTCOccurrence{}, nil
+	}
+	return s.repo.GetDTCs(ctx, repository.DTCQuery{VehicleID: vehicleID, State: state, Severity: severity, From: from, To: to})
+}
+
+// GetActiveDTCs returns the trouble codes currently active across the
+// fleet, optionally of one group or severity
+func (s *Service) GetActiveDTCs(ctx context.Context, groupID, severity string) ([]model.DTCOccurrence, error) {
+	if err := validDTCFilter("", severity); err != nil {
+		return nil, err
+	}
+	if groupID != "" {
+		if _, err := uuid.Parse(groupID); err != nil {
+			return nil, fmt.Errorf("%w: invalid group_id", ErrInvalidDiagnostics)
+		}
+	}
+	return s.repo.GetDTCs(ctx, repository.DTCQuery{GroupID: groupID, State: "active", Severity: severity})
+}
+
+// DecodeDTC describes a trouble code
+func (s *Service) DecodeDTC(code string) (dtc.Code, error) {
+	if _, ok := dtc.Normalize(code); !ok {
+		return dtc.Code{}, fmt.Errorf("%w: %q is not a trouble code such as P0301", ErrInvalidDiagnostics, code)
+	}
+	return dtc.Decode(code), nil
+}
+
+// GetEngineReadings returns the engine parameters of a vehicle in a time range
+func (s *Service) GetEngineReadings(ctx context.Context, vehicleID string, from, to time.Time) ([]model.EngineReading, error) {
+	if err := ValidateRange(from, to, MaxRouteRange); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return []model.EngineReading{}, nil
+	}
+	return s.repo.GetEngineReadings(ctx, vehicleID, from, to)
+}
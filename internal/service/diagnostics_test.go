@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportedDTCs(t *testing.T) {
+	codes, ok := reportedDTCs(map[string]interface{}{"dtcs": []interface{}{"p0420", "P0301", "bogus", 7, "P0301"}})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"P0301", "P0420"}, codes)
+
+	codes, ok = reportedDTCs(map[string]interface{}{"dtcs": []interface{}{}})
+	assert.True(t, ok, "an empty list clears every code")
+	assert.Empty(t, codes)
+
+	_, ok = reportedDTCs(map[string]interface{}{"speed": 40})
+	assert.False(t, ok)
+}
+
+func TestEngineReading(t *testing.T) {
+	e := engineReading(model.Position{}, map[string]interface{}{"engine": map[string]interface{}{"rpm": 2100.0, "engine_load": 38}})
+	require.NotNil(t, e)
+	assert.Equal(t, 2100.0, *e.RPM)
+	assert.Equal(t, 38.0, *e.EngineLoad)
+	assert.Nil(t, e.CoolantTempC)
+
+	assert.Nil(t, engineReading(model.Position{}, map[string]interface{}{"engine": map[string]interface{}{"gear": 3}}))
+
+	// A telemetry message without a location is read at its own timestamp
+	vid := uuid.New()
+	status := map[string]interface{}{"timestamp": "2025-06-17T08:00:00Z", "engine": map[string]interface{}{"rpm": 900.0}, "dtcs": []interface{}{"P0301"}}
+	_, located := parsePosition(vid, status)
+	require.False(t, located)
+	e = engineReading(telemetryPosition(vid, status, nil), status)
+	require.NotNil(t, e)
+	assert.Equal(t, vid, e.VehicleID)
+	assert.Equal(t, time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC), e.Timestamp)
+	_, ok := reportedDTCs(status)
+	assert.True(t, ok)
+}
+
+func TestDiffDTCs(t *testing.T) {
+	active := []model.DTCOccurrence{{Code: "P0301"}, {Code: "P0420"}}
+	kept, added, cleared := diffDTCs(active, []string{"P0420", "U0100"})
+	assert.Equal(t, []string{"P0420"}, kept)
+	assert.Equal(t, []string{"U0100"}, added)
+	assert.Equal(t, []string{"P0301"}, cleared)
+}
@@ -0,0 +1,522 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidScoring is returned for invalid scoring settings or queries
+var ErrInvalidScoring = errors.New("invalid scoring input")
+
+// MaxScoreRange limits how much history a driver score or ranking covers
+const MaxScoreRange = 366 * 24 * time.Hour
+
+const gravity = 9.80665 // m/s² per g
+
+// HarshParams controls how harsh driving is derived from consecutive fixes
+type HarshParams struct {
+	AccelMps2    float64       // speed gain per second flagged as harsh acceleration
+	BrakeMps2    float64       // speed loss per second flagged as harsh braking
+	CornerMps2   float64       // lateral acceleration flagged as harsh cornering
+	MaxGap       time.Duration // fixes further apart hide the peak and are not compared
+	MinCornerKmh float64       // heading changes below this speed are GPS noise
+	OverspeedGap time.Duration // longest gap within one overspeed episode
+}
+
+// DefaultHarshParams returns the thresholds used on ingest
+func DefaultHarshParams() HarshParams {
+	return HarshParams{
+		AccelMps2:    3.0,
+		BrakeMps2:    3.5,
+		CornerMps2:   4.0,
+		MaxGap:       5 * time.Second,
+		MinCornerKmh: 20,
+		OverspeedGap: 2 * time.Minute,
+	}
+}
+
+// DefaultScoringSettings returns the weights used until they are changed
+func DefaultScoringSettings() model.ScoringSettings {
+	return model.ScoringSettings{
+		Weights: map[string]float64{
+			model.HarshAcceleration: 3,
+			model.HarshBraking:      4,
+			model.HarshCornering:    3,
+			model.Overspeed:         5,
+		},
+		MinDistanceKm: 10,
+	}
+}
+
+// harshSample is a harsh event detected on one fix
+type harshSample struct {
+	kind   string
+	source string
+	value  float64
+}
+
+// deviceHarsh returns the events in the "harsh_events" list of a status
+// payload, and whether the payload had one. Entries are a kind or an object
+// with "type" and the peak "g". A device that reports the list has an
+// accelerometer, so nothing is derived from its fixes.
+func deviceHarsh(status map[string]interface{}) ([]harshSample, bool) {
+	list, ok := status["harsh_events"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	var res []harshSample
+	for _, v := range list {
+		var kind string
+		var g float64
+		switch e := v.(type) {
+		case string:
+			kind = e
+		case map[string]interface{}:
+			kind, _ = e["type"].(string)
+			g, _ = toFloat(e["g"])
+		}
+		switch kind {
+		case model.HarshAcceleration, model.HarshBraking, model.HarshCornering:
+			res = append(res, harshSample{kind: kind, source: model.HarshDevice, value: g * gravity})
+		}
+	}
+	return res, true
+}
+
+// deriveHarsh compares a fix with the one before it. Longitudinal
+// acceleration comes from the change in speed, lateral acceleration from
+// the speed times the rate of turn.
+func deriveHarsh(prev, cur model.Position, p HarshParams) []harshSample {
+	dt := cur.Timestamp.Sub(prev.Timestamp).Seconds()
+	if dt <= 0 || dt > p.MaxGap.Seconds() {
+		return nil
+	}
+	var res []harshSample
+	a := (cur.Speed - prev.Speed) / 3.6 / dt
+	switch {
+	case a >= p.AccelMps2:
+		res = append(res, harshSample{kind: model.HarshAcceleration, source: model.HarshDerived, value: a})
+	case -a >= p.BrakeMps2:
+		res = append(res, harshSample{kind: model.HarshBraking, source: model.HarshDerived, value: -a})
+	}
+
+	avg := (cur.Speed + prev.Speed) / 2
+	if prev.Heading != nil && cur.Heading != nil && avg >= p.MinCornerKmh {
+		turn := math.Abs(math.Mod(*cur.Heading-*prev.Heading+540, 360) - 180)
+		lateral := avg / 3.6 * (turn * math.Pi / 180 / dt)
+		if lateral >= p.CornerMps2 {
+			res = append(res, harshSample{kind: model.HarshCornering, source: model.HarshDerived, value: lateral})
+		}
+	}
+	return res
+}
+
+// recordHarshEvents stores the harsh driving a newly stored fix shows,
+// attached to the trip it belongs to and that trip's driver. Consecutive
+// fixes over their limit extend one overspeed episode. For a fix the noise
+// filter rejected, located is false and only events the device reported
+// are stored.
+func (s *Service) recordHarshEvents(ctx context.Context, tx *repository.Repo, pos model.Position, status map[string]interface{}, prog tripProgress, located bool) error {
+	p := DefaultHarshParams()
+	vid := pos.VehicleID.String()
+	prev, err := tx.LastPositionBefore(ctx, vid, pos.Timestamp)
+	if err != nil {
+		return err
+	}
+	samples, fromDevice := deviceHarsh(status)
+	if !fromDevice && prev != nil && located {
+		samples = deriveHarsh(*prev, pos, p)
+	}
+
+	var lim speedLimit
+	over := false
+	if located {
+		lim = s.speedLimit(pos)
+		over = s.speeding.over(pos.Speed, lim.kmh)
+	}
+	if len(samples) == 0 && !over {
+		return nil
+	}
+
+	base := model.HarshEvent{
+		VehicleID:  pos.VehicleID,
+		OccurredAt: pos.Timestamp,
+		EndedAt:    pos.Timestamp,
+		Location:   pos.Location,
+		Speed:      pos.Speed,
+	}
+	trip := prog.trip
+	if (trip == nil && prog.stale) || (trip != nil && !duringTrip(*trip, pos.Timestamp, prog.stale)) {
+		// A late fix belongs to whichever trip was under way at the time
+		if trip, err = tx.TripAt(ctx, vid, pos.Timestamp); err != nil {
+			return err
+		}
+	}
+	if trip != nil {
+		id := trip.ID
+		base.TripID, base.DriverID = &id, trip.DriverID
+	}
+	for _, hs := range samples {
+		h := base
+		h.ID, h.Kind, h.Source, h.Value = uuid.New(), hs.kind, hs.source, hs.value
+		if err := tx.InsertHarshEvent(ctx, h); err != nil {
+			return err
+		}
+	}
+
+	if !over {
+		return nil
+	}
+	excess := pos.Speed - lim.kmh
+	h := base
+	h.ID, h.Kind, h.Source, h.Value = uuid.New(), model.Overspeed, model.HarshDerived, pos.Speed
+	h.LimitKmh, h.ExcessKmh, h.LimitSource, h.Road = &lim.kmh, &excess, lim.source, lim.road
+	if prev != nil && pos.Timestamp.Sub(prev.Timestamp) <= p.OverspeedGap {
+		extended, err := tx.ExtendOverspeed(ctx, prev.Timestamp, h)
+		if err != nil || extended {
+			return err
+		}
+	}
+	return tx.InsertHarshEvent(ctx, h)
+}
+
+// duringTrip reports whether a fix at at lies within trip. The open trip
+// also takes the fixes after its last moving one, unless the fix is stale.
+func duringTrip(trip model.Trip, at time.Time, stale bool) bool {
+	if at.Before(trip.StartTime) {
+		return false
+	}
+	return !at.After(trip.EndTime) || (trip.InProgress && !stale)
+}
+
+// Score is a weighted safety score from 100 (no harsh events) down to 0:
+// 100 less the penalty, the sum of each event kind's weight times its
+// count, per 100 km driven.
+type Score struct {
+	DistanceKm float64        `json:"distance_km"`
+	Counts     map[string]int `json:"counts"`
+	Penalty    float64        `json:"penalty"`
+	Score      float64        `json:"score"`
+	scoredKm   float64        // distance with short trips raised to the minimum
+}
+
+func newScore() Score {
+	sc := Score{Counts: map[string]int{}, Score: 100}
+	for _, k := range model.HarshKinds {
+		sc.Counts[k] = 0
+	}
+	return sc
+}
+
+// add folds one trip into the score
+func (sc *Score) add(counts map[string]int, km float64, st model.ScoringSettings) {
+	sc.DistanceKm += km
+	sc.scoredKm += math.Max(km, st.MinDistanceKm)
+	for k, n := range counts {
+		sc.Counts[k] += n
+		sc.Penalty += st.Weights[k] * float64(n)
+	}
+	sc.Score = 100
+	if sc.scoredKm > 0 {
+		sc.Score = math.Max(0, 100-sc.Penalty*100/sc.scoredKm)
+	}
+}
+
+// TripScore is the safety score of one trip with its harsh events
+type TripScore struct {
+	TripID    uuid.UUID  `json:"trip_id"`
+	VehicleID uuid.UUID  `json:"vehicle_id"`
+	DriverID  *uuid.UUID `json:"driver_id,omitempty"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   time.Time  `json:"end_time"`
+	Score
+	Events []model.HarshEvent `json:"events"`
+}
+
+// WeekScore is a driver's score over one local week starting on Monday
+type WeekScore struct {
+	WeekStart time.Time `json:"week_start"`
+	Trips     int       `json:"trips"`
+	Score
+}
+
+// DriverScore is a driver's safety score over a time range and per week
+type DriverScore struct {
+	DriverID uuid.UUID `json:"driver_id"`
+	Name     string    `json:"name"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Trips    int       `json:"trips"`
+	Score
+	Weeks []WeekScore `json:"weeks"`
+}
+
+// DriverRank is a driver's place in the safety ranking
+type DriverRank struct {
+	Rank     int       `json:"rank"`
+	DriverID uuid.UUID `json:"driver_id"`
+	Name     string    `json:"name"`
+	Trips    int       `json:"trips"`
+	Score
+}
+
+// DriverRanking orders drivers from safest to least safe
+type DriverRanking struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Drivers []DriverRank `json:"drivers"`
+}
+
+// weekStart returns local midnight of the Monday starting t's week
+func weekStart(t time.Time, loc *time.Location) time.Time {
+	l := t.In(loc)
+	back := (int(l.Weekday()) + 6) % 7
+	return time.Date(l.Year(), l.Month(), l.Day()-back, 0, 0, 0, 0, loc)
+}
+
+// driverScores scores the trips of each driver overall and per week
+func driverScores(trips []repository.TripHarshCounts, st model.ScoringSettings, loc *time.Location) map[uuid.UUID]*DriverScore {
+	res := map[uuid.UUID]*DriverScore{}
+	weeks := map[uuid.UUID]map[time.Time]*WeekScore{}
+	for _, t := range trips {
+		ds := res[t.DriverID]
+		if ds == nil {
+			ds = &DriverScore{DriverID: t.DriverID, Score: newScore(), Weeks: []WeekScore{}}
+			res[t.DriverID] = ds
+			weeks[t.DriverID] = map[time.Time]*WeekScore{}
+		}
+		ds.Trips++
+		ds.add(t.Counts, t.DistanceKm, st)
+
+		ws := weekStart(t.StartTime, loc)
+		w := weeks[t.DriverID][ws]
+		if w == nil {
+			w = &WeekScore{WeekStart: ws, Score: newScore()}
+			weeks[t.DriverID][ws] = w
+		}
+		w.Trips++
+		w.add(t.Counts, t.DistanceKm, st)
+	}
+	for id, ds := range res {
+		for _, w := range weeks[id] {
+			ds.Weeks = append(ds.Weeks, *w)
+		}
+		sort.Slice(ds.Weeks, func(i, j int) bool { return ds.Weeks[i].WeekStart.Before(ds.Weeks[j].WeekStart) })
+	}
+	return res
+}
+
+// rankDrivers orders driver scores by score, then by distance driven
+func rankDrivers(scores map[uuid.UUID]*DriverScore, names map[uuid.UUID]string, minKm float64) []DriverRank {
+	res := []DriverRank{}
+	for id, ds := range scores {
+		if ds.DistanceKm < minKm {
+			continue
+		}
+		res = append(res, DriverRank{DriverID: id, Name: names[id], Trips: ds.Trips, Score: ds.Score})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Score.Score != b.Score.Score {
+			return a.Score.Score > b.Score.Score
+		}
+		if a.DistanceKm != b.DistanceKm {
+			return a.DistanceKm > b.DistanceKm
+		}
+		return a.DriverID.String() < b.DriverID.String()
+	})
+	for i := range res {
+		res[i].Rank = i + 1
+	}
+	return res
+}
+
+// GetHarshEvents returns the harsh driving events of a vehicle in a time
+// range, optionally of one kind
+func (s *Service) GetHarshEvents(ctx context.Context, vehicleID string, from, to time.Time, kind string) ([]model.HarshEvent, error) {
+	if err := ValidateRange(from, to, MaxRouteRange); err != nil {
+		return nil, err
+	}
+	if kind != "" && !validHarshKind(kind) {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidScoring, kind)
+	}
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return []model.HarshEvent{}, nil
+	}
+	return s.repo.GetHarshEvents(ctx, repository.HarshQuery{VehicleID: vehicleID, Kind: kind, From: from, To: to})
+}
+
+func validHarshKind(kind string) bool {
+	for _, k := range model.HarshKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTripScore returns the safety score and harsh events of a trip
+func (s *Service) GetTripScore(ctx context.Context, tripID string) (*TripScore, error) {
+	if _, err := uuid.Parse(tripID); err != nil {
+		return nil, repository.ErrTripNotFound
+	}
+	t, err := s.repo.GetTrip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.repo.GetScoringSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.repo.GetHarshEvents(ctx, repository.HarshQuery{TripID: tripID})
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, e := range events {
+		counts[e.Kind]++
+	}
+	ts := &TripScore{TripID: t.ID, VehicleID: t.VehicleID, DriverID: t.DriverID, StartTime: t.StartTime,
+		EndTime: t.EndTime, Score: newScore(), Events: events}
+	ts.add(counts, t.Mileage, st)
+	return ts, nil
+}
+
+// scoreTrips loads the scored trips in a range with the settings and the
+// organization's timezone
+func (s *Service) scoreTrips(ctx context.Context, from, to time.Time, driverID, groupID string) (map[uuid.UUID]*DriverScore, error) {
+	if err := ValidateRange(from, to, MaxScoreRange); err != nil {
+		return nil, err
+	}
+	st, err := s.repo.GetScoringSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.repo.GetOrgSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(org.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	trips, err := s.repo.DriverTripCounts(ctx, from, to, driverID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return driverScores(trips, st, loc), nil
+}
+
+// driverNames maps driver IDs to names
+func (s *Service) driverNames(ctx context.Context) (map[uuid.UUID]string, error) {
+	drivers, err := s.repo.ListDrivers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(drivers))
+	for _, d := range drivers {
+		names[d.ID] = d.Name
+	}
+	return names, nil
+}
+
+// GetDriverScore returns a driver's safety score over a time range, overall
+// and per week
+func (s *Service) GetDriverScore(ctx context.Context, driverID string, from, to time.Time) (*DriverScore, error) {
+	id, err := uuid.Parse(driverID)
+	if err != nil {
+		return nil, repository.ErrDriverNotFound
+	}
+	names, err := s.driverNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := names[id]
+	if !ok {
+		return nil, repository.ErrDriverNotFound
+	}
+	scores, err := s.scoreTrips(ctx, from, to, driverID, "")
+	if err != nil {
+		return nil, err
+	}
+	ds := scores[id]
+	if ds == nil {
+		ds = &DriverScore{DriverID: id, Score: newScore(), Weeks: []WeekScore{}}
+	}
+	ds.Name, ds.From, ds.To = name, from, to
+	return ds, nil
+}
+
+// GetDriverRanking ranks the drivers who drove at least minKm in a time
+// range, optionally only vehicles of one group, from safest down
+func (s *Service) GetDriverRanking(ctx context.Context, from, to time.Time, groupID string, minKm float64) (*DriverRanking, error) {
+	if groupID != "" {
+		if _, err := uuid.Parse(groupID); err != nil {
+			return nil, fmt.Errorf("%w: invalid group_id", ErrInvalidScoring)
+		}
+	}
+	scores, err := s.scoreTrips(ctx, from, to, "", groupID)
+	if err != nil {
+		return nil, err
+	}
+	names, err := s.driverNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DriverRanking{From: from, To: to, Drivers: rankDrivers(scores, names, minKm)}, nil
+}
+
+func (s *Service) GetScoringSettings(ctx context.Context) (model.ScoringSettings, error) {
+	return s.repo.GetScoringSettings(ctx)
+}
+
+// ScoringUpdate changes scoring settings; weights and fields left out keep
+// their current value
+type ScoringUpdate struct {
+	Weights       map[string]float64 `json:"weights"`
+	MinDistanceKm *float64           `json:"min_distance_km"`
+}
+
+// UpdateScoringSettings changes the score weights. Scores are computed on
+// read, so new weights apply to past trips as well.
+func (s *Service) UpdateScoringSettings(ctx context.Context, in ScoringUpdate) (model.ScoringSettings, error) {
+	var out model.ScoringSettings
+	for k, w := range in.Weights {
+		if !validHarshKind(k) {
+			return out, fmt.Errorf("%w: unknown weight %q", ErrInvalidScoring, k)
+		}
+		if w < 0 {
+			return out, fmt.Errorf("%w: weights cannot be negative", ErrInvalidScoring)
+		}
+	}
+	if in.MinDistanceKm != nil && *in.MinDistanceKm < 0 {
+		return out, fmt.Errorf("%w: min_distance_km cannot be negative", ErrInvalidScoring)
+	}
+	err := s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		var err error
+		if out, err = tx.GetScoringSettings(ctx); err != nil {
+			return err
+		}
+		if out.Weights == nil {
+			out.Weights = DefaultScoringSettings().Weights
+		}
+		for k, w := range in.Weights {
+			out.Weights[k] = w
+		}
+		if in.MinDistanceKm != nil {
+			out.MinDistanceKm = *in.MinDistanceKm
+		}
+		out.UpdatedAt = time.Now().UTC()
+		return tx.SaveScoringSettings(ctx, out)
+	})
+	return out, err
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveHarsh(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	p := DefaultHarshParams()
+	fix := func(sec int, speed, heading float64) model.Position {
+		return model.Position{Speed: speed, Heading: &heading, Timestamp: t0.Add(time.Duration(sec) * time.Second)}
+	}
+
+	h := deriveHarsh(fix(0, 20, 90), fix(1, 35, 90), p)
+	require.Len(t, h, 1)
+	assert.Equal(t, model.HarshAcceleration, h[0].kind)
+	assert.InDelta(t, 15/3.6, h[0].value, 1e-9)
+
+	h = deriveHarsh(fix(0, 80, 90), fix(2, 50, 90), p)
+	require.Len(t, h, 1)
+	assert.Equal(t, model.HarshBraking, h[0].kind)
+
+	// 50 km/h turning 30° in one second pulls about 7 m/s² sideways
+	h = deriveHarsh(fix(0, 50, 350), fix(1, 50, 20), p)
+	require.Len(t, h, 1)
+	assert.Equal(t, model.HarshCornering, h[0].kind)
+	assert.InDelta(t, 50/3.6*30*3.14159265/180, h[0].value, 1e-6)
+
+	assert.Empty(t, deriveHarsh(fix(0, 5, 0), fix(1, 8, 90), p), "heading swings while crawling")
+	assert.Empty(t, deriveHarsh(fix(0, 0, 90), fix(10, 60, 90), p), "too far apart to judge")
+	assert.Empty(t, deriveHarsh(fix(0, 60, 90), fix(1, 62, 95), p))
+}
+
+func TestDeviceHarsh(t *testing.T) {
+	h, ok := deviceHarsh(map[string]interface{}{"harsh_events": []interface{}{
+		"harsh_braking", map[string]interface{}{"type": "harsh_cornering", "g": 0.5}, "overspeed", "bogus",
+	}})
+	assert.True(t, ok)
+	require.Len(t, h, 2, "overspeed is always derived from speed")
+	assert.Equal(t, model.HarshBraking, h[0].kind)
+	assert.InDelta(t, 0.5*gravity, h[1].value, 1e-9)
+
+	_, ok = deviceHarsh(map[string]interface{}{"speed": 40})
+	assert.False(t, ok)
+}
+
+func TestDriverScores(t *testing.T) {
+	st := DefaultScoringSettings()
+	dubai, _ := time.LoadLocation("Asia/Dubai")
+	alice, bob := uuid.New(), uuid.New()
+	trip := func(driver uuid.UUID, start string, km float64, counts map[string]int) repository.TripHarshCounts {
+		ts, _ := time.Parse(time.RFC3339, start)
+		return repository.TripHarshCounts{DriverID: driver, StartTime: ts, DistanceKm: km, Counts: counts}
+	}
+	scores := driverScores([]repository.TripHarshCounts{
+		trip(alice, "2025-06-15T21:00:00Z", 100, map[string]int{model.HarshBraking: 2}), // Monday 01:00 local
+		trip(alice, "2025-06-22T19:00:00Z", 2, map[string]int{model.HarshCornering: 1}), // Sunday 23:00 local
+		trip(bob, "2025-06-17T08:00:00Z", 50, map[string]int{}),
+	}, st, dubai)
+
+	a := scores[alice]
+	require.NotNil(t, a)
+	assert.Equal(t, 2, a.Trips)
+	assert.Equal(t, 2, a.Counts[model.HarshBraking])
+	assert.Equal(t, 0, a.Counts[model.Overspeed])
+	assert.InDelta(t, 11, a.Penalty, 1e-9)
+	// the 2 km trip is scored as 10 km
+	assert.InDelta(t, 100-11.0*100/110, a.Score.Score, 1e-9)
+	require.Len(t, a.Weeks, 1, "both trips fall in the same local week")
+	assert.Equal(t, time.Date(2025, 6, 16, 0, 0, 0, 0, dubai), a.Weeks[0].WeekStart)
+
+	ranking := rankDrivers(scores, map[uuid.UUID]string{alice: "Alice", bob: "Bob"}, 0)
+	require.Len(t, ranking, 2)
+	assert.Equal(t, "Bob", ranking[0].Name)
+	assert.Equal(t, 100.0, ranking[0].Score.Score)
+	assert.Equal(t, 2, ranking[1].Rank)
+	assert.Len(t, rankDrivers(scores, nil, 60), 1)
+}
+
+func TestDuringTrip(t *testing.T) {
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	trip := model.Trip{StartTime: start, EndTime: start.Add(10 * time.Minute)}
+
+	assert.True(t, duringTrip(trip, start, false))
+	assert.True(t, duringTrip(trip, start.Add(10*time.Minute), true))
+	assert.False(t, duringTrip(trip, start.Add(-time.Second), false), "a late fix from before the trip")
+	assert.False(t, duringTrip(trip, start.Add(11*time.Minute), false), "the fix after a completed trip")
+
+	// The open trip takes new fixes after its last moving one, such as
+	// braking to a halt, but not late ones
+	trip.InProgress = true
+	assert.True(t, duringTrip(trip, start.Add(11*time.Minute), false))
+	assert.False(t, duringTrip(trip, start.Add(11*time.Minute), true))
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"fleet-tracker-service/internal/export"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// MaxExportRange limits a single range export; output is streamed so the
+// limit only bounds how long one request may hold a database snapshot
+const MaxExportRange = 366 * 24 * time.Hour
+
+// ErrUnsupportedFormat is returned for unknown export formats
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// ExportTrip streams the positions of a trip with its metadata. open is called
+// once the trip is found, with a file name without extension, and must return
+// the writer to stream to; errors before open can still be reported normally.
+func (s *Service) ExportTrip(ctx context.Context, tripID, format string, open func(name string) io.Writer) error {
+	if _, _, err := export.ContentType(format); err != nil {
+		return ErrUnsupportedFormat
+	}
+	if _, err := uuid.Parse(tripID); err != nil {
+		return repository.ErrTripNotFound
+	}
+	return s.repo.WithSnapshot(ctx, func(tx *repository.Repo) error {
+		trip, err := tx.GetTrip(ctx, tripID)
+		if err != nil {
+			return err
+		}
+		track := export.Track{
+			Name:       fmt.Sprintf("Trip %s", trip.ID),
+			Properties: export.TripProperties(trip),
+			Each: func(fn func(model.Position) error) error {
+				// end_time is inclusive
+				return tx.EachPosition(ctx, trip.VehicleID.String(), trip.StartTime, trip.EndTime.Add(time.Microsecond), fn)
+			},
+		}
+		return export.Write(open("trip-"+trip.ID.String()), format, track)
+	})
+}
+
+// ExportRange streams a vehicle's positions in [from, to) together with the
+// trips that started in the range
+func (s *Service) ExportRange(ctx context.Context, vehicleID string, from, to time.Time, format string, open func(name string) io.Writer) error {
+	if _, _, err := export.ContentType(format); err != nil {
+		return ErrUnsupportedFormat
+	}
+	if err := ValidateRange(from, to, MaxExportRange); err != nil {
+		return err
+	}
+	return s.repo.WithSnapshot(ctx, func(tx *repository.Repo) error {
+		trips, err := tx.GetTripsBetween(ctx, vehicleID, from, to)
+		if err != nil {
+			return err
+		}
+		mileage := 0.0
+		for _, t := range trips {
+			mileage += t.Mileage
+		}
+		track := export.Track{
+			Name: fmt.Sprintf("Vehicle %s %s to %s", vehicleID, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)),
+			Properties: []export.Property{
+				{Key: "vehicle_id", Value: vehicleID},
+				{Key: "from", Value: from},
+				{Key: "to", Value: to},
+				{Key: "trip_count", Value: len(trips)},
+				{Key: "mileage", Value: mileage},
+			},
+			Trips: trips,
+			Each: func(fn func(model.Position) error) error {
+				return tx.EachPosition(ctx, vehicleID, from, to, fn)
+			},
+		}
+		name := fmt.Sprintf("vehicle-%s-%s", vehicleID, from.UTC().Format("20060102T150405Z"))
+		return export.Write(open(name), format, track)
+	})
+}
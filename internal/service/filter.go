@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+)
+
+// FilterConfig controls the noise filter fixes pass before they are stored
+type FilterConfig struct {
+	Enabled       bool
+	MaxSpeedKmh   float64 // reported or implied speeds above this are rejected, 0 disables
+	MaxAccuracyM  float64 // fixes reporting a worse accuracy are rejected, 0 disables
+	MinSatellites int     // fixes reporting fewer satellites are rejected, 0 disables
+	Smoothing     bool    // Kalman-smooth stored positions
+	ProcessNoise  float64 // m/s a parked vehicle's position may drift, used by smoothing
+}
+
+// DefaultFilterConfig returns the filter used when none is configured
+func DefaultFilterConfig() FilterConfig {
+	return FilterConfig{Enabled: true, MaxSpeedKmh: 250, MaxAccuracyM: 100, MinSatellites: 4, ProcessNoise: 3}
+}
+
+// SetFilter replaces the ingest noise filter configuration
+func (s *Service) SetFilter(cfg FilterConfig) {
+	s.filter = cfg
+}
+
+const (
+	// nullIslandDeg is how close to 0,0 a fix must be to count as a tracker
+	// without a fix reporting zeros
+	nullIslandDeg = 0.001
+	// jumpSlackM is the jitter allowed between consecutive fixes on top of
+	// the maximum speed, so fixes a second apart are not rejected
+	jumpSlackM = 100
+	// defaultAccuracyM is assumed for smoothing when a fix reports none
+	defaultAccuracyM = 10.0
+)
+
+// fixQuality is what a device reports about the precision of a fix
+type fixQuality struct {
+	Accuracy   *float64 // horizontal, metres
+	Satellites *int
+}
+
+func parseFixQuality(status map[string]interface{}) fixQuality {
+	var q fixQuality
+	if v, ok := toFloat(status["accuracy"]); ok {
+		q.Accuracy = &v
+	}
+	if v, ok := toFloat(status["satellites"]); ok {
+		n := int(v)
+		q.Satellites = &n
+	}
+	return q
+}
+
+// checkFix returns why a fix is implausible on its own or after prev, the
+// previous stored fix, or an empty reason when it passes
+func checkFix(cfg FilterConfig, fix model.Position, q fixQuality, prev *model.Position) (reason, detail string) {
+	switch {
+	case math.Abs(fix.Location[0]) < nullIslandDeg && math.Abs(fix.Location[1]) < nullIslandDeg:
+		return model.RejectNullIsland, ""
+	case cfg.MinSatellites > 0 && q.Satellites != nil && *q.Satellites < cfg.MinSatellites:
+		return model.RejectLowSatellites, fmt.Sprintf("%d satellites", *q.Satellites)
+	case cfg.MaxAccuracyM > 0 && q.Accuracy != nil && *q.Accuracy > cfg.MaxAccuracyM:
+		return model.RejectLowAccuracy, fmt.Sprintf("accuracy %.0f m", *q.Accuracy)
+	case cfg.MaxSpeedKmh > 0 && fix.Speed > cfg.MaxSpeedKmh:
+		return model.RejectReportedSpeed, fmt.Sprintf("%.0f km/h", fix.Speed)
+	}
+	if prev != nil && cfg.MaxSpeedKmh > 0 && !jumpPlausible(cfg, prev.Location, prev.Timestamp, fix) {
+		d := geo.Distance(geo.FromLonLat(prev.Location), geo.FromLonLat(fix.Location))
+		return model.RejectImpliedSpeed, fmt.Sprintf("%.0f m in %s since %s", d, fix.Timestamp.Sub(prev.Timestamp), prev.Timestamp.Format(time.RFC3339))
+	}
+	return "", ""
+}
+
+// jumpPlausible reports whether a vehicle could have travelled from loc at
+// time at to fix without exceeding the maximum speed
+func jumpPlausible(cfg FilterConfig, loc [2]float64, at time.Time, fix model.Position) bool {
+	excess := geo.Distance(geo.FromLonLat(loc), geo.FromLonLat(fix.Location)) - jumpSlackM
+	if excess <= 0 {
+		return true
+	}
+	dt := fix.Timestamp.Sub(at).Seconds()
+	return dt > 0 && excess/dt*3.6 <= cfg.MaxSpeedKmh
+}
+
+// rejectFix runs the noise filter for a fix about to be stored and returns
+// the rejection to record, or nil when the fix passes. A fix that jumped
+// away from the previous one is accepted after all when it agrees with an
+// earlier rejected jump, as the vehicle then really is somewhere else.
+func (s *Service) rejectFix(ctx context.Context, tx *repository.Repo, fix model.Position, q fixQuality) (*model.RejectedPosition, error) {
+	if !s.filter.Enabled {
+		return nil, nil
+	}
+	var prev *model.Position
+	if s.filter.MaxSpeedKmh > 0 {
+		var err error
+		if prev, err = tx.LastPositionBefore(ctx, fix.VehicleID.String(), fix.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	reason, detail := checkFix(s.filter, fix, q, prev)
+	if reason == "" {
+		return nil, nil
+	}
+	if reason == model.RejectImpliedSpeed {
+		jump, err := tx.LastRejected(ctx, fix.VehicleID.String(), model.RejectImpliedSpeed, prev.Timestamp, fix.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if jump != nil && jumpPlausible(s.filter, jump.Location, jump.Timestamp, fix) {
+			return nil, nil
+		}
+	}
+	return &model.RejectedPosition{
+		VehicleID:  fix.VehicleID,
+		Location:   fix.Location,
+		Speed:      fix.Speed,
+		Accuracy:   q.Accuracy,
+		Satellites: q.Satellites,
+		Timestamp:  fix.Timestamp,
+		Reason:     reason,
+		Detail:     detail,
+	}, nil
+}
+
+// rejectedStatus is the live status of a payload whose fix was rejected: the
+// rest of the payload is kept, but the location is the last stored one, or
+// left out when there is none, so the vehicle does not jump on the map
+func rejectedStatus(status map[string]interface{}, last *model.Position) map[string]interface{} {
+	out := make(map[string]interface{}, len(status))
+	for k, v := range status {
+		out[k] = v
+	}
+	delete(out, "location")
+	if last != nil {
+		out["location"] = []interface{}{last.Location[0], last.Location[1]}
+	}
+	return out
+}
+
+// smoothFix returns fix with its location Kalman-smoothed when smoothing is
+// enabled. Fixes older than the smoothing state are stored as reported.
+func (s *Service) smoothFix(ctx context.Context, tx *repository.Repo, fix model.Position, q fixQuality) (model.Position, error) {
+	if !s.filter.Enabled || !s.filter.Smoothing {
+		return fix, nil
+	}
+	st, err := tx.GetFilterState(ctx, fix.VehicleID.String())
+	if err != nil {
+		return fix, err
+	}
+	if st != nil && !fix.Timestamp.After(st.FixAt) {
+		return fix, nil
+	}
+	next := kalmanStep(st, fix, q.Accuracy, s.filter.ProcessNoise)
+	if err := tx.SaveFilterState(ctx, fix.VehicleID.String(), next); err != nil {
+		return fix, err
+	}
+	fix.Location = next.Location
+	return fix, nil
+}
+
+// kalmanStep folds fix into the smoothing state. The position may drift by
+// noise m/s, or by the reported speed when faster, so a parked vehicle's
+// jitter is averaged out while a moving one follows its fixes closely.
+func kalmanStep(st *model.FilterState, fix model.Position, accuracy *float64, noise float64) model.FilterState {
+	acc := defaultAccuracyM
+	if accuracy != nil && *accuracy > 0 {
+		acc = *accuracy
+	}
+	if st == nil {
+		return model.FilterState{Location: fix.Location, Variance: acc * acc, FixAt: fix.Timestamp}
+	}
+	q := math.Max(noise, fix.Speed/3.6)
+	variance := st.Variance + fix.Timestamp.Sub(st.FixAt).Seconds()*q*q
+	k := variance / (variance + acc*acc)
+	return model.FilterState{
+		Location: [2]float64{
+			st.Location[0] + k*(fix.Location[0]-st.Location[0]),
+			st.Location[1] + k*(fix.Location[1]-st.Location[1]),
+		},
+		Variance: (1 - k) * variance,
+		FixAt:    fix.Timestamp,
+	}
+}
+
+// GetRejectedPositions returns the fixes of a vehicle the filter rejected in
+// [from, to), optionally only those rejected for reason
+func (s *Service) GetRejectedPositions(ctx context.Context, vehicleID string, from, to time.Time, reason string) ([]model.RejectedPosition, error) {
+	if err := ValidateRange(from, to, MaxRouteRange); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRejectedPositions(ctx, vehicleID, from, to, reason)
+}
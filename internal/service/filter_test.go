@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFix(t *testing.T) {
+	cfg := DefaultFilterConfig()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	base := geo.Point{Lat: 25.2, Lon: 55.27}
+	fix := func(p geo.Point, after time.Duration, speed float64) model.Position {
+		return model.Position{VehicleID: uuid.New(), Location: p.LonLat(), Speed: speed, Timestamp: start.Add(after)}
+	}
+	prev := fix(base, 0, 60)
+	sats, acc := 3, 250.0
+
+	cases := []struct {
+		name string
+		fix  model.Position
+		q    fixQuality
+		want string
+	}{
+		{"plausible", fix(geo.Destination(base, 90, 500), 30*time.Second, 60), fixQuality{}, ""},
+		{"jitter", fix(geo.Destination(base, 90, 80), time.Second, 0), fixQuality{}, ""},
+		{"null island", model.Position{Timestamp: start.Add(time.Minute)}, fixQuality{}, model.RejectNullIsland},
+		{"satellites", fix(base, time.Minute, 0), fixQuality{Satellites: &sats}, model.RejectLowSatellites},
+		{"accuracy", fix(base, time.Minute, 0), fixQuality{Accuracy: &acc}, model.RejectLowAccuracy},
+		{"speed spike", fix(base, time.Minute, 900), fixQuality{}, model.RejectReportedSpeed},
+		{"teleport", fix(geo.Destination(base, 0, 300000), 30*time.Second, 60), fixQuality{}, model.RejectImpliedSpeed},
+	}
+	for _, c := range cases {
+		reason, _ := checkFix(cfg, c.fix, c.q, &prev)
+		assert.Equal(t, c.want, reason, c.name)
+	}
+
+	far := fix(geo.Destination(base, 0, 300000), 30*time.Second, 60)
+	reason, _ := checkFix(cfg, far, fixQuality{}, nil)
+	assert.Empty(t, reason, "the first fix of a vehicle has nothing to jump from")
+}
+
+func TestKalmanStep(t *testing.T) {
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	parked := geo.Point{Lat: 25.2, Lon: 55.27}
+	fix := func(p geo.Point, after time.Duration, speed float64) model.Position {
+		return model.Position{Location: p.LonLat(), Speed: speed, Timestamp: start.Add(after)}
+	}
+
+	st := kalmanStep(nil, fix(parked, 0, 0), nil, 3)
+	assert.Equal(t, parked.LonLat(), st.Location)
+
+	// A parked vehicle's 40 m jitter is mostly averaged out
+	for i := 1; i <= 10; i++ {
+		p := geo.Destination(parked, float64(i%2)*180, 40)
+		next := kalmanStep(&st, fix(p, time.Duration(i)*time.Second, 0), nil, 3)
+		st = next
+	}
+	assert.Less(t, geo.Distance(parked, geo.FromLonLat(st.Location)), 25.0)
+
+	// A moving vehicle follows its fixes closely
+	moved := geo.Destination(parked, 90, 900)
+	st = kalmanStep(&st, fix(moved, 40*time.Second, 108), nil, 3)
+	assert.Less(t, geo.Distance(moved, geo.FromLonLat(st.Location)), 10.0)
+}
+
+func TestRejectedStatus(t *testing.T) {
+	status := map[string]interface{}{"location": []interface{}{0.0, 0.0}, "fuel_level": 42.0, "ignition": true}
+	last := &model.Position{Location: [2]float64{55.27, 25.2}}
+
+	got := rejectedStatus(status, last)
+	assert.Equal(t, []interface{}{55.27, 25.2}, got["location"])
+	assert.Equal(t, 42.0, got["fuel_level"])
+	assert.Equal(t, true, got["ignition"])
+	assert.Equal(t, []interface{}{0.0, 0.0}, status["location"], "the payload is left alone")
+
+	got = rejectedStatus(status, nil)
+	assert.NotContains(t, got, "location")
+	assert.Equal(t, 42.0, got["fuel_level"])
+}
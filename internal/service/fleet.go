@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidFleetInput is returned for malformed group, driver or assignment input
+var ErrInvalidFleetInput = errors.New("invalid input")
+
+func (s *Service) CreateGroup(ctx context.Context, name string) (model.Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return model.Group{}, fmt.Errorf("%w: name required", ErrInvalidFleetInput)
+	}
+	g := model.Group{ID: uuid.New(), Name: name, CreatedAt: time.Now().UTC()}
+	return g, s.repo.CreateGroup(ctx, g)
+}
+
+func (s *Service) ListGroups(ctx context.Context) ([]model.Group, error) {
+	return s.repo.ListGroups(ctx)
+}
+
+func (s *Service) CreateDriver(ctx context.Context, name, license string) (model.Driver, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return model.Driver{}, fmt.Errorf("%w: name required", ErrInvalidFleetInput)
+	}
+	d := model.Driver{ID: uuid.New(), Name: name, LicenseNumber: strings.TrimSpace(license), CreatedAt: time.Now().UTC()}
+	return d, s.repo.CreateDriver(ctx, d)
+}
+
+func (s *Service) ListDrivers(ctx context.Context) ([]model.Driver, error) {
+	return s.repo.ListDrivers(ctx)
+}
+
+// AssignVehicle sets the group and current driver of a vehicle. Empty IDs
+// clear the assignment. Trips started afterwards are attributed to the driver.
+func (s *Service) AssignVehicle(ctx context.Context, vehicleID, groupID, driverID string) error {
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return fmt.Errorf("%w: invalid vehicle id", ErrInvalidFleetInput)
+	}
+	parse := func(v string) (*uuid.UUID, error) {
+		if v == "" {
+			return nil, nil
+		}
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid id %q", ErrInvalidFleetInput, v)
+		}
+		return &id, nil
+	}
+	g, err := parse(groupID)
+	if err != nil {
+		return err
+	}
+	d, err := parse(driverID)
+	if err != nil {
+		return err
+	}
+	return s.repo.AssignVehicle(ctx, vehicleID, g, d)
+}
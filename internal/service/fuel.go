@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// FuelParams controls fuel level smoothing and refuel/drop detection
+type FuelParams struct {
+	Window         int     // raw readings in the median smoothing window
+	NoiseL         float64 // level changes up to this are treated as noise
+	RefuelMinL     float64 // smallest rise reported as a refuel
+	DropMinL       float64 // smallest stationary loss reported as a drop
+	MinDropRateLph float64 // slower losses are idling consumption, not a drop
+	MovingSpeedKmh float64 // drops are only looked for below this speed
+}
+
+// DefaultFuelParams returns the detection thresholds used on ingest
+func DefaultFuelParams() FuelParams {
+	return FuelParams{
+		Window:         5,
+		NoiseL:         0.5,
+		RefuelMinL:     10,
+		DropMinL:       8,
+		MinDropRateLph: 20,
+		MovingSpeedKmh: 5,
+	}
+}
+
+// fuelReadingSlack is how far after a trip boundary a reading may be to
+// stand in for the level at it
+const fuelReadingSlack = 5 * time.Minute
+
+// FuelReport is the fuel use of a vehicle over a time range. Consumption is
+// the level lost between the first and last reading plus what was added by
+// refuels, less the drops, which are not burnt by the engine.
+type FuelReport struct {
+	VehicleID  string            `json:"vehicle_id"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Readings   int               `json:"readings"`
+	StartLevel *float64          `json:"start_level_l,omitempty"`
+	EndLevel   *float64          `json:"end_level_l,omitempty"`
+	Refuels    int               `json:"refuels"`
+	Refuelled  float64           `json:"refuelled_l"`
+	Drops      int               `json:"drops"`
+	Dropped    float64           `json:"dropped_l"`
+	Consumed   float64           `json:"consumed_l"`
+	DistanceKm float64           `json:"distance_km"`
+	LPer100Km  *float64          `json:"l_per_100km,omitempty"`
+	Events     []model.FuelEvent `json:"events"`
+	Trips      []TripFuel        `json:"trips"`
+}
+
+// TripFuel is the fuel used on one trip; consumption is unknown when there
+// are no readings around the trip's start or end
+type TripFuel struct {
+	TripID     uuid.UUID `json:"trip_id"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	DistanceKm float64   `json:"distance_km"`
+	Consumed   *float64  `json:"consumed_l,omitempty"`
+	LPer100Km  *float64  `json:"l_per_100km,omitempty"`
+}
+
+// fuelSample is a smoothed fuel reading fed to detection
+type fuelSample struct {
+	At       time.Time
+	Level    float64
+	Speed    float64
+	Location [2]float64
+}
+
+// fuelLevel returns the fuel level reported in a status payload in litres
+func fuelLevel(status map[string]interface{}) (float64, bool) {
+	v, ok := toFloat(status["fuel_level"])
+	if !ok || v < 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// median returns the middle value of vs, the mean of the two middle ones
+// for an even count
+func median(vs []float64) float64 {
+	s := append([]float64(nil), vs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// fuelStep applies a smoothed reading to a vehicle's fuel state and returns
+// the refuel or drop it completed, if any. A rise is followed until the
+// level stops climbing; a loss only while the vehicle stays stationary.
+// Either is reported once it ends and exceeds its threshold, and a drop
+// only when it was faster than idling could burn.
+func fuelStep(st *model.FuelState, s fuelSample, p FuelParams) (model.FuelState, *model.FuelEvent) {
+	next := model.FuelState{Level: s.Level, At: s.At}
+	if st == nil {
+		return next, nil
+	}
+	delta := s.Level - st.Level
+	stationary := s.Speed < p.MovingSpeedKmh
+	rising, falling := delta > p.NoiseL, delta < -p.NoiseL
+
+	var done *model.FuelEvent
+	if pe := st.Pending; pe != nil {
+		switch {
+		case pe.Kind == model.FuelRefuel && !falling:
+			if rising {
+				next.Pending = extendFuelEvent(pe, s)
+				return next, nil
+			}
+			// the level has settled; this reading may still be a little higher
+			if s.Level > pe.EndLevel {
+				pe = extendFuelEvent(pe, s)
+			}
+			if pe.Amount >= p.RefuelMinL {
+				done = pe
+			}
+			return next, done
+		case pe.Kind == model.FuelDrop && falling && stationary:
+			next.Pending = extendFuelEvent(pe, s)
+			return next, nil
+		}
+		if closed := closeFuelEvent(pe, p); closed != nil {
+			done = closed
+		}
+	}
+
+	switch {
+	case rising:
+		next.Pending = &model.FuelEvent{Kind: model.FuelRefuel, StartAt: st.At, StartLevel: st.Level, Location: s.Location}
+	case falling && stationary:
+		next.Pending = &model.FuelEvent{Kind: model.FuelDrop, StartAt: st.At, StartLevel: st.Level, Location: s.Location}
+	}
+	if next.Pending != nil {
+		next.Pending = extendFuelEvent(next.Pending, s)
+	}
+	return next, done
+}
+
+// extendFuelEvent moves the end of a pending event to a reading
+func extendFuelEvent(pe *model.FuelEvent, s fuelSample) *model.FuelEvent {
+	e := *pe
+	e.EndAt, e.EndLevel = s.At, s.Level
+	e.Amount = math.Abs(e.EndLevel - e.StartLevel)
+	return &e
+}
+
+// closeFuelEvent returns a pending event that ended if it is worth reporting
+func closeFuelEvent(pe *model.FuelEvent, p FuelParams) *model.FuelEvent {
+	if pe.Kind == model.FuelRefuel {
+		if pe.Amount >= p.RefuelMinL {
+			return pe
+		}
+		return nil
+	}
+	hours := pe.EndAt.Sub(pe.StartAt).Hours()
+	if pe.Amount >= p.DropMinL && (hours <= 0 || pe.Amount/hours >= p.MinDropRateLph) {
+		return pe
+	}
+	return nil
+}
+
+// recordFuel stores the fuel level of a newly stored fix, if it reported
+// one, and returns the event for a refuel or drop it completed. Readings
+// older than the last one are kept for reports but skip detection.
+func recordFuel(ctx context.Context, tx *repository.Repo, pos model.Position, status map[string]interface{}) ([]model.Event, error) {
+	raw, ok := fuelLevel(status)
+	if !ok {
+		return nil, nil
+	}
+	p := DefaultFuelParams()
+	vid := pos.VehicleID.String()
+	window, err := tx.RecentRawFuel(ctx, vid, pos.Timestamp, p.Window-1)
+	if err != nil {
+		return nil, err
+	}
+	r := model.FuelReading{
+		VehicleID: pos.VehicleID,
+		Timestamp: pos.Timestamp,
+		RawLevel:  raw,
+		Level:     median(append(window, raw)),
+		Speed:     pos.Speed,
+	}
+	stored, err := tx.InsertFuelReading(ctx, r)
+	if err != nil || !stored {
+		return nil, err
+	}
+
+	st, err := tx.GetFuelState(ctx, vid)
+	if err != nil {
+		return nil, err
+	}
+	if st != nil && !r.Timestamp.After(st.At) {
+		return nil, nil
+	}
+	next, done := fuelStep(st, fuelSample{At: r.Timestamp, Level: r.Level, Speed: r.Speed, Location: pos.Location}, p)
+	if err := tx.SaveFuelState(ctx, vid, next); err != nil {
+		return nil, err
+	}
+	if done == nil {
+		return nil, nil
+	}
+	done.ID, done.VehicleID = uuid.New(), pos.VehicleID
+	if err := tx.InsertFuelEvent(ctx, *done); err != nil {
+		return nil, err
+	}
+	typ := model.EventFuelRefuelled
+	if done.Kind == model.FuelDrop {
+		typ = model.EventFuelDropDetected
+	}
+	e, err := model.NewEvent(typ, pos.VehicleID, done)
+	if err != nil {
+		return nil, err
+	}
+	return []model.Event{e}, nil
+}
+
+// GetFuelReadings returns the raw and smoothed fuel levels of a vehicle in a time range
+func (s *Service) GetFuelReadings(ctx context.Context, vehicleID string, from, to time.Time) ([]model.FuelReading, error) {
+	if err := ValidateRange(from, to, MaxRouteRange); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return []model.FuelReading{}, nil
+	}
+	return s.repo.GetFuelReadings(ctx, vehicleID, from, to)
+}
+
+// GetFuelReport returns the refuels, drops and consumption of a vehicle in
+// a time range, overall and per trip
+func (s *Service) GetFuelReport(ctx context.Context, vehicleID string, from, to time.Time) (*FuelReport, error) {
+	if err := ValidateRange(from, to, MaxRouteRange); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return fuelReport(vehicleID, from, to, nil, nil, nil), nil
+	}
+	readings, err := s.repo.GetFuelReadings(ctx, vehicleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.repo.GetFuelEvents(ctx, vehicleID, from, to, "")
+	if err != nil {
+		return nil, err
+	}
+	trips, err := s.repo.GetTripsBetween(ctx, vehicleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return fuelReport(vehicleID, from, to, readings, events, trips), nil
+}
+
+// fuelReport builds a report from readings, events and trips sorted by time
+func fuelReport(vehicleID string, from, to time.Time, readings []model.FuelReading, events []model.FuelEvent, trips []model.Trip) *FuelReport {
+	rep := &FuelReport{VehicleID: vehicleID, From: from, To: to, Readings: len(readings),
+		Events: []model.FuelEvent{}, Trips: []TripFuel{}}
+	if events != nil {
+		rep.Events = events
+	}
+	for _, t := range trips {
+		rep.DistanceKm += t.Mileage
+	}
+	for _, e := range events {
+		if e.Kind == model.FuelRefuel {
+			rep.Refuels++
+		} else {
+			rep.Drops++
+		}
+	}
+	if len(readings) > 0 {
+		first, last := readings[0], readings[len(readings)-1]
+		rep.StartLevel, rep.EndLevel = &first.Level, &last.Level
+		refuelled, dropped := fuelEventTotals(events, first.Timestamp, last.Timestamp)
+		rep.Refuelled, rep.Dropped = refuelled, dropped
+		rep.Consumed = math.Max(0, first.Level-last.Level+refuelled-dropped)
+		rep.LPer100Km = per100Km(rep.Consumed, rep.DistanceKm)
+	}
+
+	for _, t := range trips {
+		tf := TripFuel{TripID: t.ID, StartTime: t.StartTime, EndTime: t.EndTime, DistanceKm: t.Mileage}
+		start, okStart := levelAt(readings, t.StartTime)
+		end, okEnd := levelAt(readings, t.EndTime)
+		if okStart && okEnd {
+			refuelled, dropped := fuelEventTotals(events, t.StartTime, t.EndTime)
+			c := math.Max(0, start-end+refuelled-dropped)
+			tf.Consumed = &c
+			tf.LPer100Km = per100Km(c, t.Mileage)
+		}
+		rep.Trips = append(rep.Trips, tf)
+	}
+	return rep
+}
+
+// fuelEventTotals sums the refuels and drops that happened within [from, to]
+func fuelEventTotals(events []model.FuelEvent, from, to time.Time) (refuelled, dropped float64) {
+	for _, e := range events {
+		if e.StartAt.Before(from) || e.EndAt.After(to) {
+			continue
+		}
+		if e.Kind == model.FuelRefuel {
+			refuelled += e.Amount
+		} else {
+			dropped += e.Amount
+		}
+	}
+	return refuelled, dropped
+}
+
+// levelAt returns the smoothed level at t from the last reading at or
+// before it, or from a reading shortly after when there is none
+func levelAt(readings []model.FuelReading, t time.Time) (float64, bool) {
+	i := sort.Search(len(readings), func(i int) bool { return readings[i].Timestamp.After(t) })
+	if i > 0 {
+		return readings[i-1].Level, true
+	}
+	if i < len(readings) && readings[i].Timestamp.Sub(t) <= fuelReadingSlack {
+		return readings[i].Level, true
+	}
+	return 0, false
+}
+
+func per100Km(litres, km float64) *float64 {
+	if km <= 0 {
+		return nil
+	}
+	v := litres / km * 100
+	return &v
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, 50.0, median([]float64{50, 49.5, 80, 50.5, 50}), "a single spike is ignored")
+	assert.Equal(t, 2.5, median([]float64{4, 1, 3, 2}))
+}
+
+func TestTelemetryPosition(t *testing.T) {
+	vid := uuid.New()
+	status := map[string]interface{}{"timestamp": "2025-06-17T10:00:00+02:00", "fuel_level": 62.5, "speed": 0.0}
+	_, located := parsePosition(vid, status)
+	require.False(t, located)
+	level, ok := fuelLevel(status)
+	require.True(t, ok)
+	assert.Equal(t, 62.5, level)
+
+	last := &model.Position{VehicleID: vid, Location: [2]float64{55.27, 25.2}, Timestamp: time.Date(2025, 6, 17, 7, 55, 0, 0, time.UTC)}
+	pos := telemetryPosition(vid, status, last)
+	assert.Equal(t, vid, pos.VehicleID)
+	assert.Equal(t, time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC), pos.Timestamp)
+	assert.Equal(t, last.Location, pos.Location)
+
+	pos = telemetryPosition(vid, map[string]interface{}{"fuel_level": 40.0}, nil)
+	assert.Equal(t, [2]float64{}, pos.Location, "never located")
+	assert.WithinDuration(t, time.Now(), pos.Timestamp, time.Minute, "ingest time without a timestamp")
+}
+
+func TestFuelStep(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	p := DefaultFuelParams()
+	run := func(levels []float64, speed float64) []model.FuelEvent {
+		var st *model.FuelState
+		var done []model.FuelEvent
+		for i, l := range levels {
+			next, e := fuelStep(st, fuelSample{At: t0.Add(time.Duration(i) * time.Minute), Level: l, Speed: speed}, p)
+			st = &next
+			if e != nil {
+				done = append(done, *e)
+			}
+		}
+		return done
+	}
+
+	ev := run([]float64{20, 20.2, 35, 55, 70, 70.3, 70.1}, 0)
+	require.Len(t, ev, 1)
+	assert.Equal(t, model.FuelRefuel, ev[0].Kind)
+	assert.InDelta(t, 50.1, ev[0].Amount, 1e-9)
+	assert.Equal(t, t0.Add(time.Minute), ev[0].StartAt)
+	assert.Equal(t, t0.Add(5*time.Minute), ev[0].EndAt)
+
+	ev = run([]float64{60, 60, 54, 48, 44, 44}, 0)
+	require.Len(t, ev, 1, "a fast loss while parked is a drop")
+	assert.Equal(t, model.FuelDrop, ev[0].Kind)
+	assert.InDelta(t, 16, ev[0].Amount, 1e-9)
+
+	assert.Empty(t, run([]float64{60, 54, 48, 44, 44}, 60), "losses while driving are consumption")
+	assert.Empty(t, run([]float64{60, 62, 64, 64}, 0), "small rises are sensor drift")
+
+	// An idling vehicle burning 2 L/h over five hours is not a drop
+	var st *model.FuelState
+	for i := 0; i <= 10; i++ {
+		next, e := fuelStep(st, fuelSample{At: t0.Add(time.Duration(i) * 30 * time.Minute), Level: 60 - float64(i), Speed: 0}, p)
+		assert.Nil(t, e)
+		st = &next
+	}
+	_, e := fuelStep(st, fuelSample{At: t0.Add(6 * time.Hour), Level: 50, Speed: 0}, p)
+	assert.Nil(t, e)
+}
+
+func TestFuelReport(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return t0.Add(time.Duration(min) * time.Minute) }
+	reading := func(min int, l float64) model.FuelReading {
+		return model.FuelReading{Timestamp: at(min), Level: l}
+	}
+	readings := []model.FuelReading{
+		reading(0, 50), reading(60, 40), // first trip burns 10 L
+		reading(70, 40), reading(80, 90), // refuel of 50 L
+		reading(90, 90), reading(150, 75), // second trip burns 15 L
+	}
+	events := []model.FuelEvent{{Kind: model.FuelRefuel, StartAt: at(70), EndAt: at(80), StartLevel: 40, EndLevel: 90, Amount: 50}}
+	trips := []model.Trip{
+		{ID: uuid.New(), StartTime: at(0), EndTime: at(60), Mileage: 100},
+		{ID: uuid.New(), StartTime: at(90), EndTime: at(150), Mileage: 120},
+		{ID: uuid.New(), StartTime: at(-120), EndTime: at(-60), Mileage: 30},
+	}
+	rep := fuelReport("v", at(-180), at(180), readings, events, trips)
+
+	assert.Equal(t, 1, rep.Refuels)
+	assert.InDelta(t, 50, rep.Refuelled, 1e-9)
+	assert.InDelta(t, 25, rep.Consumed, 1e-9)
+	assert.InDelta(t, 250, rep.DistanceKm, 1e-9)
+	require.NotNil(t, rep.LPer100Km)
+	assert.InDelta(t, 10, *rep.LPer100Km, 1e-9)
+
+	require.Len(t, rep.Trips, 3)
+	require.NotNil(t, rep.Trips[0].Consumed)
+	assert.InDelta(t, 10, *rep.Trips[0].Consumed, 1e-9)
+	assert.InDelta(t, 10, *rep.Trips[0].LPer100Km, 1e-9)
+	assert.InDelta(t, 15, *rep.Trips[1].Consumed, 1e-9)
+	assert.InDelta(t, 12.5, *rep.Trips[1].LPer100Km, 1e-9)
+	assert.Nil(t, rep.Trips[2].Consumed, "no readings around the trip")
+}
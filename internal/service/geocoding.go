@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/geocode"
+	"fleet-tracker-service/internal/model"
+)
+
+// addressCacheTTL is how long a resolved address stays in Redis
+const addressCacheTTL = 24 * time.Hour
+
+// SetGeocoder makes a loaded reverse geocoder available to enrich responses
+func (s *Service) SetGeocoder(g *geocode.Geocoder) {
+	s.geocoder.Store(g)
+}
+
+// addressKey rounds a location to 4 decimals, about 11 m, so nearby fixes
+// share a cache entry
+func addressKey(loc [2]float64) (string, geo.Point) {
+	p := geo.Point{Lat: math.Round(loc[1]*1e4) / 1e4, Lon: math.Round(loc[0]*1e4) / 1e4}
+	return fmt.Sprintf("geocode:%.4f:%.4f", p.Lat, p.Lon), p
+}
+
+// addresses resolves [lon, lat] locations through the Redis cache. Entries
+// stay nil when no geocoder is loaded or nothing is known at a location.
+func (s *Service) addresses(ctx context.Context, locs [][2]float64) []*model.Address {
+	out := make([]*model.Address, len(locs))
+	g := s.geocoder.Load()
+	if g == nil || len(locs) == 0 {
+		return out
+	}
+	keys := make([]string, len(locs))
+	pts := make([]geo.Point, len(locs))
+	for i, loc := range locs {
+		keys[i], pts[i] = addressKey(loc)
+	}
+
+	cached, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		cached = make([]interface{}, len(keys))
+	}
+	pipe := s.rdb.Pipeline()
+	for i := range locs {
+		if v, ok := cached[i].(string); ok {
+			// An empty object caches a location with no known address
+			var a model.Address
+			if json.Unmarshal([]byte(v), &a) == nil && a.Label != "" {
+				out[i] = &a
+			}
+			continue
+		}
+		a, ok := g.Reverse(pts[i])
+		if ok {
+			out[i] = &a
+		}
+		b, _ := json.Marshal(a)
+		pipe.Set(ctx, keys[i], b, addressCacheTTL)
+	}
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			fmt.Println("redis set error:", err)
+		}
+	}
+	return out
+}
+
+// addTripAddresses fills in the start and end addresses of trips
+func (s *Service) addTripAddresses(ctx context.Context, trips []model.Trip) {
+	var locs [][2]float64
+	var targets []**model.Address
+	for i := range trips {
+		t := &trips[i]
+		if t.StartLocation != nil {
+			locs = append(locs, *t.StartLocation)
+			targets = append(targets, &t.StartAddress)
+		}
+		if t.EndLocation != nil {
+			locs = append(locs, *t.EndLocation)
+			targets = append(targets, &t.EndAddress)
+		}
+	}
+	for i, a := range s.addresses(ctx, locs) {
+		*targets[i] = a
+	}
+}
+
+// addStopAddresses fills in the address of each stop
+func (s *Service) addStopAddresses(ctx context.Context, stops []model.Stop) {
+	locs := make([][2]float64, len(stops))
+	for i, st := range stops {
+		locs[i] = st.Location
+	}
+	for i, a := range s.addresses(ctx, locs) {
+		stops[i].Address = a
+	}
+}
+
+// addStatusAddress adds the address of a status location under "address".
+// It is added as a plain map so the status still converts to a protobuf Struct.
+func (s *Service) addStatusAddress(ctx context.Context, st map[string]interface{}) {
+	loc, ok := toLonLat(st["location"])
+	if !ok {
+		return
+	}
+	a := s.addresses(ctx, [][2]float64{loc})[0]
+	if a == nil {
+		return
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	var m map[string]interface{}
+	if json.Unmarshal(b, &m) == nil {
+		st["address"] = m
+	}
+}
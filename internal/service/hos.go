@@ -0,0 +1,623 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidHOSRuleSet is returned for an invalid rule set or filter
+var ErrInvalidHOSRuleSet = errors.New("invalid hours-of-service rule set")
+
+// MaxHOSRange is the longest time range of a violations report
+const MaxHOSRange = 93 * 24 * time.Hour
+
+// hosWarningRetention is how long raised warnings are remembered so they
+// are not raised again
+const hosWarningRetention = 30 * 24 * time.Hour
+
+// HOSRuleSetInput describes a rule set; durations are in minutes and a zero
+// weekly or fortnightly limit does not apply
+type HOSRuleSetInput struct {
+	Name                    string  `json:"name"`
+	MaxContinuousDrivingMin float64 `json:"max_continuous_driving_min"`
+	MinBreakMin             float64 `json:"min_break_min"`
+	MinBreakPartMin         float64 `json:"min_break_part_min"`
+	MaxDailyDrivingMin      float64 `json:"max_daily_driving_min"`
+	MinDailyRestMin         float64 `json:"min_daily_rest_min"`
+	MaxDutySpanMin          float64 `json:"max_duty_span_min"`
+	MaxWeeklyDrivingMin     float64 `json:"max_weekly_driving_min"`
+	MaxFortnightDrivingMin  float64 `json:"max_fortnight_driving_min"`
+	WarnBeforeMin           float64 `json:"warn_before_min"`
+	IsDefault               bool    `json:"is_default"`
+}
+
+func (in HOSRuleSetInput) ruleSet(id uuid.UUID, createdAt time.Time) (model.HOSRuleSet, error) {
+	rs := model.HOSRuleSet{
+		ID:                      id,
+		Name:                    strings.TrimSpace(in.Name),
+		MaxContinuousDrivingMin: in.MaxContinuousDrivingMin,
+		MinBreakMin:             in.MinBreakMin,
+		MinBreakPartMin:         in.MinBreakPartMin,
+		MaxDailyDrivingMin:      in.MaxDailyDrivingMin,
+		MinDailyRestMin:         in.MinDailyRestMin,
+		MaxDutySpanMin:          in.MaxDutySpanMin,
+		MaxWeeklyDrivingMin:     in.MaxWeeklyDrivingMin,
+		MaxFortnightDrivingMin:  in.MaxFortnightDrivingMin,
+		WarnBeforeMin:           in.WarnBeforeMin,
+		IsDefault:               in.IsDefault,
+		CreatedAt:               createdAt,
+	}
+	invalid := func(msg string) (model.HOSRuleSet, error) {
+		return model.HOSRuleSet{}, fmt.Errorf("%w: %s", ErrInvalidHOSRuleSet, msg)
+	}
+	if rs.Name == "" {
+		return invalid("name required")
+	}
+	for _, v := range []struct {
+		name     string
+		value    float64
+		required bool
+	}{
+		{"max_continuous_driving_min", rs.MaxContinuousDrivingMin, true},
+		{"min_break_min", rs.MinBreakMin, true},
+		{"max_daily_driving_min", rs.MaxDailyDrivingMin, true},
+		{"min_daily_rest_min", rs.MinDailyRestMin, true},
+		{"max_duty_span_min", rs.MaxDutySpanMin, true},
+		{"min_break_part_min", rs.MinBreakPartMin, false},
+		{"max_weekly_driving_min", rs.MaxWeeklyDrivingMin, false},
+		{"max_fortnight_driving_min", rs.MaxFortnightDrivingMin, false},
+		{"warn_before_min", rs.WarnBeforeMin, false},
+	} {
+		if v.value < 0 || v.required && v.value == 0 {
+			return invalid(v.name + " must be positive")
+		}
+	}
+	if rs.MinBreakPartMin > rs.MinBreakMin {
+		return invalid("min_break_part_min must not exceed min_break_min")
+	}
+	if rs.MinDailyRestMin < rs.MinBreakMin {
+		return invalid("min_daily_rest_min must be at least min_break_min")
+	}
+	return rs, nil
+}
+
+// hosPeriods turns a driver's trips into driving, work and rest periods
+// covering [from, to). Pauses within a trip and the stop that ends it are
+// work while the engine idles; any other time is rest.
+func hosPeriods(trips []repository.HOSTrip, from, to time.Time) []model.HOSPeriod {
+	res := []model.HOSPeriod{}
+	cursor := from
+	add := func(activity string, vehicleID *uuid.UUID, start, end time.Time) {
+		if start.Before(cursor) {
+			start = cursor
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			return
+		}
+		if start.After(cursor) {
+			res = appendPeriod(res, model.HOSPeriod{Activity: model.ActivityRest, Start: cursor, End: start})
+		}
+		if activity == model.ActivityRest {
+			vehicleID = nil
+		}
+		res = appendPeriod(res, model.HOSPeriod{Activity: activity, Start: start, End: end, VehicleID: vehicleID})
+		cursor = end
+	}
+	pause := func(st model.Stop) string {
+		if st.Idling {
+			return model.ActivityWork
+		}
+		return model.ActivityRest
+	}
+
+	for i, t := range trips {
+		vehicleID := t.VehicleID
+		next := to
+		if i+1 < len(trips) {
+			next = trips[i+1].Start
+		}
+		at := t.Start
+		var after []model.Stop
+		for _, st := range t.Stops {
+			if !st.Arrival.Before(t.End) {
+				after = append(after, st)
+				continue
+			}
+			add(model.ActivityDriving, &vehicleID, at, st.Arrival)
+			end := st.Departure
+			if end.After(t.End) {
+				end = t.End
+			}
+			add(pause(st), &vehicleID, st.Arrival, end)
+			if end.After(at) {
+				at = end
+			}
+		}
+		add(model.ActivityDriving, &vehicleID, at, t.End)
+		for _, st := range after {
+			end := st.Departure
+			if end.After(next) {
+				end = next
+			}
+			add(pause(st), &vehicleID, st.Arrival, end)
+		}
+	}
+	add(model.ActivityRest, nil, cursor, to)
+	return res
+}
+
+// appendPeriod appends p, extending the last period when p continues it
+func appendPeriod(ps []model.HOSPeriod, p model.HOSPeriod) []model.HOSPeriod {
+	if n := len(ps); n > 0 {
+		last := &ps[n-1]
+		sameVehicle := last.VehicleID == nil && p.VehicleID == nil ||
+			last.VehicleID != nil && p.VehicleID != nil && *last.VehicleID == *p.VehicleID
+		if last.Activity == p.Activity && last.End.Equal(p.Start) && sameVehicle {
+			last.End = p.End
+			return ps
+		}
+	}
+	return append(ps, p)
+}
+
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
+
+// hosEvaluation is the outcome of checking a driver's periods against a
+// rule set
+type hosEvaluation struct {
+	violations []model.HOSViolation
+	limits     []model.HOSLimit // usage at the end of the periods
+	activity   string
+	since      time.Time
+}
+
+// evaluateHOS checks consecutive periods against a rule set. Continuous
+// driving ends with breaks adding up to MinBreakMin, counting only rests of
+// at least MinBreakPartMin; daily driving and the duty span end with a rest
+// of MinDailyRestMin. Weeks start on Monday in loc. Usage is reported as of
+// end, which is no earlier than the last period.
+func evaluateHOS(periods []model.HOSPeriod, rs model.HOSRuleSet, loc *time.Location, end time.Time) hosEvaluation {
+	var ev hosEvaluation
+	var (
+		contStart, dutyStart, week            time.Time
+		contDriving, breakTaken, dailyDriving time.Duration
+		weekDriving, prevWeekDriving          time.Duration
+	)
+	// open holds the violation of each limit still growing in its period
+	open := map[string]int{}
+	exceed := func(kind string, periodStart, at time.Time, before, after time.Duration, limitMin float64) {
+		limit := minutes(limitMin)
+		if limitMin <= 0 || after <= limit {
+			return
+		}
+		i, ok := open[kind]
+		if !ok {
+			ev.violations = append(ev.violations, model.HOSViolation{
+				Kind:        kind,
+				PeriodStart: periodStart,
+				At:          at.Add(limit - before),
+				LimitMin:    limitMin,
+			})
+			i = len(ev.violations) - 1
+			open[kind] = i
+		}
+		ev.violations[i].ActualMin = round1(after.Minutes())
+		ev.violations[i].ExcessMin = round1(after.Minutes() - limitMin)
+	}
+	toWeek := func(t time.Time) {
+		ws := weekStart(t, loc)
+		if ws.Equal(week) {
+			return
+		}
+		prevWeekDriving = 0
+		if ws.Equal(week.AddDate(0, 0, 7)) {
+			prevWeekDriving = weekDriving
+		}
+		week, weekDriving = ws, 0
+		delete(open, model.HOSWeeklyDriving)
+		delete(open, model.HOSFortnightDriving)
+	}
+
+	for _, p := range periods {
+		if p.Activity == model.ActivityRest {
+			d := p.End.Sub(p.Start)
+			if d >= minutes(rs.MinBreakPartMin) {
+				breakTaken += d
+			}
+			if breakTaken >= minutes(rs.MinBreakMin) {
+				contStart, contDriving, breakTaken = time.Time{}, 0, 0
+				delete(open, model.HOSContinuousDriving)
+			}
+			if d >= minutes(rs.MinDailyRestMin) {
+				dutyStart, dailyDriving = time.Time{}, 0
+				delete(open, model.HOSDailyDriving)
+				delete(open, model.HOSDutySpan)
+			}
+			continue
+		}
+		if dutyStart.IsZero() {
+			dutyStart = p.Start
+		}
+		exceed(model.HOSDutySpan, dutyStart, p.Start, p.Start.Sub(dutyStart), p.End.Sub(dutyStart), rs.MaxDutySpanMin)
+		if p.Activity != model.ActivityDriving {
+			continue
+		}
+		// Driving across midnight on Sunday counts towards both weeks
+		for start := p.Start; start.Before(p.End); {
+			toWeek(start)
+			stop := week.AddDate(0, 0, 7)
+			if stop.After(p.End) {
+				stop = p.End
+			}
+			d := stop.Sub(start)
+			if contStart.IsZero() {
+				contStart = start
+			}
+			exceed(model.HOSContinuousDriving, contStart, start, contDriving, contDriving+d, rs.MaxContinuousDrivingMin)
+			exceed(model.HOSDailyDriving, dutyStart, start, dailyDriving, dailyDriving+d, rs.MaxDailyDrivingMin)
+			exceed(model.HOSWeeklyDriving, week, start, weekDriving, weekDriving+d, rs.MaxWeeklyDrivingMin)
+			exceed(model.HOSFortnightDriving, week.AddDate(0, 0, -7), start, prevWeekDriving+weekDriving,
+				prevWeekDriving+weekDriving+d, rs.MaxFortnightDrivingMin)
+			contDriving += d
+			dailyDriving += d
+			weekDriving += d
+			start = stop
+		}
+	}
+
+	toWeek(end)
+	ev.activity, ev.since = model.ActivityOffDuty, end
+	if n := len(periods); n > 0 {
+		ev.activity, ev.since = periods[n-1].Activity, periods[n-1].Start
+	}
+	if dutyStart.IsZero() {
+		ev.activity = model.ActivityOffDuty
+	}
+	orEnd := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return end
+		}
+		return t
+	}
+	var span time.Duration
+	if !dutyStart.IsZero() {
+		span = end.Sub(dutyStart)
+	}
+	for _, l := range []struct {
+		kind     string
+		start    time.Time
+		used     time.Duration
+		limitMin float64
+	}{
+		{model.HOSContinuousDriving, orEnd(contStart), contDriving, rs.MaxContinuousDrivingMin},
+		{model.HOSDailyDriving, orEnd(dutyStart), dailyDriving, rs.MaxDailyDrivingMin},
+		{model.HOSDutySpan, orEnd(dutyStart), span, rs.MaxDutySpanMin},
+		{model.HOSWeeklyDriving, week, weekDriving, rs.MaxWeeklyDrivingMin},
+		{model.HOSFortnightDriving, week.AddDate(0, 0, -7), prevWeekDriving + weekDriving, rs.MaxFortnightDrivingMin},
+	} {
+		if l.limitMin <= 0 {
+			continue
+		}
+		ev.limits = append(ev.limits, model.HOSLimit{
+			Kind:         l.kind,
+			PeriodStart:  l.start,
+			LimitMin:     l.limitMin,
+			UsedMin:      round1(l.used.Minutes()),
+			RemainingMin: round1(l.limitMin - l.used.Minutes()),
+		})
+	}
+	return ev
+}
+
+// hosWarnings returns the limits in use that are within the rule set's
+// warning margin of being reached
+func hosWarnings(limits []model.HOSLimit, rs model.HOSRuleSet) []model.HOSLimit {
+	res := []model.HOSLimit{}
+	for _, l := range limits {
+		if l.UsedMin > 0 && l.RemainingMin > 0 && l.RemainingMin <= rs.WarnBeforeMin {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// hosData is the activity of drivers loaded for evaluation from start
+type hosData struct {
+	drivers []repository.HOSDriver
+	trips   map[uuid.UUID][]repository.HOSTrip
+	loc     *time.Location
+	start   time.Time
+}
+
+// loadHOS loads the drivers with the trips needed to evaluate them up to
+// to from from on. Evaluation starts a day before the week preceding from
+// so the continuous, daily and fortnightly driving carried into from counts.
+func (s *Service) loadHOS(ctx context.Context, from, to time.Time, driverID string) (hosData, error) {
+	org, err := s.repo.GetOrgSettings(ctx)
+	if err != nil {
+		return hosData{}, err
+	}
+	loc, err := time.LoadLocation(org.Timezone)
+	if err != nil {
+		return hosData{}, err
+	}
+	d := hosData{loc: loc, start: weekStart(from, loc).AddDate(0, 0, -8).UTC(), trips: map[uuid.UUID][]repository.HOSTrip{}}
+	if d.drivers, err = s.repo.HOSDrivers(ctx, driverID); err != nil {
+		return d, err
+	}
+	trips, err := s.repo.HOSTrips(ctx, d.start, to.UTC(), driverID, DefaultTripParams().StopAfter)
+	if err != nil {
+		return d, err
+	}
+	for _, t := range trips {
+		d.trips[t.DriverID] = append(d.trips[t.DriverID], t)
+	}
+	return d, nil
+}
+
+// ListHOSRuleSets returns the driving-time rule sets
+func (s *Service) ListHOSRuleSets(ctx context.Context) ([]model.HOSRuleSet, error) {
+	return s.repo.ListHOSRuleSets(ctx)
+}
+
+// CreateHOSRuleSet adds a rule set, which becomes the default when asked
+func (s *Service) CreateHOSRuleSet(ctx context.Context, in HOSRuleSetInput) (model.HOSRuleSet, error) {
+	rs, err := in.ruleSet(uuid.New(), time.Now().UTC())
+	if err != nil {
+		return rs, err
+	}
+	err = s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		return tx.SaveHOSRuleSet(ctx, rs)
+	})
+	return rs, err
+}
+
+// UpdateHOSRuleSet replaces the limits of a rule set. The default rule set
+// stays the default until another one takes over.
+func (s *Service) UpdateHOSRuleSet(ctx context.Context, id string, in HOSRuleSetInput) (model.HOSRuleSet, error) {
+	old, err := s.repo.GetHOSRuleSet(ctx, id)
+	if err != nil {
+		return old, err
+	}
+	if old.IsDefault && !in.IsDefault {
+		return model.HOSRuleSet{}, fmt.Errorf("%w: make another rule set the default instead", ErrInvalidHOSRuleSet)
+	}
+	rs, err := in.ruleSet(old.ID, old.CreatedAt)
+	if err != nil {
+		return rs, err
+	}
+	err = s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		return tx.SaveHOSRuleSet(ctx, rs)
+	})
+	return rs, err
+}
+
+// SetDriverHOSRuleSet holds a driver to a rule set; an empty id reverts to
+// the default one
+func (s *Service) SetDriverHOSRuleSet(ctx context.Context, driverID, ruleSetID string) error {
+	var id *uuid.UUID
+	if ruleSetID != "" {
+		v, err := uuid.Parse(ruleSetID)
+		if err != nil {
+			return repository.ErrHOSRuleSetNotFound
+		}
+		id = &v
+	}
+	return s.repo.SetDriverHOSRuleSet(ctx, driverID, id)
+}
+
+// DriverHours is a driver's standing against their rule set now, with their
+// activity and violations in a time range
+type DriverHours struct {
+	DriverID   uuid.UUID            `json:"driver_id"`
+	DriverName string               `json:"driver_name"`
+	RuleSet    model.HOSRuleSet     `json:"rule_set"`
+	Activity   string               `json:"activity"`
+	Since      time.Time            `json:"since"`
+	Limits     []model.HOSLimit     `json:"limits"`
+	Warnings   []model.HOSLimit     `json:"warnings"` // limits about to be reached
+	Periods    []model.HOSPeriod    `json:"periods"`
+	Violations []model.HOSViolation `json:"violations"`
+}
+
+// GetDriverHours evaluates a driver's driving time up to now and returns the
+// periods and violations in [from, to)
+func (s *Service) GetDriverHours(ctx context.Context, driverID string, from, to time.Time) (DriverHours, error) {
+	if err := ValidateRange(from, to, MaxHOSRange); err != nil {
+		return DriverHours{}, err
+	}
+	now := time.Now().UTC()
+	if from.After(now) {
+		from = now
+	}
+	data, err := s.loadHOS(ctx, from, now, driverID)
+	if err != nil {
+		return DriverHours{}, err
+	}
+	if len(data.drivers) == 0 {
+		return DriverHours{}, repository.ErrDriverNotFound
+	}
+	d := data.drivers[0]
+	periods := hosPeriods(data.trips[d.ID], data.start, now)
+	ev := evaluateHOS(periods, d.RuleSet, data.loc, now)
+	res := DriverHours{
+		DriverID:   d.ID,
+		DriverName: d.Name,
+		RuleSet:    d.RuleSet,
+		Activity:   ev.activity,
+		Since:      ev.since,
+		Limits:     ev.limits,
+		Periods:    []model.HOSPeriod{},
+		Violations: violationsIn(ev.violations, d, from, to),
+	}
+	if ev.activity != model.ActivityOffDuty {
+		res.Warnings = hosWarnings(ev.limits, d.RuleSet)
+	}
+	for _, p := range periods {
+		if !p.End.After(from) || !p.Start.Before(to) {
+			continue
+		}
+		if p.Start.Before(from) {
+			p.Start = from
+		}
+		if p.End.After(to) {
+			p.End = to
+		}
+		res.Periods = append(res.Periods, p)
+	}
+	return res, nil
+}
+
+// violationsIn returns the violations of a driver that happened in [from, to)
+func violationsIn(vs []model.HOSViolation, d repository.HOSDriver, from, to time.Time) []model.HOSViolation {
+	res := []model.HOSViolation{}
+	for _, v := range vs {
+		if v.At.Before(from) || !v.At.Before(to) {
+			continue
+		}
+		v.DriverID, v.DriverName, v.RuleSet = d.ID, d.Name, d.RuleSet.Name
+		res = append(res, v)
+	}
+	return res
+}
+
+// GetHOSViolations returns the driving-time violations in [from, to) of one
+// or every driver, optionally of one kind, in the order they happened
+func (s *Service) GetHOSViolations(ctx context.Context, from, to time.Time, driverID, kind string) ([]model.HOSViolation, error) {
+	if err := ValidateRange(from, to, MaxHOSRange); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "", model.HOSContinuousDriving, model.HOSDailyDriving, model.HOSDutySpan, model.HOSWeeklyDriving,
+		model.HOSFortnightDriving:
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %s", ErrInvalidHOSRuleSet, kind)
+	}
+	end := time.Now().UTC()
+	if to.Before(end) {
+		end = to
+	}
+	res := []model.HOSViolation{}
+	if !from.Before(end) {
+		return res, nil
+	}
+	data, err := s.loadHOS(ctx, from, end, driverID)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range data.drivers {
+		trips := data.trips[d.ID]
+		if len(trips) == 0 {
+			continue
+		}
+		ev := evaluateHOS(hosPeriods(trips, data.start, end), d.RuleSet, data.loc, end)
+		for _, v := range violationsIn(ev.violations, d, from, to) {
+			if kind == "" || v.Kind == kind {
+				res = append(res, v)
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].At.Before(res[j].At) })
+	return res, nil
+}
+
+// hosWarning is the payload of a HOSWarning event
+type hosWarning struct {
+	DriverID   uuid.UUID `json:"driver_id"`
+	DriverName string    `json:"driver_name"`
+	RuleSet    string    `json:"rule_set"`
+	model.HOSLimit
+}
+
+// HOSScheduler periodically checks the drivers on duty and warns once per
+// limit and period when one is about to reach a driving-time limit
+type HOSScheduler struct {
+	svc      *Service
+	interval time.Duration
+}
+
+func NewHOSScheduler(svc *Service, interval time.Duration) *HOSScheduler {
+	return &HOSScheduler{svc: svc, interval: interval}
+}
+
+// Run checks driving time every interval until ctx is done
+func (h *HOSScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		if n, err := h.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("hos scheduler: %v", err)
+		} else if n > 0 {
+			log.Printf("hos scheduler: %d driving-time warnings raised", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce evaluates every driver on duty and returns how many warnings were
+// raised
+func (h *HOSScheduler) RunOnce(ctx context.Context) (int, error) {
+	repo := h.svc.repo
+	now := time.Now().UTC()
+	if _, err := repo.PruneHOSWarnings(ctx, now.Add(-hosWarningRetention)); err != nil {
+		return 0, err
+	}
+	data, err := h.svc.loadHOS(ctx, now, now, "")
+	if err != nil {
+		return 0, err
+	}
+	raised := 0
+	for _, d := range data.drivers {
+		trips := data.trips[d.ID]
+		if len(trips) == 0 {
+			continue
+		}
+		ev := evaluateHOS(hosPeriods(trips, data.start, now), d.RuleSet, data.loc, now)
+		if ev.activity == model.ActivityOffDuty {
+			continue
+		}
+		vehicleID := trips[len(trips)-1].VehicleID
+		for _, l := range hosWarnings(ev.limits, d.RuleSet) {
+			err := repo.WithTx(ctx, func(tx *repository.Repo) error {
+				fresh, err := tx.MarkHOSWarning(ctx, d.ID, l.Kind, l.PeriodStart, now)
+				if err != nil || !fresh {
+					return err
+				}
+				raised++
+				e, err := model.NewEvent(model.EventHOSWarning, vehicleID, hosWarning{
+					DriverID:   d.ID,
+					DriverName: d.Name,
+					RuleSet:    d.RuleSet.Name,
+					HOSLimit:   l,
+				})
+				if err != nil {
+					return err
+				}
+				return tx.InsertEvents(ctx, e)
+			})
+			if err != nil {
+				return raised, fmt.Errorf("driver %s %s: %w", d.ID, l.Kind, err)
+			}
+		}
+	}
+	return raised, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func euRules() model.HOSRuleSet {
+	return model.HOSRuleSet{
+		Name:                    "EU 561/2006",
+		MaxContinuousDrivingMin: 270,
+		MinBreakMin:             45,
+		MinBreakPartMin:         15,
+		MaxDailyDrivingMin:      540,
+		MinDailyRestMin:         660,
+		MaxDutySpanMin:          780,
+		MaxWeeklyDrivingMin:     3360,
+		MaxFortnightDrivingMin:  5400,
+		WarnBeforeMin:           30,
+	}
+}
+
+func TestHOSRuleSetInput(t *testing.T) {
+	rs := euRules()
+	in := HOSRuleSetInput{
+		Name:                    " EU ",
+		MaxContinuousDrivingMin: rs.MaxContinuousDrivingMin,
+		MinBreakMin:             rs.MinBreakMin,
+		MinBreakPartMin:         rs.MinBreakPartMin,
+		MaxDailyDrivingMin:      rs.MaxDailyDrivingMin,
+		MinDailyRestMin:         rs.MinDailyRestMin,
+		MaxDutySpanMin:          rs.MaxDutySpanMin,
+	}
+	got, err := in.ruleSet(uuid.New(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "EU", got.Name)
+	assert.Zero(t, got.MaxWeeklyDrivingMin)
+
+	bad := in
+	bad.MinBreakMin = 0
+	_, err = bad.ruleSet(uuid.New(), time.Now())
+	assert.ErrorIs(t, err, ErrInvalidHOSRuleSet)
+
+	bad = in
+	bad.MinBreakPartMin = 60
+	_, err = bad.ruleSet(uuid.New(), time.Now())
+	assert.ErrorIs(t, err, ErrInvalidHOSRuleSet)
+}
+
+func TestHOSPeriods(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 6, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return t0.Add(time.Duration(min) * time.Minute) }
+	vid := uuid.New()
+	trips := []repository.HOSTrip{
+		{VehicleID: vid, Start: at(0), End: at(120), Stops: []model.Stop{
+			{Arrival: at(40), Departure: at(43), Idling: true}, // queueing with the engine on
+			{Arrival: at(80), Departure: at(84)},               // engine off
+			{Arrival: at(120), Departure: at(150), Idling: true},
+		}},
+		{VehicleID: vid, Start: at(140), End: at(200), Stops: []model.Stop{
+			{Arrival: at(201), Departure: at(260)},
+		}},
+	}
+	ps := hosPeriods(trips, at(-60), at(300))
+
+	var got []string
+	for _, p := range ps {
+		got = append(got, p.Activity)
+	}
+	assert.Equal(t, []string{"rest", "driving", "work", "driving", "rest", "driving", "work", "driving", "rest"}, got)
+	assert.Equal(t, at(-60), ps[0].Start)
+	assert.Equal(t, at(120), ps[6].Start)
+	assert.Equal(t, at(140), ps[6].End, "the idling stop is cut short by the next trip")
+	assert.Equal(t, at(300), ps[8].End)
+	assert.Nil(t, ps[4].VehicleID)
+	require.NotNil(t, ps[3].VehicleID)
+	assert.Equal(t, vid, *ps[3].VehicleID)
+}
+
+func TestEvaluateHOS(t *testing.T) {
+	loc := time.UTC
+	mon := time.Date(2025, 6, 16, 0, 0, 0, 0, loc)
+	var ps []model.HOSPeriod
+	cursor := mon.Add(6 * time.Hour)
+	add := func(activity string, minutes int) {
+		end := cursor.Add(time.Duration(minutes) * time.Minute)
+		ps = appendPeriod(ps, model.HOSPeriod{Activity: activity, Start: cursor, End: end})
+		cursor = end
+	}
+	drive := func(m int) { add(model.ActivityDriving, m) }
+	rest := func(m int) { add(model.ActivityRest, m) }
+
+	// Split break of 15 and 30 minutes resets continuous driving; a 10
+	// minute pause does not count towards it
+	drive(120)
+	rest(15)
+	drive(120)
+	rest(10)
+	drive(20)
+	rest(30)
+	drive(200)
+	rest(10)
+	drive(90) // 290 min since the break, daily 550
+	ev := evaluateHOS(ps, euRules(), loc, cursor)
+
+	require.Len(t, ev.violations, 2)
+	cont := ev.violations[0]
+	assert.Equal(t, model.HOSContinuousDriving, cont.Kind)
+	assert.Equal(t, mon.Add(6*time.Hour+315*time.Minute), cont.PeriodStart)
+	assert.Equal(t, 290.0, cont.ActualMin)
+	assert.Equal(t, 20.0, cont.ExcessMin)
+	assert.Equal(t, cursor.Add(-20*time.Minute), cont.At)
+	daily := ev.violations[1]
+	assert.Equal(t, model.HOSDailyDriving, daily.Kind)
+	assert.Equal(t, 550.0, daily.ActualMin)
+	assert.Equal(t, cursor.Add(-10*time.Minute), daily.At)
+	assert.Equal(t, model.ActivityDriving, ev.activity)
+
+	// A daily rest ends the duty period; a long shift breaks the duty span
+	rest(660)
+	drive(60)
+	add(model.ActivityWork, 600)
+	drive(150)
+	ev = evaluateHOS(ps, euRules(), loc, cursor)
+	require.Len(t, ev.violations, 3)
+	span := ev.violations[2]
+	assert.Equal(t, model.HOSDutySpan, span.Kind)
+	assert.Equal(t, span.PeriodStart.Add(780*time.Minute), span.At)
+	assert.Equal(t, 810.0, span.ActualMin)
+
+	limits := map[string]model.HOSLimit{}
+	for _, l := range ev.limits {
+		limits[l.Kind] = l
+	}
+	assert.Equal(t, 210.0, limits[model.HOSDailyDriving].UsedMin)
+	assert.Equal(t, 60.0, limits[model.HOSContinuousDriving].RemainingMin)
+	assert.Equal(t, 760.0, limits[model.HOSWeeklyDriving].UsedMin)
+	assert.Equal(t, mon, limits[model.HOSWeeklyDriving].PeriodStart)
+
+	// After a daily rest the driver is off duty with fresh daily limits
+	rest(720)
+	ev = evaluateHOS(ps, euRules(), loc, cursor)
+	assert.Equal(t, model.ActivityOffDuty, ev.activity)
+	for _, l := range ev.limits {
+		if l.Kind == model.HOSDailyDriving {
+			assert.Zero(t, l.UsedMin)
+		}
+	}
+}
+
+func TestEvaluateHOSWeeks(t *testing.T) {
+	loc := time.UTC
+	rs := euRules()
+	rs.MaxContinuousDrivingMin, rs.MaxDailyDrivingMin, rs.MaxDutySpanMin = 10000, 10000, 10000
+	mon := time.Date(2025, 6, 16, 0, 0, 0, 0, loc)
+	ps := []model.HOSPeriod{
+		{Activity: model.ActivityDriving, Start: mon.Add(-2 * time.Hour), End: mon.Add(3000 * time.Minute)},
+		{Activity: model.ActivityRest, Start: mon.Add(3000 * time.Minute), End: mon.AddDate(0, 0, 7)},
+		{Activity: model.ActivityDriving, Start: mon.AddDate(0, 0, 7), End: mon.AddDate(0, 0, 7).Add(2500 * time.Minute)},
+	}
+	ev := evaluateHOS(ps, rs, loc, ps[2].End)
+	require.Len(t, ev.violations, 1, "only the two weeks together are over a limit")
+	v := ev.violations[0]
+	assert.Equal(t, model.HOSFortnightDriving, v.Kind)
+	assert.Equal(t, mon, v.PeriodStart)
+	assert.Equal(t, mon.AddDate(0, 0, 7).Add(2400*time.Minute), v.At)
+	assert.Equal(t, 5500.0, v.ActualMin, "the drive into the first week counts only from Monday")
+
+	warn := hosWarnings([]model.HOSLimit{
+		{Kind: model.HOSContinuousDriving, UsedMin: 250, RemainingMin: 20},
+		{Kind: model.HOSDailyDriving, UsedMin: 250, RemainingMin: 290},
+		{Kind: model.HOSWeeklyDriving, UsedMin: 3400, RemainingMin: -40},
+	}, rs)
+	require.Len(t, warn, 1)
+	assert.Equal(t, model.HOSContinuousDriving, warn[0].Kind)
+}
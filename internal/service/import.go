@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"fleet-tracker-service/internal/importer"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidImport is returned when an import request cannot be accepted
+var ErrInvalidImport = errors.New("invalid import")
+
+// Importer runs history imports one at a time in the background. Uploaded
+// files are kept in dir until their job finishes, so jobs interrupted by a
+// restart are resumed; that is safe because fixes already stored are skipped.
+type Importer struct {
+	svc   *Service
+	dir   string
+	queue chan uuid.UUID
+}
+
+func NewImporter(svc *Service, dir string) (*Importer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Importer{svc: svc, dir: dir, queue: make(chan uuid.UUID, 1000)}, nil
+}
+
+func (im *Importer) path(id uuid.UUID) string {
+	return filepath.Join(im.dir, id.String())
+}
+
+func validateImport(opts importer.Options) error {
+	switch opts.Format {
+	case importer.FormatGPX:
+		if opts.VehicleID == "" {
+			return fmt.Errorf("%w: vehicle_id is required for gpx", ErrInvalidImport)
+		}
+	case importer.FormatCSV:
+	default:
+		return fmt.Errorf("%w: unsupported format %q", ErrInvalidImport, opts.Format)
+	}
+	if opts.VehicleID != "" {
+		if _, err := uuid.Parse(opts.VehicleID); err != nil {
+			return fmt.Errorf("%w: invalid vehicle_id", ErrInvalidImport)
+		}
+	}
+	return nil
+}
+
+// Submit stores an uploaded file and queues its import. When the same file
+// was already imported with the same options, or is being imported, the
+// existing job is returned with created set to false.
+func (im *Importer) Submit(ctx context.Context, name string, r io.Reader, opts importer.Options) (job model.ImportJob, created bool, err error) {
+	if opts.Format == "" {
+		opts.Format = importer.FormatFromName(name)
+	}
+	if err := validateImport(opts); err != nil {
+		return job, false, err
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return job, false, err
+	}
+
+	id := uuid.New()
+	f, err := os.Create(im.path(id))
+	if err != nil {
+		return job, false, err
+	}
+	h := sha256.New()
+	h.Write(optsJSON)
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(im.path(id))
+		return job, false, err
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+
+	existing, err := im.svc.repo.FindImportJob(ctx, checksum)
+	if err == nil {
+		os.Remove(im.path(id))
+		return existing, false, nil
+	}
+	if !errors.Is(err, repository.ErrImportNotFound) {
+		os.Remove(im.path(id))
+		return job, false, err
+	}
+
+	job = model.ImportJob{
+		ID:        id,
+		Format:    opts.Format,
+		FileName:  name,
+		Checksum:  checksum,
+		Options:   optsJSON,
+		Status:    model.ImportQueued,
+		SizeBytes: size,
+		CreatedAt: time.Now().UTC(),
+	}
+	if opts.VehicleID != "" {
+		v := uuid.MustParse(opts.VehicleID)
+		job.VehicleID = &v
+	}
+	if err := im.svc.repo.CreateImportJob(ctx, job); err != nil {
+		os.Remove(im.path(id))
+		return job, false, err
+	}
+	select {
+	case im.queue <- id:
+	default:
+		// Picked up from the database on the next restart
+		log.Printf("import queue full, job %s deferred", id)
+	}
+	return job, true, nil
+}
+
+// Get returns an import job by id
+func (im *Importer) Get(ctx context.Context, id string) (model.ImportJob, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return model.ImportJob{}, repository.ErrImportNotFound
+	}
+	return im.svc.repo.GetImportJob(ctx, id)
+}
+
+// Run resumes unfinished jobs and then processes new ones until ctx is done
+func (im *Importer) Run(ctx context.Context) {
+	jobs, err := im.svc.repo.GetUnfinishedImportJobs(ctx)
+	if err != nil {
+		log.Printf("import: list unfinished jobs: %v", err)
+	}
+	for _, j := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		im.process(ctx, j)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-im.queue:
+			j, err := im.svc.repo.GetImportJob(ctx, id.String())
+			if err != nil {
+				log.Printf("import %s: %v", id, err)
+				continue
+			}
+			if j.Status == model.ImportQueued || j.Status == model.ImportRunning {
+				im.process(ctx, j)
+			}
+		}
+	}
+}
+
+// countingReader tracks how much of the file has been read for progress
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (im *Importer) process(ctx context.Context, job model.ImportJob) {
+	finish := func(status string, err error) {
+		now := time.Now().UTC()
+		job.Status = status
+		job.FinishedAt = &now
+		if err != nil {
+			job.Error = err.Error()
+		}
+		if status == model.ImportCompleted {
+			job.ReadBytes = job.SizeBytes
+		}
+		// Record the outcome even when shutdown cancelled ctx
+		if uerr := im.svc.repo.UpdateImportJob(context.WithoutCancel(ctx), job); uerr != nil {
+			log.Printf("import %s: %v", job.ID, uerr)
+		}
+		os.Remove(im.path(job.ID))
+	}
+
+	var opts importer.Options
+	if err := json.Unmarshal(job.Options, &opts); err != nil {
+		finish(model.ImportFailed, err)
+		return
+	}
+	f, err := os.Open(im.path(job.ID))
+	if err != nil {
+		finish(model.ImportFailed, fmt.Errorf("upload is no longer available: %w", err))
+		return
+	}
+	defer f.Close()
+
+	// Counters restart from zero on resume; already stored fixes are
+	// counted as duplicates
+	job.Status = model.ImportRunning
+	job.ReadBytes, job.Processed, job.Imported, job.Duplicates, job.Rejected, job.Failed = 0, 0, 0, 0, 0, 0
+	if err := im.svc.repo.UpdateImportJob(ctx, job); err != nil {
+		log.Printf("import %s: %v", job.ID, err)
+	}
+
+	cr := &countingReader{r: f}
+	spans := map[string]*importSpan{}
+	var batch []importer.Record
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := im.importBatch(ctx, batch, &job, spans)
+		batch = batch[:0]
+		return err
+	}
+	lastFlush := time.Now()
+	err = importer.Read(cr, opts, func(rec importer.Record, rowErr error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		job.Processed++
+		if rowErr == nil {
+			rowErr = recordPayload(rec).Validate()
+		}
+		if rowErr != nil {
+			im.rowFailed(&job, rowErr)
+		} else {
+			batch = append(batch, rec)
+		}
+		if len(batch) >= importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if time.Since(lastFlush) >= time.Second {
+			lastFlush = time.Now()
+			job.ReadBytes = cr.n
+			if err := im.svc.repo.UpdateImportJob(ctx, job); err != nil {
+				log.Printf("import %s: %v", job.ID, err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if ctx.Err() != nil {
+		// Left running; resumed on the next start
+		return
+	}
+	if err != nil {
+		finish(model.ImportFailed, err)
+		return
+	}
+
+	// Fixes arrive in file order, so trips and stops are detected once
+	// everything is stored, over the stored range in time order
+	var trips, stops int
+	for id, sp := range spans {
+		t, st, err := im.svc.segmentHistory(ctx, id, sp.from, sp.to, sp.drivers)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			finish(model.ImportFailed, fmt.Errorf("segment trips of %s: %w", id, err))
+			return
+		}
+		trips, stops = trips+t, stops+st
+	}
+	log.Printf("import %s done: %d points, %d imported, %d duplicates, %d rejected, %d failed, %d trips and %d stops added",
+		job.ID, job.Processed, job.Imported, job.Duplicates, job.Rejected, job.Failed, trips, stops)
+	finish(model.ImportCompleted, nil)
+}
+
+// importBatchSize is how many fixes an import stores per transaction
+const importBatchSize = 500
+
+// importSpan is the time range of a vehicle's fixes an import stored and
+// the drivers reported with them, by fixKey
+type importSpan struct {
+	from, to time.Time
+	drivers  map[int64]uuid.UUID
+}
+
+func (sp *importSpan) add(t time.Time) {
+	if sp.from.IsZero() || t.Before(sp.from) {
+		sp.from = t
+	}
+	if t.After(sp.to) {
+		sp.to = t
+	}
+}
+
+func (im *Importer) rowFailed(job *model.ImportJob, err error) {
+	job.Failed++
+	if job.Failed <= 10 {
+		log.Printf("import %s: %v", job.ID, err)
+	}
+}
+
+// importBatch stores a batch of records in one transaction. When the
+// transaction fails the records are stored one by one instead, so a bad
+// record only fails itself. Stored and already stored fixes extend the
+// vehicle's span; a resumed job then still segments what it stored before.
+func (im *Importer) importBatch(ctx context.Context, recs []importer.Record, job *model.ImportJob, spans map[string]*importSpan) error {
+	results := make([]storeResult, len(recs))
+	err := im.svc.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		for i, rec := range recs {
+			res, err := im.svc.storeTx(ctx, tx, recordPayload(rec), true)
+			if err != nil {
+				return err
+			}
+			results[i] = res
+		}
+		return nil
+	})
+	if err == nil {
+		for i, rec := range recs {
+			im.recordResult(rec, results[i], job, spans)
+		}
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	for _, rec := range recs {
+		var res storeResult
+		err := im.svc.repo.WithTx(ctx, func(tx *repository.Repo) error {
+			var err error
+			res, err = im.svc.storeTx(ctx, tx, recordPayload(rec), true)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			im.rowFailed(job, err)
+			continue
+		}
+		im.recordResult(rec, res, job, spans)
+	}
+	return nil
+}
+
+func recordPayload(rec importer.Record) *IngestPayload {
+	return &IngestPayload{VehicleID: rec.VehicleID, PlateNumber: rec.PlateNumber, Status: rec.Status}
+}
+
+func (im *Importer) recordResult(rec importer.Record, res storeResult, job *model.ImportJob, spans map[string]*importSpan) {
+	switch res {
+	case storeStored:
+		job.Imported++
+	case storeDuplicate:
+		job.Duplicates++
+	case storeRejected:
+		job.Rejected++
+		return
+	}
+	pos, ok := parsePosition(uuid.MustParse(rec.VehicleID), rec.Status)
+	if !ok {
+		return
+	}
+	sp := spans[rec.VehicleID]
+	if sp == nil {
+		sp = &importSpan{drivers: map[int64]uuid.UUID{}}
+		spans[rec.VehicleID] = sp
+	}
+	sp.add(pos.Timestamp)
+	if d := reportedDriver(rec.Status); d != nil {
+		sp.drivers[fixKey(pos.Timestamp)] = *d
+	}
+}
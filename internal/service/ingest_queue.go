@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// IngestStream is the prefix of the partition streams; a vehicle's
+	// entries go to IngestStream:<n>
+	IngestStream     = "vehicle:ingest"
+	IngestDeadStream = "vehicle:ingest:dead"
+	IngestGroup      = "ingest-workers"
+)
+
+// IngestPoolConfig tunes the asynchronous ingest worker pool. Workers is the
+// number of partitions and must be the same on every instance.
+type IngestPoolConfig struct {
+	Workers       int
+	BatchSize     int64
+	Block         time.Duration
+	LeaseTTL      time.Duration
+	RetryDelay    time.Duration
+	MaxDeliveries int64
+	MaxLen        int64
+}
+
+// DefaultIngestPoolConfig returns the settings used when none are configured
+func DefaultIngestPoolConfig() IngestPoolConfig {
+	return IngestPoolConfig{
+		Workers:       4,
+		BatchSize:     50,
+		Block:         5 * time.Second,
+		LeaseTTL:      30 * time.Second,
+		RetryDelay:    time.Second,
+		MaxDeliveries: 5,
+		MaxLen:        1_000_000,
+	}
+}
+
+// IngestStats describes the state of the ingest streams and their consumers
+type IngestStats struct {
+	StreamLength int64 `json:"stream_length"`
+	Pending      int64 `json:"pending"`
+	Lag          int64 `json:"lag"`
+	Consumers    int64 `json:"consumers"`
+	Partitions   int64 `json:"partitions"`
+	Owned        int64 `json:"owned"`
+	Processed    int64 `json:"processed"`
+	Failed       int64 `json:"failed"`
+	Reclaimed    int64 `json:"reclaimed"`
+	DeadLettered int64 `json:"dead_lettered"`
+}
+
+// IngestPool consumes the ingest streams through a consumer group and calls
+// Service.Ingest for each entry. Entries are partitioned by vehicle and each
+// partition is consumed by a single worker at a time, across all instances,
+// so a vehicle's fixes are stored one after the other in the order they were
+// enqueued. Entries are acknowledged only after they are stored, so delivery
+// is at-least-once; a failed entry is retried before any later entry of its
+// partition.
+type IngestPool struct {
+	svc  *Service
+	rdb  *redis.Client
+	cfg  IngestPoolConfig
+	name string
+
+	owned        atomic.Int64
+	processed    atomic.Int64
+	failed       atomic.Int64
+	reclaimed    atomic.Int64
+	deadLettered atomic.Int64
+}
+
+func NewIngestPool(svc *Service, rdb *redis.Client, cfg IngestPoolConfig) *IngestPool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	host, _ := os.Hostname()
+	return &IngestPool{
+		svc:  svc,
+		rdb:  rdb,
+		cfg:  cfg,
+		name: fmt.Sprintf("%s-%s", host, randID()),
+	}
+}
+
+// ingestPartition maps a vehicle to its partition
+func ingestPartition(vehicleID string, partitions int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToLower(vehicleID)))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+func ingestStream(partition int) string {
+	return fmt.Sprintf("%s:%d", IngestStream, partition)
+}
+
+// Enqueue validates the payload and appends it to the vehicle's partition
+// stream for the worker pool to process. It returns the stream entry ID.
+func (p *IngestPool) Enqueue(ctx context.Context, payload IngestPayload) (string, error) {
+	if err := payload.Validate(); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return p.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: ingestStream(ingestPartition(payload.VehicleID, p.cfg.Workers)),
+		MaxLen: p.cfg.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": b},
+	}).Result()
+}
+
+// Run starts one worker per partition and blocks until ctx is done
+func (p *IngestPool) Run(ctx context.Context) error {
+	for i := 0; i < p.cfg.Workers; i++ {
+		err := p.rdb.XGroupCreateMkStream(ctx, ingestStream(i), IngestGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.cfg.Workers; i++ {
+		wg.Add(1)
+		go func(partition int) {
+			defer wg.Done()
+			p.work(ctx, partition)
+		}(i)
+	}
+	wg.Wait()
+	return nil
+}
+
+// The lease is only renewed or released by the instance holding it
+var (
+	renewLease = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseLease = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+// work consumes a partition while this instance holds its lease, and waits
+// for the lease otherwise
+func (p *IngestPool) work(ctx context.Context, partition int) {
+	stream := ingestStream(partition)
+	lease := stream + ":owner"
+	for ctx.Err() == nil {
+		ok, err := p.rdb.SetNX(ctx, lease, p.name, p.cfg.LeaseTTL).Result()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("ingest partition %d: lease error: %v", partition, err)
+		}
+		if !ok {
+			sleepCtx(ctx, p.cfg.Block)
+			continue
+		}
+
+		p.owned.Add(1)
+		p.consume(ctx, partition, lease)
+		p.owned.Add(-1)
+		// The context is cancelled by now, so release with a fresh one
+		_ = releaseLease.Run(context.Background(), p.rdb, []string{lease}, p.name).Err()
+	}
+}
+
+// consume processes a partition until the lease is lost or ctx is done. The
+// consumer name is fixed per partition, so a new owner first replays the
+// entries its predecessor left pending.
+func (p *IngestPool) consume(ctx context.Context, partition int, lease string) {
+	stream := ingestStream(partition)
+	consumer := fmt.Sprintf("partition-%d", partition)
+	renewed := time.Now()
+	renew := func() bool {
+		if time.Since(renewed) < p.cfg.LeaseTTL/3 {
+			return true
+		}
+		n, err := renewLease.Run(ctx, p.rdb, []string{lease}, p.name, p.cfg.LeaseTTL.Milliseconds()).Int()
+		if err != nil || n == 0 {
+			if ctx.Err() == nil {
+				log.Printf("ingest partition %d: lost lease: %v", partition, err)
+			}
+			return false
+		}
+		renewed = time.Now()
+		return true
+	}
+
+	for ctx.Err() == nil && renew() {
+		// Pending entries come first, so a retried entry is never overtaken
+		msgs, err := p.read(ctx, stream, consumer, "0", -1)
+		if err == nil && len(msgs) > 0 {
+			p.reclaimed.Add(int64(len(msgs)))
+		} else if err == nil {
+			msgs, err = p.read(ctx, stream, consumer, ">", p.cfg.Block)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("ingest partition %d: read error: %v", partition, err)
+				sleepCtx(ctx, time.Second)
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			if !p.handle(ctx, stream, msg) {
+				// Keep the rest pending behind the failed entry
+				sleepCtx(ctx, p.cfg.RetryDelay)
+				break
+			}
+			if !renew() {
+				return
+			}
+		}
+	}
+}
+
+func (p *IngestPool) read(ctx context.Context, stream, consumer, id string, block time.Duration) ([]redis.XMessage, error) {
+	res, err := p.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    IngestGroup,
+		Consumer: consumer,
+		Streams:  []string{stream, id},
+		Count:    p.cfg.BatchSize,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs []redis.XMessage
+	for _, s := range res {
+		msgs = append(msgs, s.Messages...)
+	}
+	return msgs, nil
+}
+
+// handle stores one entry and reports whether the partition can move on
+func (p *IngestPool) handle(ctx context.Context, stream string, msg redis.XMessage) bool {
+	raw, _ := msg.Values["payload"].(string)
+	var payload IngestPayload
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		return p.deadLetter(ctx, stream, msg.ID, "malformed payload: "+err.Error())
+	}
+
+	if err := p.svc.Ingest(ctx, payload); err != nil {
+		p.failed.Add(1)
+		if errors.Is(err, ErrInvalidPayload) {
+			return p.deadLetter(ctx, stream, msg.ID, err.Error())
+		}
+		log.Printf("ingest worker: entry %s failed: %v", msg.ID, err)
+		if p.deliveries(ctx, stream, msg.ID) >= p.cfg.MaxDeliveries {
+			return p.deadLetter(ctx, stream, msg.ID, fmt.Sprintf("exceeded %d deliveries", p.cfg.MaxDeliveries))
+		}
+		// Leave the entry pending so it is retried first
+		return false
+	}
+
+	if err := p.rdb.XAck(ctx, stream, IngestGroup, msg.ID).Err(); err != nil {
+		log.Printf("ingest worker: ack %s: %v", msg.ID, err)
+		return false
+	}
+	p.processed.Add(1)
+	return true
+}
+
+// deliveries returns how often the pending entry was delivered
+func (p *IngestPool) deliveries(ctx context.Context, stream, id string) int64 {
+	pending, err := p.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  IngestGroup,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return pending[0].RetryCount
+}
+
+// deadLetter copies the entry to the dead-letter stream and acknowledges it
+func (p *IngestPool) deadLetter(ctx context.Context, stream, id, reason string) bool {
+	values := map[string]interface{}{"id": id, "stream": stream, "reason": reason}
+	if msgs, err := p.rdb.XRange(ctx, stream, id, id).Result(); err == nil && len(msgs) == 1 {
+		values["payload"] = msgs[0].Values["payload"]
+	}
+	if err := p.rdb.XAdd(ctx, &redis.XAddArgs{Stream: IngestDeadStream, Values: values}).Err(); err != nil {
+		log.Printf("ingest worker: dead-letter %s: %v", id, err)
+		return false
+	}
+	if err := p.rdb.XAck(ctx, stream, IngestGroup, id).Err(); err != nil {
+		log.Printf("ingest worker: ack %s: %v", id, err)
+		return false
+	}
+	p.deadLettered.Add(1)
+	return true
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// Stats reports stream length, consumer-group lag and pool counters summed
+// over the partitions
+func (p *IngestPool) Stats(ctx context.Context) (IngestStats, error) {
+	st := IngestStats{
+		Partitions:   int64(p.cfg.Workers),
+		Owned:        p.owned.Load(),
+		Processed:    p.processed.Load(),
+		Failed:       p.failed.Load(),
+		Reclaimed:    p.reclaimed.Load(),
+		DeadLettered: p.deadLettered.Load(),
+	}
+
+	for i := 0; i < p.cfg.Workers; i++ {
+		stream := ingestStream(i)
+		n, err := p.rdb.XLen(ctx, stream).Result()
+		if err != nil {
+			return st, err
+		}
+		st.StreamLength += n
+
+		groups, err := p.rdb.XInfoGroups(ctx, stream).Result()
+		if err != nil {
+			return st, err
+		}
+		for _, g := range groups {
+			if g.Name == IngestGroup {
+				st.Pending += g.Pending
+				st.Lag += g.Lag
+				st.Consumers += g.Consumers
+			}
+		}
+	}
+	return st, nil
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestPartition(t *testing.T) {
+	id := uuid.NewString()
+	p := ingestPartition(id, 8)
+	assert.Equal(t, p, ingestPartition(strings.ToUpper(id), 8), "a vehicle always maps to the same partition")
+	assert.Equal(t, "vehicle:ingest:3", ingestStream(3))
+
+	seen := map[int]bool{}
+	for i := 0; i < 200; i++ {
+		n := ingestPartition(uuid.NewString(), 8)
+		assert.True(t, n >= 0 && n < 8)
+		seen[n] = true
+	}
+	assert.Len(t, seen, 8, "vehicles spread over all partitions")
+}
@@ -0,0 +1,511 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidJob is returned for an invalid job, assignment, status change or upload
+var ErrInvalidJob = errors.New("invalid job input")
+
+// MaxAttachmentBytes limits the size of a proof-of-delivery upload
+const MaxAttachmentBytes = 10 << 20
+
+// attachmentTypes are the content types accepted as proof of delivery
+var attachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/webp":      true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+// DispatchParams controls job stop detection and ETAs
+type DispatchParams struct {
+	RadiusM      float64 // stop radius when a job does not set one
+	ExitSlackM   float64 // distance beyond the radius a vehicle must go to have left
+	DetourFactor float64 // road distance per straight-line metre
+	MinSpeedKmh  float64 // slower vehicles are assumed to travel at CruiseKmh
+	CruiseKmh    float64
+}
+
+// DefaultDispatchParams returns the parameters used on ingest and for ETAs
+func DefaultDispatchParams() DispatchParams {
+	return DispatchParams{RadiusM: 150, ExitSlackM: 50, DetourFactor: 1.3, MinSpeedKmh: 15, CruiseKmh: 40}
+}
+
+// SetAttachmentStore sets where proof-of-delivery files are kept
+func (s *Service) SetAttachmentStore(st storage.Store) {
+	s.attachments = st
+}
+
+// JobStopInput describes the pickup or drop of a new job
+type JobStopInput struct {
+	Location    [2]float64 `json:"location"` // lon, lat
+	Address     string     `json:"address"`
+	RadiusM     *float64   `json:"radius_m"`
+	WindowStart *time.Time `json:"window_start"`
+	WindowEnd   *time.Time `json:"window_end"`
+}
+
+// JobInput describes a new job; with a VehicleID it starts assigned
+type JobInput struct {
+	Reference   string       `json:"reference"`
+	Description string       `json:"description"`
+	Priority    string       `json:"priority"`
+	VehicleID   string       `json:"vehicle_id"`
+	Pickup      JobStopInput `json:"pickup"`
+	Drop        JobStopInput `json:"drop"`
+}
+
+func (in JobStopInput) stop(name string, p DispatchParams) (model.JobStop, error) {
+	st := model.JobStop{
+		Location:    in.Location,
+		Address:     strings.TrimSpace(in.Address),
+		RadiusM:     p.RadiusM,
+		WindowStart: in.WindowStart,
+		WindowEnd:   in.WindowEnd,
+	}
+	lon, lat := in.Location[0], in.Location[1]
+	if lon < -180 || lon > 180 || lat < -90 || lat > 90 || (lon == 0 && lat == 0) {
+		return st, fmt.Errorf("%w: %s location must be [lon, lat]", ErrInvalidJob, name)
+	}
+	if in.RadiusM != nil {
+		if *in.RadiusM <= 0 || *in.RadiusM > 5000 {
+			return st, fmt.Errorf("%w: %s radius_m must be between 0 and 5000", ErrInvalidJob, name)
+		}
+		st.RadiusM = *in.RadiusM
+	}
+	if st.WindowStart != nil && st.WindowEnd != nil && !st.WindowStart.Before(*st.WindowEnd) {
+		return st, fmt.Errorf("%w: %s window_start must be before window_end", ErrInvalidJob, name)
+	}
+	return st, nil
+}
+
+func validPriority(p string) bool {
+	switch p {
+	case model.JobPriorityLow, model.JobPriorityNormal, model.JobPriorityHigh, model.JobPriorityUrgent:
+		return true
+	}
+	return false
+}
+
+func (in JobInput) job(now time.Time, p DispatchParams) (model.Job, error) {
+	j := model.Job{
+		ID:          uuid.New(),
+		Reference:   strings.TrimSpace(in.Reference),
+		Description: strings.TrimSpace(in.Description),
+		Priority:    in.Priority,
+		Status:      model.JobPending,
+		StatusAt:    now,
+		CreatedAt:   now,
+	}
+	if j.Priority == "" {
+		j.Priority = model.JobPriorityNormal
+	}
+	if !validPriority(j.Priority) {
+		return j, fmt.Errorf("%w: priority must be low, normal, high or urgent", ErrInvalidJob)
+	}
+	var err error
+	if j.Pickup, err = in.Pickup.stop("pickup", p); err != nil {
+		return j, err
+	}
+	if j.Drop, err = in.Drop.stop("drop", p); err != nil {
+		return j, err
+	}
+	if in.VehicleID != "" {
+		id, err := uuid.Parse(in.VehicleID)
+		if err != nil {
+			return j, fmt.Errorf("%w: invalid vehicle_id", ErrInvalidJob)
+		}
+		j.VehicleID, j.AssignedAt, j.Status = &id, &now, model.JobAssigned
+	}
+	return j, nil
+}
+
+// jobRank orders statuses; cancelled ranks after every other
+func jobRank(status string) int {
+	for i, s := range model.JobStatuses {
+		if s == status {
+			return i
+		}
+	}
+	return -1
+}
+
+func jobDone(status string) bool {
+	return status == model.JobDelivered || status == model.JobCancelled
+}
+
+// transition moves a job to status at a time, stamping the milestone the
+// status marks unless it already has one
+func transition(j *model.Job, status string, at time.Time) {
+	stamp := func(t **time.Time) {
+		if *t == nil {
+			v := at
+			*t = &v
+		}
+	}
+	switch status {
+	case model.JobAtPickup:
+		stamp(&j.Pickup.ArrivedAt)
+	case model.JobPickedUp:
+		stamp(&j.Pickup.DepartedAt)
+	case model.JobAtDrop:
+		stamp(&j.Drop.ArrivedAt)
+	case model.JobDelivered:
+		stamp(&j.DeliveredAt)
+	case model.JobCancelled:
+		stamp(&j.CancelledAt)
+	}
+	j.Status, j.StatusAt = status, at
+}
+
+// advanceJob moves a job on by a fix of its vehicle: into a stop's radius
+// is arriving there and beyond the radius plus ExitSlackM is leaving. Leaving
+// the drop only records the departure; the job stays at_drop until proof of
+// delivery or a status call delivers it. Fixes no newer than the last status
+// change are ignored.
+func advanceJob(j model.Job, pos model.Position, p DispatchParams) (model.Job, bool) {
+	if !pos.Timestamp.After(j.StatusAt) {
+		return j, false
+	}
+	at := geo.FromLonLat(pos.Location)
+	inside := func(st model.JobStop) bool { return geo.Distance(at, geo.FromLonLat(st.Location)) <= st.RadiusM }
+	left := func(st model.JobStop) bool {
+		return geo.Distance(at, geo.FromLonLat(st.Location)) > st.RadiusM+p.ExitSlackM
+	}
+	switch {
+	case j.Status == model.JobAssigned && inside(j.Pickup):
+		transition(&j, model.JobAtPickup, pos.Timestamp)
+	case j.Status == model.JobAtPickup && left(j.Pickup):
+		transition(&j, model.JobPickedUp, pos.Timestamp)
+	case j.Status == model.JobPickedUp && inside(j.Drop):
+		transition(&j, model.JobAtDrop, pos.Timestamp)
+	case j.Status == model.JobAtDrop && j.Drop.DepartedAt == nil && left(j.Drop):
+		j.Drop.DepartedAt = &pos.Timestamp
+	default:
+		return j, false
+	}
+	return j, true
+}
+
+func jobEvent(j model.Job, from string) (model.Event, error) {
+	var vid uuid.UUID
+	if j.VehicleID != nil {
+		vid = *j.VehicleID
+	}
+	return model.NewEvent(model.EventJobStatusChanged, vid, map[string]interface{}{
+		"job_id":     j.ID,
+		"reference":  j.Reference,
+		"vehicle_id": j.VehicleID,
+		"from":       from,
+		"to":         j.Status,
+		"at":         j.StatusAt,
+	})
+}
+
+// advanceJobs moves on the active jobs of the vehicle of a newly stored fix
+// and returns an event for every status change
+func advanceJobs(ctx context.Context, tx *repository.Repo, pos model.Position) ([]model.Event, error) {
+	jobs, err := tx.ActiveJobs(ctx, pos.VehicleID.String())
+	if err != nil {
+		return nil, err
+	}
+	var events []model.Event
+	for _, j := range jobs {
+		next, changed := advanceJob(j, pos, DefaultDispatchParams())
+		if !changed {
+			continue
+		}
+		if err := tx.SaveJob(ctx, next); err != nil {
+			return nil, err
+		}
+		if next.Status == j.Status {
+			continue
+		}
+		e, err := jobEvent(next, j.Status)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// jobETA estimates when the vehicle at pos reaches the next stop of a job
+// it has not reached yet: the straight-line distance stretched by the
+// detour factor at the vehicle's speed, or the cruise speed while it is
+// slower. It is nil for jobs that are not heading to a stop.
+func jobETA(j model.Job, pos model.Position, now time.Time, p DispatchParams) *model.JobETA {
+	name, stop := "", model.JobStop{}
+	switch j.Status {
+	case model.JobAssigned:
+		name, stop = "pickup", j.Pickup
+	case model.JobAtPickup, model.JobPickedUp:
+		name, stop = "drop", j.Drop
+	default:
+		return nil
+	}
+	dist := geo.Distance(geo.FromLonLat(pos.Location), geo.FromLonLat(stop.Location)) * p.DetourFactor
+	speed := pos.Speed
+	if speed < p.MinSpeedKmh {
+		speed = p.CruiseKmh
+	}
+	eta := &model.JobETA{
+		Stop:       name,
+		DistanceM:  math.Round(dist),
+		SpeedKmh:   speed,
+		ArrivalAt:  now.Add(time.Duration(dist / (speed / 3.6) * float64(time.Second))).Round(time.Second),
+		PositionAt: pos.Timestamp,
+	}
+	eta.Late = stop.WindowEnd != nil && eta.ArrivalAt.After(*stop.WindowEnd)
+	return eta
+}
+
+// withETAs fills in the ETA of jobs heading to a stop from their vehicles'
+// latest fixes
+func (s *Service) withETAs(ctx context.Context, jobs []model.Job) error {
+	var ids []uuid.UUID
+	for _, j := range jobs {
+		if j.VehicleID != nil && !jobDone(j.Status) {
+			ids = append(ids, *j.VehicleID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	latest, err := s.repo.LatestPositions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for i, j := range jobs {
+		if j.VehicleID == nil {
+			continue
+		}
+		if pos, ok := latest[*j.VehicleID]; ok {
+			jobs[i].ETA = jobETA(j, pos, now, DefaultDispatchParams())
+		}
+	}
+	return nil
+}
+
+// CreateJob adds a dispatch job
+func (s *Service) CreateJob(ctx context.Context, in JobInput) (model.Job, error) {
+	j, err := in.job(time.Now().UTC(), DefaultDispatchParams())
+	if err != nil {
+		return j, err
+	}
+	if err := s.repo.CreateJob(ctx, j); err != nil {
+		return j, err
+	}
+	return j, nil
+}
+
+// GetJob returns a job with its attachments and ETA
+func (s *Service) GetJob(ctx context.Context, id string) (model.Job, error) {
+	j, err := s.repo.GetJob(ctx, id)
+	if err != nil {
+		return j, err
+	}
+	if j.Attachments, err = s.repo.GetJobAttachments(ctx, id); err != nil {
+		return j, err
+	}
+	jobs := []model.Job{j}
+	err = s.withETAs(ctx, jobs)
+	return jobs[0], err
+}
+
+// ListJobs returns jobs with their ETAs, most urgent first
+func (s *Service) ListJobs(ctx context.Context, q repository.JobQuery) ([]model.Job, error) {
+	if q.Status != "" && q.Status != "active" && jobRank(q.Status) < 0 {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidJob, q.Status)
+	}
+	if q.Priority != "" && !validPriority(q.Priority) {
+		return nil, fmt.Errorf("%w: priority must be low, normal, high or urgent", ErrInvalidJob)
+	}
+	if _, err := uuid.Parse(q.VehicleID); q.VehicleID != "" && err != nil {
+		return nil, fmt.Errorf("%w: invalid vehicle_id", ErrInvalidJob)
+	}
+	if !q.From.IsZero() {
+		if err := ValidateRange(q.From, q.To, 0); err != nil {
+			return nil, err
+		}
+	}
+	if q.Limit <= 0 || q.Limit > 500 {
+		return nil, fmt.Errorf("%w: limit must be between 1 and 500", ErrInvalidJob)
+	}
+	jobs, err := s.repo.ListJobs(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return jobs, s.withETAs(ctx, jobs)
+}
+
+// updateJob applies fn to a locked job and stores it with an event when
+// its status changed
+func (s *Service) updateJob(ctx context.Context, id string, fn func(tx *repository.Repo, j *model.Job) error) (model.Job, error) {
+	var res model.Job
+	err := s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		j, err := tx.GetJobForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		from := j.Status
+		if err := fn(tx, &j); err != nil {
+			return err
+		}
+		if err := tx.SaveJob(ctx, j); err != nil {
+			return err
+		}
+		res = j
+		if j.Status == from || j.VehicleID == nil {
+			return nil
+		}
+		e, err := jobEvent(j, from)
+		if err != nil {
+			return err
+		}
+		return tx.InsertEvents(ctx, e)
+	})
+	return res, err
+}
+
+// AssignJob assigns a job that has not reached its pickup to a vehicle, or
+// returns it to pending with an empty vehicleID
+func (s *Service) AssignJob(ctx context.Context, id, vehicleID string) (model.Job, error) {
+	var vid *uuid.UUID
+	if vehicleID != "" {
+		v, err := uuid.Parse(vehicleID)
+		if err != nil {
+			return model.Job{}, fmt.Errorf("%w: invalid vehicle_id", ErrInvalidJob)
+		}
+		vid = &v
+	}
+	return s.updateJob(ctx, id, func(_ *repository.Repo, j *model.Job) error {
+		if j.Status != model.JobPending && j.Status != model.JobAssigned {
+			return fmt.Errorf("%w: a job can only be reassigned before its pickup, it is %s", ErrInvalidJob, j.Status)
+		}
+		now := time.Now().UTC()
+		j.VehicleID, j.Status, j.StatusAt = vid, model.JobAssigned, now
+		j.AssignedAt = &now
+		if vid == nil {
+			j.Status, j.AssignedAt = model.JobPending, nil
+		}
+		return nil
+	})
+}
+
+// SetJobStatus moves a job forward by hand, for stops the vehicle's fixes
+// missed, or cancels it
+func (s *Service) SetJobStatus(ctx context.Context, id, status string) (model.Job, error) {
+	if jobRank(status) <= jobRank(model.JobAssigned) {
+		return model.Job{}, fmt.Errorf("%w: status must be at_pickup, picked_up, at_drop, delivered or cancelled", ErrInvalidJob)
+	}
+	return s.updateJob(ctx, id, func(_ *repository.Repo, j *model.Job) error {
+		switch {
+		case jobDone(j.Status):
+			return fmt.Errorf("%w: the job is already %s", ErrInvalidJob, j.Status)
+		case status == model.JobCancelled:
+		case j.VehicleID == nil:
+			return fmt.Errorf("%w: the job is not assigned", ErrInvalidJob)
+		case jobRank(status) <= jobRank(j.Status):
+			return fmt.Errorf("%w: the job is already %s", ErrInvalidJob, j.Status)
+		}
+		transition(j, status, time.Now().UTC())
+		return nil
+	})
+}
+
+// AddJobAttachment stores a proof-of-delivery signature or photo of a job
+// that has been picked up. The content type is sniffed from the file. A
+// signature completes the delivery of a job picked up or at its drop; a
+// photo only does when deliver is set.
+func (s *Service) AddJobAttachment(ctx context.Context, jobID, kind, name string, size int64, r io.Reader, deliver bool) (model.JobAttachment, error) {
+	var a model.JobAttachment
+	if kind == "" {
+		kind = model.AttachmentPhoto
+	}
+	if kind != model.AttachmentSignature && kind != model.AttachmentPhoto {
+		return a, fmt.Errorf("%w: kind must be signature or photo", ErrInvalidJob)
+	}
+	if size <= 0 || size > MaxAttachmentBytes {
+		return a, fmt.Errorf("%w: file must be between 1 byte and %d MB", ErrInvalidJob, MaxAttachmentBytes>>20)
+	}
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	ct := http.DetectContentType(head)
+	if !attachmentTypes[ct] {
+		return a, fmt.Errorf("%w: %s files are not accepted, upload a PNG, JPEG, WebP, GIF or PDF", ErrInvalidJob, ct)
+	}
+	if s.attachments == nil {
+		return a, errors.New("attachment storage is not configured")
+	}
+	j, err := s.repo.GetJob(ctx, jobID)
+	if err != nil {
+		return a, err
+	}
+	if jobRank(j.Status) < jobRank(model.JobPickedUp) || j.Status == model.JobCancelled {
+		return a, fmt.Errorf("%w: proof of delivery needs a picked up job, it is %s", ErrInvalidJob, j.Status)
+	}
+
+	a = model.JobAttachment{
+		ID:          uuid.New(),
+		JobID:       j.ID,
+		Kind:        kind,
+		FileName:    path.Base(strings.ReplaceAll(name, `\`, "/")),
+		ContentType: ct,
+		SizeBytes:   size,
+		CreatedAt:   time.Now().UTC(),
+	}
+	a.StorageKey = "jobs/" + j.ID.String() + "/" + a.ID.String()
+	if err := s.attachments.Put(ctx, a.StorageKey, ct, io.LimitReader(br, size), size); err != nil {
+		return a, err
+	}
+	_, err = s.updateJob(ctx, jobID, func(tx *repository.Repo, j *model.Job) error {
+		if err := tx.InsertJobAttachment(ctx, a); err != nil {
+			return err
+		}
+		if (kind == model.AttachmentSignature || deliver) && (j.Status == model.JobPickedUp || j.Status == model.JobAtDrop) {
+			transition(j, model.JobDelivered, a.CreatedAt)
+		}
+		return nil
+	})
+	if err != nil {
+		// Nothing refers to the file without its row
+		if derr := s.attachments.Delete(context.WithoutCancel(ctx), a.StorageKey); derr != nil {
+			log.Printf("job %s: delete attachment %s: %v", jobID, a.StorageKey, derr)
+		}
+	}
+	return a, err
+}
+
+// OpenJobAttachment returns an attachment of a job and its content
+func (s *Service) OpenJobAttachment(ctx context.Context, jobID, id string) (model.JobAttachment, io.ReadCloser, error) {
+	a, err := s.repo.GetJobAttachment(ctx, jobID, id)
+	if err != nil {
+		return a, nil, err
+	}
+	if s.attachments == nil {
+		return a, nil, errors.New("attachment storage is not configured")
+	}
+	rc, err := s.attachments.Open(ctx, a.StorageKey)
+	return a, rc, err
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvanceJob(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	pickup := geo.Point{Lat: 25.2, Lon: 55.27}
+	drop := geo.Destination(pickup, 90, 5000)
+	p := DefaultDispatchParams()
+	j, err := JobInput{
+		VehicleID: uuid.NewString(),
+		Pickup:    JobStopInput{Location: pickup.LonLat()},
+		Drop:      JobStopInput{Location: drop.LonLat()},
+	}.job(t0, p)
+	require.NoError(t, err)
+	require.Equal(t, model.JobAssigned, j.Status)
+
+	sec := 0
+	fix := func(at geo.Point) model.Position {
+		sec += 60
+		return model.Position{Location: at.LonLat(), Timestamp: t0.Add(time.Duration(sec) * time.Second)}
+	}
+	var statuses []string
+	for _, at := range []geo.Point{
+		geo.Destination(pickup, 270, 1000), // on the way
+		geo.Destination(pickup, 270, 100),  // inside the pickup radius
+		geo.Destination(pickup, 90, 180),   // past the radius but within the slack
+		geo.Destination(pickup, 90, 250),   // left the pickup
+		geo.Destination(drop, 270, 120),    // at the drop
+		geo.Destination(drop, 90, 300),     // left the drop
+		drop,
+	} {
+		next, changed := advanceJob(j, fix(at), p)
+		if changed {
+			statuses = append(statuses, next.Status)
+		}
+		j = next
+	}
+	// Leaving the drop without proof of delivery records the departure only
+	assert.Equal(t, []string{model.JobAtPickup, model.JobPickedUp, model.JobAtDrop, model.JobAtDrop}, statuses)
+	assert.Equal(t, model.JobAtDrop, j.Status)
+	assert.Equal(t, t0.Add(2*time.Minute), *j.Pickup.ArrivedAt)
+	assert.Equal(t, t0.Add(4*time.Minute), *j.Pickup.DepartedAt)
+	assert.Equal(t, t0.Add(5*time.Minute), *j.Drop.ArrivedAt)
+	assert.Equal(t, t0.Add(6*time.Minute), *j.Drop.DepartedAt)
+	assert.Nil(t, j.DeliveredAt)
+	_, changed := advanceJob(j, fix(geo.Destination(drop, 90, 400)), p)
+	assert.False(t, changed, "the departure is recorded once")
+
+	stale := model.Job{Status: model.JobAssigned, StatusAt: t0.Add(time.Hour), Pickup: j.Pickup, Drop: j.Drop}
+	_, changed = advanceJob(stale, model.Position{Location: pickup.LonLat(), Timestamp: t0}, p)
+	assert.False(t, changed, "fixes older than the last change are ignored")
+}
+
+func TestJobETA(t *testing.T) {
+	now := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	pickup := geo.Point{Lat: 25.2, Lon: 55.27}
+	end := now.Add(10 * time.Minute)
+	j := model.Job{Status: model.JobAssigned, Pickup: model.JobStop{Location: pickup.LonLat(), WindowEnd: &end}}
+	p := DefaultDispatchParams()
+
+	pos := model.Position{Location: geo.Destination(pickup, 0, 10000).LonLat(), Speed: 60, Timestamp: now}
+	eta := jobETA(j, pos, now, p)
+	require.NotNil(t, eta)
+	assert.Equal(t, "pickup", eta.Stop)
+	assert.InDelta(t, 13000, eta.DistanceM, 1)
+	assert.Equal(t, now.Add(13*time.Minute), eta.ArrivalAt, "13 km at 60 km/h")
+	assert.True(t, eta.Late)
+
+	pos.Speed = 0
+	eta = jobETA(j, pos, now, p)
+	assert.Equal(t, 40.0, eta.SpeedKmh, "a stopped vehicle is assumed to cruise")
+
+	j.Status = model.JobDelivered
+	assert.Nil(t, jobETA(j, pos, now, p))
+}
+
+func TestJobInput(t *testing.T) {
+	ok := JobStopInput{Location: [2]float64{55.27, 25.2}}
+	_, err := JobInput{Pickup: ok, Drop: JobStopInput{}}.job(time.Now(), DefaultDispatchParams())
+	assert.ErrorIs(t, err, ErrInvalidJob, "drop location missing")
+	_, err = JobInput{Pickup: ok, Drop: ok, Priority: "asap"}.job(time.Now(), DefaultDispatchParams())
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	j, err := JobInput{Pickup: ok, Drop: ok}.job(time.Now(), DefaultDispatchParams())
+	require.NoError(t, err)
+	assert.Equal(t, model.JobPending, j.Status)
+	assert.Equal(t, model.JobPriorityNormal, j.Priority)
+	assert.Equal(t, 150.0, j.Drop.RadiusM)
+}
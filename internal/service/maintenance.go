@@ -0,0 +1,458 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidMaintenance is returned for an invalid plan, service record or filter
+var ErrInvalidMaintenance = errors.New("invalid maintenance input")
+
+// defaultDueSoonRatio is the share of an interval before it falls due that a
+// plan turns due soon when no margin is given
+const defaultDueSoonRatio = 0.1
+
+// PlanInput describes a new maintenance plan. Exactly one of VehicleID and
+// GroupID is set; nil due-soon margins default to a tenth of the interval.
+type PlanInput struct {
+	Name          string   `json:"name"`
+	VehicleID     string   `json:"vehicle_id"`
+	GroupID       string   `json:"group_id"`
+	IntervalKm    *float64 `json:"interval_km"`
+	IntervalHours *float64 `json:"interval_hours"`
+	IntervalDays  *int     `json:"interval_days"`
+	DueSoonKm     *float64 `json:"due_soon_km"`
+	DueSoonHours  *float64 `json:"due_soon_hours"`
+	DueSoonDays   *int     `json:"due_soon_days"`
+}
+
+// ServiceInput describes work done on a vehicle. Missing meters default to
+// the current ones and a missing time to now.
+type ServiceInput struct {
+	PlanID      string     `json:"plan_id"`
+	PerformedAt *time.Time `json:"performed_at"`
+	OdometerKm  *float64   `json:"odometer_km"`
+	EngineHours *float64   `json:"engine_hours"`
+	Notes       string     `json:"notes"`
+	Cost        *float64   `json:"cost"`
+}
+
+func (in PlanInput) plan() (model.MaintenancePlan, error) {
+	p := model.MaintenancePlan{
+		ID:            uuid.New(),
+		Name:          strings.TrimSpace(in.Name),
+		IntervalKm:    in.IntervalKm,
+		IntervalHours: in.IntervalHours,
+		IntervalDays:  in.IntervalDays,
+		CreatedAt:     time.Now().UTC(),
+	}
+	invalid := func(msg string) (model.MaintenancePlan, error) {
+		return model.MaintenancePlan{}, fmt.Errorf("%w: %s", ErrInvalidMaintenance, msg)
+	}
+	if p.Name == "" {
+		return invalid("name required")
+	}
+	if (in.VehicleID == "") == (in.GroupID == "") {
+		return invalid("exactly one of vehicle_id and group_id required")
+	}
+	for _, v := range []struct {
+		id  string
+		dst **uuid.UUID
+	}{{in.VehicleID, &p.VehicleID}, {in.GroupID, &p.GroupID}} {
+		if v.id == "" {
+			continue
+		}
+		id, err := uuid.Parse(v.id)
+		if err != nil {
+			return invalid("invalid id " + v.id)
+		}
+		*v.dst = &id
+	}
+	if p.IntervalKm == nil && p.IntervalHours == nil && p.IntervalDays == nil {
+		return invalid("at least one of interval_km, interval_hours and interval_days required")
+	}
+
+	var err error
+	if p.DueSoonKm, err = dueSoonMargin("km", p.IntervalKm, in.DueSoonKm); err != nil {
+		return model.MaintenancePlan{}, err
+	}
+	if p.DueSoonHours, err = dueSoonMargin("hours", p.IntervalHours, in.DueSoonHours); err != nil {
+		return model.MaintenancePlan{}, err
+	}
+	var days, daysMargin *float64
+	if p.IntervalDays != nil {
+		v := float64(*p.IntervalDays)
+		days = &v
+	}
+	if in.DueSoonDays != nil {
+		v := float64(*in.DueSoonDays)
+		daysMargin = &v
+	}
+	m, err := dueSoonMargin("days", days, daysMargin)
+	if err != nil {
+		return model.MaintenancePlan{}, err
+	}
+	p.DueSoonDays = int(math.Ceil(m))
+	return p, nil
+}
+
+// dueSoonMargin validates an interval and its due-soon margin
+func dueSoonMargin(unit string, interval, margin *float64) (float64, error) {
+	switch {
+	case interval == nil && margin != nil:
+		return 0, fmt.Errorf("%w: due_soon_%s without interval_%s", ErrInvalidMaintenance, unit, unit)
+	case interval == nil:
+		return 0, nil
+	case *interval <= 0:
+		return 0, fmt.Errorf("%w: interval_%s must be positive", ErrInvalidMaintenance, unit)
+	case margin == nil:
+		return *interval * defaultDueSoonRatio, nil
+	case *margin < 0 || *margin >= *interval:
+		return 0, fmt.Errorf("%w: due_soon_%s must be at least 0 and less than the interval", ErrInvalidMaintenance, unit)
+	}
+	return *margin, nil
+}
+
+// stateRank orders maintenance states from best to worst
+func stateRank(s string) int {
+	switch s {
+	case model.MaintenanceOverdue:
+		return 2
+	case model.MaintenanceDueSoon:
+		return 1
+	}
+	return 0
+}
+
+// dueState computes when a plan next falls due for a vehicle and whether it
+// is due soon or overdue, whichever of distance, engine hours and time
+// comes first
+func dueState(t repository.MaintenanceTarget, base repository.MaintenanceStatus, now time.Time) model.MaintenanceDue {
+	p := t.Plan
+	d := model.MaintenanceDue{
+		PlanID:          p.ID,
+		PlanName:        p.Name,
+		VehicleID:       t.VehicleID,
+		State:           model.MaintenanceOK,
+		BaseAt:          base.BaseAt,
+		BaseOdometerKm:  base.BaseOdometerKm,
+		BaseEngineHours: base.BaseEngineHours,
+		LastServiceID:   base.BaseServiceID,
+	}
+	check := func(remaining, margin float64) {
+		s := model.MaintenanceOK
+		switch {
+		case remaining <= 0:
+			s = model.MaintenanceOverdue
+		case remaining <= margin:
+			s = model.MaintenanceDueSoon
+		}
+		if stateRank(s) > stateRank(d.State) {
+			d.State = s
+		}
+	}
+	if p.IntervalKm != nil {
+		due := base.BaseOdometerKm + *p.IntervalKm
+		rem := due - t.OdometerKm
+		d.DueOdometerKm, d.RemainingKm = &due, &rem
+		check(rem, p.DueSoonKm)
+	}
+	if p.IntervalHours != nil {
+		due := base.BaseEngineHours + *p.IntervalHours
+		rem := due - t.EngineHours
+		d.DueEngineHours, d.RemainingHours = &due, &rem
+		check(rem, p.DueSoonHours)
+	}
+	if p.IntervalDays != nil {
+		due := base.BaseAt.AddDate(0, 0, *p.IntervalDays)
+		rem := due.Sub(now).Hours() / 24
+		d.DueAt, d.RemainingDays = &due, &rem
+		check(rem, float64(p.DueSoonDays))
+	}
+	return d
+}
+
+// baseOf is the stored base of a target, or the plan starting to apply now
+// at the vehicle's current meters
+func baseOf(t repository.MaintenanceTarget, now time.Time) repository.MaintenanceStatus {
+	if t.Status != nil {
+		return *t.Status
+	}
+	return repository.MaintenanceStatus{
+		BaseAt:          now,
+		BaseOdometerKm:  t.OdometerKm,
+		BaseEngineHours: t.EngineHours,
+		State:           model.MaintenanceOK,
+		NotifiedState:   model.MaintenanceOK,
+	}
+}
+
+// CreatePlan adds a maintenance plan for a vehicle or group
+func (s *Service) CreatePlan(ctx context.Context, in PlanInput) (model.MaintenancePlan, error) {
+	p, err := in.plan()
+	if err != nil {
+		return p, err
+	}
+	return p, s.repo.CreatePlan(ctx, p)
+}
+
+// ListPlans lists maintenance plans, optionally of one vehicle or group
+func (s *Service) ListPlans(ctx context.Context, vehicleID, groupID string) ([]model.MaintenancePlan, error) {
+	return s.repo.ListPlans(ctx, vehicleID, groupID)
+}
+
+// DeletePlan removes a maintenance plan
+func (s *Service) DeletePlan(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return repository.ErrPlanNotFound
+	}
+	return s.repo.DeletePlan(ctx, id)
+}
+
+// GetVehicleMaintenance returns when each plan applying to a vehicle falls
+// due, computed from the current meters
+func (s *Service) GetVehicleMaintenance(ctx context.Context, vehicleID string) ([]model.MaintenanceDue, error) {
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return nil, repository.ErrNoVehicleFound
+	}
+	if _, err := s.repo.GetMeters(ctx, vehicleID); err != nil {
+		return nil, err
+	}
+	return s.maintenanceDue(ctx, repository.MaintenanceFilter{VehicleID: vehicleID}, "")
+}
+
+// GetDueMaintenance returns the plans due soon or overdue across the fleet,
+// optionally only one state or group
+func (s *Service) GetDueMaintenance(ctx context.Context, state, groupID string) ([]model.MaintenanceDue, error) {
+	if state != "" && state != model.MaintenanceDueSoon && state != model.MaintenanceOverdue {
+		return nil, fmt.Errorf("%w: state must be due_soon or overdue", ErrInvalidMaintenance)
+	}
+	if groupID != "" {
+		if _, err := uuid.Parse(groupID); err != nil {
+			return nil, fmt.Errorf("%w: invalid group_id", ErrInvalidMaintenance)
+		}
+	}
+	due, err := s.maintenanceDue(ctx, repository.MaintenanceFilter{GroupID: groupID}, state)
+	if err != nil {
+		return nil, err
+	}
+	out := due[:0]
+	for _, d := range due {
+		if d.State != model.MaintenanceOK {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) maintenanceDue(ctx context.Context, f repository.MaintenanceFilter, state string) ([]model.MaintenanceDue, error) {
+	targets, err := s.repo.MaintenanceTargets(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	res := []model.MaintenanceDue{}
+	for _, t := range targets {
+		d := dueState(t, baseOf(t, now), now)
+		if state == "" || d.State == state {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+
+// AddServiceRecord records work done on a vehicle. Work under a plan
+// restarts the plan's interval from the record unless a later service is
+// already recorded.
+func (s *Service) AddServiceRecord(ctx context.Context, vehicleID string, in ServiceInput, actor string) (model.ServiceRecord, error) {
+	vid, err := uuid.Parse(vehicleID)
+	if err != nil {
+		return model.ServiceRecord{}, repository.ErrNoVehicleFound
+	}
+	now := time.Now().UTC()
+	rec := model.ServiceRecord{
+		ID:          uuid.New(),
+		VehicleID:   vid,
+		PerformedAt: now,
+		Notes:       in.Notes,
+		Cost:        in.Cost,
+		RecordedBy:  actor,
+		CreatedAt:   now,
+	}
+	switch {
+	case in.PerformedAt != nil && in.PerformedAt.After(now):
+		return rec, fmt.Errorf("%w: performed_at is in the future", ErrInvalidMaintenance)
+	case in.OdometerKm != nil && *in.OdometerKm < 0, in.EngineHours != nil && *in.EngineHours < 0:
+		return rec, fmt.Errorf("%w: meters cannot be negative", ErrInvalidMaintenance)
+	case in.Cost != nil && *in.Cost < 0:
+		return rec, fmt.Errorf("%w: cost cannot be negative", ErrInvalidMaintenance)
+	}
+	if in.PerformedAt != nil {
+		rec.PerformedAt = in.PerformedAt.UTC()
+	}
+	if in.PlanID != "" {
+		id, err := uuid.Parse(in.PlanID)
+		if err != nil {
+			return rec, repository.ErrPlanNotFound
+		}
+		rec.PlanID = &id
+	}
+
+	err = s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		m, err := tx.GetMetersForUpdate(ctx, vehicleID)
+		if err != nil {
+			return err
+		}
+		rec.OdometerKm, rec.EngineHours = m.OdometerKm, m.EngineHours
+		if in.OdometerKm != nil {
+			rec.OdometerKm = *in.OdometerKm
+		}
+		if in.EngineHours != nil {
+			rec.EngineHours = *in.EngineHours
+		}
+
+		var target *repository.MaintenanceTarget
+		if rec.PlanID != nil {
+			targets, err := tx.MaintenanceTargets(ctx, repository.MaintenanceFilter{VehicleID: vehicleID, PlanID: rec.PlanID.String()})
+			if err != nil {
+				return err
+			}
+			if len(targets) == 0 {
+				return fmt.Errorf("%w: plan does not apply to this vehicle", repository.ErrPlanNotFound)
+			}
+			target = &targets[0]
+		}
+		if err := tx.InsertServiceRecord(ctx, rec); err != nil {
+			return err
+		}
+		if target == nil {
+			return nil
+		}
+
+		st, err := tx.GetMaintenanceStatusForUpdate(ctx, *rec.PlanID, vid)
+		if err != nil {
+			return err
+		}
+		if st != nil && st.BaseServiceID != nil && !rec.PerformedAt.After(st.BaseAt) {
+			return nil
+		}
+		next := repository.MaintenanceStatus{
+			BaseAt:          rec.PerformedAt,
+			BaseOdometerKm:  rec.OdometerKm,
+			BaseEngineHours: rec.EngineHours,
+			BaseServiceID:   &rec.ID,
+		}
+		next.State = dueState(*target, next, now).State
+		next.NotifiedState = next.State
+		return tx.SaveMaintenanceStatus(ctx, *rec.PlanID, vid, next)
+	})
+	return rec, err
+}
+
+// GetServiceRecords returns the service history of a vehicle
+func (s *Service) GetServiceRecords(ctx context.Context, vehicleID string) ([]model.ServiceRecord, error) {
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return nil, repository.ErrNoVehicleFound
+	}
+	return s.repo.GetServiceRecords(ctx, vehicleID)
+}
+
+// ListVehicles returns the fleet with meters and maintenance state,
+// optionally one group
+func (s *Service) ListVehicles(ctx context.Context, groupID string) ([]model.VehicleSummary, error) {
+	if groupID != "" {
+		if _, err := uuid.Parse(groupID); err != nil {
+			return nil, fmt.Errorf("%w: invalid group id", ErrInvalidFleetInput)
+		}
+	}
+	return s.repo.ListVehicles(ctx, groupID)
+}
+
+// MaintenanceScheduler periodically recomputes when every plan falls due,
+// keeps the maintenance state of the fleet list current and emits a
+// MaintenanceDue event when a plan becomes due soon or overdue
+type MaintenanceScheduler struct {
+	svc      *Service
+	interval time.Duration
+}
+
+func NewMaintenanceScheduler(svc *Service, interval time.Duration) *MaintenanceScheduler {
+	return &MaintenanceScheduler{svc: svc, interval: interval}
+}
+
+// Run recomputes maintenance every interval until ctx is done
+func (m *MaintenanceScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if n, err := m.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("maintenance scheduler: %v", err)
+		} else if n > 0 {
+			log.Printf("maintenance scheduler: %d plans became due", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce recomputes every plan and vehicle pair and returns how many
+// notifications were raised
+func (m *MaintenanceScheduler) RunOnce(ctx context.Context) (int, error) {
+	repo := m.svc.repo
+	if _, err := repo.PruneMaintenanceStatus(ctx); err != nil {
+		return 0, err
+	}
+	targets, err := repo.MaintenanceTargets(ctx, repository.MaintenanceFilter{})
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	raised := 0
+	for _, t := range targets {
+		if t.Status != nil && dueState(t, *t.Status, now).State == t.Status.State {
+			continue
+		}
+		err := repo.WithTx(ctx, func(tx *repository.Repo) error {
+			// A service recorded since the targets were read moves the base
+			st, err := tx.GetMaintenanceStatusForUpdate(ctx, t.Plan.ID, t.VehicleID)
+			if err != nil {
+				return err
+			}
+			t.Status = st
+			next := baseOf(t, now)
+			d := dueState(t, next, now)
+			next.State = d.State
+			notify := stateRank(d.State) > stateRank(next.NotifiedState)
+			next.NotifiedState = d.State
+			if err := tx.SaveMaintenanceStatus(ctx, t.Plan.ID, t.VehicleID, next); err != nil {
+				return err
+			}
+			if !notify {
+				return nil
+			}
+			raised++
+			e, err := model.NewEvent(model.EventMaintenanceDue, t.VehicleID, d)
+			if err != nil {
+				return err
+			}
+			return tx.InsertEvents(ctx, e)
+		})
+		if err != nil {
+			return raised, fmt.Errorf("plan %s vehicle %s: %w", t.Plan.ID, t.VehicleID, err)
+		}
+	}
+	return raised, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanInput(t *testing.T) {
+	km, days, soon := 10000.0, 180, 5
+	p, err := PlanInput{Name: " Oil change ", GroupID: "5b0c1e2a-1f0e-4d6a-9a43-2f1f7c1c9e01", IntervalKm: &km,
+		IntervalDays: &days, DueSoonDays: &soon}.plan()
+	require.NoError(t, err)
+	assert.Equal(t, "Oil change", p.Name)
+	assert.NotNil(t, p.GroupID)
+	assert.Nil(t, p.VehicleID)
+	assert.Equal(t, 1000.0, p.DueSoonKm, "a tenth of the interval by default")
+	assert.Equal(t, 5, p.DueSoonDays)
+	assert.Zero(t, p.DueSoonHours)
+
+	bad := []PlanInput{
+		{Name: "x", IntervalKm: &km},
+		{Name: "x", GroupID: "5b0c1e2a-1f0e-4d6a-9a43-2f1f7c1c9e01"},
+		{Name: "x", GroupID: "5b0c1e2a-1f0e-4d6a-9a43-2f1f7c1c9e01", IntervalDays: &days, DueSoonKm: &km},
+		{Name: "x", GroupID: "5b0c1e2a-1f0e-4d6a-9a43-2f1f7c1c9e01", IntervalKm: &km, DueSoonKm: &km},
+		{Name: "", VehicleID: "5b0c1e2a-1f0e-4d6a-9a43-2f1f7c1c9e01", IntervalKm: &km},
+	}
+	for _, in := range bad {
+		_, err := in.plan()
+		assert.ErrorIs(t, err, ErrInvalidMaintenance, "%+v", in)
+	}
+}
+
+func TestDueState(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	km, hours, days := 10000.0, 500.0, 180
+	target := repository.MaintenanceTarget{
+		Plan: model.MaintenancePlan{Name: "Oil change", IntervalKm: &km, IntervalHours: &hours, IntervalDays: &days,
+			DueSoonKm: 1000, DueSoonHours: 50, DueSoonDays: 14},
+		OdometerKm:  84000,
+		EngineHours: 3100,
+	}
+	base := repository.MaintenanceStatus{BaseAt: now.AddDate(0, -3, 0), BaseOdometerKm: 80000, BaseEngineHours: 2900}
+
+	d := dueState(target, base, now)
+	assert.Equal(t, model.MaintenanceOK, d.State)
+	assert.Equal(t, 90000.0, *d.DueOdometerKm)
+	assert.Equal(t, 6000.0, *d.RemainingKm)
+	assert.Equal(t, 300.0, *d.RemainingHours)
+	assert.Equal(t, base.BaseAt.AddDate(0, 0, 180), *d.DueAt)
+
+	// Whichever comes first
+	target.EngineHours = 3360
+	assert.Equal(t, model.MaintenanceDueSoon, dueState(target, base, now).State)
+	target.OdometerKm = 90000
+	assert.Equal(t, model.MaintenanceOverdue, dueState(target, base, now).State)
+
+	target.OdometerKm, target.EngineHours = 80000, 2900
+	assert.Equal(t, model.MaintenanceDueSoon, dueState(target, base, base.BaseAt.AddDate(0, 0, 170)).State)
+	assert.Equal(t, model.MaintenanceOverdue, dueState(target, base, base.BaseAt.AddDate(0, 0, 181)).State)
+}
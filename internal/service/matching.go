@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/mapmatch"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrNoRoadNetwork is returned while no road network is loaded for map matching
+var ErrNoRoadNetwork = errors.New("road network not loaded")
+
+// MatchedRoad is a stretch of a matched trip along one named road
+type MatchedRoad struct {
+	Name       string    `json:"name,omitempty"`
+	Ref        string    `json:"ref,omitempty"`
+	Highway    string    `json:"highway"`
+	DistanceKm float64   `json:"distance_km"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+}
+
+// MatchedTrip is a trip snapped to the road network
+type MatchedTrip struct {
+	TripID            uuid.UUID     `json:"trip_id"`
+	VehicleID         uuid.UUID     `json:"vehicle_id"`
+	RawDistanceKm     float64       `json:"raw_distance_km"`
+	MatchedDistanceKm float64       `json:"matched_distance_km"`
+	Points            int           `json:"points"`
+	MatchedPoints     int           `json:"matched_points"`
+	UnmatchedPoints   int           `json:"unmatched_points"`
+	Breaks            int           `json:"breaks"`
+	Polyline          string        `json:"polyline"`
+	GeoJSON           geo.Feature   `json:"geojson"`
+	Roads             []MatchedRoad `json:"roads"`
+}
+
+// SetRoadNetwork makes a loaded road network available for map matching
+func (s *Service) SetRoadNetwork(g *mapmatch.Graph) {
+	s.roads.Store(g)
+}
+
+// MatchTrip snaps the positions of a trip to the road network
+func (s *Service) MatchTrip(ctx context.Context, tripID string) (*MatchedTrip, error) {
+	g := s.roads.Load()
+	if g == nil {
+		return nil, ErrNoRoadNetwork
+	}
+	if _, err := uuid.Parse(tripID); err != nil {
+		return nil, repository.ErrTripNotFound
+	}
+	trip, err := s.repo.GetTrip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	var fixes []mapmatch.Fix
+	// end_time is inclusive
+	err = s.repo.EachPosition(ctx, trip.VehicleID.String(), trip.StartTime, trip.EndTime.Add(time.Microsecond), func(p model.Position) error {
+		fixes = append(fixes, mapmatch.Fix{Point: geo.FromLonLat(p.Location), Time: p.Timestamp})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := g.Match(fixes, mapmatch.DefaultParams())
+	out := &MatchedTrip{
+		TripID:            trip.ID,
+		VehicleID:         trip.VehicleID,
+		RawDistanceKm:     trip.Mileage,
+		MatchedDistanceKm: res.DistanceM / 1000,
+		Points:            len(fixes),
+		MatchedPoints:     res.Matched,
+		UnmatchedPoints:   res.Unmatched,
+		Breaks:            res.Breaks,
+		Polyline:          geo.EncodePolyline(res.Geometry),
+		GeoJSON: geo.NewLineString(res.Geometry, map[string]interface{}{
+			"trip_id":     trip.ID,
+			"distance_km": res.DistanceM / 1000,
+		}),
+		Roads: []MatchedRoad{},
+	}
+	for _, r := range res.Roads {
+		out.Roads = append(out.Roads, MatchedRoad{
+			Name:       r.Name,
+			Ref:        r.Ref,
+			Highway:    r.Highway,
+			DistanceKm: r.DistanceM / 1000,
+			Start:      r.Start,
+			End:        r.End,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidMeters is returned for an invalid calibration
+var ErrInvalidMeters = errors.New("invalid meters")
+
+// MeterCalibration manually corrects a vehicle's meters. Nil values and an
+// empty source are left unchanged.
+type MeterCalibration struct {
+	OdometerKm     *float64 `json:"odometer_km"`
+	EngineHours    *float64 `json:"engine_hours"`
+	OdometerSource string   `json:"odometer_source"`
+	Note           string   `json:"note"`
+}
+
+// tripDistanceAdded is the distance a fix added to the vehicle's trips
+func tripDistanceAdded(open, next, completed *model.OpenTrip) float64 {
+	var before, after float64
+	if open != nil {
+		before = open.Mileage
+	}
+	if completed != nil {
+		after += completed.Mileage
+	}
+	if next != nil && (completed == nil || next.ID != completed.ID) {
+		after += next.Mileage
+	}
+	return after - before
+}
+
+// deviceOdometer returns the odometer reported in a status payload in km
+func deviceOdometer(status map[string]interface{}) *float64 {
+	v, ok := toFloat(status["odometer"])
+	if !ok || v < 0 {
+		return nil
+	}
+	return &v
+}
+
+// meterStep applies a stored fix to a vehicle's meters. Engine time accrues
+// between fixes while the ignition was on, at most maxGap per gap so a
+// silent device does not run up hours. Fixes older than the last one counted
+// change nothing.
+func meterStep(m model.VehicleMeters, fix model.Position, device *float64, km float64, maxGap time.Duration) model.VehicleMeters {
+	if m.LastFixAt != nil && !fix.Timestamp.After(*m.LastFixAt) {
+		return m
+	}
+	if m.LastFixAt != nil && m.LastIgnition != nil && *m.LastIgnition {
+		gap := fix.Timestamp.Sub(*m.LastFixAt)
+		if gap > maxGap {
+			gap = maxGap
+		}
+		m.EngineHours += gap.Hours()
+	}
+	at := fix.Timestamp
+	m.LastFixAt = &at
+	if fix.Ignition != nil {
+		m.LastIgnition = fix.Ignition
+	}
+
+	if device != nil {
+		m.DeviceOdometerKm = device
+	}
+	switch {
+	case m.OdometerSource == model.OdometerDevice && device != nil:
+		m.OdometerKm = *device + m.DeviceOffsetKm
+	case m.OdometerSource != model.OdometerDevice:
+		m.OdometerKm += km
+	}
+	return m
+}
+
+// advanceMeters updates the vehicle's odometer and engine hours with a newly
+// stored fix and records a reading when it completed a trip
+func advanceMeters(ctx context.Context, tx *repository.Repo, pos model.Position, status map[string]interface{}, prog tripProgress) error {
+	m, err := tx.GetMetersForUpdate(ctx, pos.VehicleID.String())
+	if err != nil {
+		return err
+	}
+	m = meterStep(m, pos, deviceOdometer(status), prog.km, DefaultTripParams().MaxGap)
+	if err := tx.SaveMeters(ctx, m); err != nil {
+		return err
+	}
+	if prog.completed == nil {
+		return nil
+	}
+	return tx.InsertMeterReading(ctx, tripReading(m, *prog.completed))
+}
+
+func tripReading(m model.VehicleMeters, t model.Trip) model.MeterReading {
+	id := t.ID
+	return model.MeterReading{
+		VehicleID:      m.VehicleID,
+		RecordedAt:     t.EndTime,
+		Kind:           model.ReadingTrip,
+		OdometerKm:     m.OdometerKm,
+		EngineHours:    m.EngineHours,
+		OdometerSource: m.OdometerSource,
+		TripID:         &id,
+	}
+}
+
+// GetMeters returns the current odometer and engine hours of a vehicle
+func (s *Service) GetMeters(ctx context.Context, vehicleID string) (model.VehicleMeters, error) {
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return model.VehicleMeters{}, repository.ErrNoVehicleFound
+	}
+	return s.repo.GetMeters(ctx, vehicleID)
+}
+
+// CalibrateMeters corrects a vehicle's meters and records the change with
+// who made it. With the device source the odometer is kept by adjusting the
+// offset added to the device reading, so switching sources does not jump.
+func (s *Service) CalibrateMeters(ctx context.Context, vehicleID string, c MeterCalibration, actor string) (model.VehicleMeters, error) {
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return model.VehicleMeters{}, repository.ErrNoVehicleFound
+	}
+	switch {
+	case c.OdometerKm == nil && c.EngineHours == nil && c.OdometerSource == "":
+		return model.VehicleMeters{}, fmt.Errorf("%w: nothing to calibrate", ErrInvalidMeters)
+	case c.OdometerKm != nil && *c.OdometerKm < 0, c.EngineHours != nil && *c.EngineHours < 0:
+		return model.VehicleMeters{}, fmt.Errorf("%w: meters cannot be negative", ErrInvalidMeters)
+	case c.OdometerSource != "" && c.OdometerSource != model.OdometerVirtual && c.OdometerSource != model.OdometerDevice:
+		return model.VehicleMeters{}, fmt.Errorf("%w: odometer_source must be virtual or device", ErrInvalidMeters)
+	}
+
+	var m model.VehicleMeters
+	err := s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		var err error
+		if m, err = tx.GetMetersForUpdate(ctx, vehicleID); err != nil {
+			return err
+		}
+		prevKm, prevHours := m.OdometerKm, m.EngineHours
+		if c.OdometerSource != "" {
+			m.OdometerSource = c.OdometerSource
+		}
+		if c.OdometerKm != nil {
+			m.OdometerKm = *c.OdometerKm
+		}
+		if c.EngineHours != nil {
+			m.EngineHours = *c.EngineHours
+		}
+		if m.OdometerSource == model.OdometerDevice {
+			if m.DeviceOdometerKm == nil && c.OdometerKm != nil {
+				return fmt.Errorf("%w: no device odometer reading to calibrate against yet", ErrInvalidMeters)
+			}
+			if m.DeviceOdometerKm != nil {
+				m.DeviceOffsetKm = m.OdometerKm - *m.DeviceOdometerKm
+			}
+		}
+		if err := tx.SaveMeters(ctx, m); err != nil {
+			return err
+		}
+		if err := tx.InsertMeterReading(ctx, model.MeterReading{
+			VehicleID:       m.VehicleID,
+			RecordedAt:      time.Now().UTC(),
+			Kind:            model.ReadingCalibration,
+			OdometerKm:      m.OdometerKm,
+			EngineHours:     m.EngineHours,
+			PrevOdometerKm:  &prevKm,
+			PrevEngineHours: &prevHours,
+			OdometerSource:  m.OdometerSource,
+			Actor:           actor,
+			Note:            c.Note,
+		}); err != nil {
+			return err
+		}
+		e, err := model.NewEvent(model.EventMetersCalibrated, m.VehicleID, map[string]interface{}{
+			"vehicle_id":        m.VehicleID,
+			"odometer_km":       m.OdometerKm,
+			"engine_hours":      m.EngineHours,
+			"odometer_source":   m.OdometerSource,
+			"prev_odometer_km":  prevKm,
+			"prev_engine_hours": prevHours,
+			"actor":             actor,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.InsertEvents(ctx, e)
+	})
+	return m, err
+}
+
+// GetMeterHistory returns the meter readings of a vehicle in a time range,
+// optionally only one kind
+func (s *Service) GetMeterHistory(ctx context.Context, vehicleID string, from, to time.Time, kind string) ([]model.MeterReading, error) {
+	if err := ValidateRange(from, to, 0); err != nil {
+		return nil, err
+	}
+	if kind != "" && kind != model.ReadingTrip && kind != model.ReadingCalibration {
+		return nil, fmt.Errorf("%w: kind must be trip or calibration", ErrInvalidMeters)
+	}
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return []model.MeterReading{}, nil
+	}
+	return s.repo.GetMeterReadings(ctx, vehicleID, from, to, kind)
+}
+
+// addStatusMeters adds the current odometer and engine hours to a status
+func (s *Service) addStatusMeters(ctx context.Context, vehicleID string, st map[string]interface{}) {
+	m, err := s.repo.GetMeters(ctx, vehicleID)
+	if err != nil {
+		return
+	}
+	st["odometer_km"] = m.OdometerKm
+	st["engine_hours"] = m.EngineHours
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeterStep(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	on, off := true, false
+	origin := geo.Point{Lat: 25.2, Lon: 55.27}
+	fix := func(min int, ign *bool) model.Position {
+		return model.Position{Location: origin.LonLat(), Ignition: ign, Timestamp: t0.Add(time.Duration(min) * time.Minute)}
+	}
+	gap := DefaultTripParams().MaxGap
+
+	m := model.VehicleMeters{OdometerSource: model.OdometerVirtual, OdometerKm: 1000}
+	m = meterStep(m, fix(0, &on), nil, 0, gap)
+	m = meterStep(m, fix(30, nil), nil, 12.5, gap) // ignition unknown keeps it on
+	m = meterStep(m, fix(45, &off), nil, 3, gap)
+	m = meterStep(m, fix(120, &on), nil, 0, gap) // off in between
+	assert.InDelta(t, 0.75, m.EngineHours, 1e-9)
+	assert.InDelta(t, 1015.5, m.OdometerKm, 1e-9)
+
+	m = meterStep(m, fix(300, &off), nil, 0, gap)
+	assert.InDelta(t, 1.25, m.EngineHours, 1e-9, "a silent device adds at most MaxGap")
+
+	old := meterStep(m, fix(10, &on), nil, 5, gap)
+	assert.Equal(t, m, old, "older fixes change nothing")
+
+	// The device odometer replaces trip distance, shifted by the calibration
+	reading := 84210.0
+	m.OdometerSource, m.DeviceOffsetKm = model.OdometerDevice, -4.2
+	m = meterStep(m, fix(301, &on), &reading, 7, gap)
+	assert.InDelta(t, 84205.8, m.OdometerKm, 1e-9)
+	m = meterStep(m, fix(302, &on), nil, 7, gap)
+	assert.InDelta(t, 84205.8, m.OdometerKm, 1e-9)
+}
+
+func TestTripDistanceAdded(t *testing.T) {
+	open := &model.OpenTrip{Trip: model.Trip{Mileage: 4}}
+	open.ID[0] = 1
+	next := *open
+	next.Mileage = 4.5
+	assert.InDelta(t, 0.5, tripDistanceAdded(open, &next, nil), 1e-9)
+	assert.InDelta(t, 0.5, tripDistanceAdded(open, nil, &next), 1e-9)
+
+	started := &model.OpenTrip{}
+	started.ID[0] = 2
+	assert.InDelta(t, 0.5, tripDistanceAdded(open, started, &next), 1e-9)
+	assert.Zero(t, tripDistanceAdded(nil, started, nil))
+	assert.Zero(t, tripDistanceAdded(open, open, nil))
+}
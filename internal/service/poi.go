@@ -0,0 +1,520 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidPOI is returned for an invalid POI, import or visit query
+var ErrInvalidPOI = errors.New("invalid poi input")
+
+const (
+	// DefaultPOIRadiusM is the radius of a POI that does not set one
+	DefaultPOIRadiusM = 100
+	// MaxPOIRadiusM bounds the radius of a POI and so the search around a stop
+	MaxPOIRadiusM = 2000
+	// MaxPOIImportBytes limits the size of a POI CSV upload
+	MaxPOIImportBytes = 20 << 20
+	// MaxPOIVisitRange limits how much history a visits report covers
+	MaxPOIVisitRange = 93 * 24 * time.Hour
+
+	poiCellDeg       = 0.01 // grid cell size of the POI spatial index
+	maxImportErrors  = 100  // row errors listed in an import result
+	maxPOIListLimit  = 1000
+	defaultPOIListed = 100
+)
+
+// poiCell returns the grid cell key of a location
+func poiCell(p geo.Point) int64 {
+	cx, cy := int32(math.Floor(p.Lon/poiCellDeg)), int32(math.Floor(p.Lat/poiCellDeg))
+	return int64(cy)<<32 | int64(uint32(cx))
+}
+
+// poiCells returns the grid cells holding every location within radius
+// metres of p
+func poiCells(p geo.Point, radius float64) []int64 {
+	dLat := radius / 111320
+	dLon := radius / (111320 * math.Max(math.Cos(p.Lat*math.Pi/180), 0.01))
+	x1, y1 := int32(math.Floor((p.Lon-dLon)/poiCellDeg)), int32(math.Floor((p.Lat-dLat)/poiCellDeg))
+	x2, y2 := int32(math.Floor((p.Lon+dLon)/poiCellDeg)), int32(math.Floor((p.Lat+dLat)/poiCellDeg))
+	var cells []int64
+	for cy := y1; cy <= y2; cy++ {
+		for cx := x1; cx <= x2; cx++ {
+			cells = append(cells, int64(cy)<<32|int64(uint32(cx)))
+		}
+	}
+	return cells
+}
+
+// POIInput describes a new or changed POI
+type POIInput struct {
+	Name        string     `json:"name"`
+	Category    string     `json:"category"`
+	ExternalRef string     `json:"external_ref"`
+	Address     string     `json:"address"`
+	Location    [2]float64 `json:"location"` // lon, lat
+	RadiusM     *float64   `json:"radius_m"`
+}
+
+func (in POIInput) poi(now time.Time) (model.POI, error) {
+	p := model.POI{
+		ID:          uuid.New(),
+		Name:        strings.TrimSpace(in.Name),
+		Category:    strings.ToLower(strings.TrimSpace(in.Category)),
+		ExternalRef: strings.TrimSpace(in.ExternalRef),
+		Address:     strings.TrimSpace(in.Address),
+		Location:    in.Location,
+		RadiusM:     DefaultPOIRadiusM,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if p.Name == "" {
+		return p, fmt.Errorf("%w: name required", ErrInvalidPOI)
+	}
+	if !validLonLat(p.Location) {
+		return p, fmt.Errorf("%w: location must be [lon, lat]", ErrInvalidPOI)
+	}
+	if in.RadiusM != nil {
+		if *in.RadiusM <= 0 || *in.RadiusM > MaxPOIRadiusM {
+			return p, fmt.Errorf("%w: radius_m must be between 0 and %d", ErrInvalidPOI, MaxPOIRadiusM)
+		}
+		p.RadiusM = *in.RadiusM
+	}
+	return p, nil
+}
+
+// CreatePOI adds a point of interest
+func (s *Service) CreatePOI(ctx context.Context, in POIInput) (model.POI, error) {
+	p, err := in.poi(time.Now().UTC())
+	if err != nil {
+		return p, err
+	}
+	return p, s.repo.CreatePOI(ctx, p, poiCell(geo.FromLonLat(p.Location)))
+}
+
+// UpdatePOI replaces the details of a POI. Visits already recorded are kept.
+func (s *Service) UpdatePOI(ctx context.Context, id string, in POIInput) (model.POI, error) {
+	old, err := s.repo.GetPOI(ctx, id)
+	if err != nil {
+		return old, err
+	}
+	p, err := in.poi(time.Now().UTC())
+	if err != nil {
+		return p, err
+	}
+	p.ID, p.CreatedAt = old.ID, old.CreatedAt
+	return p, s.repo.UpdatePOI(ctx, p, poiCell(geo.FromLonLat(p.Location)))
+}
+
+// GetPOI returns a POI
+func (s *Service) GetPOI(ctx context.Context, id string) (model.POI, error) {
+	return s.repo.GetPOI(ctx, id)
+}
+
+// DeletePOI removes a POI with its visits
+func (s *Service) DeletePOI(ctx context.Context, id string) error {
+	return s.repo.DeletePOI(ctx, id)
+}
+
+// POICategories returns the categories in use
+func (s *Service) POICategories(ctx context.Context) ([]model.POICategory, error) {
+	return s.repo.POICategories(ctx)
+}
+
+// POINear restricts a POI listing to within RadiusM of a location
+type POINear struct {
+	Location [2]float64
+	RadiusM  float64
+}
+
+// ListPOIs returns POIs by category and name, or nearest first when near is set
+func (s *Service) ListPOIs(ctx context.Context, q repository.POIQuery, near *POINear) ([]model.POI, error) {
+	if q.Limit == 0 {
+		q.Limit = defaultPOIListed
+	}
+	if q.Limit < 0 || q.Limit > maxPOIListLimit || q.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPOI, maxPOIListLimit)
+	}
+	if near == nil {
+		return s.repo.ListPOIs(ctx, q)
+	}
+	if !validLonLat(near.Location) || near.RadiusM <= 0 || near.RadiusM > 10000 {
+		return nil, fmt.Errorf("%w: near must be lon,lat with a radius up to 10000 m", ErrInvalidPOI)
+	}
+	at := geo.FromLonLat(near.Location)
+	limit, offset := q.Limit, q.Offset
+	q.Cells, q.Limit, q.Offset = poiCells(at, near.RadiusM), 0, 0
+	all, err := s.repo.ListPOIs(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	matches := poisWithin(all, at, func(model.POI) float64 { return near.RadiusM })
+	res := []model.POI{}
+	for i := offset; i < len(matches) && len(res) < limit; i++ {
+		res = append(res, matches[i].poi)
+	}
+	return res, nil
+}
+
+// poiMatch is a POI and how far a location is from it
+type poiMatch struct {
+	poi   model.POI
+	distM float64
+}
+
+// poisWithin returns the POIs within radius(poi) of at, nearest first
+func poisWithin(pois []model.POI, at geo.Point, radius func(model.POI) float64) []poiMatch {
+	var res []poiMatch
+	for _, p := range pois {
+		if d := geo.Distance(at, geo.FromLonLat(p.Location)); d <= radius(p) {
+			res = append(res, poiMatch{poi: p, distM: d})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].distM < res[j].distM })
+	return res
+}
+
+// POIImportError is a CSV row that was not imported
+type POIImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// POIImportResult summarises a POI CSV import
+type POIImportResult struct {
+	Rows    int              `json:"rows"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"` // rows whose external_ref matched an existing POI
+	Failed  int              `json:"failed"`
+	Errors  []POIImportError `json:"errors"` // the first 100 failed rows
+}
+
+func (res *POIImportResult) fail(row int, err error) {
+	res.Failed++
+	if len(res.Errors) < maxImportErrors {
+		res.Errors = append(res.Errors, POIImportError{Row: row, Error: strings.TrimPrefix(err.Error(), ErrInvalidPOI.Error()+": ")})
+	}
+}
+
+// poiImportRow is a readable CSV row with its line number
+type poiImportRow struct {
+	row int
+	in  POIInput
+}
+
+// readPOICSV reads POIs from a CSV file with a header row. name, lat and
+// lon are required columns; category, radius_m, address and external_ref
+// are optional. Unreadable rows are recorded in res and skipped.
+func readPOICSV(r io.Reader, res *POIImportResult) ([]poiImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read the header row: %v", ErrInvalidPOI, err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	for _, c := range []string{"name", "lat", "lon"} {
+		if _, ok := col[c]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidPOI, c)
+		}
+	}
+
+	var rows []poiImportRow
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				return nil, err
+			}
+			res.Rows++
+			res.fail(line, err)
+			continue
+		}
+		res.Rows++
+		get := func(c string) string {
+			if i, ok := col[c]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		in := POIInput{Name: get("name"), Category: get("category"), ExternalRef: get("external_ref"), Address: get("address")}
+		lat, err1 := strconv.ParseFloat(get("lat"), 64)
+		lon, err2 := strconv.ParseFloat(get("lon"), 64)
+		if err1 != nil || err2 != nil {
+			res.fail(line, errors.New("lat and lon must be numbers"))
+			continue
+		}
+		in.Location = [2]float64{lon, lat}
+		if v := get("radius_m"); v != "" {
+			radius, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				res.fail(line, errors.New("radius_m must be a number"))
+				continue
+			}
+			in.RadiusM = &radius
+		}
+		rows = append(rows, poiImportRow{row: line, in: in})
+	}
+	return rows, nil
+}
+
+// ImportPOIs adds the POIs of a CSV file in one transaction. A row whose
+// external_ref matches an existing POI updates it, so a catalogue can be
+// re-imported as it changes.
+func (s *Service) ImportPOIs(ctx context.Context, r io.Reader) (POIImportResult, error) {
+	res := POIImportResult{Errors: []POIImportError{}}
+	rows, err := readPOICSV(r, &res)
+	if err != nil {
+		return res, err
+	}
+	now := time.Now().UTC()
+	err = s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		for _, row := range rows {
+			p, err := row.in.poi(now)
+			if err != nil {
+				res.fail(row.row, err)
+				continue
+			}
+			cell := poiCell(geo.FromLonLat(p.Location))
+			if p.ExternalRef == "" {
+				if err := tx.CreatePOI(ctx, p, cell); err != nil {
+					return err
+				}
+				res.Created++
+				continue
+			}
+			created, err := tx.UpsertPOIByRef(ctx, p, cell)
+			if err != nil {
+				return err
+			}
+			if created {
+				res.Created++
+			} else {
+				res.Updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return POIImportResult{}, err
+	}
+	return res, nil
+}
+
+// stopConfirmed reports whether a fix made next a stop long enough to
+// keep: it lasted MinDuration and did not before
+func stopConfirmed(open, next *model.OpenStop, p StopParams) bool {
+	if next == nil || next.DurationSeconds < p.MinDuration.Seconds() {
+		return false
+	}
+	return open == nil || *open.ID != *next.ID || open.DurationSeconds < p.MinDuration.Seconds()
+}
+
+func poiVisitEvent(kind string, v model.POIVisit) (model.Event, error) {
+	return model.NewEvent(kind, v.VehicleID, map[string]interface{}{
+		"poi_id":           v.POIID,
+		"poi_name":         v.POIName,
+		"category":         v.Category,
+		"vehicle_id":       v.VehicleID,
+		"stop_id":          v.StopID,
+		"arrival":          v.Arrival,
+		"departure":        v.Departure,
+		"duration_seconds": v.DurationSeconds,
+	})
+}
+
+// unvisited drops the matches a stop has already recorded a visit to and
+// the POIs added after the stop ended, such as when importing old history
+func unvisited(matches []poiMatch, visits []model.POIVisit, departure time.Time) []poiMatch {
+	seen := map[uuid.UUID]bool{}
+	for _, v := range visits {
+		seen[v.POIID] = true
+	}
+	var res []poiMatch
+	for _, m := range matches {
+		if !seen[m.poi.ID] && !m.poi.CreatedAt.After(departure) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// recordPOIVisits records a visit to every POI a stop is within that it
+// has not visited yet and returns the arrival events
+func recordPOIVisits(ctx context.Context, tx *repository.Repo, st model.Stop, visits []model.POIVisit) ([]model.Event, error) {
+	at := geo.FromLonLat(st.Location)
+	pois, err := tx.ListPOIs(ctx, repository.POIQuery{Cells: poiCells(at, MaxPOIRadiusM)})
+	if err != nil {
+		return nil, err
+	}
+	var events []model.Event
+	for _, m := range unvisited(poisWithin(pois, at, func(p model.POI) float64 { return p.RadiusM }), visits, st.Departure) {
+		d := math.Round(m.distM)
+		if err := tx.InsertPOIVisit(ctx, m.poi.ID, st, d); err != nil {
+			return nil, err
+		}
+		e, err := poiVisitEvent(model.EventPOIArrived, model.POIVisit{
+			POIID:           m.poi.ID,
+			POIName:         m.poi.Name,
+			Category:        m.poi.Category,
+			StopID:          *st.ID,
+			VehicleID:       st.VehicleID,
+			Arrival:         st.Arrival,
+			DurationSeconds: st.DurationSeconds,
+			DistanceM:       d,
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// endPOIVisits matches an ended stop against the POIs again, since its
+// location settles as fixes arrive and POIs may have been added since it
+// was confirmed, and returns the arrival events of the new visits followed
+// by the departure events of all of them
+func endPOIVisits(ctx context.Context, tx *repository.Repo, st model.Stop) ([]model.Event, error) {
+	visits, err := tx.GetStopPOIVisits(ctx, *st.ID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := recordPOIVisits(ctx, tx, st, visits)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > 0 {
+		if visits, err = tx.GetStopPOIVisits(ctx, *st.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range visits {
+		e, err := poiVisitEvent(model.EventPOIDeparted, v)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Visit report groupings
+const (
+	VisitsByPOI     = "poi"
+	VisitsByVehicle = "vehicle"
+	VisitsByVisit   = "visit" // one row per visit
+)
+
+// POIVisitSummary totals the visits of one POI or one vehicle
+type POIVisitSummary struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`               // POI name or plate number
+	Category        string    `json:"category,omitempty"` // of a POI
+	Visits          int       `json:"visits"`
+	Distinct        int       `json:"distinct"` // vehicles visiting a POI, or POIs a vehicle visited
+	DwellSeconds    float64   `json:"dwell_seconds"`
+	AvgDwellSeconds float64   `json:"avg_dwell_seconds"`
+	FirstArrival    time.Time `json:"first_arrival"`
+	LastArrival     time.Time `json:"last_arrival"`
+}
+
+// summarizeVisits totals visits per POI or per vehicle, most visits first
+func summarizeVisits(visits []model.POIVisit, by string) []POIVisitSummary {
+	idx := map[uuid.UUID]int{}
+	seen := map[[2]uuid.UUID]bool{}
+	res := []POIVisitSummary{}
+	for _, v := range visits {
+		id, other, name, category := v.POIID, v.VehicleID, v.POIName, v.Category
+		if by == VisitsByVehicle {
+			id, other, name, category = v.VehicleID, v.POIID, v.PlateNumber, ""
+		}
+		i, ok := idx[id]
+		if !ok {
+			i = len(res)
+			idx[id] = i
+			res = append(res, POIVisitSummary{ID: id, Name: name, Category: category, FirstArrival: v.Arrival})
+		}
+		sum := &res[i]
+		sum.Visits++
+		sum.DwellSeconds += v.DurationSeconds
+		if !seen[[2]uuid.UUID{id, other}] {
+			seen[[2]uuid.UUID{id, other}] = true
+			sum.Distinct++
+		}
+		if v.Arrival.Before(sum.FirstArrival) {
+			sum.FirstArrival = v.Arrival
+		}
+		if v.Arrival.After(sum.LastArrival) {
+			sum.LastArrival = v.Arrival
+		}
+	}
+	for i := range res {
+		res[i].AvgDwellSeconds = math.Round(res[i].DwellSeconds / float64(res[i].Visits))
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Visits != res[j].Visits {
+			return res[i].Visits > res[j].Visits
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func validVisitQuery(q repository.POIVisitQuery) error {
+	if err := ValidateRange(q.From, q.To, MaxPOIVisitRange); err != nil {
+		return err
+	}
+	if q.MinDuration < 0 {
+		return fmt.Errorf("%w: min_duration must not be negative", ErrInvalidPOI)
+	}
+	for name, id := range map[string]string{"poi_id": q.POIID, "vehicle_id": q.VehicleID} {
+		if _, err := uuid.Parse(id); id != "" && err != nil {
+			return fmt.Errorf("%w: invalid %s", ErrInvalidPOI, name)
+		}
+	}
+	return nil
+}
+
+// GetPOIVisits returns the POI visits arriving in a time range, optionally
+// of one POI, vehicle or category
+func (s *Service) GetPOIVisits(ctx context.Context, q repository.POIVisitQuery) ([]model.POIVisit, error) {
+	if err := validVisitQuery(q); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPOIVisits(ctx, q)
+}
+
+// GetPOIVisitSummary totals the visits matching q per POI or per vehicle
+func (s *Service) GetPOIVisitSummary(ctx context.Context, q repository.POIVisitQuery, by string) ([]POIVisitSummary, error) {
+	if by != VisitsByPOI && by != VisitsByVehicle {
+		return nil, fmt.Errorf("%w: by must be poi, vehicle or visit", ErrInvalidPOI)
+	}
+	visits, err := s.GetPOIVisits(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return summarizeVisits(visits, by), nil
+}
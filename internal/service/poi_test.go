@@ -0,0 +1,128 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPOICSV(t *testing.T) {
+	file := "\ufeffName,Lat,Lon,Category,radius_m,external_ref\n" +
+		"Al Noor Pharmacy,25.2048,55.2708,Pharmacy,80,CUST-001\n" +
+		"\"Warehouse, Jebel Ali\",25.0117,55.0612,,,\n" +
+		"Nowhere,north,55.1,,,\n" +
+		"Bad radius,25.1,55.1,,wide,\n"
+	res := POIImportResult{}
+	rows, err := readPOICSV(strings.NewReader(file), &res)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, 4, res.Rows)
+	assert.Equal(t, 2, res.Failed)
+	assert.Equal(t, []POIImportError{{Row: 4, Error: "lat and lon must be numbers"}, {Row: 5, Error: "radius_m must be a number"}}, res.Errors)
+
+	p, err := rows[0].in.poi(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "pharmacy", p.Category)
+	assert.Equal(t, "CUST-001", p.ExternalRef)
+	assert.Equal(t, [2]float64{55.2708, 25.2048}, p.Location)
+	assert.Equal(t, 80.0, p.RadiusM)
+	p, err = rows[1].in.poi(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "Warehouse, Jebel Ali", p.Name)
+	assert.Equal(t, float64(DefaultPOIRadiusM), p.RadiusM)
+
+	_, err = readPOICSV(strings.NewReader("name,latitude,longitude\n"), &POIImportResult{})
+	assert.ErrorIs(t, err, ErrInvalidPOI)
+}
+
+func TestPOICells(t *testing.T) {
+	at := geo.Point{Lat: 25.2049, Lon: 55.27995}
+	cells := poiCells(at, MaxPOIRadiusM)
+	for _, bearing := range []float64{0, 45, 90, 135, 180, 225, 270, 315} {
+		p := geo.Destination(at, bearing, MaxPOIRadiusM)
+		assert.Contains(t, cells, poiCell(p), "bearing %v", bearing)
+	}
+	assert.Len(t, poiCells(at, 10), 2, "straddles a cell boundary in longitude")
+
+	near := model.POI{Name: "near", Location: geo.Destination(at, 90, 60).LonLat(), RadiusM: 100}
+	far := model.POI{Name: "far", Location: geo.Destination(at, 0, 150).LonLat(), RadiusM: 100}
+	big := model.POI{Name: "big", Location: geo.Destination(at, 0, 150).LonLat(), RadiusM: 500}
+	closest := model.POI{Name: "closest", Location: geo.Destination(at, 0, 10).LonLat(), RadiusM: 50}
+	var names []string
+	for _, m := range poisWithin([]model.POI{near, far, big, closest}, at, func(p model.POI) float64 { return p.RadiusM }) {
+		names = append(names, m.poi.Name)
+	}
+	assert.Equal(t, []string{"closest", "near", "big"}, names)
+}
+
+func TestStopConfirmed(t *testing.T) {
+	p := DefaultStopParams()
+	id := uuid.New()
+	stop := func(id uuid.UUID, d time.Duration) *model.OpenStop {
+		return &model.OpenStop{Stop: model.Stop{ID: &id, DurationSeconds: d.Seconds()}}
+	}
+	assert.False(t, stopConfirmed(nil, stop(id, 0), p))
+	assert.False(t, stopConfirmed(stop(id, 0), stop(id, time.Minute), p))
+	assert.True(t, stopConfirmed(stop(id, time.Minute), stop(id, 2*time.Minute), p))
+	assert.False(t, stopConfirmed(stop(id, 2*time.Minute), stop(id, 3*time.Minute), p), "only once")
+	assert.False(t, stopConfirmed(stop(id, 3*time.Minute), nil, p))
+}
+
+func TestUnvisited(t *testing.T) {
+	departure := time.Date(2025, 6, 17, 9, 0, 0, 0, time.UTC)
+	a := model.POI{ID: uuid.New(), Name: "a", CreatedAt: departure.AddDate(0, -1, 0)}
+	b := model.POI{ID: uuid.New(), Name: "b", CreatedAt: departure.AddDate(0, -1, 0)}
+	c := model.POI{ID: uuid.New(), Name: "c", CreatedAt: departure}
+	matches := []poiMatch{{poi: a, distM: 10}, {poi: b, distM: 20}, {poi: c, distM: 30}}
+
+	assert.Equal(t, matches, unvisited(matches, nil, departure))
+	left := unvisited(matches, []model.POIVisit{{POIID: b.ID}, {POIID: uuid.New()}}, departure)
+	require.Len(t, left, 2)
+	assert.Equal(t, "a", left[0].poi.Name)
+	assert.Equal(t, "c", left[1].poi.Name)
+	assert.Empty(t, unvisited(matches, []model.POIVisit{{POIID: a.ID}, {POIID: b.ID}, {POIID: c.ID}}, departure))
+
+	// An imported stop from before a POI was added does not visit it
+	left = unvisited(matches, nil, departure.Add(-time.Minute))
+	require.Len(t, left, 2)
+	assert.Equal(t, "b", left[1].poi.Name)
+}
+
+func TestSummarizeVisits(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 9, 0, 0, 0, time.UTC)
+	pharmacy, clinic := uuid.New(), uuid.New()
+	van1, van2 := uuid.New(), uuid.New()
+	visit := func(poi uuid.UUID, name string, van uuid.UUID, plate string, h int, dwell float64) model.POIVisit {
+		return model.POIVisit{POIID: poi, POIName: name, VehicleID: van, PlateNumber: plate,
+			Arrival: t0.Add(time.Duration(h) * time.Hour), DurationSeconds: dwell}
+	}
+	visits := []model.POIVisit{
+		visit(clinic, "Clinic", van1, "D 1", 0, 600),
+		visit(pharmacy, "Pharmacy", van1, "D 1", 1, 300),
+		visit(pharmacy, "Pharmacy", van2, "D 2", 2, 900),
+		visit(pharmacy, "Pharmacy", van1, "D 1", 3, 300),
+	}
+
+	byPOI := summarizeVisits(visits, VisitsByPOI)
+	require.Len(t, byPOI, 2)
+	assert.Equal(t, "Pharmacy", byPOI[0].Name)
+	assert.Equal(t, 3, byPOI[0].Visits)
+	assert.Equal(t, 2, byPOI[0].Distinct)
+	assert.Equal(t, 1500.0, byPOI[0].DwellSeconds)
+	assert.Equal(t, 500.0, byPOI[0].AvgDwellSeconds)
+	assert.Equal(t, t0.Add(time.Hour), byPOI[0].FirstArrival)
+	assert.Equal(t, t0.Add(3*time.Hour), byPOI[0].LastArrival)
+
+	byVehicle := summarizeVisits(visits, VisitsByVehicle)
+	require.Len(t, byVehicle, 2)
+	assert.Equal(t, "D 1", byVehicle[0].Name)
+	assert.Equal(t, 3, byVehicle[0].Visits)
+	assert.Equal(t, 2, byVehicle[0].Distinct)
+}
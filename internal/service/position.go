@@ -0,0 +1,114 @@
+package service
+
+import (
+	"time"
+
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// parsePosition extracts a fix from an ingest status. It reports false when
+// the status carries no usable location. A missing or malformed timestamp
+// falls back to the time of ingest.
+func parsePosition(vehicleID uuid.UUID, status map[string]interface{}) (model.Position, bool) {
+	loc, ok := toLonLat(status["location"])
+	if !ok {
+		return model.Position{}, false
+	}
+	p := model.Position{
+		VehicleID: vehicleID,
+		Location:  loc,
+		Timestamp: statusTime(status),
+	}
+	if v, ok := toFloat(status["speed"]); ok {
+		p.Speed = v
+	}
+	if v, ok := toFloat(status["heading"]); ok {
+		p.Heading = &v
+	}
+	if v, ok := status["ignition"].(bool); ok {
+		p.Ignition = &v
+	}
+	return p, true
+}
+
+// statusTime is the timestamp of an ingest status, or the time of ingest
+// when it is missing or malformed
+func statusTime(status map[string]interface{}) time.Time {
+	if ts, ok := status["timestamp"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+// telemetryPosition is where telemetry of a status without a location is
+// recorded: at the status's time and speed and the last stored location,
+// if the vehicle has one
+func telemetryPosition(vehicleID uuid.UUID, status map[string]interface{}, last *model.Position) model.Position {
+	p := model.Position{VehicleID: vehicleID, Timestamp: statusTime(status)}
+	if last != nil {
+		p.Location = last.Location
+	}
+	if v, ok := toFloat(status["speed"]); ok {
+		p.Speed = v
+	}
+	return p
+}
+
+// reportedDriver returns the driver identified by the device, for example
+// with an RFID card, when the status carries a valid driver_id
+func reportedDriver(status map[string]interface{}) *uuid.UUID {
+	v, ok := status["driver_id"].(string)
+	if !ok {
+		return nil
+	}
+	id, err := uuid.Parse(v)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+func toLonLat(v interface{}) ([2]float64, bool) {
+	var out [2]float64
+	switch loc := v.(type) {
+	case []interface{}:
+		if len(loc) < 2 {
+			return out, false
+		}
+		lon, ok1 := toFloat(loc[0])
+		lat, ok2 := toFloat(loc[1])
+		if !ok1 || !ok2 {
+			return out, false
+		}
+		out = [2]float64{lon, lat}
+	case []float64:
+		if len(loc) < 2 {
+			return out, false
+		}
+		out = [2]float64{loc[0], loc[1]}
+	default:
+		return out, false
+	}
+	if out[0] < -180 || out[0] > 180 || out[1] < -90 || out[1] > 90 {
+		return out, false
+	}
+	return out, true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
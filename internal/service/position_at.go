@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// positionAtWindow is how far from the requested instant fixes are looked up
+const positionAtWindow = 24 * time.Hour
+
+// stationaryM is the largest distance between bracketing fixes that still
+// counts as the vehicle not having moved
+const stationaryM = 50
+
+// Confidence levels of a point-in-time position
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+// ErrNoPosition is returned when a vehicle has no fix near the requested time
+var ErrNoPosition = errors.New("no position near that time")
+
+// PositionAt is the estimated position of a vehicle at an instant.
+// Method is exact, interpolated, last_known (only an earlier fix) or
+// first_known (only a later fix).
+type PositionAt struct {
+	VehicleID  string          `json:"vehicle_id"`
+	At         time.Time       `json:"at"`
+	Location   [2]float64      `json:"location"` // lon, lat
+	Speed      float64         `json:"speed"`
+	Heading    *float64        `json:"heading,omitempty"`
+	Method     string          `json:"method"`
+	Confidence string          `json:"confidence"`
+	GapSeconds float64         `json:"gap_seconds"` // time between the fixes used
+	Address    *model.Address  `json:"address,omitempty"`
+	Before     *model.Position `json:"before,omitempty"`
+	After      *model.Position `json:"after,omitempty"`
+}
+
+// FleetPositionAt is the position of every vehicle with a fix near an instant
+type FleetPositionAt struct {
+	At       time.Time    `json:"at"`
+	Count    int          `json:"count"`
+	Vehicles []PositionAt `json:"vehicles"`
+}
+
+// GetPositionAt estimates where a vehicle was at an instant from the fixes
+// bracketing it
+func (s *Service) GetPositionAt(ctx context.Context, vehicleID string, at time.Time) (*PositionAt, error) {
+	if _, err := uuid.Parse(vehicleID); err != nil {
+		return nil, ErrNoPosition
+	}
+	before, after, err := s.repo.PositionsAround(ctx, vehicleID, at, positionAtWindow)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil && after == nil {
+		return nil, ErrNoPosition
+	}
+	p := estimatePosition(vehicleID, at, before, after)
+	p.Address = s.addresses(ctx, [][2]float64{p.Location})[0]
+	return &p, nil
+}
+
+// GetFleetPositionAt estimates the position of every vehicle, optionally of
+// one group, at an instant
+func (s *Service) GetFleetPositionAt(ctx context.Context, at time.Time, groupID string) (*FleetPositionAt, error) {
+	if groupID != "" {
+		if _, err := uuid.Parse(groupID); err != nil {
+			return nil, ErrInvalidFleetInput
+		}
+	}
+	pairs, err := s.repo.FleetPositionsAround(ctx, at, positionAtWindow, groupID)
+	if err != nil {
+		return nil, err
+	}
+	res := &FleetPositionAt{At: at, Count: len(pairs), Vehicles: make([]PositionAt, len(pairs))}
+	locs := make([][2]float64, len(pairs))
+	for i, pp := range pairs {
+		res.Vehicles[i] = estimatePosition(pp.VehicleID, at, pp.Before, pp.After)
+		locs[i] = res.Vehicles[i].Location
+	}
+	for i, a := range s.addresses(ctx, locs) {
+		res.Vehicles[i].Address = a
+	}
+	return res, nil
+}
+
+// estimatePosition interpolates location, speed and heading linearly between
+// the bracketing fixes. With only one of them the vehicle is assumed to be
+// where it was last or first seen.
+func estimatePosition(vehicleID string, at time.Time, before, after *model.Position) PositionAt {
+	p := PositionAt{VehicleID: vehicleID, At: at, Before: before, After: after}
+	switch {
+	case before != nil && before.Timestamp.Equal(at):
+		p.Location, p.Speed, p.Heading = before.Location, before.Speed, before.Heading
+		p.Method, p.Confidence = "exact", ConfidenceHigh
+		p.Before, p.After = before, nil
+	case before != nil && after != nil:
+		gap := after.Timestamp.Sub(before.Timestamp)
+		f := at.Sub(before.Timestamp).Seconds() / gap.Seconds()
+		a, b := geo.FromLonLat(before.Location), geo.FromLonLat(after.Location)
+		moved := geo.Distance(a, b)
+		p.Location = geo.Interpolate(a, b, f).LonLat()
+		p.Speed = before.Speed + (after.Speed-before.Speed)*f
+		p.Heading = interpolateHeading(before.Heading, after.Heading, f)
+		if p.Heading == nil && moved >= stationaryM {
+			h := geo.Bearing(a, b)
+			p.Heading = &h
+		}
+		p.Method = "interpolated"
+		p.GapSeconds = gap.Seconds()
+		p.Confidence = gapConfidence(gap, moved)
+	case before != nil:
+		p.Location, p.Speed, p.Heading = before.Location, before.Speed, before.Heading
+		p.Method = "last_known"
+		p.GapSeconds = at.Sub(before.Timestamp).Seconds()
+		p.Confidence = edgeConfidence(at.Sub(before.Timestamp), before)
+	default:
+		p.Location, p.Speed, p.Heading = after.Location, after.Speed, after.Heading
+		p.Method = "first_known"
+		p.GapSeconds = after.Timestamp.Sub(at).Seconds()
+		p.Confidence = edgeConfidence(after.Timestamp.Sub(at), after)
+	}
+	return p
+}
+
+// gapConfidence rates an interpolation by the time between its fixes. A
+// vehicle that did not move between them was most likely parked throughout.
+func gapConfidence(gap time.Duration, moved float64) string {
+	switch {
+	case gap <= 30*time.Second:
+		return ConfidenceHigh
+	case moved < stationaryM && gap <= 12*time.Hour:
+		return ConfidenceHigh
+	case gap <= 5*time.Minute:
+		return ConfidenceMedium
+	}
+	return ConfidenceLow
+}
+
+// edgeConfidence rates a position known from one side only. A parked
+// vehicle with the ignition off stays put; a moving one may be anywhere.
+func edgeConfidence(gap time.Duration, fix *model.Position) string {
+	parked := fix.Ignition != nil && !*fix.Ignition
+	switch {
+	case gap <= 30*time.Second:
+		return ConfidenceMedium
+	case parked && gap <= time.Hour:
+		return ConfidenceMedium
+	}
+	return ConfidenceLow
+}
+
+// interpolateHeading turns the shorter way between two headings
+func interpolateHeading(a, b *float64, f float64) *float64 {
+	if a == nil || b == nil {
+		return nil
+	}
+	d := math.Mod(*b-*a+540, 360) - 180
+	h := math.Mod(*a+d*f+360, 360)
+	return &h
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimatePosition(t *testing.T) {
+	t0 := time.Date(2025, 6, 17, 14, 32, 0, 0, time.UTC)
+	origin := geo.Point{Lat: 25.2, Lon: 55.27}
+	h1, h2 := 350.0, 30.0
+	before := &model.Position{Location: origin.LonLat(), Speed: 40, Heading: &h1, Timestamp: t0}
+	after := &model.Position{Location: geo.Destination(origin, 90, 200).LonLat(), Speed: 60, Heading: &h2, Timestamp: t0.Add(20 * time.Second)}
+
+	p := estimatePosition("v", t0.Add(5*time.Second), before, after)
+	assert.Equal(t, "interpolated", p.Method)
+	assert.Equal(t, ConfidenceHigh, p.Confidence)
+	assert.Equal(t, 20.0, p.GapSeconds)
+	assert.InDelta(t, 50, geo.Distance(origin, geo.FromLonLat(p.Location)), 0.5)
+	assert.InDelta(t, 45, p.Speed, 1e-9)
+	require.NotNil(t, p.Heading)
+	assert.InDelta(t, 0, *p.Heading, 1e-9, "turns through north, not south")
+
+	p = estimatePosition("v", t0, before, after)
+	assert.Equal(t, "exact", p.Method)
+	assert.Equal(t, before.Location, p.Location)
+
+	// Ten minutes between fixes 200 m apart is a guess; parked is not
+	after.Timestamp = t0.Add(10 * time.Minute)
+	assert.Equal(t, ConfidenceLow, estimatePosition("v", t0.Add(time.Minute), before, after).Confidence)
+	after.Location = geo.Destination(origin, 90, 10).LonLat()
+	assert.Equal(t, ConfidenceHigh, estimatePosition("v", t0.Add(time.Minute), before, after).Confidence)
+
+	off := false
+	before.Ignition = &off
+	p = estimatePosition("v", t0.Add(20*time.Minute), before, nil)
+	assert.Equal(t, "last_known", p.Method)
+	assert.Equal(t, ConfidenceMedium, p.Confidence)
+	assert.Equal(t, 1200.0, p.GapSeconds)
+	p = estimatePosition("v", t0.Add(-2*time.Hour), nil, after)
+	assert.Equal(t, "first_known", p.Method)
+	assert.Equal(t, ConfidenceLow, p.Confidence)
+}
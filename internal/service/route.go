@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+)
+
+// MaxRouteRange limits how much history a single playback request may load
+const MaxRouteRange = 31 * 24 * time.Hour
+
+// ErrInvalidRange is returned for empty, reversed or too long time ranges
+var ErrInvalidRange = errors.New("invalid time range")
+
+// RoutePlayback is the path a vehicle travelled in a time range
+type RoutePlayback struct {
+	VehicleID        string       `json:"vehicle_id"`
+	From             time.Time    `json:"from"`
+	To               time.Time    `json:"to"`
+	Points           int          `json:"points"`
+	SimplifiedPoints int          `json:"simplified_points"`
+	DistanceKm       float64      `json:"distance_km"`
+	Polyline         string       `json:"polyline"`
+	GeoJSON          geo.Feature  `json:"geojson"`
+	Stops            []model.Stop `json:"stops"`
+}
+
+// ValidateRange checks that from is before to and the range is not longer than max
+func ValidateRange(from, to time.Time, max time.Duration) error {
+	if !from.Before(to) {
+		return ErrInvalidRange
+	}
+	if max > 0 && to.Sub(from) > max {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// GetRoute returns the travelled path from stored positions. tolerance (in
+// metres) simplifies the path with Douglas-Peucker; 0 keeps every fix. Stops
+// are detected on the full-resolution positions.
+func (s *Service) GetRoute(ctx context.Context, vehicleID string, from, to time.Time, tolerance float64, sp StopParams) (*RoutePlayback, error) {
+	if err := ValidateRange(from, to, MaxRouteRange); err != nil {
+		return nil, err
+	}
+	positions, err := s.repo.GetPositions(ctx, vehicleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	route := buildRoute(vehicleID, from, to, positions, tolerance, sp)
+	s.addStopAddresses(ctx, route.Stops)
+	return route, nil
+}
+
+func buildRoute(vehicleID string, from, to time.Time, positions []model.Position, tolerance float64, sp StopParams) *RoutePlayback {
+	pts := make([]geo.Point, len(positions))
+	for i, p := range positions {
+		pts[i] = geo.FromLonLat(p.Location)
+	}
+	idx := geo.Simplify(pts, tolerance)
+
+	kept := make([]geo.Point, len(idx))
+	times := make([]string, len(idx))
+	speeds := make([]float64, len(idx))
+	for i, k := range idx {
+		kept[i] = pts[k]
+		times[i] = positions[k].Timestamp.UTC().Format(time.RFC3339)
+		speeds[i] = positions[k].Speed
+	}
+
+	return &RoutePlayback{
+		VehicleID:        vehicleID,
+		From:             from,
+		To:               to,
+		Points:           len(positions),
+		SimplifiedPoints: len(idx),
+		DistanceKm:       math.Round(geo.PathLength(pts)) / 1000,
+		Polyline:         geo.EncodePolyline(kept),
+		GeoJSON: geo.NewLineString(kept, map[string]interface{}{
+			"vehicle_id": vehicleID,
+			"coordTimes": times,
+			"speeds":     speeds,
+		}),
+		Stops: detectStops(positions, sp),
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// track builds fixes every 30s: driving east at 36 km/h, a 5 minute stop, then driving again
+func track(vehicleID uuid.UUID, start time.Time) []model.Position {
+	var out []model.Position
+	p := geo.Point{Lat: 25.2, Lon: 55.27}
+	ts := start
+	add := func(speed float64) {
+		out = append(out, model.Position{VehicleID: vehicleID, Location: p.LonLat(), Speed: speed, Timestamp: ts})
+		ts = ts.Add(30 * time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		add(36)
+		p = geo.Destination(p, 90, 300)
+	}
+	for i := 0; i < 10; i++ {
+		add(0)
+	}
+	for i := 0; i < 10; i++ {
+		p = geo.Destination(p, 90, 300)
+		add(36)
+	}
+	return out
+}
+
+func TestDetectStops(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	stops := detectStops(track(vid, start), DefaultStopParams())
+
+	if assert.Len(t, stops, 1) {
+		assert.Equal(t, start.Add(5*time.Minute), stops[0].Arrival)
+		assert.Equal(t, start.Add(10*time.Minute), stops[0].Departure)
+		assert.Equal(t, 300.0, stops[0].DurationSeconds)
+	}
+
+	sp := DefaultStopParams()
+	sp.MinDuration = 10 * time.Minute
+	assert.Empty(t, detectStops(track(vid, start), sp))
+}
+
+func TestAdvanceStopMatchesDetectStops(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	p := DefaultStopParams()
+
+	var open *model.OpenStop
+	var stops []model.Stop
+	for _, fix := range track(vid, start) {
+		var ended *model.OpenStop
+		open, ended = advanceStop(open, fix, p)
+		if ended != nil && ended.Departure.Sub(ended.Arrival) >= p.MinDuration {
+			stops = append(stops, ended.Stop)
+		}
+	}
+	assert.Nil(t, open)
+	if assert.Len(t, stops, 1) {
+		want := detectStops(track(vid, start), p)[0]
+		assert.Equal(t, want.Arrival, stops[0].Arrival)
+		assert.Equal(t, want.Departure, stops[0].Departure)
+		assert.Equal(t, want.DurationSeconds, stops[0].DurationSeconds)
+		assert.False(t, stops[0].InProgress)
+		assert.False(t, stops[0].Idling)
+	}
+}
+
+func TestAdvanceStopIdling(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	loc := [2]float64{55.27, 25.2}
+	on, off := true, false
+	fix := func(min int, speed float64, ign *bool) model.Position {
+		return model.Position{VehicleID: vid, Location: loc, Speed: speed, Ignition: ign, Timestamp: start.Add(time.Duration(min) * time.Minute)}
+	}
+
+	open, _ := advanceStop(nil, fix(0, 0, &on), DefaultStopParams())
+	open, _ = advanceStop(open, fix(6, 0, &off), DefaultStopParams())
+	open, _ = advanceStop(open, fix(8, 0, &off), DefaultStopParams())
+	assert.True(t, open.InProgress)
+	assert.Equal(t, 480.0, open.DurationSeconds)
+	assert.Equal(t, 360.0, open.IdleSeconds)
+	assert.True(t, open.Idling)
+
+	stale, ended := advanceStop(open, fix(7, 0, &on), DefaultStopParams())
+	assert.Same(t, open, stale, "older fixes are ignored")
+	assert.Nil(t, ended)
+
+	next, ended := advanceStop(open, fix(10, 40, &on), DefaultStopParams())
+	assert.Nil(t, next)
+	if assert.NotNil(t, ended) {
+		assert.Equal(t, 600.0, ended.DurationSeconds)
+		assert.Equal(t, 360.0, ended.IdleSeconds)
+		assert.True(t, ended.Idling)
+	}
+}
+
+func TestBuildRoute(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	positions := track(vid, start)
+
+	full := buildRoute(vid.String(), start, start.Add(time.Hour), positions, 0, DefaultStopParams())
+	assert.Equal(t, len(positions), full.SimplifiedPoints)
+	assert.InDelta(t, 6.0, full.DistanceKm, 0.01)
+
+	simple := buildRoute(vid.String(), start, start.Add(time.Hour), positions, 5, DefaultStopParams())
+	assert.Equal(t, 2, simple.SimplifiedPoints, "a straight track simplifies to its endpoints")
+	decoded, err := geo.DecodePolyline(simple.Polyline)
+	assert.NoError(t, err)
+	assert.Len(t, decoded, 2)
+	assert.Len(t, simple.GeoJSON.Properties["coordTimes"], 2)
+	assert.Len(t, simple.Stops, 1)
+
+	empty := buildRoute(vid.String(), start, start.Add(time.Hour), nil, 5, DefaultStopParams())
+	assert.Equal(t, 0, empty.Points)
+	assert.NotNil(t, empty.Stops)
+}
+
+func TestParsePosition(t *testing.T) {
+	vid := uuid.New()
+	p, ok := parsePosition(vid, map[string]interface{}{
+		"location":  []interface{}{55.29, 25.27},
+		"speed":     60.5,
+		"ignition":  true,
+		"timestamp": "2025-06-17T09:12:00Z",
+	})
+	assert.True(t, ok)
+	assert.Equal(t, [2]float64{55.29, 25.27}, p.Location)
+	assert.Equal(t, 60.5, p.Speed)
+	assert.True(t, *p.Ignition)
+	assert.Nil(t, p.Heading)
+	assert.Equal(t, time.Date(2025, 6, 17, 9, 12, 0, 0, time.UTC), p.Timestamp)
+
+	_, ok = parsePosition(vid, map[string]interface{}{"speed": 10.0})
+	assert.False(t, ok)
+	_, ok = parsePosition(vid, map[string]interface{}{"location": []interface{}{255.0, 25.0}})
+	assert.False(t, ok)
+}
@@ -7,13 +7,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
+	"fleet-tracker-service/internal/geocode"
+	"fleet-tracker-service/internal/mapmatch"
 	"fleet-tracker-service/internal/model"
 	"fleet-tracker-service/internal/repository"
+	"fleet-tracker-service/internal/storage"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -24,13 +27,27 @@ type IngestPayload struct {
 	Status      map[string]interface{} `json:"status"`
 }
 
+// StatusUpdate is published every time a vehicle status is ingested
+type StatusUpdate struct {
+	VehicleID string                 `json:"vehicle_id"`
+	Status    map[string]interface{} `json:"status"`
+}
+
+const statusUpdatesChannel = "vehicle:status:updates"
+
 type Service struct {
-	repo *repository.Repo
-	rdb  *redis.Client
+	repo     *repository.Repo
+	rdb      *redis.Client
+	filter   FilterConfig
+	speeding SpeedingConfig
+	roads    atomic.Pointer[mapmatch.Graph]
+	geocoder atomic.Pointer[geocode.Geocoder]
+	// attachments keeps proof-of-delivery files
+	attachments storage.Store
 }
 
 func NewService(r *repository.Repo, rdb *redis.Client) *Service {
-	return &Service{repo: r, rdb: rdb}
+	return &Service{repo: r, rdb: rdb, filter: DefaultFilterConfig(), speeding: DefaultSpeedingConfig()}
 }
 
 func cacheKeyStatus(vehicleID string) string {
@@ -43,41 +60,356 @@ func randID() string {
 	return hex.EncodeToString(b)
 }
 
-func (s *Service) Ingest(ctx context.Context, p IngestPayload) error {
+// ErrInvalidPayload is returned when an ingest payload fails validation
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// Validate checks the payload before it is stored or queued
+func (p IngestPayload) Validate() error {
 	if p.VehicleID == "" || p.Status == nil {
-		return errors.New("invalid payload")
+		return ErrInvalidPayload
 	}
+	if _, err := uuid.Parse(p.VehicleID); err != nil {
+		return fmt.Errorf("%w: invalid vehicle_id: %v", ErrInvalidPayload, err)
+	}
+	return nil
+}
 
-	if err := s.repo.UpsertVehicleStatus(ctx, p.VehicleID, p.PlateNumber, p.Status); err != nil {
+func (s *Service) Ingest(ctx context.Context, p IngestPayload) error {
+	if err := p.Validate(); err != nil {
 		return err
 	}
-
-	vehicleUUID, err := uuid.Parse(p.VehicleID)
-	if err != nil {
-		return fmt.Errorf("invalid vehicle_id: %w", err)
+	if _, err := s.store(ctx, &p); err != nil {
+		return err
 	}
 
-	if tsRaw, ok := p.Status["timestamp"].(string); ok {
-		if ts, err := time.Parse(time.RFC3339, tsRaw); err == nil {
-			t := model.Trip{
-				ID:        uuid.New(),
-				VehicleID: vehicleUUID,
-				StartTime: ts.Add(-1 * time.Minute),
-				EndTime:   ts,
-				Mileage:   0.5,
-				AvgSpeed:  30.0,
-			}
-			_ = s.repo.InsertTrip(ctx, t)
-		}
-	}
 	key := cacheKeyStatus(p.VehicleID)
 	b, _ := json.Marshal(p.Status)
 	if err := s.rdb.Set(ctx, key, b, 5*time.Minute).Err(); err != nil {
 		fmt.Println("redis set error:", err)
 	}
+	s.publishStatus(ctx, p.VehicleID, p.Status)
 	return nil
 }
 
+// storeResult is what store did with a payload
+type storeResult int
+
+const (
+	storeStored    storeResult = iota
+	storeDuplicate             // the fix was already stored; nothing changed
+	storeRejected              // the noise filter dropped the fix; only the status and non-GPS telemetry were stored
+)
+
+// store writes a validated payload, its position, trip and stop segmentation,
+// meters and outbox events in one transaction. When the noise filter rejects
+// the fix, p.Status is given the last stored location instead.
+func (s *Service) store(ctx context.Context, p *IngestPayload) (storeResult, error) {
+	var res storeResult
+	// State changes and their outbox events commit or roll back together
+	err := s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		var err error
+		res, err = s.storeTx(ctx, tx, p, false)
+		return err
+	})
+	return res, err
+}
+
+// storeTx is store within the caller's transaction. Historical payloads
+// never replace the live status and are not segmented fix by fix: imports
+// segment the stored range afterwards with segmentHistory. A rejected fix
+// is recorded as such and its non-GPS telemetry is still applied, but it is
+// not stored, smoothed or used for anything that depends on the location.
+// Fuel and diagnostics reported without a location are still recorded at
+// the payload's timestamp and the last stored location.
+func (s *Service) storeTx(ctx context.Context, tx *repository.Repo, p *IngestPayload, historical bool) (storeResult, error) {
+	vehicleUUID := uuid.MustParse(p.VehicleID)
+	res := storeStored
+
+	err := func() error {
+		pos, ok := parsePosition(vehicleUUID, p.Status)
+		var q fixQuality
+		if ok {
+			q = parseFixQuality(p.Status)
+			rej, err := s.rejectFix(ctx, tx, pos, q)
+			if err != nil {
+				return err
+			}
+			if rej != nil {
+				res = storeRejected
+				if fresh, err := tx.InsertRejectedPosition(ctx, *rej); err != nil || !fresh {
+					// Already recorded, so its telemetry was applied too
+					return err
+				}
+				last, err := tx.LastPositionBefore(ctx, p.VehicleID, pos.Timestamp)
+				if err != nil {
+					return err
+				}
+				p.Status = rejectedStatus(p.Status, last)
+			}
+		}
+		located := ok && res != storeRejected
+
+		var events []model.Event
+		var inserted bool
+		var err error
+		if historical {
+			inserted, err = tx.EnsureVehicle(ctx, p.VehicleID, p.PlateNumber, p.Status)
+		} else {
+			inserted, err = tx.UpsertVehicleStatus(ctx, p.VehicleID, p.PlateNumber, p.Status)
+		}
+		if err != nil {
+			return err
+		}
+		if inserted {
+			e, err := model.NewEvent(model.EventVehicleRegistered, vehicleUUID, map[string]interface{}{
+				"vehicle_id":   p.VehicleID,
+				"plate_number": p.PlateNumber,
+			})
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+
+		if located {
+			if pos, err = s.smoothFix(ctx, tx, pos, q); err != nil {
+				return err
+			}
+			stored, err := tx.InsertPosition(ctx, pos)
+			if err != nil {
+				return err
+			}
+			if !stored {
+				res = storeDuplicate
+				return tx.InsertEvents(ctx, events...)
+			}
+		}
+		if res != storeRejected {
+			e, err := model.NewEvent(model.EventPositionRecorded, vehicleUUID, p)
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+
+		var prog tripProgress
+		if ok {
+			if located && !historical {
+				te, tp, err := segmentTrip(ctx, tx, pos, p.Status)
+				if err != nil {
+					return err
+				}
+				prog = tp
+				events = append(events, te...)
+				se, err := segmentStop(ctx, tx, pos)
+				if err != nil {
+					return err
+				}
+				events = append(events, se...)
+			}
+			if err := advanceMeters(ctx, tx, pos, p.Status, prog); err != nil {
+				return err
+			}
+		} else {
+			// Fuel and trouble code events are placed at the last stored location
+			var last *model.Position
+			_, fuel := fuelLevel(p.Status)
+			if _, dtcs := reportedDTCs(p.Status); fuel || dtcs {
+				if last, err = tx.LastPositionBefore(ctx, p.VehicleID, statusTime(p.Status)); err != nil {
+					return err
+				}
+			}
+			pos = telemetryPosition(vehicleUUID, p.Status, last)
+		}
+		fe, err := recordFuel(ctx, tx, pos, p.Status)
+		if err != nil {
+			return err
+		}
+		events = append(events, fe...)
+		de, err := recordDiagnostics(ctx, tx, pos, p.Status)
+		if err != nil {
+			return err
+		}
+		events = append(events, de...)
+		if ok {
+			if err := s.recordHarshEvents(ctx, tx, pos, p.Status, prog, located); err != nil {
+				return err
+			}
+		}
+		if located {
+			je, err := advanceJobs(ctx, tx, pos)
+			if err != nil {
+				return err
+			}
+			events = append(events, je...)
+
+			re, err := trackRoutes(ctx, tx, pos)
+			if err != nil {
+				return err
+			}
+			events = append(events, re...)
+		}
+		return tx.InsertEvents(ctx, events...)
+	}()
+	return res, err
+}
+
+// tripProgress is what a fix changed about the vehicle's trips
+type tripProgress struct {
+	km        float64     // distance added to the open or completed trip
+	completed *model.Trip // trip the fix completed, if any
+	trip      *model.Trip // trip the fix belongs to, if any
+	stale     bool        // the fix was older than the open trip's last fix
+}
+
+// segmentTrip advances the vehicle's open trip with a newly stored fix and
+// returns the resulting trip events
+func segmentTrip(ctx context.Context, tx *repository.Repo, pos model.Position, status map[string]interface{}) ([]model.Event, tripProgress, error) {
+	var prog tripProgress
+	open, err := tx.GetOpenTrip(ctx, pos.VehicleID.String())
+	if err != nil {
+		return nil, prog, err
+	}
+	next, completed := advanceTrip(open, pos, DefaultTripParams())
+	prog.km = tripDistanceAdded(open, next, completed)
+	prog.stale = open != nil && !pos.Timestamp.After(open.LastFixAt)
+
+	var events []model.Event
+	if completed != nil {
+		prog.completed = &completed.Trip
+		if err := tx.SaveTrip(ctx, *completed); err != nil {
+			return nil, prog, err
+		}
+		e, err := tripCompletedEvent(completed.Trip)
+		if err != nil {
+			return nil, prog, err
+		}
+		events = append(events, e)
+	}
+	if next != nil && next != open {
+		started := open == nil || next.ID != open.ID
+		if started {
+			if next.DriverID, err = tx.TripDriver(ctx, pos.VehicleID.String(), reportedDriver(status)); err != nil {
+				return nil, prog, err
+			}
+		}
+		if err := tx.SaveTrip(ctx, *next); err != nil {
+			return nil, prog, err
+		}
+		if started {
+			e, err := tripStartedEvent(next.Trip)
+			if err != nil {
+				return nil, prog, err
+			}
+			events = append(events, e)
+		}
+	}
+	switch {
+	case next != nil:
+		prog.trip = &next.Trip
+	case completed != nil:
+		prog.trip = prog.completed
+	}
+	return events, prog, nil
+}
+
+// segmentStop advances the vehicle's open stop with a newly stored fix.
+// A stop that lasts long enough records visits to the POIs it is within;
+// the arrival and departure events are returned.
+func segmentStop(ctx context.Context, tx *repository.Repo, pos model.Position) ([]model.Event, error) {
+	open, err := tx.GetOpenStop(ctx, pos.VehicleID.String())
+	if err != nil {
+		return nil, err
+	}
+	p := DefaultStopParams()
+	next, ended := advanceStop(open, pos, p)
+
+	var events []model.Event
+	if ended != nil {
+		if ended.Departure.Sub(ended.Arrival) < p.MinDuration {
+			if err := tx.DeleteStop(ctx, ended.ID.String()); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := tx.SaveStop(ctx, *ended); err != nil {
+				return nil, err
+			}
+			if events, err = endPOIVisits(ctx, tx, ended.Stop); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if next == nil || next == open {
+		return events, nil
+	}
+	if err := tx.SaveStop(ctx, *next); err != nil {
+		return nil, err
+	}
+	if !stopConfirmed(open, next, p) {
+		return events, nil
+	}
+	ve, err := recordPOIVisits(ctx, tx, next.Stop, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(events, ve...), nil
+}
+
+func (s *Service) publishStatus(ctx context.Context, vehicleID string, status map[string]interface{}) {
+	b, err := json.Marshal(StatusUpdate{VehicleID: vehicleID, Status: status})
+	if err != nil {
+		return
+	}
+	if err := s.rdb.Publish(ctx, statusUpdatesChannel, b).Err(); err != nil {
+		fmt.Println("redis publish error:", err)
+	}
+}
+
+// WatchStatus streams ingested status updates for the given vehicles, or for
+// every vehicle when vehicleIDs is empty. The channel is closed once ctx is done.
+func (s *Service) WatchStatus(ctx context.Context, vehicleIDs []string) (<-chan StatusUpdate, error) {
+	sub := s.rdb.Subscribe(ctx, statusUpdatesChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+
+	filter := make(map[string]bool, len(vehicleIDs))
+	for _, id := range vehicleIDs {
+		filter[id] = true
+	}
+
+	out := make(chan StatusUpdate)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var u StatusUpdate
+				if err := json.Unmarshal([]byte(msg.Payload), &u); err != nil {
+					continue
+				}
+				if len(filter) > 0 && !filter[u.VehicleID] {
+					continue
+				}
+				select {
+				case out <- u:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
 func (s *Service) GetStatus(ctx context.Context, vehicleID string) (map[string]interface{}, error) {
 	key := cacheKeyStatus(vehicleID)
 	vcmd := s.rdb.Get(ctx, key)
@@ -85,6 +417,8 @@ func (s *Service) GetStatus(ctx context.Context, vehicleID string) (map[string]i
 	if err := vcmd.Scan(&raw); err == nil {
 		var m map[string]interface{}
 		if err := json.Unmarshal([]byte(raw), &m); err == nil {
+			s.addStatusAddress(ctx, m)
+			s.addStatusMeters(ctx, vehicleID, m)
 			return m, nil
 		}
 	}
@@ -98,49 +432,17 @@ func (s *Service) GetStatus(ctx context.Context, vehicleID string) (map[string]i
 	if err := s.rdb.Set(ctx, key, st, 5*time.Minute).Err(); err != nil {
 		fmt.Println("redis set error:", err)
 	}
+	s.addStatusAddress(ctx, st)
+	s.addStatusMeters(ctx, vehicleID, st)
 	return st, nil
 }
 
 func (s *Service) GetTripsLast24h(ctx context.Context, vehicleID string) ([]model.Trip, error) {
 	since := time.Now().Add(-24 * time.Hour)
-	return s.repo.GetTripsSince(ctx, vehicleID, since)
-}
-
-func (s *Service) StartSimulator(ctx context.Context) {
-	go func() {
-		vehicleIDs, err := s.repo.GetAllVehicleIDs(ctx)
-		if err != nil {
-			log.Printf("Error fetching vehicle IDs: %v", err)
-			return
-		}
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				for _, vid := range vehicleIDs {
-					now := time.Now().UTC()
-					status := map[string]interface{}{
-						"location":  []float64{55.296249 + randOffset(), 25.276987 + randOffset()},
-						"speed":     40 + randFloat(0, 30),
-						"timestamp": now.Format(time.RFC3339),
-					}
-
-					_ = s.Ingest(ctx, IngestPayload{VehicleID: vid, Status: status})
-
-					log.Printf("Simulated data for Vehicle ID: %s, Status: %v", vid, status)
-				}
-				time.Sleep(2 * time.Second)
-			}
-		}
-	}()
-}
-
-func randOffset() float64 {
-	return (randFloat(-0.001, 0.001))
-}
-
-func randFloat(min, max float64) float64 {
-	return min + (max-min)*float64(time.Now().UnixNano()%1000)/1000.0
+	trips, err := s.repo.GetTripsSince(ctx, vehicleID, since)
+	if err != nil {
+		return nil, err
+	}
+	s.addTripAddresses(ctx, trips)
+	return trips, nil
 }
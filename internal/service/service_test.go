@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -179,6 +180,28 @@ func TestCacheKeyStatus(t *testing.T) {
 	}
 }
 
+func TestIngestPayloadValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		payload IngestPayload
+		wantErr bool
+	}{
+		{"valid", IngestPayload{VehicleID: uuid.New().String(), Status: map[string]interface{}{"speed": 10.0}}, false},
+		{"missing vehicle", IngestPayload{Status: map[string]interface{}{}}, true},
+		{"missing status", IngestPayload{VehicleID: uuid.New().String()}, true},
+		{"bad uuid", IngestPayload{VehicleID: "123", Status: map[string]interface{}{}}, true},
+	}
+	for _, tc := range testCases {
+		err := tc.payload.Validate()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: expected ErrInvalidPayload, got %v", tc.name, err)
+		}
+	}
+}
+
 func TestRandIDUnique(t *testing.T) {
 	firstID := randID()
 	secondID := randID()
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// SpeedingConfig controls what counts as overspeed. A fix is held to the
+// maxspeed of the road it is on, or DefaultLimitKmh where the road network
+// is not loaded or the road has no limit, and is over when it exceeds that
+// limit by more than TolerancePct.
+type SpeedingConfig struct {
+	TolerancePct    float64
+	DefaultLimitKmh float64
+	RoadRadiusM     float64 // how far from a road a fix may be to be on it
+}
+
+// DefaultSpeedingConfig returns the overspeed rules used when none are configured
+func DefaultSpeedingConfig() SpeedingConfig {
+	return SpeedingConfig{TolerancePct: 10, DefaultLimitKmh: 120, RoadRadiusM: 30}
+}
+
+// SetSpeeding replaces the overspeed rules
+func (s *Service) SetSpeeding(cfg SpeedingConfig) {
+	s.speeding = cfg
+}
+
+// over reports whether speed breaks limit beyond the tolerance
+func (c SpeedingConfig) over(speed, limit float64) bool {
+	return limit > 0 && speed > limit*(1+c.TolerancePct/100)
+}
+
+// speedLimit is the limit a fix is held to
+type speedLimit struct {
+	kmh    float64
+	source string
+	road   string
+}
+
+// speedLimit looks up the posted limit where a fix was taken
+func (s *Service) speedLimit(pos model.Position) speedLimit {
+	lim := speedLimit{kmh: s.speeding.DefaultLimitKmh, source: model.LimitDefault}
+	g := s.roads.Load()
+	if g == nil {
+		return lim
+	}
+	r, _, ok := g.RoadAt(geo.FromLonLat(pos.Location), pos.Heading, s.speeding.RoadRadiusM)
+	if !ok {
+		return lim
+	}
+	lim.road = r.Name
+	if lim.road == "" {
+		lim.road = r.Ref
+	}
+	if r.MaxSpeedKmh > 0 {
+		lim.kmh, lim.source = r.MaxSpeedKmh, model.LimitRoad
+	}
+	return lim
+}
+
+// GetSpeedingReport returns the overspeed episodes starting in a time
+// range, optionally of one vehicle, driver or group, lasting at least
+// q.MinDuration
+func (s *Service) GetSpeedingReport(ctx context.Context, q repository.SpeedingQuery) ([]model.SpeedingViolation, error) {
+	if err := ValidateRange(q.From, q.To, MaxScoreRange); err != nil {
+		return nil, err
+	}
+	if q.MinDuration < 0 {
+		return nil, fmt.Errorf("%w: min_duration must not be negative", ErrInvalidScoring)
+	}
+	for name, id := range map[string]string{"vehicle_id": q.VehicleID, "driver_id": q.DriverID, "group_id": q.GroupID} {
+		if _, err := uuid.Parse(id); id != "" && err != nil {
+			return nil, fmt.Errorf("%w: invalid %s", ErrInvalidScoring, name)
+		}
+	}
+	return s.repo.GetSpeedingViolations(ctx, q)
+}
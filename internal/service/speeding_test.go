@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/mapmatch"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/osm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeedLimit(t *testing.T) {
+	origin := geo.Point{Lat: 25.2, Lon: 55.27}
+	coords := map[int64][2]float64{
+		1: origin.LonLat(),
+		2: geo.Destination(origin, 90, 1000).LonLat(),
+		3: geo.Destination(origin, 0, 500).LonLat(),
+		4: geo.Destination(geo.Destination(origin, 0, 500), 90, 1000).LonLat(),
+	}
+	g := mapmatch.Build([]osm.Way{
+		{ID: 1, Nodes: []int64{1, 2}, Tags: map[string]string{"highway": "residential", "name": "School Lane", "maxspeed": "40"}},
+		{ID: 2, Nodes: []int64{3, 4}, Tags: map[string]string{"highway": "primary", "ref": "E44"}},
+	}, coords)
+
+	s := &Service{speeding: DefaultSpeedingConfig()}
+	at := func(p geo.Point) model.Position { return model.Position{Location: p.LonLat()} }
+	lane := at(geo.Destination(origin, 90, 300))
+	assert.Equal(t, speedLimit{kmh: 120, source: model.LimitDefault}, s.speedLimit(lane), "no road network loaded")
+
+	s.SetRoadNetwork(g)
+	assert.Equal(t, speedLimit{kmh: 40, source: model.LimitRoad, road: "School Lane"}, s.speedLimit(lane))
+	e44 := at(geo.Destination(geo.Destination(origin, 0, 500), 90, 300))
+	assert.Equal(t, speedLimit{kmh: 120, source: model.LimitDefault, road: "E44"}, s.speedLimit(e44),
+		"roads without maxspeed fall back to the default")
+
+	assert.False(t, s.speeding.over(44, 40), "within the 10% tolerance")
+	assert.True(t, s.speeding.over(45, 40))
+	assert.False(t, s.speeding.over(200, 0))
+}
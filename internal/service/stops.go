@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// StopParams controls stop detection
+type StopParams struct {
+	MaxSpeedKmh float64       // fixes at or below this speed count as stationary
+	RadiusM     float64       // all fixes of a stop stay within this radius of its first fix
+	MinDuration time.Duration // shorter pauses are ignored
+}
+
+// DefaultStopParams returns the thresholds used when none are given
+func DefaultStopParams() StopParams {
+	return StopParams{MaxSpeedKmh: 3, RadiusM: 50, MinDuration: 2 * time.Minute}
+}
+
+// detectStops finds runs of consecutive slow fixes that stay within the
+// radius for at least the minimum duration. positions must be in time order.
+// A stop departs at the first fix that leaves it, or at the last fix when the
+// vehicle is still stopped at the end of the range.
+func detectStops(positions []model.Position, p StopParams) []model.Stop {
+	stops := []model.Stop{}
+	i := 0
+	for i < len(positions) {
+		if positions[i].Speed > p.MaxSpeedKmh {
+			i++
+			continue
+		}
+		anchor := geo.FromLonLat(positions[i].Location)
+		j := i + 1
+		for j < len(positions) && positions[j].Speed <= p.MaxSpeedKmh &&
+			geo.Distance(anchor, geo.FromLonLat(positions[j].Location)) <= p.RadiusM {
+			j++
+		}
+
+		departure := positions[j-1].Timestamp
+		if j < len(positions) {
+			departure = positions[j].Timestamp
+		}
+		arrival := positions[i].Timestamp
+		if departure.Sub(arrival) >= p.MinDuration {
+			idle := 0.0
+			for k := i; k < j; k++ {
+				next := departure
+				if k+1 < j {
+					next = positions[k+1].Timestamp
+				}
+				idle += idleSeconds(positions[k].Ignition, next.Sub(positions[k].Timestamp))
+			}
+			duration := departure.Sub(arrival).Seconds()
+			stops = append(stops, model.Stop{
+				VehicleID:       positions[i].VehicleID,
+				Location:        centroid(positions[i:j]),
+				Arrival:         arrival,
+				Departure:       departure,
+				DurationSeconds: duration,
+				IdleSeconds:     idle,
+				Idling:          isIdling(idle, duration),
+			})
+		}
+		i = j
+	}
+	return stops
+}
+
+// maxIdleGap caps the time credited as idling between two fixes, so a
+// device that went silent is not assumed to have kept the engine running
+const maxIdleGap = 30 * time.Minute
+
+func idleSeconds(ignition *bool, gap time.Duration) float64 {
+	if ignition == nil || !*ignition || gap <= 0 || gap > maxIdleGap {
+		return 0
+	}
+	return gap.Seconds()
+}
+
+func isIdling(idle, duration float64) bool {
+	return duration > 0 && idle >= duration/2
+}
+
+// advanceStop applies fix to the vehicle's open stop, which is nil when the
+// vehicle is moving. It returns the open stop afterwards and the stop the
+// fix ended, if any, which the caller discards when it is shorter than
+// MinDuration. Unlike trips, a long silence does not end a stop: a parked
+// device often stops reporting.
+func advanceStop(open *model.OpenStop, fix model.Position, p StopParams) (next, ended *model.OpenStop) {
+	stationary := fix.Speed <= p.MaxSpeedKmh
+	if open != nil {
+		if !fix.Timestamp.After(open.LastFixAt) {
+			return open, nil
+		}
+		st := *open
+		st.IdleSeconds += idleSeconds(st.LastIgnition, fix.Timestamp.Sub(st.LastFixAt))
+		st.Departure = fix.Timestamp
+		st.DurationSeconds = st.Departure.Sub(st.Arrival).Seconds()
+		if stationary && geo.Distance(geo.FromLonLat(st.Anchor), geo.FromLonLat(fix.Location)) <= p.RadiusM {
+			st.SumLon += fix.Location[0]
+			st.SumLat += fix.Location[1]
+			st.Fixes++
+			st.Location = [2]float64{st.SumLon / float64(st.Fixes), st.SumLat / float64(st.Fixes)}
+			st.LastFixAt = fix.Timestamp
+			st.LastIgnition = fix.Ignition
+			st.Idling = isIdling(st.IdleSeconds, st.DurationSeconds)
+			return &st, nil
+		}
+		st.InProgress = false
+		st.Idling = isIdling(st.IdleSeconds, st.DurationSeconds)
+		ended = &st
+	}
+	if !stationary {
+		return nil, ended
+	}
+	id := uuid.New()
+	return &model.OpenStop{
+		Stop: model.Stop{
+			ID:         &id,
+			VehicleID:  fix.VehicleID,
+			Location:   fix.Location,
+			Arrival:    fix.Timestamp,
+			Departure:  fix.Timestamp,
+			InProgress: true,
+		},
+		Anchor:       fix.Location,
+		SumLon:       fix.Location[0],
+		SumLat:       fix.Location[1],
+		Fixes:        1,
+		LastFixAt:    fix.Timestamp,
+		LastIgnition: fix.Ignition,
+	}, ended
+}
+
+func centroid(positions []model.Position) [2]float64 {
+	var lon, lat float64
+	for _, p := range positions {
+		lon += p.Location[0]
+		lat += p.Location[1]
+	}
+	n := float64(len(positions))
+	return [2]float64{lon / n, lat / n}
+}
+
+// StopReport summarises the stops of a vehicle in a time range
+type StopReport struct {
+	VehicleID      string       `json:"vehicle_id"`
+	From           time.Time    `json:"from"`
+	To             time.Time    `json:"to"`
+	Count          int          `json:"count"`
+	DwellSeconds   float64      `json:"dwell_seconds"`
+	IdleSeconds    float64      `json:"idle_seconds"`
+	IdlingStops    int          `json:"idling_stops"`
+	LongestSeconds float64      `json:"longest_seconds"`
+	Stops          []model.Stop `json:"stops"`
+}
+
+// GetStops returns the stored stops of a vehicle arriving in [from, to).
+// minDuration raises the detection threshold; idling filters on idle stops
+// when set.
+func (s *Service) GetStops(ctx context.Context, vehicleID string, from, to time.Time, minDuration time.Duration, idling *bool) (*StopReport, error) {
+	if err := ValidateRange(from, to, MaxRouteRange); err != nil {
+		return nil, err
+	}
+	stops, err := s.repo.GetStops(ctx, repository.StopQuery{
+		VehicleID:   vehicleID,
+		From:        from,
+		To:          to,
+		MinDuration: minDuration,
+		Idling:      idling,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.addStopAddresses(ctx, stops)
+	rep := &StopReport{VehicleID: vehicleID, From: from, To: to, Count: len(stops), Stops: stops}
+	for _, st := range stops {
+		rep.DwellSeconds += st.DurationSeconds
+		rep.IdleSeconds += st.IdleSeconds
+		if st.Idling {
+			rep.IdlingStops++
+		}
+		if st.DurationSeconds > rep.LongestSeconds {
+			rep.LongestSeconds = st.DurationSeconds
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Trip search limits
+const (
+	MaxTripSearchRange  = 366 * 24 * time.Hour
+	DefaultTripPageSize = 50
+	MaxTripPageSize     = 500
+)
+
+// ErrInvalidSearch is returned for malformed trip search parameters
+var ErrInvalidSearch = errors.New("invalid search")
+
+// TripSearch filters and orders trips. Sort is a key such as "start_time",
+// "mileage", "duration" or "avg_speed", prefixed with "-" for descending.
+type TripSearch struct {
+	From, To    time.Time
+	VehicleIDs  []string
+	DriverID    string
+	GroupID     string
+	MinMileage  float64 // km
+	MinDuration time.Duration
+	Sort        string
+	Cursor      string
+	Limit       int
+}
+
+// TripPage is one page of search results. NextCursor is empty on the last page.
+type TripPage struct {
+	Trips      []model.Trip `json:"trips"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// tripCursor is encoded into the opaque next_cursor token
+type tripCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// SearchTrips returns a page of trips starting in [From, To), newest first
+// unless another sort is given. An empty page is not an error.
+func (s *Service) SearchTrips(ctx context.Context, q TripSearch) (TripPage, error) {
+	rq, err := q.query()
+	if err != nil {
+		return TripPage{}, err
+	}
+	limit := rq.Limit
+	rq.Limit++
+	trips, err := s.repo.SearchTrips(ctx, rq)
+	if err != nil {
+		return TripPage{}, err
+	}
+
+	page := TripPage{Trips: trips}
+	if len(trips) > limit {
+		page.Trips = trips[:limit]
+		last := page.Trips[limit-1]
+		page.NextCursor = encodeTripCursor(tripCursor{Sort: q.Sort, Value: tripSortValue(last, rq.Sort), ID: last.ID.String()})
+	}
+	s.addTripAddresses(ctx, page.Trips)
+	return page, nil
+}
+
+func (q *TripSearch) query() (repository.TripQuery, error) {
+	if err := ValidateRange(q.From, q.To, MaxTripSearchRange); err != nil {
+		return repository.TripQuery{}, err
+	}
+	if q.Sort == "" {
+		q.Sort = "-" + repository.TripSortStartTime
+	}
+	rq := repository.TripQuery{
+		From:        q.From,
+		To:          q.To,
+		VehicleIDs:  q.VehicleIDs,
+		DriverID:    q.DriverID,
+		GroupID:     q.GroupID,
+		MinMileage:  q.MinMileage,
+		MinDuration: q.MinDuration,
+		Sort:        strings.TrimPrefix(q.Sort, "-"),
+		Desc:        strings.HasPrefix(q.Sort, "-"),
+		Limit:       q.Limit,
+	}
+	if !repository.ValidTripSort(rq.Sort) {
+		return rq, fmt.Errorf("%w: sort must be one of start_time, mileage, duration, avg_speed with optional - prefix", ErrInvalidSearch)
+	}
+	for _, id := range append(append([]string{}, q.VehicleIDs...), q.DriverID, q.GroupID) {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return rq, fmt.Errorf("%w: invalid id %q", ErrInvalidSearch, id)
+		}
+	}
+	if q.MinMileage < 0 || q.MinDuration < 0 {
+		return rq, fmt.Errorf("%w: minimums must not be negative", ErrInvalidSearch)
+	}
+	switch {
+	case rq.Limit == 0:
+		rq.Limit = DefaultTripPageSize
+	case rq.Limit < 0 || rq.Limit > MaxTripPageSize:
+		return rq, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSearch, MaxTripPageSize)
+	}
+	if q.Cursor != "" {
+		c, err := decodeTripCursor(q.Cursor)
+		if err == nil && c.Sort == q.Sort {
+			err = validSortValue(rq.Sort, c.Value)
+		}
+		if err != nil || c.Sort != q.Sort {
+			return rq, fmt.Errorf("%w: invalid cursor", ErrInvalidSearch)
+		}
+		rq.After = &repository.TripCursor{Value: c.Value, ID: c.ID}
+	}
+	return rq, nil
+}
+
+// tripSortValue renders the sort key of t the way the database compares it
+func tripSortValue(t model.Trip, key string) string {
+	switch key {
+	case repository.TripSortMileage:
+		return strconv.FormatFloat(t.Mileage, 'g', -1, 64)
+	case repository.TripSortAvgSpeed:
+		return strconv.FormatFloat(t.AvgSpeed, 'g', -1, 64)
+	case repository.TripSortDuration:
+		return strconv.FormatFloat(t.EndTime.Sub(t.StartTime).Seconds(), 'f', 6, 64)
+	default:
+		// start_time is stored without a time zone
+		return t.StartTime.UTC().Format("2006-01-02 15:04:05.999999")
+	}
+}
+
+func validSortValue(key, v string) error {
+	if key == repository.TripSortStartTime {
+		_, err := time.Parse("2006-01-02 15:04:05.999999", v)
+		return err
+	}
+	_, err := strconv.ParseFloat(v, 64)
+	return err
+}
+
+func encodeTripCursor(c tripCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTripCursor(s string) (tripCursor, error) {
+	var c tripCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return c, err
+	}
+	return c, nil
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// TripParams controls how fixes are segmented into trips
+type TripParams struct {
+	MovingSpeedKmh float64       // fixes above this speed count as moving
+	StopAfter      time.Duration // a trip ends after standing still this long
+	MaxGap         time.Duration // a trip ends when no fix arrives for this long
+}
+
+// DefaultTripParams returns the thresholds used by ingest
+func DefaultTripParams() TripParams {
+	return TripParams{MovingSpeedKmh: 5, StopAfter: 5 * time.Minute, MaxGap: 30 * time.Minute}
+}
+
+// advanceTrip applies fix to the vehicle's open trip, which is nil when the
+// vehicle is not on a trip. It returns the open trip afterwards and the trip
+// the fix completed, if any. A trip starts at the first moving fix and ends
+// when the ignition is switched off, the vehicle stands still for StopAfter
+// or the device goes silent for MaxGap. Fixes older than the open trip's last
+// fix cannot change it and are ignored.
+func advanceTrip(open *model.OpenTrip, fix model.Position, p TripParams) (next, completed *model.OpenTrip) {
+	ignitionOff := fix.Ignition != nil && !*fix.Ignition
+	moving := fix.Speed > p.MovingSpeedKmh && !ignitionOff
+
+	if open != nil {
+		if !fix.Timestamp.After(open.LastFixAt) {
+			return open, nil
+		}
+		t := *open
+		switch {
+		case fix.Timestamp.Sub(t.LastFixAt) > p.MaxGap:
+			completed = finishTrip(t)
+		case ignitionOff:
+			t.Mileage += distanceKm(t.LastLocation, fix.Location)
+			t.EndTime = fix.Timestamp
+			t.LastLocation = fix.Location
+			completed = finishTrip(t)
+		case !moving && fix.Timestamp.Sub(t.LastMovingAt) >= p.StopAfter:
+			completed = finishTrip(t)
+		default:
+			// Only moving fixes extend the route, so GPS jitter while
+			// standing still does not add distance
+			if moving {
+				t.Mileage += distanceKm(t.LastLocation, fix.Location)
+				t.LastMovingAt = fix.Timestamp
+				t.LastLocation = fix.Location
+				t.EndTime = fix.Timestamp
+			}
+			t.LastFixAt = fix.Timestamp
+			t.AvgSpeed = avgSpeed(t.Trip)
+			return &t, nil
+		}
+	}
+
+	if !moving {
+		return nil, completed
+	}
+	start := fix.Location
+	return &model.OpenTrip{
+		Trip: model.Trip{
+			ID:            uuid.New(),
+			VehicleID:     fix.VehicleID,
+			StartTime:     fix.Timestamp,
+			EndTime:       fix.Timestamp,
+			InProgress:    true,
+			StartLocation: &start,
+		},
+		LastFixAt:    fix.Timestamp,
+		LastMovingAt: fix.Timestamp,
+		LastLocation: fix.Location,
+	}, completed
+}
+
+func finishTrip(t model.OpenTrip) *model.OpenTrip {
+	end := t.LastLocation
+	t.EndLocation = &end
+	t.InProgress = false
+	t.AvgSpeed = avgSpeed(t.Trip)
+	return &t
+}
+
+func distanceKm(a, b [2]float64) float64 {
+	return geo.Distance(geo.FromLonLat(a), geo.FromLonLat(b)) / 1000
+}
+
+// avgSpeed is the trip's average speed in km/h
+func avgSpeed(t model.Trip) float64 {
+	h := t.EndTime.Sub(t.StartTime).Hours()
+	if h <= 0 {
+		return 0
+	}
+	return t.Mileage / h
+}
+
+// tripStartedEvent is emitted when segmentation opens a trip
+func tripStartedEvent(t model.Trip) (model.Event, error) {
+	return model.NewEvent(model.EventTripStarted, t.VehicleID, map[string]interface{}{
+		"trip_id":    t.ID,
+		"vehicle_id": t.VehicleID,
+		"driver_id":  t.DriverID,
+		"start_time": t.StartTime,
+	})
+}
+
+// tripCompletedEvent is emitted when segmentation closes a trip
+func tripCompletedEvent(t model.Trip) (model.Event, error) {
+	return model.NewEvent(model.EventTripCompleted, t.VehicleID, t)
+}
+
+// fixKey identifies a fix of a vehicle by its time at the microsecond
+// precision positions are stored with
+func fixKey(t time.Time) int64 {
+	return t.Round(time.Microsecond).UnixMicro()
+}
+
+// historySegmenter folds a vehicle's fixes, in time order, into trips and
+// stops the same way ingest does fix by fix
+type historySegmenter struct {
+	tp    TripParams
+	sp    StopParams
+	trip  *model.OpenTrip
+	stop  *model.OpenStop
+	trips []model.OpenTrip
+	stops []model.OpenStop
+}
+
+func newHistorySegmenter() *historySegmenter {
+	return &historySegmenter{tp: DefaultTripParams(), sp: DefaultStopParams()}
+}
+
+// add folds in the next fix; a trip it starts is charged to the driver the
+// device reported with it, if any
+func (h *historySegmenter) add(fix model.Position, reported *uuid.UUID) {
+	next, completed := advanceTrip(h.trip, fix, h.tp)
+	if completed != nil {
+		h.trips = append(h.trips, *completed)
+	}
+	if next != nil && (h.trip == nil || next.ID != h.trip.ID) {
+		next.DriverID = reported
+	}
+	h.trip = next
+
+	stop, ended := advanceStop(h.stop, fix, h.sp)
+	if ended != nil {
+		h.keepStop(*ended)
+	}
+	h.stop = stop
+}
+
+func (h *historySegmenter) keepStop(st model.OpenStop) {
+	if st.Departure.Sub(st.Arrival) >= h.sp.MinDuration {
+		h.stops = append(h.stops, st)
+	}
+}
+
+// finish closes the trip and stop still open at the end of the history
+func (h *historySegmenter) finish() {
+	if h.trip != nil {
+		h.trips = append(h.trips, *finishTrip(*h.trip))
+		h.trip = nil
+	}
+	if h.stop != nil {
+		st := *h.stop
+		st.InProgress = false
+		h.keepStop(st)
+		h.stop = nil
+	}
+}
+
+// segmentHistory detects the trips and stops in a vehicle's stored fixes
+// between from and to, both inclusive, and stores those that do not overlap
+// a trip or stop already stored, so imported history is merged with what
+// live ingest or earlier imports produced. It returns how many were added.
+// A trip's driver is the one reported with its first fix, keyed by fixKey;
+// the vehicle's current driver did not necessarily drive it back then.
+func (s *Service) segmentHistory(ctx context.Context, vehicleID string, from, to time.Time, reported map[int64]uuid.UUID) (trips, stops int, err error) {
+	h := newHistorySegmenter()
+	err = s.repo.EachPosition(ctx, vehicleID, from, to.Add(time.Microsecond), func(p model.Position) error {
+		var driver *uuid.UUID
+		if id, ok := reported[fixKey(p.Timestamp)]; ok {
+			driver = &id
+		}
+		h.add(p, driver)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	h.finish()
+
+	known := map[uuid.UUID]bool{}
+	if len(reported) > 0 {
+		drivers, err := s.repo.ListDrivers(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, d := range drivers {
+			known[d.ID] = true
+		}
+	}
+
+	err = s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		trips, stops = 0, 0
+		var events []model.Event
+		for _, t := range h.trips {
+			if t.DriverID != nil && !known[*t.DriverID] {
+				t.DriverID = nil
+			}
+			added, err := tx.InsertTripIfFree(ctx, t)
+			if err != nil {
+				return err
+			}
+			if !added {
+				continue
+			}
+			trips++
+			if err := tx.AttributeHarshEvents(ctx, t.Trip); err != nil {
+				return err
+			}
+			e, err := tripCompletedEvent(t.Trip)
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		for _, st := range h.stops {
+			added, err := tx.InsertStopIfFree(ctx, st)
+			if err != nil {
+				return err
+			}
+			if !added {
+				continue
+			}
+			stops++
+			ve, err := endPOIVisits(ctx, tx, st.Stop)
+			if err != nil {
+				return err
+			}
+			events = append(events, ve...)
+		}
+		return tx.InsertEvents(ctx, events...)
+	})
+	return trips, stops, err
+}
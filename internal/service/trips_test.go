@@ -0,0 +1,174 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// segment feeds fixes through advanceTrip and returns the completed trips
+// and the trip still open at the end
+func segment(fixes []model.Position) ([]model.OpenTrip, *model.OpenTrip) {
+	var done []model.OpenTrip
+	var open *model.OpenTrip
+	for _, f := range fixes {
+		var completed *model.OpenTrip
+		open, completed = advanceTrip(open, f, DefaultTripParams())
+		if completed != nil {
+			done = append(done, *completed)
+		}
+	}
+	return done, open
+}
+
+func TestAdvanceTripSplitsOnStop(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	done, open := segment(track(vid, start))
+
+	require.Len(t, done, 1)
+	first := done[0]
+	assert.False(t, first.InProgress)
+	assert.Equal(t, vid, first.VehicleID)
+	assert.Equal(t, start, first.StartTime)
+	assert.Equal(t, start.Add(270*time.Second), first.EndTime)
+	assert.InDelta(t, 2.7, first.Mileage, 0.01)
+	assert.InDelta(t, 36, first.AvgSpeed, 0.5)
+
+	// The second leg counts from the last moving fix before the stop
+	require.NotNil(t, open)
+	assert.True(t, open.InProgress)
+	assert.Equal(t, start.Add(10*time.Minute), open.StartTime)
+	assert.InDelta(t, 2.7, open.Mileage, 0.01)
+}
+
+func TestAdvanceTripEndsOnIgnitionOffAndGap(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	p := geo.Point{Lat: 25.2, Lon: 55.27}
+	off := false
+	fix := func(at time.Duration, speed float64) model.Position {
+		p = geo.Destination(p, 0, 500)
+		return model.Position{VehicleID: vid, Location: p.LonLat(), Speed: speed, Timestamp: start.Add(at)}
+	}
+
+	fixes := []model.Position{fix(0, 30), fix(time.Minute, 30), fix(2*time.Minute, 0)}
+	fixes[2].Ignition = &off
+	fixes = append(fixes,
+		fix(3*time.Minute, 30),
+		fix(4*time.Minute, 30),
+		// The device goes silent for an hour
+		fix(64*time.Minute, 30),
+		fix(65*time.Minute, 30),
+	)
+	done, open := segment(fixes)
+
+	require.Len(t, done, 2)
+	assert.Equal(t, start.Add(2*time.Minute), done[0].EndTime)
+	assert.InDelta(t, 1.0, done[0].Mileage, 0.01)
+	assert.Equal(t, start.Add(3*time.Minute), done[1].StartTime)
+	assert.Equal(t, start.Add(4*time.Minute), done[1].EndTime)
+	require.NotNil(t, open)
+	assert.Equal(t, start.Add(64*time.Minute), open.StartTime)
+}
+
+func TestAdvanceTripIgnoresOldFixes(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	loc := [2]float64{55.27, 25.2}
+	open, _ := advanceTrip(nil, model.Position{VehicleID: vid, Location: loc, Speed: 40, Timestamp: start}, DefaultTripParams())
+	require.NotNil(t, open)
+
+	next, completed := advanceTrip(open, model.Position{VehicleID: vid, Location: loc, Speed: 40, Timestamp: start.Add(-time.Minute)}, DefaultTripParams())
+	assert.Nil(t, completed)
+	assert.Same(t, open, next)
+
+	next, completed = advanceTrip(nil, model.Position{VehicleID: vid, Location: loc, Speed: 2, Timestamp: start}, DefaultTripParams())
+	assert.Nil(t, next)
+	assert.Nil(t, completed)
+}
+
+func TestTripSearchQuery(t *testing.T) {
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(7 * 24 * time.Hour)
+
+	q := TripSearch{From: from, To: to}
+	rq, err := q.query()
+	require.NoError(t, err)
+	assert.Equal(t, "start_time", rq.Sort)
+	assert.True(t, rq.Desc)
+	assert.Equal(t, DefaultTripPageSize, rq.Limit)
+
+	trip := model.Trip{ID: uuid.New(), StartTime: from.Add(90 * time.Minute), EndTime: from.Add(2 * time.Hour), Mileage: 12.5}
+	for _, sort := range []string{"-start_time", "mileage", "-duration", "avg_speed"} {
+		key := sort
+		if key[0] == '-' {
+			key = key[1:]
+		}
+		cursor := encodeTripCursor(tripCursor{Sort: sort, Value: tripSortValue(trip, key), ID: trip.ID.String()})
+		q := TripSearch{From: from, To: to, Sort: sort, Cursor: cursor}
+		rq, err := q.query()
+		require.NoError(t, err, sort)
+		require.NotNil(t, rq.After)
+		assert.Equal(t, trip.ID.String(), rq.After.ID)
+	}
+	assert.Equal(t, "2025-06-01 01:30:00", tripSortValue(trip, "start_time"))
+	assert.Equal(t, "1800.000000", tripSortValue(trip, "duration"))
+
+	for name, q := range map[string]TripSearch{
+		"sort":           {From: from, To: to, Sort: "plate"},
+		"vehicle":        {From: from, To: to, VehicleIDs: []string{"nope"}},
+		"limit":          {From: from, To: to, Limit: MaxTripPageSize + 1},
+		"cursor":         {From: from, To: to, Cursor: "garbage"},
+		"cursor sort":    {From: from, To: to, Sort: "mileage", Cursor: encodeTripCursor(tripCursor{Sort: "-mileage", Value: "1", ID: uuid.NewString()})},
+		"cursor value":   {From: from, To: to, Sort: "mileage", Cursor: encodeTripCursor(tripCursor{Sort: "mileage", Value: "1; DROP", ID: uuid.NewString()})},
+		"reversed range": {From: to, To: from},
+	} {
+		_, err := q.query()
+		assert.Error(t, err, name)
+	}
+}
+
+func TestHistorySegmenter(t *testing.T) {
+	vid := uuid.New()
+	start := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	fixes := track(vid, start)
+	driver := uuid.New()
+	h := newHistorySegmenter()
+	for _, f := range fixes {
+		var reported *uuid.UUID
+		if f.Timestamp.After(start.Add(5 * time.Minute)) {
+			reported = &driver
+		}
+		h.add(f, reported)
+	}
+	h.finish()
+
+	// History closes the trip still open at its end
+	require.Len(t, h.trips, 2)
+	assert.Equal(t, start.Add(270*time.Second), h.trips[0].EndTime)
+	assert.Equal(t, start.Add(10*time.Minute), h.trips[1].StartTime)
+	assert.Equal(t, start.Add(870*time.Second), h.trips[1].EndTime)
+	assert.False(t, h.trips[1].InProgress)
+	require.NotNil(t, h.trips[1].EndLocation)
+
+	// Each trip has the driver reported with its first fix
+	assert.Nil(t, h.trips[0].DriverID)
+	assert.Equal(t, &driver, h.trips[1].DriverID)
+
+	// Stops match the batch detection over the same fixes
+	want := detectStops(fixes, DefaultStopParams())
+	require.Len(t, h.stops, len(want))
+	for i, st := range h.stops {
+		assert.Equal(t, want[i].Arrival, st.Arrival)
+		assert.Equal(t, want[i].Departure, st.Departure)
+		assert.False(t, st.InProgress)
+		assert.NotNil(t, st.ID)
+	}
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+	"fleet-tracker-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// MaxUtilizationRange limits how many days one report covers
+const MaxUtilizationRange = 366 * 24 * time.Hour
+
+// ErrInvalidSettings is returned for malformed organization settings
+var ErrInvalidSettings = errors.New("invalid settings")
+
+const usageRollup = "vehicle_daily_usage"
+
+func (s *Service) GetOrgSettings(ctx context.Context) (model.OrgSettings, error) {
+	return s.repo.GetOrgSettings(ctx)
+}
+
+// UpdateOrgSettings saves the settings. A new timezone or working schedule
+// invalidates the usage rollups, which are then rebuilt from all history.
+func (s *Service) UpdateOrgSettings(ctx context.Context, in model.OrgSettings) (model.OrgSettings, error) {
+	if err := validateOrgSettings(in); err != nil {
+		return in, err
+	}
+	sort.Ints(in.WorkDays)
+	in.UpdatedAt = time.Now().UTC()
+	err := s.repo.WithTx(ctx, func(tx *repository.Repo) error {
+		if err := tx.SaveOrgSettings(ctx, in); err != nil {
+			return err
+		}
+		if err := tx.DeleteDailyUsage(ctx); err != nil {
+			return err
+		}
+		return tx.SetWatermark(ctx, usageRollup, time.Time{})
+	})
+	return in, err
+}
+
+func validateOrgSettings(in model.OrgSettings) error {
+	if _, err := time.LoadLocation(in.Timezone); err != nil || in.Timezone == "" {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidSettings, in.Timezone)
+	}
+	start, err1 := parseClock(in.WorkStart)
+	end, err2 := parseClock(in.WorkEnd)
+	if err1 != nil || err2 != nil || end <= start {
+		return fmt.Errorf("%w: work_start and work_end must be HH:MM with start before end", ErrInvalidSettings)
+	}
+	for _, d := range in.WorkDays {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("%w: work_days must be 0 (Sunday) to 6 (Saturday)", ErrInvalidSettings)
+		}
+	}
+	return nil
+}
+
+// parseClock reads HH:MM as an offset from midnight
+func parseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// workWindow returns the working hours of a local day, or an empty window on
+// days off
+func workWindow(day time.Time, settings model.OrgSettings, loc *time.Location) (time.Time, time.Time) {
+	working := false
+	for _, d := range settings.WorkDays {
+		if time.Weekday(d) == day.Weekday() {
+			working = true
+		}
+	}
+	if !working {
+		return time.Time{}, time.Time{}
+	}
+	start, _ := parseClock(settings.WorkStart)
+	end, _ := parseClock(settings.WorkEnd)
+	y, m, d := day.Date()
+	at := func(off time.Duration) time.Time {
+		return time.Date(y, m, d, int(off/time.Hour), int(off%time.Hour/time.Minute), 0, 0, loc)
+	}
+	return at(start), at(end)
+}
+
+// overlap returns the length of [a1, a2) ∩ [b1, b2)
+func overlap(a1, a2, b1, b2 time.Time) time.Duration {
+	if b1.After(a1) {
+		a1 = b1
+	}
+	if b2.Before(a2) {
+		a2 = b2
+	}
+	if !a2.After(a1) {
+		return 0
+	}
+	return a2.Sub(a1)
+}
+
+// dayUsage computes a vehicle's usage for the local day [start, end) from its
+// fixes, which should begin up to MaxGap before start, and the trips that
+// started that day. The time between two fixes counts as driving when either
+// fix is moving and as idling when both are stationary with the ignition on;
+// gaps longer than MaxGap count as neither.
+func dayUsage(vehicleID uuid.UUID, start, end time.Time, positions []model.Position, trips []model.Trip,
+	workStart, workEnd time.Time, p TripParams) model.DailyUsage {
+	u := model.DailyUsage{
+		VehicleID:      vehicleID,
+		Day:            start,
+		WorkingSeconds: workEnd.Sub(workStart).Seconds(),
+	}
+	moving := func(x model.Position) bool {
+		return x.Speed > p.MovingSpeedKmh && (x.Ignition == nil || *x.Ignition)
+	}
+	for i, x := range positions {
+		if !x.Timestamp.Before(start) && x.Timestamp.Before(end) && x.Speed > u.MaxSpeed {
+			u.MaxSpeed = x.Speed
+		}
+		if i == 0 {
+			continue
+		}
+		prev := positions[i-1]
+		gap := x.Timestamp.Sub(prev.Timestamp)
+		if gap <= 0 || gap > p.MaxGap {
+			continue
+		}
+		in := overlap(prev.Timestamp, x.Timestamp, start, end)
+		if in == 0 {
+			continue
+		}
+		switch {
+		case moving(prev) || moving(x):
+			u.DrivingSeconds += in.Seconds()
+			u.WorkingDrivingSeconds += overlap(prev.Timestamp, x.Timestamp, workStart, workEnd).Seconds()
+			d := geo.Distance(geo.FromLonLat(prev.Location), geo.FromLonLat(x.Location)) / 1000
+			u.DistanceKm += d * in.Seconds() / gap.Seconds()
+		case prev.Ignition != nil && *prev.Ignition:
+			u.IdleSeconds += in.Seconds()
+		}
+	}
+	u.DistanceKm = math.Round(u.DistanceKm*1000) / 1000
+
+	for _, t := range trips {
+		u.TripCount++
+		if u.FirstStart == nil || t.StartTime.Before(*u.FirstStart) {
+			st := t.StartTime
+			u.FirstStart = &st
+		}
+		if !t.InProgress && (u.LastStop == nil || t.EndTime.After(*u.LastStop)) {
+			et := t.EndTime
+			u.LastStop = &et
+		}
+	}
+	return u
+}
+
+// computeDailyUsage recomputes and stores one vehicle's usage for a local day
+func (s *Service) computeDailyUsage(ctx context.Context, vehicleID string, day time.Time, settings model.OrgSettings, loc *time.Location) error {
+	y, m, d := day.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 1)
+	p := DefaultTripParams()
+
+	positions, err := s.repo.GetPositions(ctx, vehicleID, start.Add(-p.MaxGap).UTC(), end.UTC())
+	if err != nil {
+		return err
+	}
+	// Trip times are stored without a time zone, in UTC
+	trips, err := s.repo.GetTripsBetween(ctx, vehicleID, start.UTC(), end.UTC())
+	if err != nil {
+		return err
+	}
+	ws, we := workWindow(start, settings, loc)
+	u := dayUsage(uuid.MustParse(vehicleID), start, end, positions, trips, ws, we, p)
+	return s.repo.UpsertDailyUsage(ctx, u)
+}
+
+// idleDayUsage is the usage of a local day without fixes. It is stored so
+// the day's working hours still count towards utilization.
+func idleDayUsage(vehicleID string, day time.Time, settings model.OrgSettings, loc *time.Location) model.DailyUsage {
+	y, m, d := day.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	ws, we := workWindow(start, settings, loc)
+	return model.DailyUsage{
+		VehicleID:      uuid.MustParse(vehicleID),
+		Day:            start,
+		WorkingSeconds: we.Sub(ws).Seconds(),
+	}
+}
+
+// UsageRollup keeps vehicle_daily_usage up to date. Each run recomputes the
+// local days that received fixes since the previous run, so late and
+// imported data are picked up, and adds empty rows for the days since a
+// vehicle's first rollup on which it sent nothing.
+type UsageRollup struct {
+	svc      *Service
+	interval time.Duration
+	overlap  time.Duration
+}
+
+func NewUsageRollup(svc *Service, interval time.Duration) *UsageRollup {
+	// Fixes committed shortly after a run started may carry an earlier
+	// received_at, so each run looks back a little further
+	return &UsageRollup{svc: svc, interval: interval, overlap: 2 * time.Minute}
+}
+
+// Run refreshes the rollups every interval until ctx is done
+func (r *UsageRollup) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if n, err := r.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("usage rollup: %v", err)
+		} else if n > 0 {
+			log.Printf("usage rollup: refreshed %d vehicle days", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce refreshes the days changed since the last run and returns how many
+// vehicle days were recomputed
+func (r *UsageRollup) RunOnce(ctx context.Context) (int, error) {
+	repo := r.svc.repo
+	settings, err := repo.GetOrgSettings(ctx)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return 0, err
+	}
+	wm, err := repo.GetWatermark(ctx, usageRollup)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	since := wm
+	if !since.IsZero() {
+		since = since.Add(-r.overlap)
+	}
+	days, err := repo.ChangedVehicleDays(ctx, settings.Timezone, since, now)
+	if err != nil {
+		return 0, err
+	}
+	// A fix shortly after midnight also changes the previous day's tail
+	seen := map[repository.VehicleDay]bool{}
+	var todo []repository.VehicleDay
+	for _, d := range days {
+		for _, day := range []time.Time{d.Day.AddDate(0, 0, -1), d.Day} {
+			k := repository.VehicleDay{VehicleID: d.VehicleID, Day: day}
+			if !seen[k] {
+				seen[k] = true
+				todo = append(todo, k)
+			}
+		}
+	}
+	for _, d := range todo {
+		if err := r.svc.computeDailyUsage(ctx, d.VehicleID, d.Day, settings, loc); err != nil {
+			return 0, fmt.Errorf("vehicle %s day %s: %w", d.VehicleID, d.Day.Format("2006-01-02"), err)
+		}
+	}
+
+	// Idle days have no fixes to be found by; look back from the day of the
+	// previous run, or over all history after a rebuild
+	var idleFrom time.Time
+	if !since.IsZero() {
+		idleFrom = since.In(loc).AddDate(0, 0, -1)
+	}
+	idle, err := repo.IdleVehicleDays(ctx, idleFrom, now.In(loc))
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range idle {
+		if err := repo.UpsertDailyUsage(ctx, idleDayUsage(d.VehicleID, d.Day, settings, loc)); err != nil {
+			return 0, fmt.Errorf("vehicle %s day %s: %w", d.VehicleID, d.Day.Format("2006-01-02"), err)
+		}
+	}
+	return len(todo) + len(idle), repo.SetWatermark(ctx, usageRollup, now)
+}
+
+// UtilizationReport describes a utilization report request. From and To are
+// local dates (YYYY-MM-DD), both inclusive.
+type UtilizationReport struct {
+	From, To   string
+	Period     string // day or month
+	GroupBy    string // vehicle or group
+	VehicleIDs []string
+	GroupID    string
+}
+
+// GetUtilization returns utilization rows from the daily rollups
+func (s *Service) GetUtilization(ctx context.Context, q UtilizationReport) ([]model.UtilizationRow, error) {
+	from, err1 := time.Parse("2006-01-02", q.From)
+	to, err2 := time.Parse("2006-01-02", q.To)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("%w: from and to must be dates (YYYY-MM-DD)", ErrInvalidRange)
+	}
+	if err := ValidateRange(from, to.AddDate(0, 0, 1), MaxUtilizationRange); err != nil {
+		return nil, err
+	}
+	rq := repository.UtilizationQuery{From: from, To: to, VehicleIDs: q.VehicleIDs, GroupID: q.GroupID}
+	switch q.Period {
+	case "", "day":
+	case "month":
+		rq.Monthly = true
+	default:
+		return nil, fmt.Errorf("%w: period must be day or month", ErrInvalidSearch)
+	}
+	switch q.GroupBy {
+	case "", "vehicle":
+	case "group":
+		rq.ByGroup = true
+	default:
+		return nil, fmt.Errorf("%w: group_by must be vehicle or group", ErrInvalidSearch)
+	}
+	for _, id := range append(append([]string{}, q.VehicleIDs...), q.GroupID) {
+		if _, err := uuid.Parse(id); id != "" && err != nil {
+			return nil, fmt.Errorf("%w: invalid id %q", ErrInvalidSearch, strings.TrimSpace(id))
+		}
+	}
+	return s.repo.GetUtilization(ctx, rq)
+}
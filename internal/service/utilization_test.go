@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+	"fleet-tracker-service/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDayUsage(t *testing.T) {
+	dubai, err := time.LoadLocation("Asia/Dubai")
+	require.NoError(t, err)
+	settings := model.OrgSettings{Timezone: "Asia/Dubai", WorkStart: "08:00", WorkEnd: "18:00", WorkDays: []int{1, 2, 3, 4, 5}}
+
+	// Tuesday; the vehicle drives 07:50-08:10 local at 36 km/h, then idles 10 minutes
+	start := time.Date(2025, 6, 17, 0, 0, 0, 0, dubai)
+	ws, we := workWindow(start, settings, dubai)
+	assert.Equal(t, time.Date(2025, 6, 17, 8, 0, 0, 0, dubai), ws)
+	assert.Equal(t, 10*time.Hour, we.Sub(ws))
+
+	vid := uuid.New()
+	on := true
+	p := geo.Point{Lat: 25.2, Lon: 55.27}
+	ts := time.Date(2025, 6, 17, 7, 50, 0, 0, dubai)
+	var fixes []model.Position
+	for i := 0; i <= 20; i++ {
+		fixes = append(fixes, model.Position{VehicleID: vid, Location: p.LonLat(), Speed: 36, Ignition: &on, Timestamp: ts})
+		p = geo.Destination(p, 90, 600)
+		ts = ts.Add(time.Minute)
+	}
+	for i := 0; i < 10; i++ {
+		fixes = append(fixes, model.Position{VehicleID: vid, Location: p.LonLat(), Speed: 0, Ignition: &on, Timestamp: ts})
+		ts = ts.Add(time.Minute)
+	}
+	trips := []model.Trip{{StartTime: fixes[0].Timestamp, EndTime: fixes[20].Timestamp}}
+
+	u := dayUsage(vid, start, start.AddDate(0, 0, 1), fixes, trips, ws, we, DefaultTripParams())
+	assert.InDelta(t, 12.6, u.DistanceKm, 0.01)
+	// The first stationary fix still counts as arriving
+	assert.InDelta(t, 21*60, u.DrivingSeconds, 1)
+	assert.InDelta(t, 9*60, u.IdleSeconds, 1)
+	assert.InDelta(t, 11*60, u.WorkingDrivingSeconds, 1)
+	assert.Equal(t, 10*3600.0, u.WorkingSeconds)
+	assert.Equal(t, 36.0, u.MaxSpeed)
+	assert.Equal(t, 1, u.TripCount)
+	require.NotNil(t, u.LastStop)
+	assert.Equal(t, fixes[20].Timestamp, *u.LastStop)
+
+	// Saturday has no working hours
+	ws, we = workWindow(start.AddDate(0, 0, 4), settings, dubai)
+	assert.True(t, ws.IsZero() && we.IsZero())
+}
+
+func TestIdleDayUsage(t *testing.T) {
+	dubai, err := time.LoadLocation("Asia/Dubai")
+	require.NoError(t, err)
+	settings := model.OrgSettings{Timezone: "Asia/Dubai", WorkStart: "08:00", WorkEnd: "18:00", WorkDays: []int{1, 2, 3, 4, 5}}
+	vid := uuid.New()
+
+	// Days come back from the database as UTC dates
+	u := idleDayUsage(vid.String(), time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC), settings, dubai)
+	assert.Equal(t, vid, u.VehicleID)
+	assert.Equal(t, time.Date(2025, 6, 17, 0, 0, 0, 0, dubai), u.Day)
+	assert.Equal(t, 10*3600.0, u.WorkingSeconds, "an idle working day still counts its working hours")
+	assert.Zero(t, u.DrivingSeconds)
+
+	u = idleDayUsage(vid.String(), time.Date(2025, 6, 21, 0, 0, 0, 0, time.UTC), settings, dubai)
+	assert.Zero(t, u.WorkingSeconds)
+}
+
+func TestValidateOrgSettings(t *testing.T) {
+	ok := model.OrgSettings{Timezone: "Asia/Dubai", WorkStart: "08:00", WorkEnd: "18:00", WorkDays: []int{1, 5}}
+	assert.NoError(t, validateOrgSettings(ok))
+
+	bad := ok
+	bad.Timezone = "Mars/Olympus"
+	assert.ErrorIs(t, validateOrgSettings(bad), ErrInvalidSettings)
+	bad = ok
+	bad.WorkEnd = "07:00"
+	assert.ErrorIs(t, validateOrgSettings(bad), ErrInvalidSettings)
+	bad = ok
+	bad.WorkDays = []int{7}
+	assert.ErrorIs(t, validateOrgSettings(bad), ErrInvalidSettings)
+}
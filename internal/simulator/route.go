@@ -0,0 +1,304 @@
+package simulator
+
+import (
+	"embed"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fleet-tracker-service/internal/geo"
+)
+
+//go:embed routes/*.geojson
+var builtinRoutes embed.FS
+
+// Route is a polyline a simulated vehicle drives along
+type Route struct {
+	Name   string
+	Points []geo.Point
+	// cum[i] is the distance in metres from Points[0] to Points[i]
+	cum []float64
+}
+
+// NewRoute builds a route from at least two points
+func NewRoute(name string, pts []geo.Point) (*Route, error) {
+	if len(pts) < 2 {
+		return nil, fmt.Errorf("route %q needs at least two points", name)
+	}
+	r := &Route{Name: name, Points: pts, cum: make([]float64, len(pts))}
+	for i := 1; i < len(pts); i++ {
+		r.cum[i] = r.cum[i-1] + geo.Distance(pts[i-1], pts[i])
+	}
+	if r.Length() == 0 {
+		return nil, fmt.Errorf("route %q has zero length", name)
+	}
+	return r, nil
+}
+
+// Length returns the route length in metres
+func (r *Route) Length() float64 {
+	return r.cum[len(r.cum)-1]
+}
+
+// At returns the position and heading at dist metres along the route
+func (r *Route) At(dist float64) (geo.Point, float64) {
+	if dist <= 0 {
+		return r.Points[0], geo.Bearing(r.Points[0], r.Points[1])
+	}
+	n := len(r.Points)
+	if dist >= r.Length() {
+		return r.Points[n-1], geo.Bearing(r.Points[n-2], r.Points[n-1])
+	}
+	i := 1
+	for r.cum[i] < dist {
+		i++
+	}
+	a, b := r.Points[i-1], r.Points[i]
+	seg := r.cum[i] - r.cum[i-1]
+	f := 0.0
+	if seg > 0 {
+		f = (dist - r.cum[i-1]) / seg
+	}
+	return geo.Interpolate(a, b, f), geo.Bearing(a, b)
+}
+
+// Reversed returns the same route driven in the opposite direction
+func (r *Route) Reversed() *Route {
+	pts := make([]geo.Point, len(r.Points))
+	for i, p := range r.Points {
+		pts[len(pts)-1-i] = p
+	}
+	rev, _ := NewRoute(r.Name+" (return)", pts)
+	return rev
+}
+
+// BuiltinRoutes returns the embedded sample routes around Dubai
+func BuiltinRoutes() ([]*Route, error) {
+	entries, err := builtinRoutes.ReadDir("routes")
+	if err != nil {
+		return nil, err
+	}
+	var routes []*Route
+	for _, e := range entries {
+		f, err := builtinRoutes.Open("routes/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		rs, err := ParseGeoJSON(f, e.Name())
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, rs...)
+	}
+	return routes, nil
+}
+
+// LoadRoutes reads routes from .gpx, .geojson and .json files. Directories
+// are scanned one level deep.
+func LoadRoutes(paths ...string) ([]*Route, error) {
+	var routes []*Route
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{p}
+		if info.IsDir() {
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, e := range entries {
+				if !e.IsDir() && isRouteFile(e.Name()) {
+					files = append(files, filepath.Join(p, e.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			rs, err := LoadRouteFile(file)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, rs...)
+		}
+	}
+	if len(routes) == 0 {
+		return nil, errors.New("no routes found")
+	}
+	return routes, nil
+}
+
+func isRouteFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gpx", ".geojson", ".json":
+		return true
+	}
+	return false
+}
+
+// LoadRouteFile reads the routes in a single GPX or GeoJSON file
+func LoadRouteFile(path string) ([]*Route, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+	if strings.EqualFold(filepath.Ext(path), ".gpx") {
+		return ParseGPX(f, name)
+	}
+	return ParseGeoJSON(f, name)
+}
+
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+type gpxFile struct {
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Routes []struct {
+		Name   string     `xml:"name"`
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+// ParseGPX reads every track and route in a GPX document. Track segments
+// are joined into a single route per track.
+func ParseGPX(r io.Reader, name string) ([]*Route, error) {
+	var doc gpxFile
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse gpx %s: %w", name, err)
+	}
+
+	var routes []*Route
+	add := func(rname string, pts []gpxPoint) error {
+		if rname == "" {
+			rname = fmt.Sprintf("%s#%d", name, len(routes)+1)
+		}
+		gp := make([]geo.Point, len(pts))
+		for i, p := range pts {
+			gp[i] = geo.Point{Lat: p.Lat, Lon: p.Lon}
+		}
+		rt, err := NewRoute(rname, gp)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, rt)
+		return nil
+	}
+	for _, t := range doc.Tracks {
+		var pts []gpxPoint
+		for _, s := range t.Segments {
+			pts = append(pts, s.Points...)
+		}
+		if err := add(t.Name, pts); err != nil {
+			return nil, err
+		}
+	}
+	for _, rt := range doc.Routes {
+		if err := add(rt.Name, rt.Points); err != nil {
+			return nil, err
+		}
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("gpx %s contains no tracks or routes", name)
+	}
+	return routes, nil
+}
+
+type geoJSONObject struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSONObject  `json:"geometry"`
+	Properties  struct {
+		Name string `json:"name"`
+	} `json:"properties"`
+	Features []geoJSONObject `json:"features"`
+}
+
+// ParseGeoJSON reads LineString and MultiLineString geometries from a
+// Geometry, Feature or FeatureCollection document
+func ParseGeoJSON(r io.Reader, name string) ([]*Route, error) {
+	var obj geoJSONObject
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("parse geojson %s: %w", name, err)
+	}
+
+	var routes []*Route
+	var walk func(o geoJSONObject, label string) error
+	walk = func(o geoJSONObject, label string) error {
+		switch o.Type {
+		case "FeatureCollection":
+			for _, f := range o.Features {
+				if err := walk(f, label); err != nil {
+					return err
+				}
+			}
+		case "Feature":
+			if o.Geometry == nil {
+				return nil
+			}
+			if o.Properties.Name != "" {
+				label = o.Properties.Name
+			}
+			return walk(*o.Geometry, label)
+		case "LineString":
+			var coords [][]float64
+			if err := json.Unmarshal(o.Coordinates, &coords); err != nil {
+				return err
+			}
+			return addLine(&routes, label, name, coords)
+		case "MultiLineString":
+			var lines [][][]float64
+			if err := json.Unmarshal(o.Coordinates, &lines); err != nil {
+				return err
+			}
+			for _, coords := range lines {
+				if err := addLine(&routes, label, name, coords); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(obj, ""); err != nil {
+		return nil, fmt.Errorf("geojson %s: %w", name, err)
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("geojson %s contains no line strings", name)
+	}
+	return routes, nil
+}
+
+func addLine(routes *[]*Route, label, file string, coords [][]float64) error {
+	pts := make([]geo.Point, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 2 {
+			return errors.New("coordinate needs longitude and latitude")
+		}
+		pts = append(pts, geo.Point{Lon: c[0], Lat: c[1]})
+	}
+	if label == "" {
+		label = fmt.Sprintf("%s#%d", file, len(*routes)+1)
+	}
+	rt, err := NewRoute(label, pts)
+	if err != nil {
+		return err
+	}
+	*routes = append(*routes, rt)
+	return nil
+}
@@ -0,0 +1,148 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+)
+
+// Scenario event types
+const (
+	EventSpeeding       = "speeding"
+	EventGeofenceBreach = "geofence_breach"
+	EventOffline        = "offline"
+	EventGPSJump        = "gps_jump"
+)
+
+// Duration is a time.Duration that reads "90s" style strings from JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ScenarioEvent changes what some vehicles report during a time window
+// measured from the start of the run
+type ScenarioEvent struct {
+	Type     string   `json:"type"`
+	Vehicles []int    `json:"vehicles"` // vehicle indexes, ignored when All is set
+	All      bool     `json:"all"`
+	At       Duration `json:"at"`
+	Duration Duration `json:"duration"`
+
+	// speeding
+	SpeedKmh float64 `json:"speed_kmh"`
+	// geofence_breach: the vehicle is reported at Location (lon, lat)
+	Location [2]float64 `json:"location"`
+	// gps_jump: one fix displaced by DistanceM metres
+	DistanceM float64 `json:"distance_m"`
+}
+
+// Scenario is a repeatable script of misbehaviour applied on top of normal driving
+type Scenario struct {
+	Name   string          `json:"name"`
+	Events []ScenarioEvent `json:"events"`
+}
+
+// LoadScenario reads a JSON scenario file
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sc Scenario
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return nil, fmt.Errorf("parse scenario %s: %w", path, err)
+	}
+	for i, e := range sc.Events {
+		switch e.Type {
+		case EventSpeeding, EventGeofenceBreach, EventOffline, EventGPSJump:
+		default:
+			return nil, fmt.Errorf("scenario %s: event %d has unknown type %q", path, i, e.Type)
+		}
+	}
+	return &sc, nil
+}
+
+func (e ScenarioEvent) applies(idx int, elapsed time.Duration) bool {
+	start := time.Duration(e.At)
+	if elapsed < start {
+		return false
+	}
+	// A GPS jump affects a single fix: the first one at or after At
+	if e.Type != EventGPSJump && elapsed >= start+time.Duration(e.Duration) {
+		return false
+	}
+	if e.All {
+		return true
+	}
+	for _, v := range e.Vehicles {
+		if v == idx {
+			return true
+		}
+	}
+	return false
+}
+
+// ScenarioState tracks one-off events per vehicle while a scenario runs
+type ScenarioState struct {
+	sc     *Scenario
+	rng    *rand.Rand
+	jumped map[[2]int]bool // event index, vehicle index
+}
+
+func NewScenarioState(sc *Scenario, seed int64) *ScenarioState {
+	return &ScenarioState{sc: sc, rng: rand.New(rand.NewSource(seed)), jumped: map[[2]int]bool{}}
+}
+
+// Apply rewrites status for vehicle idx at elapsed time into the run. It
+// returns false when the vehicle is offline and nothing should be sent.
+func (s *ScenarioState) Apply(idx int, elapsed time.Duration, status map[string]interface{}) bool {
+	if s == nil || s.sc == nil {
+		return true
+	}
+	for i, e := range s.sc.Events {
+		if !e.applies(idx, elapsed) {
+			continue
+		}
+		switch e.Type {
+		case EventOffline:
+			return false
+		case EventSpeeding:
+			status["speed"] = e.SpeedKmh
+		case EventGeofenceBreach:
+			status["location"] = []float64{e.Location[0], e.Location[1]}
+			status["speed"] = 10.0
+		case EventGPSJump:
+			key := [2]int{i, idx}
+			if s.jumped[key] {
+				continue
+			}
+			s.jumped[key] = true
+			loc, ok := status["location"].([]float64)
+			if !ok || len(loc) < 2 {
+				continue
+			}
+			p := geo.Destination(geo.Point{Lon: loc[0], Lat: loc[1]}, s.rng.Float64()*360, e.DistanceM)
+			status["location"] = []float64{p.Lon, p.Lat}
+		}
+	}
+	return true
+}
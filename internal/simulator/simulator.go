@@ -0,0 +1,236 @@
+package simulator
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+)
+
+// Config controls how simulated vehicles drive. Rates are expected events
+// per hour of driving.
+type Config struct {
+	Seed            int64
+	MinCruiseKmh    float64
+	MaxCruiseKmh    float64
+	AccelMS2        float64
+	BrakeMS2        float64
+	StopsPerHour    float64
+	MinStop         time.Duration
+	MaxStop         time.Duration
+	TrafficPerHour  float64
+	MinTrafficSpeed float64 // fraction of cruise speed in heavy traffic
+	MinTraffic      time.Duration
+	MaxTraffic      time.Duration
+	MinPark         time.Duration
+	MaxPark         time.Duration
+	GPSNoiseMeters  float64
+}
+
+// DefaultConfig returns urban driving behaviour around 40-90 km/h
+func DefaultConfig() Config {
+	return Config{
+		Seed:            1,
+		MinCruiseKmh:    40,
+		MaxCruiseKmh:    90,
+		AccelMS2:        2.0,
+		BrakeMS2:        3.0,
+		StopsPerHour:    12,
+		MinStop:         20 * time.Second,
+		MaxStop:         3 * time.Minute,
+		TrafficPerHour:  4,
+		MinTrafficSpeed: 0.2,
+		MinTraffic:      time.Minute,
+		MaxTraffic:      6 * time.Minute,
+		MinPark:         2 * time.Minute,
+		MaxPark:         15 * time.Minute,
+		GPSNoiseMeters:  3,
+	}
+}
+
+type state int
+
+const (
+	driving state = iota
+	stopped       // engine running, waiting at a light or delivery
+	parked        // ignition off at the end of a route
+)
+
+// Vehicle is one simulated vehicle following its routes
+type Vehicle struct {
+	ID string
+
+	cfg    Config
+	rng    *rand.Rand
+	routes []*Route
+
+	route       *Route
+	dist        float64 // metres along route
+	speed       float64 // m/s
+	cruise      float64 // m/s
+	traffic     float64 // speed factor, 1 when the road is clear
+	trafficLeft time.Duration
+	state       state
+	stopping    bool // braking for a stop
+	wait        time.Duration
+	ignition    bool
+}
+
+func newVehicle(id string, cfg Config, routes []*Route) *Vehicle {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(id))
+	v := &Vehicle{
+		ID:       id,
+		cfg:      cfg,
+		rng:      rand.New(rand.NewSource(cfg.Seed ^ int64(h.Sum64()))),
+		routes:   routes,
+		traffic:  1,
+		ignition: true,
+	}
+	v.route = routes[v.rng.Intn(len(routes))]
+	if v.rng.Intn(2) == 0 {
+		v.route = v.route.Reversed()
+	}
+	v.dist = v.rng.Float64() * v.route.Length()
+	v.pickCruise()
+	v.speed = v.cruise
+	return v
+}
+
+func (v *Vehicle) between(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(v.rng.Int63n(int64(max-min)))
+}
+
+// happens reports whether an event with the given hourly rate occurs within dt
+func (v *Vehicle) happens(perHour float64, dt time.Duration) bool {
+	p := 1 - math.Exp(-perHour*dt.Hours())
+	return v.rng.Float64() < p
+}
+
+func (v *Vehicle) pickCruise() {
+	kmh := v.cfg.MinCruiseKmh + v.rng.Float64()*(v.cfg.MaxCruiseKmh-v.cfg.MinCruiseKmh)
+	v.cruise = kmh / 3.6
+}
+
+// Step advances the vehicle by dt
+func (v *Vehicle) Step(dt time.Duration) {
+	secs := dt.Seconds()
+	switch v.state {
+	case parked:
+		v.wait -= dt
+		if v.wait > 0 {
+			return
+		}
+		// Head back the way we came, or occasionally switch route
+		if v.rng.Intn(4) == 0 {
+			v.route = v.routes[v.rng.Intn(len(v.routes))]
+		} else {
+			v.route = v.route.Reversed()
+		}
+		v.dist = 0
+		v.ignition = true
+		v.state = driving
+		v.pickCruise()
+		return
+	case stopped:
+		v.wait -= dt
+		if v.wait <= 0 {
+			v.state = driving
+		}
+		return
+	}
+
+	if v.trafficLeft > 0 {
+		v.trafficLeft -= dt
+		if v.trafficLeft <= 0 {
+			v.traffic = 1
+		}
+	} else if v.happens(v.cfg.TrafficPerHour, dt) {
+		v.traffic = v.cfg.MinTrafficSpeed + v.rng.Float64()*(0.7-v.cfg.MinTrafficSpeed)
+		v.trafficLeft = v.between(v.cfg.MinTraffic, v.cfg.MaxTraffic)
+	}
+	if !v.stopping && v.happens(v.cfg.StopsPerHour, dt) {
+		v.stopping = true
+	}
+	if v.happens(6, dt) {
+		v.pickCruise()
+	}
+
+	target := v.cruise * v.traffic
+	remaining := v.route.Length() - v.dist
+	// Brake in time to stop at the end of the route
+	if limit := math.Sqrt(2 * v.cfg.BrakeMS2 * remaining); limit < target {
+		target = limit
+	}
+	if v.stopping {
+		target = 0
+	}
+	if v.speed < target {
+		v.speed = math.Min(target, v.speed+v.cfg.AccelMS2*secs)
+	} else {
+		v.speed = math.Max(target, v.speed-v.cfg.BrakeMS2*secs)
+	}
+	if v.stopping && v.speed == 0 {
+		v.stopping = false
+		v.state = stopped
+		v.wait = v.between(v.cfg.MinStop, v.cfg.MaxStop)
+	}
+
+	v.dist += v.speed * secs
+	if v.dist >= v.route.Length() {
+		v.dist = v.route.Length()
+		v.speed = 0
+		v.stopping = false
+		v.state = parked
+		v.ignition = false
+		v.wait = v.between(v.cfg.MinPark, v.cfg.MaxPark)
+	}
+}
+
+// Status returns the device payload for the vehicle's current state
+func (v *Vehicle) Status(now time.Time) map[string]interface{} {
+	pos, heading := v.route.At(v.dist)
+	if v.cfg.GPSNoiseMeters > 0 {
+		pos = geo.Destination(pos, v.rng.Float64()*360, math.Abs(v.rng.NormFloat64())*v.cfg.GPSNoiseMeters)
+	}
+	return map[string]interface{}{
+		"location":  []float64{pos.Lon, pos.Lat},
+		"speed":     math.Round(v.speed*3.6*10) / 10,
+		"heading":   math.Round(heading),
+		"ignition":  v.ignition,
+		"timestamp": now.UTC().Format(time.RFC3339),
+	}
+}
+
+// Simulator owns a set of vehicles that share routes and configuration.
+// Each vehicle's random source is seeded from Config.Seed and its ID, so a
+// run is repeatable regardless of the order vehicles are added.
+type Simulator struct {
+	cfg    Config
+	routes []*Route
+
+	mu       sync.Mutex
+	vehicles map[string]*Vehicle
+}
+
+func New(cfg Config, routes []*Route) *Simulator {
+	return &Simulator{cfg: cfg, routes: routes, vehicles: map[string]*Vehicle{}}
+}
+
+// Vehicle returns the simulated vehicle for id, creating it on first use
+func (s *Simulator) Vehicle(id string) *Vehicle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.vehicles[id]
+	if !ok {
+		v = newVehicle(id, s.cfg, s.routes)
+		s.vehicles[id] = v
+	}
+	return v
+}
@@ -0,0 +1,176 @@
+package simulator
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"fleet-tracker-service/internal/geo"
+)
+
+const sampleGPX = `<?xml version="1.0"?>
+<gpx version="1.1" creator="test">
+  <trk><name>Track A</name>
+    <trkseg>
+      <trkpt lat="25.2000" lon="55.2700"/>
+      <trkpt lat="25.2100" lon="55.2800"/>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="25.2200" lon="55.2900"/>
+    </trkseg>
+  </trk>
+  <rte><name>Route B</name>
+    <rtept lat="25.1000" lon="55.1000"/>
+    <rtept lat="25.1100" lon="55.1100"/>
+  </rte>
+</gpx>`
+
+func TestParseGPX(t *testing.T) {
+	routes, err := ParseGPX(strings.NewReader(sampleGPX), "sample.gpx")
+	if err != nil {
+		t.Fatalf("ParseGPX: %v", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("got %d routes, want 2", len(routes))
+	}
+	if routes[0].Name != "Track A" || len(routes[0].Points) != 3 {
+		t.Errorf("track segments not joined: %+v", routes[0])
+	}
+	if routes[1].Name != "Route B" {
+		t.Errorf("got route name %q, want Route B", routes[1].Name)
+	}
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	doc := `{"type":"Feature","properties":{"name":"Loop"},
+		"geometry":{"type":"MultiLineString","coordinates":[[[55.1,25.1],[55.2,25.2]],[[55.3,25.3],[55.4,25.4]]]}}`
+	routes, err := ParseGeoJSON(strings.NewReader(doc), "loop.geojson")
+	if err != nil {
+		t.Fatalf("ParseGeoJSON: %v", err)
+	}
+	if len(routes) != 2 || routes[0].Name != "Loop" {
+		t.Fatalf("unexpected routes: %+v", routes)
+	}
+	if routes[0].Points[0] != (geo.Point{Lat: 25.1, Lon: 55.1}) {
+		t.Errorf("coordinates should be read as [lon, lat], got %+v", routes[0].Points[0])
+	}
+}
+
+func TestBuiltinRoutes(t *testing.T) {
+	routes, err := BuiltinRoutes()
+	if err != nil || len(routes) == 0 {
+		t.Fatalf("BuiltinRoutes() = %d routes, err %v", len(routes), err)
+	}
+}
+
+func TestRouteAt(t *testing.T) {
+	r, err := NewRoute("line", []geo.Point{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid, heading := r.At(r.Length() / 2)
+	if math.Abs(mid.Lon-0.5) > 1e-9 || math.Abs(heading-90) > 1e-6 {
+		t.Errorf("At(half) = %+v heading %.2f, want lon 0.5 heading 90", mid, heading)
+	}
+}
+
+func run(sim *Simulator, id string, steps int) []map[string]interface{} {
+	var out []map[string]interface{}
+	now := time.Date(2025, 6, 17, 8, 0, 0, 0, time.UTC)
+	v := sim.Vehicle(id)
+	for i := 0; i < steps; i++ {
+		v.Step(2 * time.Second)
+		now = now.Add(2 * time.Second)
+		out = append(out, v.Status(now))
+	}
+	return out
+}
+
+func TestSimulatorDeterministic(t *testing.T) {
+	routes, _ := BuiltinRoutes()
+	a := run(New(DefaultConfig(), routes), "veh-1", 200)
+	b := run(New(DefaultConfig(), routes), "veh-1", 200)
+	for i := range a {
+		if a[i]["location"].([]float64)[0] != b[i]["location"].([]float64)[0] || a[i]["speed"] != b[i]["speed"] {
+			t.Fatalf("step %d differs with the same seed: %v vs %v", i, a[i], b[i])
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Seed = 42
+	c := run(New(cfg, routes), "veh-1", 1)
+	if c[0]["location"].([]float64)[0] == a[0]["location"].([]float64)[0] {
+		t.Errorf("different seeds produced the same start position")
+	}
+}
+
+func TestSimulatorRealisticMovement(t *testing.T) {
+	routes, _ := BuiltinRoutes()
+	cfg := DefaultConfig()
+	cfg.GPSNoiseMeters = 0
+	statuses := run(New(cfg, routes), "veh-2", 3600)
+
+	sawStop, sawIgnitionOff := false, false
+	for i, st := range statuses {
+		speed := st["speed"].(float64)
+		if speed < 0 || speed > cfg.MaxCruiseKmh+0.1 {
+			t.Fatalf("step %d: speed %.1f outside 0..%.0f", i, speed, cfg.MaxCruiseKmh)
+		}
+		if speed == 0 {
+			sawStop = true
+		}
+		if !st["ignition"].(bool) {
+			sawIgnitionOff = true
+		}
+		if i == 0 {
+			continue
+		}
+		prev := st["location"].([]float64)
+		cur := statuses[i-1]["location"].([]float64)
+		jump := geo.Distance(geo.Point{Lon: prev[0], Lat: prev[1]}, geo.Point{Lon: cur[0], Lat: cur[1]})
+		// A route switch after parking may start elsewhere; otherwise
+		// the vehicle can only travel as far as its speed allows
+		if jump > 60 && st["ignition"].(bool) && statuses[i-1]["ignition"].(bool) {
+			t.Fatalf("step %d: vehicle jumped %.0f m in 2s", i, jump)
+		}
+	}
+	if !sawStop || !sawIgnitionOff {
+		t.Errorf("expected stops and ignition off over two hours (stop=%v ignitionOff=%v)", sawStop, sawIgnitionOff)
+	}
+}
+
+func TestScenarioApply(t *testing.T) {
+	sc := &Scenario{Events: []ScenarioEvent{
+		{Type: EventOffline, Vehicles: []int{1}, At: Duration(time.Minute), Duration: Duration(time.Minute)},
+		{Type: EventSpeeding, All: true, At: 0, Duration: Duration(30 * time.Second), SpeedKmh: 140},
+		{Type: EventGPSJump, Vehicles: []int{0}, At: Duration(time.Minute), DistanceM: 300000},
+	}}
+	state := NewScenarioState(sc, 1)
+	status := func() map[string]interface{} {
+		return map[string]interface{}{"location": []float64{55.27, 25.2}, "speed": 50.0}
+	}
+
+	st := status()
+	if !state.Apply(0, 10*time.Second, st) || st["speed"] != 140.0 {
+		t.Errorf("speeding not applied: %v", st)
+	}
+	if state.Apply(1, 90*time.Second, status()) {
+		t.Errorf("vehicle 1 should be offline at 90s")
+	}
+	if !state.Apply(1, 3*time.Minute, status()) {
+		t.Errorf("vehicle 1 should be back online at 3m")
+	}
+
+	jumped := status()
+	state.Apply(0, 61*time.Second, jumped)
+	loc := jumped["location"].([]float64)
+	if d := geo.Distance(geo.Point{Lon: 55.27, Lat: 25.2}, geo.Point{Lon: loc[0], Lat: loc[1]}); math.Abs(d-300000) > 1 {
+		t.Errorf("gps jump moved %.0f m, want 300000", d)
+	}
+	again := status()
+	state.Apply(0, 63*time.Second, again)
+	if again["location"].([]float64)[0] != 55.27 {
+		t.Errorf("gps jump should affect a single fix")
+	}
+}
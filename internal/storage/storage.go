@@ -0,0 +1,97 @@
+// Package storage keeps uploaded files such as proof-of-delivery photos and
+// signatures on local disk or in an S3-compatible object store
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when a stored object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Store saves, reads and deletes objects by key. Keys are slash separated
+// paths such as "jobs/<job_id>/<attachment_id>".
+type Store interface {
+	Put(ctx context.Context, key, contentType string, r io.Reader, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Local stores objects as files under a directory
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a store writing under dir, creating it if needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	p := filepath.Join(l.dir, filepath.FromSlash(key))
+	if key == "" || !strings.HasPrefix(p, filepath.Clean(l.dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return p, nil
+}
+
+// Put writes an object, replacing one with the same key. A partly written
+// file is removed.
+func (l *Local) Put(_ context.Context, key, _ string, r io.Reader, _ int64) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Open reads an object
+func (l *Local) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes an object; a missing one is not an error
+func (l *Local) Delete(_ context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
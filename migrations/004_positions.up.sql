@@ -0,0 +1,11 @@
+-- Position history, one row per ingested fix
+CREATE TABLE IF NOT EXISTS positions (
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id),
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    heading DOUBLE PRECISION,
+    ignition BOOLEAN,
+    PRIMARY KEY (vehicle_id, recorded_at)
+);
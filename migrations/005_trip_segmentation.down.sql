@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_import_jobs_checksum;
+DROP TABLE IF EXISTS import_jobs;
+DROP INDEX IF EXISTS idx_trips_one_open_per_vehicle;
+ALTER TABLE trips DROP COLUMN IF EXISTS last_lat;
+ALTER TABLE trips DROP COLUMN IF EXISTS last_lon;
+ALTER TABLE trips DROP COLUMN IF EXISTS last_moving_at;
+ALTER TABLE trips DROP COLUMN IF EXISTS last_fix_at;
+ALTER TABLE trips DROP COLUMN IF EXISTS in_progress;
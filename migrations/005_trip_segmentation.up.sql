@@ -0,0 +1,31 @@
+-- Trips are now built from consecutive fixes; an in-progress trip keeps the
+-- state needed to extend it with the next fix
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS in_progress BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS last_fix_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS last_moving_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS last_lon DOUBLE PRECISION;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS last_lat DOUBLE PRECISION;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trips_one_open_per_vehicle ON trips(vehicle_id) WHERE in_progress;
+
+-- Background history imports
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id UUID PRIMARY KEY,
+    format TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    vehicle_id UUID,
+    options JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    read_bytes BIGINT NOT NULL DEFAULT 0,
+    processed BIGINT NOT NULL DEFAULT 0,
+    imported BIGINT NOT NULL DEFAULT 0,
+    duplicates BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_checksum ON import_jobs(checksum);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_trips_driver_start_time;
+DROP INDEX IF EXISTS idx_trips_vehicle_start_time;
+DROP INDEX IF EXISTS idx_trips_start_time_id;
+DROP INDEX IF EXISTS idx_vehicle_group_id;
+ALTER TABLE trips DROP COLUMN IF EXISTS driver_id;
+ALTER TABLE vehicle DROP COLUMN IF EXISTS driver_id;
+ALTER TABLE vehicle DROP COLUMN IF EXISTS group_id;
+DROP TABLE IF EXISTS drivers;
+DROP TABLE IF EXISTS vehicle_groups;
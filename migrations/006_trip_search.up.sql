@@ -0,0 +1,22 @@
+-- Vehicle groups and drivers used to filter trips and reports
+CREATE TABLE IF NOT EXISTS vehicle_groups (
+    id UUID PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS drivers (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    license_number TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE vehicle ADD COLUMN IF NOT EXISTS group_id UUID REFERENCES vehicle_groups(id) ON DELETE SET NULL;
+ALTER TABLE vehicle ADD COLUMN IF NOT EXISTS driver_id UUID REFERENCES drivers(id) ON DELETE SET NULL;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS driver_id UUID REFERENCES drivers(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_vehicle_group_id ON vehicle(group_id);
+CREATE INDEX IF NOT EXISTS idx_trips_start_time_id ON trips(start_time, id);
+CREATE INDEX IF NOT EXISTS idx_trips_vehicle_start_time ON trips(vehicle_id, start_time);
+CREATE INDEX IF NOT EXISTS idx_trips_driver_start_time ON trips(driver_id, start_time);
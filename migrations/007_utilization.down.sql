@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS rollup_state;
+DROP INDEX IF EXISTS idx_vehicle_daily_usage_day;
+DROP TABLE IF EXISTS vehicle_daily_usage;
+DROP TABLE IF EXISTS organization_settings;
+DROP INDEX IF EXISTS idx_positions_received_at;
+ALTER TABLE positions DROP COLUMN IF EXISTS received_at;
@@ -0,0 +1,38 @@
+-- When a fix reached the service, so rollups can find late and imported data
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS idx_positions_received_at ON positions(received_at);
+
+-- Organization-wide reporting settings, a single row
+CREATE TABLE IF NOT EXISTS organization_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    work_start TEXT NOT NULL DEFAULT '08:00',
+    work_end TEXT NOT NULL DEFAULT '18:00',
+    work_days INT[] NOT NULL DEFAULT '{1,2,3,4,5}',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+INSERT INTO organization_settings (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
+
+-- Per vehicle and local day usage, refreshed by the rollup worker
+CREATE TABLE IF NOT EXISTS vehicle_daily_usage (
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    distance_km DOUBLE PRECISION NOT NULL DEFAULT 0,
+    driving_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    idle_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    trip_count INT NOT NULL DEFAULT 0,
+    max_speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    first_start TIMESTAMP WITH TIME ZONE,
+    last_stop TIMESTAMP WITH TIME ZONE,
+    working_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    working_driving_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    computed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (vehicle_id, day)
+);
+CREATE INDEX IF NOT EXISTS idx_vehicle_daily_usage_day ON vehicle_daily_usage(day);
+
+-- Progress of background rollups
+CREATE TABLE IF NOT EXISTS rollup_state (
+    name TEXT PRIMARY KEY,
+    watermark TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_stops_one_open_per_vehicle;
+DROP INDEX IF EXISTS idx_stops_vehicle_arrival;
+DROP TABLE IF EXISTS stops;
@@ -0,0 +1,24 @@
+-- Stops detected on ingest; an in-progress stop keeps the state needed to
+-- extend it with the next fix
+CREATE TABLE IF NOT EXISTS stops (
+    id UUID PRIMARY KEY,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    arrival TIMESTAMP WITH TIME ZONE NOT NULL,
+    departure TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    idle_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    idling BOOLEAN NOT NULL DEFAULT FALSE,
+    in_progress BOOLEAN NOT NULL DEFAULT FALSE,
+    anchor_lon DOUBLE PRECISION NOT NULL,
+    anchor_lat DOUBLE PRECISION NOT NULL,
+    sum_lon DOUBLE PRECISION NOT NULL,
+    sum_lat DOUBLE PRECISION NOT NULL,
+    fixes INT NOT NULL,
+    last_fix_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_ignition BOOLEAN
+);
+
+CREATE INDEX IF NOT EXISTS idx_stops_vehicle_arrival ON stops(vehicle_id, arrival);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stops_one_open_per_vehicle ON stops(vehicle_id) WHERE in_progress;
@@ -0,0 +1,3 @@
+ALTER TABLE import_jobs DROP COLUMN IF EXISTS rejected;
+DROP TABLE IF EXISTS position_filter_state;
+DROP TABLE IF EXISTS rejected_positions;
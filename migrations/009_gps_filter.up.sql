@@ -0,0 +1,27 @@
+-- Fixes dropped by the ingest filter, kept for diagnostics. Not tied to
+-- vehicle so a bogus first fix of an unknown device is still recorded.
+CREATE TABLE IF NOT EXISTS rejected_positions (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id UUID NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    accuracy DOUBLE PRECISION,
+    satellites INT,
+    reason TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    UNIQUE (vehicle_id, recorded_at)
+);
+
+-- Kalman smoothing state per vehicle
+CREATE TABLE IF NOT EXISTS position_filter_state (
+    vehicle_id UUID PRIMARY KEY REFERENCES vehicle(id) ON DELETE CASCADE,
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    variance DOUBLE PRECISION NOT NULL,
+    fix_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+ALTER TABLE import_jobs ADD COLUMN IF NOT EXISTS rejected BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE trips DROP COLUMN IF EXISTS start_lat;
+ALTER TABLE trips DROP COLUMN IF EXISTS start_lon;
@@ -0,0 +1,10 @@
+-- Where trips start; they end at last_lon/last_lat
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS start_lon DOUBLE PRECISION;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS start_lat DOUBLE PRECISION;
+
+UPDATE trips t
+SET start_lon = p.lon, start_lat = p.lat
+FROM positions p
+WHERE t.start_lon IS NULL
+  AND p.vehicle_id = t.vehicle_id
+  AND p.recorded_at = t.start_time AT TIME ZONE 'UTC';
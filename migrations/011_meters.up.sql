@@ -0,0 +1,29 @@
+-- Odometer and engine hours per vehicle
+CREATE TABLE IF NOT EXISTS vehicle_meters (
+    vehicle_id UUID PRIMARY KEY REFERENCES vehicle(id) ON DELETE CASCADE,
+    odometer_km DOUBLE PRECISION NOT NULL DEFAULT 0,
+    engine_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    odometer_source TEXT NOT NULL DEFAULT 'virtual',
+    device_odometer_km DOUBLE PRECISION,
+    device_offset_km DOUBLE PRECISION NOT NULL DEFAULT 0,
+    last_fix_at TIMESTAMP WITH TIME ZONE,
+    last_ignition BOOLEAN,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- Audit history: a reading at the end of every trip and every calibration
+CREATE TABLE IF NOT EXISTS meter_readings (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    kind TEXT NOT NULL,
+    odometer_km DOUBLE PRECISION NOT NULL,
+    engine_hours DOUBLE PRECISION NOT NULL,
+    prev_odometer_km DOUBLE PRECISION,
+    prev_engine_hours DOUBLE PRECISION,
+    odometer_source TEXT NOT NULL,
+    trip_id UUID,
+    actor TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_meter_readings_vehicle_recorded ON meter_readings(vehicle_id, recorded_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS maintenance_status;
+DROP TABLE IF EXISTS service_records;
+DROP TABLE IF EXISTS maintenance_plans;
@@ -0,0 +1,50 @@
+-- Preventive maintenance plans for a vehicle or every vehicle of a group
+CREATE TABLE IF NOT EXISTS maintenance_plans (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    vehicle_id UUID REFERENCES vehicle(id) ON DELETE CASCADE,
+    group_id UUID REFERENCES vehicle_groups(id) ON DELETE CASCADE,
+    interval_km DOUBLE PRECISION,
+    interval_hours DOUBLE PRECISION,
+    interval_days INT,
+    due_soon_km DOUBLE PRECISION NOT NULL DEFAULT 0,
+    due_soon_hours DOUBLE PRECISION NOT NULL DEFAULT 0,
+    due_soon_days INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((vehicle_id IS NULL) <> (group_id IS NULL)),
+    CHECK (interval_km IS NOT NULL OR interval_hours IS NOT NULL OR interval_days IS NOT NULL)
+);
+CREATE INDEX IF NOT EXISTS idx_maintenance_plans_vehicle ON maintenance_plans(vehicle_id);
+CREATE INDEX IF NOT EXISTS idx_maintenance_plans_group ON maintenance_plans(group_id);
+
+-- Work done on a vehicle, optionally under a plan
+CREATE TABLE IF NOT EXISTS service_records (
+    id UUID PRIMARY KEY,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    plan_id UUID REFERENCES maintenance_plans(id) ON DELETE SET NULL,
+    performed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    odometer_km DOUBLE PRECISION NOT NULL,
+    engine_hours DOUBLE PRECISION NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    cost DOUBLE PRECISION,
+    recorded_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_service_records_vehicle_performed ON service_records(vehicle_id, performed_at);
+
+-- Per plan and vehicle: what the next due date counts from (the last service
+-- under the plan, or when the plan started applying), the state last
+-- computed by the scheduler and the last state notified
+CREATE TABLE IF NOT EXISTS maintenance_status (
+    plan_id UUID NOT NULL REFERENCES maintenance_plans(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    base_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    base_odometer_km DOUBLE PRECISION NOT NULL,
+    base_engine_hours DOUBLE PRECISION NOT NULL,
+    base_service_id UUID REFERENCES service_records(id) ON DELETE SET NULL,
+    state TEXT NOT NULL DEFAULT 'ok',
+    notified_state TEXT NOT NULL DEFAULT 'ok',
+    computed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (plan_id, vehicle_id)
+);
+CREATE INDEX IF NOT EXISTS idx_maintenance_status_vehicle ON maintenance_status(vehicle_id);
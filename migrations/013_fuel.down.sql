@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS fuel_state;
+DROP TABLE IF EXISTS fuel_events;
+DROP TABLE IF EXISTS fuel_readings;
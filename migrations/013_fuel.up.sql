@@ -0,0 +1,36 @@
+-- Fuel level samples from the status payload; level_l is the smoothed value
+CREATE TABLE IF NOT EXISTS fuel_readings (
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    raw_level_l DOUBLE PRECISION NOT NULL,
+    level_l DOUBLE PRECISION NOT NULL,
+    speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (vehicle_id, recorded_at)
+);
+
+-- Detected refuels and drops while stationary
+CREATE TABLE IF NOT EXISTS fuel_events (
+    id UUID PRIMARY KEY,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    start_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    start_level_l DOUBLE PRECISION NOT NULL,
+    end_level_l DOUBLE PRECISION NOT NULL,
+    amount_l DOUBLE PRECISION NOT NULL,
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_fuel_events_vehicle_start ON fuel_events(vehicle_id, start_at);
+
+-- Detection state per vehicle: the last smoothed level and a rise or drop in progress
+CREATE TABLE IF NOT EXISTS fuel_state (
+    vehicle_id UUID PRIMARY KEY REFERENCES vehicle(id) ON DELETE CASCADE,
+    level_l DOUBLE PRECISION NOT NULL,
+    at TIMESTAMP WITH TIME ZONE NOT NULL,
+    pending_kind TEXT,
+    pending_start_at TIMESTAMP WITH TIME ZONE,
+    pending_start_level_l DOUBLE PRECISION,
+    pending_lon DOUBLE PRECISION,
+    pending_lat DOUBLE PRECISION
+);
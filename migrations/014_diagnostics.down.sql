@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS engine_readings;
+DROP TABLE IF EXISTS dtc_reports;
+DROP TABLE IF EXISTS dtc_occurrences;
@@ -0,0 +1,31 @@
+-- Diagnostic trouble codes reported by a vehicle; an occurrence lasts from
+-- the first report that lists the code until one that no longer does
+CREATE TABLE IF NOT EXISTS dtc_occurrences (
+    id UUID PRIMARY KEY,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    code TEXT NOT NULL,
+    system TEXT NOT NULL,
+    description TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    cleared_at TIMESTAMP WITH TIME ZONE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dtc_occurrences_active ON dtc_occurrences(vehicle_id, code) WHERE cleared_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_dtc_occurrences_vehicle_seen ON dtc_occurrences(vehicle_id, first_seen_at);
+
+-- Time of the last DTC list applied per vehicle, so older reports are ignored
+CREATE TABLE IF NOT EXISTS dtc_reports (
+    vehicle_id UUID PRIMARY KEY REFERENCES vehicle(id) ON DELETE CASCADE,
+    reported_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Engine parameters (OBD-II PIDs) reported with a fix
+CREATE TABLE IF NOT EXISTS engine_readings (
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    rpm DOUBLE PRECISION,
+    coolant_temp_c DOUBLE PRECISION,
+    engine_load DOUBLE PRECISION,
+    PRIMARY KEY (vehicle_id, recorded_at)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS scoring_settings;
+DROP TABLE IF EXISTS harsh_events;
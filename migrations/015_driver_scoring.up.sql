@@ -0,0 +1,29 @@
+-- Harsh acceleration, braking, cornering and overspeed episodes, attached to
+-- the trip and driver of the fix they were detected on
+CREATE TABLE IF NOT EXISTS harsh_events (
+    id UUID PRIMARY KEY,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    trip_id UUID,
+    driver_id UUID,
+    kind TEXT NOT NULL,
+    source TEXT NOT NULL,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    speed DOUBLE PRECISION NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    limit_kmh DOUBLE PRECISION
+);
+CREATE INDEX IF NOT EXISTS idx_harsh_events_vehicle_occurred ON harsh_events(vehicle_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_harsh_events_trip ON harsh_events(trip_id);
+CREATE INDEX IF NOT EXISTS idx_harsh_events_driver_occurred ON harsh_events(driver_id, occurred_at);
+
+-- Penalty weights of the safety score, a single row
+CREATE TABLE IF NOT EXISTS scoring_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    weights JSONB NOT NULL DEFAULT '{"harsh_acceleration": 3, "harsh_braking": 4, "harsh_cornering": 3, "overspeed": 5}',
+    min_distance_km DOUBLE PRECISION NOT NULL DEFAULT 10,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+INSERT INTO scoring_settings (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
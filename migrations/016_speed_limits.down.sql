@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_harsh_events_kind_occurred;
+ALTER TABLE harsh_events DROP COLUMN IF EXISTS road;
+ALTER TABLE harsh_events DROP COLUMN IF EXISTS limit_source;
+ALTER TABLE harsh_events DROP COLUMN IF EXISTS excess_kmh;
@@ -0,0 +1,7 @@
+-- Overspeed episodes are measured against the posted limit of the road
+-- driven on: how far over it the peak was, where the limit came from and
+-- the road's name
+ALTER TABLE harsh_events ADD COLUMN IF NOT EXISTS excess_kmh DOUBLE PRECISION;
+ALTER TABLE harsh_events ADD COLUMN IF NOT EXISTS limit_source TEXT;
+ALTER TABLE harsh_events ADD COLUMN IF NOT EXISTS road TEXT;
+CREATE INDEX IF NOT EXISTS idx_harsh_events_kind_occurred ON harsh_events(kind, occurred_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS job_attachments;
+DROP TABLE IF EXISTS jobs;
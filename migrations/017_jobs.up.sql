@@ -0,0 +1,46 @@
+-- Dispatch jobs: a pickup and a drop with time windows, assigned to a
+-- vehicle and advanced automatically as it enters and leaves each radius
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY,
+    reference TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    priority TEXT NOT NULL DEFAULT 'normal',
+    status TEXT NOT NULL,
+    status_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    vehicle_id UUID REFERENCES vehicle(id) ON DELETE SET NULL,
+    assigned_at TIMESTAMP WITH TIME ZONE,
+    pickup_lon DOUBLE PRECISION NOT NULL,
+    pickup_lat DOUBLE PRECISION NOT NULL,
+    pickup_address TEXT NOT NULL DEFAULT '',
+    pickup_radius_m DOUBLE PRECISION NOT NULL,
+    pickup_window_start TIMESTAMP WITH TIME ZONE,
+    pickup_window_end TIMESTAMP WITH TIME ZONE,
+    pickup_arrived_at TIMESTAMP WITH TIME ZONE,
+    pickup_departed_at TIMESTAMP WITH TIME ZONE,
+    drop_lon DOUBLE PRECISION NOT NULL,
+    drop_lat DOUBLE PRECISION NOT NULL,
+    drop_address TEXT NOT NULL DEFAULT '',
+    drop_radius_m DOUBLE PRECISION NOT NULL,
+    drop_window_start TIMESTAMP WITH TIME ZONE,
+    drop_window_end TIMESTAMP WITH TIME ZONE,
+    drop_arrived_at TIMESTAMP WITH TIME ZONE,
+    drop_departed_at TIMESTAMP WITH TIME ZONE,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_vehicle_status ON jobs(vehicle_id, status);
+CREATE INDEX IF NOT EXISTS idx_jobs_status_created ON jobs(status, created_at);
+
+-- Proof of delivery: signatures and photos kept in the attachment store
+CREATE TABLE IF NOT EXISTS job_attachments (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_job_attachments_job ON job_attachments(job_id);
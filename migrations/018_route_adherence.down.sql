@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS route_deviations;
+DROP TABLE IF EXISTS route_stop_visits;
+DROP TABLE IF EXISTS route_assignments;
+DROP TABLE IF EXISTS planned_routes;
@@ -0,0 +1,55 @@
+-- Planned routes: the expected path of a fixed route with a corridor width
+-- and its scheduled stops
+CREATE TABLE IF NOT EXISTS planned_routes (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    path JSONB NOT NULL,
+    corridor_m DOUBLE PRECISION NOT NULL,
+    length_m DOUBLE PRECISION NOT NULL,
+    stops JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- A planned route driven by a vehicle in a time window, with the progress
+-- ingest has tracked so far
+CREATE TABLE IF NOT EXISTS route_assignments (
+    id UUID PRIMARY KEY,
+    route_id UUID NOT NULL REFERENCES planned_routes(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    start_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    progress_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+    fixes INTEGER NOT NULL DEFAULT 0,
+    fixes_in_corridor INTEGER NOT NULL DEFAULT 0,
+    off_route_id UUID,
+    last_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_route_assignments_vehicle_window ON route_assignments(vehicle_id, start_at, end_at);
+CREATE INDEX IF NOT EXISTS idx_route_assignments_route ON route_assignments(route_id, start_at);
+
+-- When each scheduled stop of an assignment was visited or skipped
+CREATE TABLE IF NOT EXISTS route_stop_visits (
+    assignment_id UUID NOT NULL REFERENCES route_assignments(id) ON DELETE CASCADE,
+    stop_index INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (assignment_id, stop_index)
+);
+
+-- Corridor exits and skipped stops
+CREATE TABLE IF NOT EXISTS route_deviations (
+    id UUID PRIMARY KEY,
+    assignment_id UUID NOT NULL REFERENCES route_assignments(id) ON DELETE CASCADE,
+    route_id UUID NOT NULL,
+    vehicle_id UUID NOT NULL,
+    kind TEXT NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    max_distance_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+    stop_index INTEGER,
+    stop_name TEXT,
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_route_deviations_assignment ON route_deviations(assignment_id, started_at);
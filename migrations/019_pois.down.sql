@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS poi_visits;
+DROP TABLE IF EXISTS pois;
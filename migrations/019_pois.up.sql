@@ -0,0 +1,31 @@
+-- Points of interest such as customer sites. cell is the 0.01° grid cell
+-- of the location, the spatial index used to find the POIs around a stop.
+CREATE TABLE IF NOT EXISTS pois (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    category TEXT NOT NULL DEFAULT '',
+    external_ref TEXT,
+    address TEXT,
+    lon DOUBLE PRECISION NOT NULL,
+    lat DOUBLE PRECISION NOT NULL,
+    radius_m DOUBLE PRECISION NOT NULL,
+    cell BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_pois_cell ON pois(cell);
+CREATE INDEX IF NOT EXISTS idx_pois_category ON pois(category, name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pois_external_ref ON pois(external_ref) WHERE external_ref IS NOT NULL;
+
+-- A stop within a POI. Arrival, departure and duration are the stop's.
+CREATE TABLE IF NOT EXISTS poi_visits (
+    poi_id UUID NOT NULL REFERENCES pois(id) ON DELETE CASCADE,
+    stop_id UUID NOT NULL REFERENCES stops(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES vehicle(id) ON DELETE CASCADE,
+    arrival TIMESTAMP WITH TIME ZONE NOT NULL,
+    distance_m DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (poi_id, stop_id)
+);
+CREATE INDEX IF NOT EXISTS idx_poi_visits_poi_arrival ON poi_visits(poi_id, arrival);
+CREATE INDEX IF NOT EXISTS idx_poi_visits_vehicle_arrival ON poi_visits(vehicle_id, arrival);
+CREATE INDEX IF NOT EXISTS idx_poi_visits_stop ON poi_visits(stop_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_trips_driver_end_time;
+DROP TABLE IF EXISTS hos_warnings;
+ALTER TABLE drivers DROP COLUMN IF EXISTS hos_rule_set_id;
+DROP TABLE IF EXISTS hos_rule_sets;
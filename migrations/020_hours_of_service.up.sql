@@ -0,0 +1,38 @@
+-- Driving-time rule sets. Durations are in minutes; a zero weekly or
+-- fortnightly limit does not apply.
+CREATE TABLE IF NOT EXISTS hos_rule_sets (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    max_continuous_driving_min DOUBLE PRECISION NOT NULL,
+    min_break_min DOUBLE PRECISION NOT NULL,
+    min_break_part_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    max_daily_driving_min DOUBLE PRECISION NOT NULL,
+    min_daily_rest_min DOUBLE PRECISION NOT NULL,
+    max_duty_span_min DOUBLE PRECISION NOT NULL,
+    max_weekly_driving_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    max_fortnight_driving_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    warn_before_min DOUBLE PRECISION NOT NULL DEFAULT 30,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hos_rule_sets_default ON hos_rule_sets(is_default) WHERE is_default;
+
+INSERT INTO hos_rule_sets (id, name, max_continuous_driving_min, min_break_min, min_break_part_min,
+                           max_daily_driving_min, min_daily_rest_min, max_duty_span_min,
+                           max_weekly_driving_min, max_fortnight_driving_min, is_default)
+VALUES (uuid_generate_v4(), 'EU 561/2006', 270, 45, 15, 540, 660, 780, 3360, 5400, TRUE),
+       (uuid_generate_v4(), 'US FMCSA property-carrying', 480, 30, 30, 660, 600, 840, 0, 0, FALSE)
+ON CONFLICT (name) DO NOTHING;
+
+-- Rule set a driver is held to; NULL uses the default one
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS hos_rule_set_id UUID REFERENCES hos_rule_sets(id) ON DELETE SET NULL;
+
+-- Approaching-limit warnings already raised, one per limit and period
+CREATE TABLE IF NOT EXISTS hos_warnings (
+    driver_id UUID NOT NULL REFERENCES drivers(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    raised_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (driver_id, kind, period_start)
+);
+CREATE INDEX IF NOT EXISTS idx_trips_driver_end_time ON trips(driver_id, end_time);
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"fleet-tracker-service/internal/auth"
+	"fleet-tracker-service/internal/grpcapi"
+	"fleet-tracker-service/internal/pb"
+	"fleet-tracker-service/internal/service"
+
+	"google.golang.org/grpc"
+)
+
+// deviceMethods are the RPCs tracking devices may call with a device key;
+// everything else needs a JWT
+var deviceMethods = []string{pb.TelemetryService_StreamPositions_FullMethodName}
+
+// newGRPCServer builds the telemetry gRPC server with JWT/device-key auth
+func newGRPCServer(svc *service.Service, authSvc *auth.JWTService, keys auth.DeviceKeys) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.UnaryAuthInterceptor(authSvc, keys, deviceMethods...)),
+		grpc.ChainStreamInterceptor(auth.StreamAuthInterceptor(authSvc, keys, deviceMethods...)),
+	)
+	pb.RegisterTelemetryServiceServer(srv, grpcapi.NewServer(svc))
+	return srv
+}
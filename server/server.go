@@ -3,16 +3,24 @@ package server
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"fleet-tracker-service/internal/auth"
+	"fleet-tracker-service/internal/events"
+	"fleet-tracker-service/internal/geocode"
 	"fleet-tracker-service/internal/handlers"
+	"fleet-tracker-service/internal/mapmatch"
 	"fleet-tracker-service/internal/repository"
 	"fleet-tracker-service/internal/service"
+	"fleet-tracker-service/internal/storage"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -29,6 +37,16 @@ func Run() error {
 	redisAddr := mustGetenv("REDIS_ADDR", "redis:6379")
 	issuer := mustGetenv("JWT_ISSUER", "fleet-tracker")
 	aud := mustGetenv("JWT_AUD", "fleet-clients")
+	grpcPort := mustGetenv("GRPC_PORT", "9090")
+	deviceKeys := auth.ParseDeviceKeys(os.Getenv("DEVICE_KEYS"))
+	ingestMode := mustGetenv("INGEST_MODE", "sync")
+	importDir := mustGetenv("IMPORT_DIR", filepath.Join(os.TempDir(), "fleet-imports"))
+	eventCfg := events.Config{
+		Bus:          mustGetenv("EVENT_BUS", "redis"),
+		Topic:        mustGetenv("EVENT_TOPIC", "fleet.events"),
+		NATSURL:      mustGetenv("NATS_URL", "nats://nats:4222"),
+		KafkaBrokers: mustGetenv("KAFKA_BROKERS", "kafka:9092"),
+	}
 
 	// Run migrations
 	if err := runMigrations(pgDSN); err != nil {
@@ -57,8 +75,85 @@ func Run() error {
 	// To Setup dependencies
 	repo := repository.NewRepo(db)
 	svc := service.NewService(repo, rdb)
+	filter, err := filterConfig()
+	if err != nil {
+		return err
+	}
+	svc.SetFilter(filter)
+	speeding, err := speedingConfig()
+	if err != nil {
+		return err
+	}
+	svc.SetSpeeding(speeding)
+	attachments, err := attachmentStore()
+	if err != nil {
+		return err
+	}
+	svc.SetAttachmentStore(attachments)
 	authSvc := auth.NewJWT([]byte(jwtSecret), issuer, aud)
 
+	// Background workers share this context and stop on shutdown
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Relay outbox events to the configured bus
+	if eventCfg.Bus != "none" {
+		pub, err := events.NewPublisher(eventCfg, rdb)
+		if err != nil {
+			return err
+		}
+		defer pub.Close()
+		go events.NewRelay(repo, pub).Run(bgCtx)
+		log.Printf("Publishing outbox events to %s (%s)", eventCfg.Bus, eventCfg.Topic)
+	}
+
+	var ingestPool *service.IngestPool
+	if ingestMode == "async" {
+		cfg := service.DefaultIngestPoolConfig()
+		if n, err := strconv.Atoi(os.Getenv("INGEST_WORKERS")); err == nil && n > 0 {
+			cfg.Workers = n
+		}
+		ingestPool = service.NewIngestPool(svc, rdb, cfg)
+		go func() {
+			if err := ingestPool.Run(bgCtx); err != nil {
+				log.Printf("ingest pool stopped: %v", err)
+			}
+		}()
+		log.Printf("Async ingest enabled with %d partitions", cfg.Workers)
+	}
+
+	// Usage rollups for utilization reports
+	rollupEvery, err := time.ParseDuration(mustGetenv("REPORT_ROLLUP_INTERVAL", "5m"))
+	if err != nil {
+		return err
+	}
+	go service.NewUsageRollup(svc, rollupEvery).Run(bgCtx)
+
+	// Maintenance due dates and notifications
+	maintenanceEvery, err := time.ParseDuration(mustGetenv("MAINTENANCE_INTERVAL", "15m"))
+	if err != nil {
+		return err
+	}
+	go service.NewMaintenanceScheduler(svc, maintenanceEvery).Run(bgCtx)
+
+	// Driving-time warnings for drivers on duty
+	hosEvery, err := time.ParseDuration(mustGetenv("HOS_INTERVAL", "5m"))
+	if err != nil {
+		return err
+	}
+	go service.NewHOSScheduler(svc, hosEvery).Run(bgCtx)
+
+	// Road network and geocoding data load in the background; map matching
+	// and addresses are unavailable until they are ready
+	go loadMaps(svc, os.Getenv("MAP_PBF"), os.Getenv("GEONAMES_FILE"))
+
+	// History imports run one at a time in the background
+	imp, err := service.NewImporter(svc, importDir)
+	if err != nil {
+		return err
+	}
+	go imp.Run(bgCtx)
+
 	// To Setup Gin Router
 	router := gin.New()
 	router.Use(gin.Recovery(), auth.RequestLogger())
@@ -83,14 +178,89 @@ func Run() error {
 	api := router.Group("/api")
 	api.Use(auth.JWTMiddleware(authSvc))
 	{
-		api.POST("/vehicle/ingest", handlers.IngestHandler(svc))
+		if ingestPool != nil {
+			api.POST("/vehicle/ingest", handlers.AsyncIngestHandler(ingestPool))
+			api.GET("/ingest/stats", handlers.IngestStatsHandler(ingestPool))
+		} else {
+			api.POST("/vehicle/ingest", handlers.IngestHandler(svc))
+		}
 		api.GET("/vehicle/status", handlers.StatusHandler(svc))
 		api.GET("/vehicle/trips", handlers.TripsHandler(svc))
+		api.GET("/vehicle/route", handlers.RouteHandler(svc))
+		api.GET("/vehicle/stops", handlers.StopsHandler(svc))
+		api.GET("/vehicle/rejected", handlers.RejectedPositionsHandler(svc))
+		api.GET("/vehicle/harsh-events", handlers.HarshEventsHandler(svc))
+		api.GET("/vehicle/fuel", handlers.FuelReportHandler(svc))
+		api.GET("/vehicle/fuel/readings", handlers.FuelReadingsHandler(svc))
+		api.GET("/vehicle/position-at", handlers.PositionAtHandler(svc))
+		api.GET("/fleet/position-at", handlers.FleetPositionAtHandler(svc))
+		api.GET("/vehicle/export", handlers.ExportRangeHandler(svc))
+		api.GET("/trips", handlers.TripSearchHandler(svc))
+		api.GET("/trips/:id/export", handlers.ExportTripHandler(svc))
+		api.GET("/trips/:id/matched", handlers.MatchTripHandler(svc))
+		api.GET("/trips/:id/score", handlers.TripScoreHandler(svc))
+		api.POST("/imports", handlers.CreateImportHandler(imp))
+		api.GET("/imports/:id", handlers.ImportHandler(imp))
+		api.POST("/groups", handlers.CreateGroupHandler(svc))
+		api.GET("/groups", handlers.ListGroupsHandler(svc))
+		api.POST("/drivers", handlers.CreateDriverHandler(svc))
+		api.GET("/drivers", handlers.ListDriversHandler(svc))
+		api.GET("/drivers/ranking", handlers.DriverRankingHandler(svc))
+		api.GET("/drivers/:id/score", handlers.DriverScoreHandler(svc))
+		api.GET("/scoring/settings", handlers.ScoringSettingsHandler(svc))
+		api.PUT("/scoring/settings", handlers.UpdateScoringSettingsHandler(svc))
+		api.GET("/vehicles", handlers.ListVehiclesHandler(svc))
+		api.PUT("/vehicles/:id/assignment", handlers.AssignVehicleHandler(svc))
+		api.GET("/vehicles/:id/meters", handlers.MetersHandler(svc))
+		api.PUT("/vehicles/:id/meters", handlers.CalibrateMetersHandler(svc))
+		api.GET("/vehicles/:id/meters/history", handlers.MeterHistoryHandler(svc))
+		api.GET("/vehicles/:id/dtcs", handlers.VehicleDTCsHandler(svc))
+		api.GET("/vehicles/:id/engine", handlers.EngineReadingsHandler(svc))
+		api.GET("/dtcs/active", handlers.ActiveDTCsHandler(svc))
+		api.GET("/dtcs/codes/:code", handlers.DecodeDTCHandler(svc))
+		api.GET("/vehicles/:id/maintenance", handlers.VehicleMaintenanceHandler(svc))
+		api.POST("/vehicles/:id/service-records", handlers.CreateServiceRecordHandler(svc))
+		api.GET("/vehicles/:id/service-records", handlers.ServiceRecordsHandler(svc))
+		api.POST("/maintenance/plans", handlers.CreatePlanHandler(svc))
+		api.GET("/maintenance/plans", handlers.ListPlansHandler(svc))
+		api.DELETE("/maintenance/plans/:id", handlers.DeletePlanHandler(svc))
+		api.GET("/maintenance/due", handlers.DueMaintenanceHandler(svc))
+		api.GET("/organization/settings", handlers.OrgSettingsHandler(svc))
+		api.PUT("/organization/settings", handlers.UpdateOrgSettingsHandler(svc))
+		api.GET("/reports/utilization", handlers.UtilizationReportHandler(svc))
+		api.GET("/reports/speeding", handlers.SpeedingReportHandler(svc))
+		api.POST("/jobs", handlers.CreateJobHandler(svc))
+		api.GET("/jobs", handlers.ListJobsHandler(svc))
+		api.GET("/jobs/:id", handlers.JobHandler(svc))
+		api.POST("/jobs/:id/assign", handlers.AssignJobHandler(svc))
+		api.POST("/jobs/:id/status", handlers.JobStatusHandler(svc))
+		api.POST("/jobs/:id/attachments", handlers.UploadJobAttachmentHandler(svc))
+		api.GET("/jobs/:id/attachments/:attachment_id", handlers.JobAttachmentHandler(svc))
+		api.POST("/planned-routes", handlers.CreatePlannedRouteHandler(svc))
+		api.GET("/planned-routes", handlers.ListPlannedRoutesHandler(svc))
+		api.GET("/planned-routes/:id", handlers.PlannedRouteHandler(svc))
+		api.DELETE("/planned-routes/:id", handlers.DeletePlannedRouteHandler(svc))
+		api.POST("/planned-routes/:id/assignments", handlers.AssignPlannedRouteHandler(svc))
+		api.GET("/route-assignments/:id", handlers.RouteAdherenceHandler(svc))
+		api.GET("/reports/route-adherence", handlers.AdherenceReportHandler(svc))
+		api.POST("/pois", handlers.CreatePOIHandler(svc))
+		api.GET("/pois", handlers.ListPOIsHandler(svc))
+		api.POST("/pois/import", handlers.ImportPOIsHandler(svc))
+		api.GET("/pois/categories", handlers.POICategoriesHandler(svc))
+		api.GET("/pois/:id", handlers.POIHandler(svc))
+		api.PUT("/pois/:id", handlers.UpdatePOIHandler(svc))
+		api.DELETE("/pois/:id", handlers.DeletePOIHandler(svc))
+		api.GET("/pois/:id/visits", handlers.POIVisitsHandler(svc))
+		api.GET("/vehicles/:id/poi-visits", handlers.VehiclePOIVisitsHandler(svc))
+		api.GET("/reports/poi-visits", handlers.POIVisitReportHandler(svc))
+		api.GET("/hos/rule-sets", handlers.ListHOSRuleSetsHandler(svc))
+		api.POST("/hos/rule-sets", handlers.CreateHOSRuleSetHandler(svc))
+		api.PUT("/hos/rule-sets/:id", handlers.UpdateHOSRuleSetHandler(svc))
+		api.PUT("/drivers/:id/hos-rule-set", handlers.SetDriverHOSRuleSetHandler(svc))
+		api.GET("/drivers/:id/hours", handlers.DriverHoursHandler(svc))
+		api.GET("/reports/hos-violations", handlers.HOSViolationsReportHandler(svc))
 	}
 
-	// Start simulator in background
-	go svc.StartSimulator(context.Background())
-
 	// Start server
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -105,15 +275,42 @@ func Run() error {
 		}
 	}()
 
+	// Start gRPC telemetry server
+	grpcSrv := newGRPCServer(svc, authSvc, deviceKeys)
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		log.Printf("gRPC server listening on %s", lis.Addr())
+		if err := grpcSrv.Serve(lis); err != nil {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+	}()
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	log.Println("Shutting down server...")
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Watch streams never end on their own, so force-stop once the deadline passes
+	stopped := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcSrv.Stop()
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		return err
 	}
@@ -122,6 +319,93 @@ func Run() error {
 	return nil
 }
 
+// loadMaps builds the road graph from an OSM extract and the reverse
+// geocoder from its places and addresses plus an optional GeoNames dump
+func loadMaps(svc *service.Service, pbf, geonames string) {
+	var roads *mapmatch.Graph
+	var places []geocode.Place
+	var addrs []geocode.AddressPoint
+	if pbf != "" {
+		start := time.Now()
+		g, err := mapmatch.Load(pbf)
+		if err != nil {
+			log.Printf("road network not loaded: %v", err)
+		} else {
+			nodes, edges, _ := g.Stats()
+			log.Printf("Road network loaded from %s in %s: %d nodes, %d segments", pbf, time.Since(start).Round(time.Millisecond), nodes, edges)
+			roads = g
+			svc.SetRoadNetwork(g)
+		}
+		if places, addrs, err = geocode.LoadOSM(pbf); err != nil {
+			log.Printf("osm places not loaded: %v", err)
+		}
+	}
+	if geonames != "" {
+		p, err := geocode.LoadGeoNames(geonames)
+		if err != nil {
+			log.Printf("geonames not loaded: %v", err)
+		}
+		places = append(places, p...)
+	}
+	if roads == nil && len(places) == 0 && len(addrs) == 0 {
+		return
+	}
+	gc := geocode.New(roads, places, addrs)
+	np, na := gc.Stats()
+	log.Printf("Reverse geocoder ready: %d places, %d addresses", np, na)
+	svc.SetGeocoder(gc)
+}
+
+// filterConfig reads the ingest noise filter settings from the environment
+func filterConfig() (service.FilterConfig, error) {
+	cfg := service.DefaultFilterConfig()
+	cfg.Enabled = mustGetenv("GPS_FILTER", "on") != "off"
+	cfg.Smoothing = mustGetenv("GPS_SMOOTHING", "off") == "on"
+	var err error
+	if cfg.MaxSpeedKmh, err = strconv.ParseFloat(mustGetenv("GPS_MAX_SPEED_KMH", "250"), 64); err != nil {
+		return cfg, fmt.Errorf("GPS_MAX_SPEED_KMH: %w", err)
+	}
+	if cfg.MaxAccuracyM, err = strconv.ParseFloat(mustGetenv("GPS_MAX_ACCURACY_M", "100"), 64); err != nil {
+		return cfg, fmt.Errorf("GPS_MAX_ACCURACY_M: %w", err)
+	}
+	if cfg.MinSatellites, err = strconv.Atoi(mustGetenv("GPS_MIN_SATELLITES", "4")); err != nil {
+		return cfg, fmt.Errorf("GPS_MIN_SATELLITES: %w", err)
+	}
+	return cfg, nil
+}
+
+// attachmentStore opens the store for proof-of-delivery files:
+// POD_STORAGE=local keeps them under POD_DIR, s3 in an S3-compatible bucket
+func attachmentStore() (storage.Store, error) {
+	switch kind := mustGetenv("POD_STORAGE", "local"); kind {
+	case "local":
+		return storage.NewLocal(mustGetenv("POD_DIR", filepath.Join(os.TempDir(), "fleet-pod")))
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    mustGetenv("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("POD_STORAGE must be local or s3, not %q", kind)
+	}
+}
+
+// speedingConfig reads the overspeed rules from the environment
+func speedingConfig() (service.SpeedingConfig, error) {
+	cfg := service.DefaultSpeedingConfig()
+	var err error
+	if cfg.TolerancePct, err = strconv.ParseFloat(mustGetenv("OVERSPEED_TOLERANCE_PCT", "10"), 64); err != nil {
+		return cfg, fmt.Errorf("OVERSPEED_TOLERANCE_PCT: %w", err)
+	}
+	if cfg.DefaultLimitKmh, err = strconv.ParseFloat(mustGetenv("OVERSPEED_DEFAULT_KMH", "120"), 64); err != nil {
+		return cfg, fmt.Errorf("OVERSPEED_DEFAULT_KMH: %w", err)
+	}
+	return cfg, nil
+}
+
 func mustGetenv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v